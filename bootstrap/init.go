@@ -8,6 +8,10 @@ import (
 	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
 	"github.com/cloudreve/Cloudreve/v3/pkg/crontab"
 	"github.com/cloudreve/Cloudreve/v3/pkg/email"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/onedrive"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/task"
 	"github.com/gin-gonic/gin"
 )
@@ -27,7 +31,13 @@ func Init(path string) {
 		aria2.Init(false)
 		email.Init()
 		crontab.Init()
+		onedrive.ResumeMonitors()
+		onedrive.ResumeThumbRetries()
+		response.DefaultMeter = filesystem.NewTrafficMeter()
 		InitStatic()
 	}
+	if conf.SystemConfig.Mode == "slave" {
+		local.StartChunkCollector()
+	}
 	auth.Init()
 }
@@ -281,6 +281,16 @@ func UpyunCallbackAuth() gin.HandlerFunc {
 // TODO 解耦
 func OneDriveCallbackAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 先验证签名再消耗回调会话，避免伪造的回调使正常上传失效
+		if sessionRaw, ok := cache.Get("callback_" + c.Param("key")); ok {
+			session := sessionRaw.(serializer.UploadSession)
+			if err := onedrive.CheckCallbackSign(c.Query("sign"), &session); err != nil {
+				c.JSON(401, serializer.GeneralUploadCallbackFailed{Error: err.Error()})
+				c.Abort()
+				return
+			}
+		}
+
 		// 验证key并查找用户
 		resp, _ := uploadCallbackCheck(c)
 		if resp.Code != 0 {
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 
@@ -13,6 +14,7 @@ import (
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/onedrive"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	"github.com/gin-gonic/gin"
@@ -640,17 +642,47 @@ func TestOneDriveCallbackAuth(t *testing.T) {
 		asserts.True(c.IsAborted())
 	}
 
+	auth.General = auth.HMACAuth{SecretKey: []byte("test")}
+	cache.Set(
+		"callback_testCallBackOneDrive",
+		serializer.UploadSession{
+			Key:         "testCallBackOneDrive",
+			UID:         1,
+			PolicyID:    512,
+			VirtualPath: "/",
+			Size:        1024,
+			SavePath:    "/a.txt",
+		},
+		0,
+	)
+
+	// 签名无效，不消耗回调会话
+	{
+		sign := onedrive.SignCallback("testCallBackOneDrive", "/b.txt", 1024, 60)
+		c, _ := gin.CreateTestContext(rec)
+		c.Params = []gin.Param{
+			{"key", "testCallBackOneDrive"},
+		}
+		c.Request, _ = http.NewRequest("POST", "/api/v3/callback/onedrive/finish/testCallBackOneDrive?sign="+url.QueryEscape(sign), nil)
+		AuthFunc(c)
+		asserts.True(c.IsAborted())
+		_, ok := cache.Get("callback_testCallBackOneDrive")
+		asserts.True(ok)
+	}
+
+	// 未携带签名
+	{
+		c, _ := gin.CreateTestContext(rec)
+		c.Params = []gin.Param{
+			{"key", "testCallBackOneDrive"},
+		}
+		c.Request, _ = http.NewRequest("POST", "/api/v3/callback/onedrive/finish/testCallBackOneDrive", nil)
+		AuthFunc(c)
+		asserts.True(c.IsAborted())
+	}
+
 	// 成功
 	{
-		cache.Set(
-			"callback_testCallBackUpyun",
-			serializer.UploadSession{
-				UID:         1,
-				PolicyID:    512,
-				VirtualPath: "/",
-			},
-			0,
-		)
 		cache.Deletes([]string{"1"}, "policy_")
 		mock.ExpectQuery("SELECT(.+)users(.+)").
 			WillReturnRows(sqlmock.NewRows([]string{"id", "group_id"}).AddRow(1, 1))
@@ -658,11 +690,12 @@ func TestOneDriveCallbackAuth(t *testing.T) {
 			WillReturnRows(sqlmock.NewRows([]string{"id", "policies"}).AddRow(1, "[657]"))
 		mock.ExpectQuery("SELECT(.+)policies(.+)").
 			WillReturnRows(sqlmock.NewRows([]string{"id", "access_key", "secret_key"}).AddRow(2, "123", "123"))
+		sign := onedrive.SignCallback("testCallBackOneDrive", "/a.txt", 1024, 60)
 		c, _ := gin.CreateTestContext(rec)
 		c.Params = []gin.Param{
-			{"key", "testCallBackUpyun"},
+			{"key", "testCallBackOneDrive"},
 		}
-		c.Request, _ = http.NewRequest("POST", "/api/v3/callback/upyun/testCallBackUpyun", ioutil.NopCloser(strings.NewReader("1")))
+		c.Request, _ = http.NewRequest("POST", "/api/v3/callback/onedrive/finish/testCallBackOneDrive?sign="+url.QueryEscape(sign), ioutil.NopCloser(strings.NewReader("1")))
 		AuthFunc(c)
 		asserts.NoError(mock.ExpectationsWereMet())
 		asserts.False(c.IsAborted())
@@ -189,6 +189,13 @@ func (file *File) UpdatePicInfo(value string) error {
 	return DB.Model(&file).Update("pic_info", value).Error
 }
 
+// ClearPicInfoBySourceNames 清空存储策略下给定源文件的所有文件记录的图像信息
+func ClearPicInfoBySourceNames(policyID uint, sourceNames []string) error {
+	return DB.Model(&File{}).
+		Where("policy_id = ? and source_name in (?)", policyID, sourceNames).
+		Update("pic_info", "").Error
+}
+
 // UpdateSize 更新文件的大小信息
 func (file *File) UpdateSize(value uint64) error {
 	return DB.Model(&file).Update("size", value).Error
@@ -358,6 +358,16 @@ func TestFile_Updates(t *testing.T) {
 	}
 }
 
+func TestClearPicInfoBySourceNames(t *testing.T) {
+	asserts := assert.New(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)pic_info(.+)").WithArgs("", sqlmock.AnyArg(), 1, "a.jpg", "b.jpg").WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectCommit()
+	err := ClearPicInfoBySourceNames(1, []string{"a.jpg", "b.jpg"})
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+}
+
 func TestFile_FileInfoInterface(t *testing.T) {
 	asserts := assert.New(t)
 	file := File{
@@ -103,10 +103,41 @@ func addDefaultSettings() {
 		{Name: "onedrive_monitor_timeout", Value: `600`, Type: "timeout"},
 		{Name: "share_download_session_timeout", Value: `2073600`, Type: "timeout"},
 		{Name: "onedrive_callback_check", Value: `20`, Type: "timeout"},
+		{Name: "onedrive_copy_check", Value: `2`, Type: "timeout"},
 		{Name: "aria2_call_timeout", Value: `5`, Type: "timeout"},
 		{Name: "onedrive_chunk_retries", Value: `1`, Type: "retry"},
+		{Name: "onedrive_throttle_retries", Value: `3`, Type: "retry"},
+		{Name: "onedrive_breaker_threshold", Value: `5`, Type: "retry"},
+		{Name: "onedrive_breaker_window", Value: `60`, Type: "timeout"},
+		{Name: "onedrive_breaker_cooldown", Value: `30`, Type: "timeout"},
+		{Name: "onedrive_max_idle_conns_per_host", Value: `16`, Type: "task"},
+		{Name: "onedrive_max_conns_per_host", Value: `32`, Type: "task"},
+		{Name: "onedrive_idle_conn_timeout", Value: `90`, Type: "timeout"},
+		{Name: "onedrive_download_retries", Value: `3`, Type: "retry"},
+		{Name: "onedrive_download_max_redirects", Value: `5`, Type: "retry"},
+		{Name: "slave_chunk_retries", Value: `3`, Type: "retry"},
 		{Name: "onedrive_source_timeout", Value: `1800`, Type: "timeout"},
+		{Name: "onedrive_etag_cache_ttl", Value: `3600`, Type: "timeout"},
+		{Name: "onedrive_notfound_cache_ttl", Value: `10`, Type: "timeout"},
+		{Name: "onedrive_readonly_cache_ttl", Value: `300`, Type: "timeout"},
+		{Name: "onedrive_list_concurrency", Value: `4`, Type: "task"},
+		{Name: "onedrive_list_cache_ttl", Value: `0`, Type: "timeout"},
+		{Name: "onedrive_list_max_depth", Value: `0`, Type: "task"},
+		{Name: "onedrive_quota_cache_ttl", Value: `60`, Type: "timeout"},
+		{Name: "onedrive_shortcut_cache_ttl", Value: `3600`, Type: "timeout"},
+		{Name: "onedrive_thumb_retries", Value: `5`, Type: "retry"},
+		{Name: "onedrive_thumb_retry_interval", Value: `60`, Type: "timeout"},
+		{Name: "dir_size_cache_ttl", Value: `60`, Type: "timeout"},
+		{Name: "webdav_max_depth", Value: `20`, Type: "webdav"},
 		{Name: "reset_after_upload_failed", Value: `0`, Type: "upload"},
+		{Name: "onedrive_verify_upload", Value: `0`, Type: "upload"},
+		{Name: "onedrive_upload_buffers", Value: `2`, Type: "upload"},
+		{Name: "onedrive_dedup_ttl", Value: `604800`, Type: "timeout"},
+		{Name: "onedrive_user_agent", Value: ``, Type: "basic"},
+		{Name: "onedrive_url_upload_max_size", Value: `0`, Type: "upload"},
+		{Name: "onedrive_url_upload_timeout", Value: `3600`, Type: "timeout"},
+		{Name: "onedrive_url_upload_allow_private", Value: `0`, Type: "upload"},
+		{Name: "slave_chunk_size", Value: `10485760`, Type: "upload"},
 		{Name: "login_captcha", Value: `0`, Type: "login"},
 		{Name: "reg_captcha", Value: `0`, Type: "login"},
 		{Name: "email_active", Value: `0`, Type: "register"},
@@ -232,6 +232,17 @@ func TestPolicy_GetUploadURL(t *testing.T) {
 		asserts.Equal("https://s3.us-east.amazonaws.com/bucket", policy.GetUploadURL())
 	}
 
+	// s3 路径形式
+	{
+		policy := Policy{
+			Type:              "s3",
+			Server:            "https://bucket.minio.cloudreve.org/",
+			BucketName:        "bucket",
+			OptionsSerialized: PolicyOption{S3ForcePathStyle: true},
+		}
+		asserts.Equal("https://bucket.minio.cloudreve.org/bucket", policy.GetUploadURL())
+	}
+
 }
 
 func TestPolicy_IsPathGenerateNeeded(t *testing.T) {
@@ -262,6 +273,19 @@ func TestPolicy_UpdateAccessKey(t *testing.T) {
 	asserts.NoError(err)
 }
 
+func TestPolicy_UpdateOptions(t *testing.T) {
+	asserts := assert.New(t)
+	policy := Policy{Model: gorm.Model{ID: 202}}
+	policy.OptionsSerialized.OdDeltaLink = "delta"
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)").WithArgs(sqlmock.AnyArg(), 202).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	err := policy.UpdateOptions()
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+	asserts.Contains(policy.Options, `"od_delta_link":"delta"`)
+}
+
 func TestPolicy_Props(t *testing.T) {
 	asserts := assert.New(t)
 	policy := Policy{Type: "onedrive"}
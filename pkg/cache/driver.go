@@ -19,7 +19,7 @@ func Init() {
 			conf.RedisConfig.Server,
 			conf.RedisConfig.Password,
 			conf.RedisConfig.DB,
-		)
+		).WithNamespace(conf.RedisConfig.Namespace)
 	}
 }
 
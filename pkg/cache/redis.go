@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/gob"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
@@ -13,6 +14,8 @@ import (
 // RedisStore redis存储驱动
 type RedisStore struct {
 	pool *redis.Pool
+	// namespace 所有键的前缀，多个站点共用同一 Redis 数据库时用于隔离
+	namespace string
 }
 
 type item struct {
@@ -43,6 +46,9 @@ func deserializer(value []byte) (interface{}, error) {
 	return res.Value, nil
 }
 
+// redisGlobEscaper 转义 SCAN MATCH 模式中的特殊字符
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
 // NewRedisStore 创建新的redis存储
 func NewRedisStore(size int, network, address, password, database string) *RedisStore {
 	return &RedisStore{
@@ -75,6 +81,12 @@ func NewRedisStore(size int, network, address, password, database string) *Redis
 	}
 }
 
+// WithNamespace 为存储的所有键加上命名空间前缀，返回存储本身
+func (store *RedisStore) WithNamespace(namespace string) *RedisStore {
+	store.namespace = namespace
+	return store
+}
+
 // Set 存储值
 func (store *RedisStore) Set(key string, value interface{}, ttl int) error {
 	rc := store.pool.Get()
@@ -90,9 +102,9 @@ func (store *RedisStore) Set(key string, value interface{}, ttl int) error {
 	}
 
 	if ttl > 0 {
-		_, err = rc.Do("SETEX", key, ttl, serialized)
+		_, err = rc.Do("SETEX", store.namespace+key, ttl, serialized)
 	} else {
-		_, err = rc.Do("SET", key, serialized)
+		_, err = rc.Do("SET", store.namespace+key, serialized)
 	}
 
 	if err != nil {
@@ -110,7 +122,7 @@ func (store *RedisStore) Get(key string) (interface{}, bool) {
 		return nil, false
 	}
 
-	v, err := redis.Bytes(rc.Do("GET", key))
+	v, err := redis.Bytes(rc.Do("GET", store.namespace+key))
 	if err != nil || v == nil {
 		return nil, false
 	}
@@ -134,7 +146,7 @@ func (store *RedisStore) Gets(keys []string, prefix string) (map[string]interfac
 
 	var queryKeys = make([]string, len(keys))
 	for key, value := range keys {
-		queryKeys[key] = prefix + value
+		queryKeys[key] = store.namespace + prefix + value
 	}
 
 	v, err := redis.ByteSlices(rc.Do("MGET", redis.Args{}.AddFlat(queryKeys)...))
@@ -172,7 +184,7 @@ func (store *RedisStore) Sets(values map[string]interface{}, prefix string) erro
 		if err != nil {
 			return err
 		}
-		setValues[prefix+key] = serialized
+		setValues[store.namespace+prefix+key] = serialized
 	}
 
 	_, err := rc.Do("MSET", redis.Args{}.AddFlat(setValues)...)
@@ -193,7 +205,7 @@ func (store *RedisStore) Delete(keys []string, prefix string) error {
 
 	// 处理前缀
 	for i := 0; i < len(keys); i++ {
-		keys[i] = prefix + keys[i]
+		keys[i] = store.namespace + prefix + keys[i]
 	}
 
 	_, err := rc.Do("DEL", redis.Args{}.AddFlat(keys)...)
@@ -203,7 +215,7 @@ func (store *RedisStore) Delete(keys []string, prefix string) error {
 	return nil
 }
 
-// DeleteAll 批量所有键
+// DeleteAll 批量所有键，指定了命名空间时只删除该命名空间下的键
 func (store *RedisStore) DeleteAll() error {
 	rc := store.pool.Get()
 	defer rc.Close()
@@ -211,7 +223,30 @@ func (store *RedisStore) DeleteAll() error {
 		return rc.Err()
 	}
 
-	_, err := rc.Do("FLUSHDB")
+	if store.namespace == "" {
+		_, err := rc.Do("FLUSHDB")
+		return err
+	}
 
-	return err
+	cursor := "0"
+	pattern := redisGlobEscaper.Replace(store.namespace) + "*"
+	for {
+		values, err := redis.Values(rc.Do("SCAN", cursor, "MATCH", pattern, "COUNT", 1000))
+		if err != nil {
+			return err
+		}
+
+		var keys []string
+		if _, err := redis.Scan(values, &cursor, &keys); err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if _, err := rc.Do("DEL", redis.Args{}.AddFlat(keys)...); err != nil {
+				return err
+			}
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
 }
@@ -322,3 +322,56 @@ func TestRedisStore_Delete(t *testing.T) {
 		asserts.Error(err)
 	}
 }
+
+func TestRedisStore_Namespace(t *testing.T) {
+	asserts := assert.New(t)
+	conn := redigomock.NewConn()
+	pool := &redis.Pool{
+		Dial:    func() (redis.Conn, error) { return conn, nil },
+		MaxIdle: 10,
+	}
+	store := (&RedisStore{pool: pool}).WithNamespace("site1:")
+
+	// 读写时键加上命名空间
+	{
+		cmd := conn.Command("SET", "site1:test", redigomock.NewAnyData()).ExpectStringSlice("OK")
+		asserts.NoError(store.Set("test", "test val", -1))
+		asserts.Equal(1, conn.Stats(cmd))
+
+		conn.Clear()
+		value, _ := serializer("test val")
+		cmd = conn.Command("GET", "site1:test").Expect(value)
+		val, ok := store.Get("test")
+		asserts.True(ok)
+		asserts.Equal("test val", val.(string))
+		asserts.Equal(1, conn.Stats(cmd))
+	}
+
+	// 批量删除
+	{
+		conn.Clear()
+		cmd := conn.Command("DEL", "site1:test_1", "site1:test_2").Expect("OK")
+		asserts.NoError(store.Delete([]string{"1", "2"}, "test_"))
+		asserts.Equal(1, conn.Stats(cmd))
+	}
+
+	// 清空时只删除命名空间下的键
+	{
+		conn.Clear()
+		scan := conn.Command("SCAN", "0", "MATCH", "site1:*", "COUNT", 1000).
+			Expect([]interface{}{[]byte("0"), []interface{}{[]byte("site1:a"), []byte("site1:b")}})
+		del := conn.Command("DEL", "site1:a", "site1:b").Expect("OK")
+		flush := conn.Command("FLUSHDB").Expect("OK")
+		asserts.NoError(store.DeleteAll())
+		asserts.Equal(1, conn.Stats(scan))
+		asserts.Equal(1, conn.Stats(del))
+		asserts.Equal(0, conn.Stats(flush))
+	}
+
+	// 清空失败
+	{
+		conn.Clear()
+		conn.Command("SCAN", "0", "MATCH", "site1:*", "COUNT", 1000).ExpectError(errors.New("error"))
+		asserts.Error(store.DeleteAll())
+	}
+}
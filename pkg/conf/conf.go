@@ -42,6 +42,8 @@ type slave struct {
 	Secret          string `validate:"omitempty,gte=64"`
 	CallbackTimeout int    `validate:"omitempty,gte=1"`
 	SignatureTTL    int    `validate:"omitempty,gte=1"`
+	ChunkTempDir    string `validate:"omitempty,min=1"`
+	ChunkTTL        int    `validate:"omitempty,gte=1"`
 }
 
 // captcha 验证码配置
@@ -65,6 +67,9 @@ type redis struct {
 	Server   string
 	Password string
 	DB       string
+	// Namespace 缓存键的命名空间，多个站点共用同一 Redis 数据库时用于隔离，
+	// 同一站点的各节点应使用相同的值以共享缓存
+	Namespace string
 }
 
 // 缩略图 配置
@@ -72,6 +77,7 @@ type thumb struct {
 	MaxWidth   uint
 	MaxHeight  uint
 	FileSuffix string `validate:"min=1"`
+	CacheDir   string `validate:"min=1"`
 }
 
 // 跨域配置
@@ -53,12 +53,15 @@ var ThumbConfig = &thumb{
 	MaxWidth:   400,
 	MaxHeight:  300,
 	FileSuffix: "._thumb",
+	CacheDir:   "temp/thumb",
 }
 
 // SlaveConfig 从机配置
 var SlaveConfig = &slave{
 	CallbackTimeout: 20,
 	SignatureTTL:    60,
+	ChunkTempDir:    "temp/chunk",
+	ChunkTTL:        86400,
 }
 
 var SSLConfig = &ssl{
@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -29,6 +30,8 @@ import (
 
 // Compress 创建给定目录和文件的压缩文件
 func (fs *FileSystem) Compress(ctx context.Context, folderIDs, fileIDs []uint, isArchive bool) (string, error) {
+	ctx = fs.withUser(ctx)
+
 	// 查找待压缩目录
 	folders, err := model.GetFoldersByIDs(folderIDs, fs.User.ID)
 	if err != nil && len(folderIDs) != 0 {
@@ -194,6 +197,200 @@ func (fs *FileSystem) doCompress(ctx context.Context, file *model.File, folder *
 	}
 }
 
+// ArchiveFile 打包下载中的一个对象
+type ArchiveFile struct {
+	// Source 文件在存储端的物理路径，目录留空
+	Source string
+	// Name 对象在压缩包内的相对路径，以 / 分隔
+	Name string
+	// Size 文件大小
+	Size uint64
+	// Modified 修改时间
+	Modified time.Time
+	// IsDir 是否为目录
+	IsDir bool
+}
+
+// archiveStoredExtension 已压缩过的媒体、归档文件扩展名，打包时不再压缩
+var archiveStoredExtension = []string{
+	"jpg", "jpeg", "png", "gif", "webp", "heic",
+	"mp3", "aac", "flac", "ogg", "m4a",
+	"mp4", "mkv", "mov", "avi", "webm", "flv",
+	"zip", "rar", "7z", "gz", "bz2", "xz",
+}
+
+// archiveErrorsFileName 宽松模式下记录打包失败文件的说明文件名
+const archiveErrorsFileName = "ERRORS.txt"
+
+// ArchiveFailure 打包时处理失败的文件
+type ArchiveFailure struct {
+	// Name 文件在压缩包内的路径
+	Name string
+	// Err 失败原因
+	Err error
+}
+
+// ArchiveError 宽松模式下打包完成但部分文件失败时返回的汇总错误
+type ArchiveError struct {
+	Failures []ArchiveFailure
+}
+
+func (err *ArchiveError) Error() string {
+	return fmt.Sprintf("%d 个文件未能完整打包", len(err.Failures))
+}
+
+// StreamArchive 通过 handler 逐个获取文件，以流的方式打包为 zip 并写入 w，
+// 不会在内存或磁盘中缓存完整的压缩包。重名对象会被自动重命名。
+// strict 为 true 时，任一文件获取失败立即中止，不写入压缩包目录区，客户端会得到
+// 不完整的压缩包；否则跳过失败的文件，在压缩包末尾写入 ERRORS.txt 说明失败原因，
+// 并返回 *ArchiveError 供调用方记录
+func StreamArchive(ctx context.Context, handler Handler, w io.Writer, files []ArchiveFile, strict bool) error {
+	zipWriter := zip.NewWriter(w)
+	names := make(map[string]bool, len(files))
+	var failures []ArchiveFailure
+
+	for _, file := range files {
+		select {
+		case <-ctx.Done():
+			return ErrClientCanceled
+		default:
+		}
+
+		name := path.Clean(strings.TrimPrefix(util.FormSlash(file.Name), "/"))
+
+		// 目录只写入一次，重名目录的内容合并在一起
+		if file.IsDir {
+			if names[name+"/"] {
+				continue
+			}
+			names[name+"/"] = true
+			if _, err := zipWriter.CreateHeader(&zip.FileHeader{
+				Name:     name + "/",
+				Modified: file.Modified,
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name = uniqueArchiveName(names, name)
+		header := &zip.FileHeader{
+			Name:     name,
+			Modified: file.Modified,
+		}
+
+		header.UncompressedSize64 = file.Size
+		header.Method = zip.Deflate
+		if IsInExtensionList(archiveStoredExtension, name) {
+			header.Method = zip.Store
+		}
+
+		if err := writeArchiveFile(ctx, handler, zipWriter, header, file.Source); err != nil {
+			var sourceErr *archiveSourceError
+			if strict || !errors.As(err, &sourceErr) {
+				return err
+			}
+			util.Log().Debug("打包时跳过文件 %s，%s", name, sourceErr.err)
+			failures = append(failures, ArchiveFailure{Name: name, Err: sourceErr.err})
+		}
+	}
+
+	if len(failures) == 0 {
+		return zipWriter.Close()
+	}
+
+	if err := writeArchiveErrors(zipWriter, uniqueArchiveName(names, archiveErrorsFileName), failures); err != nil {
+		return err
+	}
+	if err := zipWriter.Close(); err != nil {
+		return err
+	}
+	return &ArchiveError{Failures: failures}
+}
+
+// archiveSourceError 读取存储端文件时的错误，与写入压缩包时的错误区分，
+// 前者在宽松模式下可以跳过
+type archiveSourceError struct {
+	name string
+	err  error
+}
+
+func (err *archiveSourceError) Error() string {
+	return fmt.Sprintf("无法获取文件 %s，%s", err.name, err.err)
+}
+
+func (err *archiveSourceError) Unwrap() error {
+	return err.err
+}
+
+// writeArchiveErrors 将打包失败的文件及原因写入压缩包内的说明文件
+func writeArchiveErrors(zipWriter *zip.Writer, name string, failures []ArchiveFailure) error {
+	writer, err := zipWriter.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Modified: time.Now(),
+		Method:   zip.Deflate,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, failure := range failures {
+		if _, err := fmt.Fprintf(writer, "%s: %s\r\n", failure.Name, failure.Err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeArchiveFile 获取单个文件并写入压缩包
+func writeArchiveFile(ctx context.Context, handler Handler, zipWriter *zip.Writer, header *zip.FileHeader, source string) error {
+	content, err := handler.Get(ctx, source)
+	if err != nil {
+		return &archiveSourceError{name: header.Name, err: err}
+	}
+	defer content.Close()
+
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	// 区分读取存储端与写入客户端时的错误，后者无法继续打包
+	if _, err := io.Copy(writer, archiveSourceReader{name: header.Name, reader: content}); err != nil {
+		var sourceErr *archiveSourceError
+		if errors.As(err, &sourceErr) {
+			return err
+		}
+		return fmt.Errorf("无法写入文件 %s，%w", header.Name, err)
+	}
+	return nil
+}
+
+// archiveSourceReader 将读取存储端文件时的错误包装为 archiveSourceError
+type archiveSourceReader struct {
+	name   string
+	reader io.Reader
+}
+
+func (r archiveSourceReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = &archiveSourceError{name: r.name, err: err}
+	}
+	return n, err
+}
+
+// uniqueArchiveName 为压缩包内重名的对象追加序号，如 a (1).txt
+func uniqueArchiveName(names map[string]bool, name string) string {
+	res := name
+	ext := path.Ext(name)
+	for i := 1; names[res]; i++ {
+		res = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	names[res] = true
+	return res
+}
+
 // Decompress 解压缩给定压缩文件到dst目录
 func (fs *FileSystem) Decompress(ctx context.Context, src, dst string) error {
 	err := fs.ResetFileIfNotExist(ctx, src)
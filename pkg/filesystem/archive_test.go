@@ -1,9 +1,12 @@
 package filesystem
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	"errors"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
@@ -254,3 +257,172 @@ func TestFileSystem_Decompress(t *testing.T) {
 		testHandler.AssertExpectations(t)
 	}
 }
+
+// archiveContent 打包测试中使用的文件流
+type archiveContent struct {
+	*strings.Reader
+}
+
+func (archiveContent) Close() error {
+	return nil
+}
+
+// failedContent 读取时出错的文件流
+type failedContent struct {
+	archiveContent
+}
+
+func (failedContent) Read(p []byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+// failedWriter 写入时出错的客户端
+type failedWriter struct{}
+
+func (failedWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write error")
+}
+
+func TestStreamArchive(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 成功
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "src/1").Return(archiveContent{strings.NewReader("content1")}, nil)
+		testHandler.On("Get", testMock.Anything, "src/2").Return(archiveContent{strings.NewReader("content2")}, nil)
+		testHandler.On("Get", testMock.Anything, "src/3").Return(archiveContent{strings.NewReader("image")}, nil)
+		buf := &bytes.Buffer{}
+		err := StreamArchive(context.Background(), testHandler, buf, []ArchiveFile{
+			{Name: "dir", IsDir: true},
+			{Name: "dir/a.txt", Source: "src/1", Size: 8},
+			{Name: "/dir/a.txt", Source: "src/2", Size: 8},
+			{Name: "dir/", IsDir: true},
+			{Name: "b.jpg", Source: "src/3", Size: 5},
+			{Name: "empty", IsDir: true},
+		}, true)
+		testHandler.AssertExpectations(t)
+		asserts.NoError(err)
+
+		r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		asserts.NoError(err)
+		names := make([]string, 0, len(r.File))
+		contents := make(map[string]string)
+		for _, f := range r.File {
+			names = append(names, f.Name)
+			reader, err := f.Open()
+			asserts.NoError(err)
+			content, _ := ioutil.ReadAll(reader)
+			reader.Close()
+			contents[f.Name] = string(content)
+		}
+		asserts.Equal([]string{"dir/", "dir/a.txt", "dir/a (1).txt", "b.jpg", "empty/"}, names)
+		asserts.Equal("content1", contents["dir/a.txt"])
+		asserts.Equal("content2", contents["dir/a (1).txt"])
+		asserts.Equal("image", contents["b.jpg"])
+		asserts.Equal(zip.Deflate, r.File[1].Method)
+		asserts.Equal(zip.Store, r.File[3].Method)
+	}
+
+	// 严格模式，中途获取文件失败
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "src/1").Return(archiveContent{strings.NewReader("content1")}, nil)
+		testHandler.On("Get", testMock.Anything, "src/2").Return(archiveContent{}, errors.New("error"))
+		buf := &bytes.Buffer{}
+		err := StreamArchive(context.Background(), testHandler, buf, []ArchiveFile{
+			{Name: "a.txt", Source: "src/1"},
+			{Name: "b.txt", Source: "src/2"},
+			{Name: "c.txt", Source: "src/3"},
+		}, true)
+		testHandler.AssertExpectations(t)
+		asserts.Error(err)
+		_, err = zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		asserts.Error(err)
+	}
+
+	// 宽松模式，跳过获取失败的文件并写入说明
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "src/1").Return(archiveContent{strings.NewReader("content1")}, nil)
+		testHandler.On("Get", testMock.Anything, "src/2").Return(archiveContent{}, errors.New("not found"))
+		testHandler.On("Get", testMock.Anything, "src/3").Return(archiveContent{strings.NewReader("content3")}, nil)
+		testHandler.On("Get", testMock.Anything, "src/4").Return(failedContent{}, nil)
+		buf := &bytes.Buffer{}
+		err := StreamArchive(context.Background(), testHandler, buf, []ArchiveFile{
+			{Name: "a.txt", Source: "src/1"},
+			{Name: "b.txt", Source: "src/2"},
+			{Name: "ERRORS.txt", Source: "src/3"},
+			{Name: "d.txt", Source: "src/4"},
+		}, false)
+		testHandler.AssertExpectations(t)
+		archiveErr, ok := err.(*ArchiveError)
+		asserts.True(ok)
+		asserts.Len(archiveErr.Failures, 2)
+		asserts.Equal("b.txt", archiveErr.Failures[0].Name)
+		asserts.Equal("d.txt", archiveErr.Failures[1].Name)
+
+		r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		asserts.NoError(err)
+		names := make([]string, 0, len(r.File))
+		contents := make(map[string]string)
+		for _, f := range r.File {
+			names = append(names, f.Name)
+			reader, err := f.Open()
+			asserts.NoError(err)
+			content, _ := ioutil.ReadAll(reader)
+			reader.Close()
+			contents[f.Name] = string(content)
+		}
+		asserts.Equal([]string{"a.txt", "ERRORS.txt", "d.txt", "ERRORS (1).txt"}, names)
+		asserts.Equal("content1", contents["a.txt"])
+		asserts.Equal("content3", contents["ERRORS.txt"])
+		asserts.Equal("b.txt: not found\r\nd.txt: read error\r\n", contents["ERRORS (1).txt"])
+	}
+
+	// 宽松模式下全部成功时不写入说明
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "src/1").Return(archiveContent{strings.NewReader("content1")}, nil)
+		buf := &bytes.Buffer{}
+		err := StreamArchive(context.Background(), testHandler, buf, []ArchiveFile{
+			{Name: "a.txt", Source: "src/1"},
+		}, false)
+		asserts.NoError(err)
+		r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		asserts.NoError(err)
+		asserts.Len(r.File, 1)
+	}
+
+	// 宽松模式下写入客户端失败时中止
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "src/1").Return(archiveContent{strings.NewReader("content1")}, nil)
+		err := StreamArchive(context.Background(), testHandler, failedWriter{}, []ArchiveFile{
+			{Name: "a.txt", Source: "src/1"},
+		}, false)
+		asserts.Error(err)
+		_, ok := err.(*ArchiveError)
+		asserts.False(ok)
+	}
+
+	// 上下文取消
+	{
+		testHandler := new(FileHeaderMock)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := StreamArchive(ctx, testHandler, &bytes.Buffer{}, []ArchiveFile{{Name: "a.txt", Source: "src/1"}}, true)
+		asserts.Equal(ErrClientCanceled, err)
+		testHandler.AssertNotCalled(t, "Get", testMock.Anything, testMock.Anything)
+	}
+}
+
+func TestUniqueArchiveName(t *testing.T) {
+	asserts := assert.New(t)
+	names := make(map[string]bool)
+	asserts.Equal("a.txt", uniqueArchiveName(names, "a.txt"))
+	asserts.Equal("a (1).txt", uniqueArchiveName(names, "a.txt"))
+	asserts.Equal("a (2).txt", uniqueArchiveName(names, "a.txt"))
+	asserts.Equal("dir/b", uniqueArchiveName(names, "dir/b"))
+	asserts.Equal("dir/b (1)", uniqueArchiveName(names, "dir/b"))
+}
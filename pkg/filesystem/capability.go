@@ -0,0 +1,18 @@
+package filesystem
+
+import (
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+)
+
+// PolicyCapabilities 获取当前存储策略适配器支持的功能。适配器未报告时返回零值，
+// 调用方应照旧尝试后处理失败，或自行模拟
+func (fs *FileSystem) PolicyCapabilities() response.Capabilities {
+	if err := fs.DispatchHandler(); fs.Policy == nil || err != nil {
+		return response.Capabilities{}
+	}
+
+	if reporter, ok := fs.Handler.(CapabilityReporter); ok {
+		return reporter.Capabilities()
+	}
+	return response.Capabilities{}
+}
@@ -0,0 +1,57 @@
+package filesystem
+
+import (
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+	"github.com/stretchr/testify/assert"
+)
+
+type CapabilityReporterMock struct {
+	FileHeaderMock
+}
+
+func (m CapabilityReporterMock) Capabilities() response.Capabilities {
+	return response.Capabilities{NativeMove: true, Upload: response.UploadDirect}
+}
+
+func TestFileSystem_PolicyCapabilities(t *testing.T) {
+	asserts := assert.New(t)
+	newFS := func(handler Handler) *FileSystem {
+		return &FileSystem{
+			Handler: handler,
+			Policy:  &model.Policy{Type: "mock"},
+		}
+	}
+
+	// 未知存储策略
+	{
+		fs := newFS(new(CapabilityReporterMock))
+		fs.Policy.Type = "unknown"
+		asserts.Equal(response.Capabilities{}, fs.PolicyCapabilities())
+	}
+
+	// 适配器未报告
+	{
+		res := newFS(new(FileHeaderMock)).PolicyCapabilities()
+		asserts.Equal(response.Capabilities{}, res)
+		asserts.Equal(response.UploadRelay, res.Upload)
+	}
+
+	// 由适配器报告
+	{
+		res := newFS(new(CapabilityReporterMock)).PolicyCapabilities()
+		asserts.True(res.NativeMove)
+		asserts.False(res.NativeCopy)
+		asserts.Equal(response.UploadDirect, res.Upload)
+	}
+
+	// OneDrive
+	{
+		fs := &FileSystem{Policy: &model.Policy{Type: "onedrive"}}
+		res := fs.PolicyCapabilities()
+		asserts.True(res.NativeMove)
+		asserts.Equal(response.UploadDirectChunked, res.Upload)
+	}
+}
@@ -120,7 +120,7 @@ func (handler Driver) List(ctx context.Context, base string, recursive bool) ([]
 		})
 	}
 
-	return res, nil
+	return fsctx.ListFilter(ctx).Filter(res), nil
 
 }
 
@@ -219,6 +219,24 @@ func (handler Driver) Delete(ctx context.Context, files []string) ([]string, err
 	return failed, errors.New("删除失败")
 }
 
+// Head 获取文件元信息
+func (handler Driver) Head(ctx context.Context, path string) (response.Object, error) {
+	resp, err := handler.Client.Object.Head(ctx, path, nil)
+	if err != nil {
+		return response.Object{}, err
+	}
+
+	lastModify, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return response.Object{
+		Name:         filepath.Base(path),
+		RelativePath: filepath.Base(path),
+		Source:       path,
+		Size:         uint64(resp.ContentLength),
+		LastModify:   lastModify,
+		ETag:         strings.Trim(resp.Header.Get("ETag"), `"`),
+	}, nil
+}
+
 // Thumb 获取文件缩略图
 func (handler Driver) Thumb(ctx context.Context, path string) (*response.ContentResponse, error) {
 	var (
@@ -426,3 +444,8 @@ func (handler Driver) getUploadCredential(ctx context.Context, policy UploadPoli
 		KeyTime:   keyTime,
 	}, nil
 }
+
+// Close 释放资源，此存储策略无需清理
+func (handler Driver) Close() error {
+	return nil
+}
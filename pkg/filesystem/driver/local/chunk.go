@@ -0,0 +1,178 @@
+package local
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+var (
+	// ErrInvalidChunkSession 分片上传会话ID无效
+	ErrInvalidChunkSession = errors.New("无效的分片上传会话")
+	// ErrChunkOffsetMismatch 分片起始偏移与已接收的数据不连续
+	ErrChunkOffsetMismatch = errors.New("分片起始偏移超出已接收的数据")
+)
+
+// chunkSessionPattern 分片上传会话ID格式，避免被用于访问任意路径
+var chunkSessionPattern = regexp.MustCompile(`^[0-9a-zA-Z]{1,64}$`)
+
+// chunkCompletedSuffix 文件保存成功后写入的完成标记的后缀，会话ID中不含“.”，不会与临时文件冲突
+const chunkCompletedSuffix = ".done"
+
+// chunkCollectInterval 清理被放弃的分片上传临时文件的间隔
+const chunkCollectInterval = time.Hour
+
+// chunkLocks 正在保存文件的分片上传会话，键为会话ID，值为 *sync.Mutex
+var chunkLocks sync.Map
+
+// GetChunkFilePath 获取分片上传会话对应的临时文件路径
+func GetChunkFilePath(sessionID string) (string, error) {
+	if !chunkSessionPattern.MatchString(sessionID) {
+		return "", ErrInvalidChunkSession
+	}
+	return util.RelativePath(filepath.Join(conf.SlaveConfig.ChunkTempDir, sessionID)), nil
+}
+
+// LockChunkSession 锁定分片上传会话，用于串行处理同一会话最后一个分片的写入及文件保存，
+// 返回解锁函数
+func LockChunkSession(sessionID string) func() {
+	lock, _ := chunkLocks.LoadOrStore(sessionID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return func() {
+		chunkLocks.Delete(sessionID)
+		lock.(*sync.Mutex).Unlock()
+	}
+}
+
+// IsChunkCompleted 分片上传会话对应的文件是否已保存成功
+func IsChunkCompleted(sessionID string) (bool, error) {
+	chunkPath, err := GetChunkFilePath(sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(chunkPath + chunkCompletedSuffix)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MarkChunkCompleted 记录分片上传会话对应的文件已保存成功，并删除临时文件。
+// 主机未收到保存结果时，可据此确认上传已完成
+func MarkChunkCompleted(sessionID string) error {
+	chunkPath, err := GetChunkFilePath(sessionID)
+	if err != nil {
+		return err
+	}
+
+	marker, err := os.Create(chunkPath + chunkCompletedSuffix)
+	if err != nil {
+		return err
+	}
+	if err := marker.Close(); err != nil {
+		return err
+	}
+
+	return DeleteChunkFile(sessionID)
+}
+
+// GetChunkOffset 获取分片上传会话已确认接收的字节数，会话不存在时返回 0
+func GetChunkOffset(sessionID string) (uint64, error) {
+	chunkPath, err := GetChunkFilePath(sessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(chunkPath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(info.Size()), nil
+}
+
+// WriteChunk 从 offset 处写入分片数据，offset 之后已有的数据将被丢弃，
+// 因此重复发送同一分片是安全的。返回写入后已确认接收的字节数
+func WriteChunk(sessionID string, offset uint64, chunk io.Reader) (uint64, error) {
+	chunkPath, err := GetChunkFilePath(sessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	current, err := GetChunkOffset(sessionID)
+	if err != nil {
+		return 0, err
+	}
+	if offset > current {
+		return current, ErrChunkOffsetMismatch
+	}
+
+	if err := os.MkdirAll(filepath.Dir(chunkPath), 0744); err != nil {
+		return current, err
+	}
+
+	out, err := os.OpenFile(chunkPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return current, err
+	}
+	defer out.Close()
+
+	if err := out.Truncate(int64(offset)); err != nil {
+		return current, err
+	}
+	if _, err := out.Seek(int64(offset), io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	// 中途断开时已写入的部分仍被保留，可从新的偏移处续传
+	written, err := io.Copy(out, chunk)
+	return offset + uint64(written), err
+}
+
+// DeleteChunkFile 删除分片上传会话的临时文件
+func DeleteChunkFile(sessionID string) error {
+	chunkPath, err := GetChunkFilePath(sessionID)
+	if err != nil {
+		return err
+	}
+	return os.Remove(chunkPath)
+}
+
+// CollectChunkFiles 删除超过 ttl 未更新的分片上传临时文件及完成标记
+func CollectChunkFiles(ttl time.Duration) {
+	root := util.RelativePath(conf.SlaveConfig.ChunkTempDir)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && time.Now().Sub(info.ModTime()) > ttl {
+			util.Log().Debug("删除过期分片上传临时文件 [%s]", path)
+			if err := os.Remove(path); err != nil {
+				util.Log().Debug("临时文件 [%s] 删除失败 , %s", path, err)
+			}
+		}
+		return nil
+	})
+
+	if err != nil && !os.IsNotExist(err) {
+		util.Log().Debug("无法列取分片上传临时目录，%s", err)
+	}
+}
+
+// StartChunkCollector 在新协程中定期清理被放弃的分片上传临时文件
+func StartChunkCollector() {
+	ttl := time.Duration(conf.SlaveConfig.ChunkTTL) * time.Second
+	go func() {
+		for range time.Tick(chunkCollectInterval) {
+			CollectChunkFiles(ttl)
+		}
+	}()
+}
@@ -0,0 +1,117 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteChunk(t *testing.T) {
+	asserts := assert.New(t)
+	sessionID := "TestWriteChunk"
+	defer DeleteChunkFile(sessionID)
+
+	// 会话不存在
+	{
+		offset, err := GetChunkOffset(sessionID)
+		asserts.NoError(err)
+		asserts.EqualValues(0, offset)
+	}
+
+	// 顺序写入分片
+	{
+		received, err := WriteChunk(sessionID, 0, strings.NewReader("01234"))
+		asserts.NoError(err)
+		asserts.EqualValues(5, received)
+		received, err = WriteChunk(sessionID, 5, strings.NewReader("56789"))
+		asserts.NoError(err)
+		asserts.EqualValues(10, received)
+	}
+
+	// 重传分片时丢弃其后的数据
+	{
+		received, err := WriteChunk(sessionID, 5, strings.NewReader("abc"))
+		asserts.NoError(err)
+		asserts.EqualValues(8, received)
+		offset, err := GetChunkOffset(sessionID)
+		asserts.NoError(err)
+		asserts.EqualValues(8, offset)
+
+		chunkPath, _ := GetChunkFilePath(sessionID)
+		content, err := ioutil.ReadFile(chunkPath)
+		asserts.NoError(err)
+		asserts.Equal("01234abc", string(content))
+	}
+
+	// 偏移不连续
+	{
+		_, err := WriteChunk(sessionID, 20, strings.NewReader("abc"))
+		asserts.Equal(ErrChunkOffsetMismatch, err)
+	}
+
+	// 会话ID无效
+	{
+		_, err := WriteChunk("../../a", 0, strings.NewReader("abc"))
+		asserts.Equal(ErrInvalidChunkSession, err)
+		_, err = GetChunkOffset("")
+		asserts.Equal(ErrInvalidChunkSession, err)
+	}
+}
+
+func TestMarkChunkCompleted(t *testing.T) {
+	asserts := assert.New(t)
+	sessionID := "TestMarkChunkCompleted"
+	chunkPath, _ := GetChunkFilePath(sessionID)
+	defer os.Remove(chunkPath + chunkCompletedSuffix)
+
+	// 尚未完成
+	{
+		_, err := WriteChunk(sessionID, 0, strings.NewReader("01234"))
+		asserts.NoError(err)
+		completed, err := IsChunkCompleted(sessionID)
+		asserts.NoError(err)
+		asserts.False(completed)
+	}
+
+	// 记录完成状态并删除临时文件
+	{
+		asserts.NoError(MarkChunkCompleted(sessionID))
+		completed, err := IsChunkCompleted(sessionID)
+		asserts.NoError(err)
+		asserts.True(completed)
+		offset, err := GetChunkOffset(sessionID)
+		asserts.NoError(err)
+		asserts.EqualValues(0, offset)
+	}
+
+	// 会话ID无效
+	{
+		_, err := IsChunkCompleted("../../a")
+		asserts.Equal(ErrInvalidChunkSession, err)
+		asserts.Equal(ErrInvalidChunkSession, MarkChunkCompleted("../../a"))
+	}
+}
+
+func TestCollectChunkFiles(t *testing.T) {
+	asserts := assert.New(t)
+	expired, active := "TestCollectChunkFilesExpired", "TestCollectChunkFilesActive"
+	defer DeleteChunkFile(active)
+	_, err := WriteChunk(expired, 0, strings.NewReader("01234"))
+	asserts.NoError(err)
+	_, err = WriteChunk(active, 0, strings.NewReader("01234"))
+	asserts.NoError(err)
+	expiredPath, _ := GetChunkFilePath(expired)
+	asserts.NoError(os.Chtimes(expiredPath, time.Now().Add(-2*time.Hour), time.Now().Add(-2*time.Hour)))
+
+	// 仅删除超过有效期未更新的文件
+	CollectChunkFiles(time.Hour)
+	asserts.False(util.Exists(expiredPath))
+	offset, err := GetChunkOffset(active)
+	asserts.NoError(err)
+	asserts.EqualValues(5, offset)
+}
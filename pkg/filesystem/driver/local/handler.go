@@ -2,6 +2,7 @@ package local
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -67,7 +68,7 @@ func (handler Driver) List(ctx context.Context, path string, recursive bool) ([]
 			return nil
 		})
 
-	return res, err
+	return fsctx.ListFilter(ctx).Filter(res), err
 }
 
 // Get 获取文件内容
@@ -139,13 +140,46 @@ func (handler Driver) Delete(ctx context.Context, files []string) ([]string, err
 
 		// 尝试删除文件的缩略图（如果有）
 		_ = os.Remove(util.RelativePath(value + conf.ThumbConfig.FileSuffix))
+		_ = os.RemoveAll(getThumbCacheDir(value))
 	}
 
 	return deleteFailed, retErr
 }
 
-// Thumb 获取文件缩略图
+// Head 获取文件元信息
+func (handler Driver) Head(ctx context.Context, path string) (response.Object, error) {
+	info, err := os.Stat(util.RelativePath(filepath.FromSlash(path)))
+	if err != nil {
+		return response.Object{}, err
+	}
+
+	return response.Object{
+		Name:         info.Name(),
+		RelativePath: info.Name(),
+		Source:       path,
+		Size:         uint64(info.Size()),
+		IsDir:        info.IsDir(),
+		LastModify:   info.ModTime(),
+	}, nil
+}
+
+// Thumb 获取文件缩略图，上下文中指定尺寸时按需生成并缓存，
+// 无法生成时使用上传时预先生成的缩略图
 func (handler Driver) Thumb(ctx context.Context, path string) (*response.ContentResponse, error) {
+	if size, ok := ctx.Value(fsctx.ThumbSizeCtx).([2]uint); ok {
+		cachePath, err := generateThumb(path, size[0], size[1])
+		if err == nil {
+			if file, err := os.Open(cachePath); err == nil {
+				return &response.ContentResponse{
+					Redirect: false,
+					Content:  file,
+				}, nil
+			}
+		} else {
+			util.Log().Debug("无法生成缩略图 [%s]：%s", path, err)
+		}
+	}
+
 	file, err := handler.Get(ctx, path+conf.ThumbConfig.FileSuffix)
 	if err != nil {
 		return nil, err
@@ -184,8 +218,8 @@ func (handler Driver) Source(
 		signedURI *url.URL
 		err       error
 	)
-	if isDownload {
-		// 创建下载会话，将文件信息写入缓存
+	if user, ok := ctx.Value(fsctx.UserCtx).(model.User); isDownload && ok && user.Group.OptionsSerialized.OneTimeDownload {
+		// 一次性下载需要经由下载会话，下载后使会话失效
 		downloadSessionID := util.RandStringRunes(16)
 		err = cache.Set("download_"+downloadSessionID, file, int(ttl))
 		if err != nil {
@@ -199,10 +233,16 @@ func (handler Driver) Source(
 			ttl,
 		)
 	} else {
-		// 签名生成文件记录
+		controller := "/api/v3/file/local/download"
+		if !isDownload {
+			controller = "/api/v3/file/local/source"
+		}
+
+		// 签名包含物理路径及有效期的直链，无需查询数据库或缓存即可验证
+		sourcePath := base64.RawURLEncoding.EncodeToString([]byte(file.SourceName))
 		signedURI, err = auth.SignURI(
 			auth.General,
-			fmt.Sprintf("/api/v3/file/get/%d/%s", file.ID, file.Name),
+			fmt.Sprintf("%s/%d/%s/%s", controller, speed, sourcePath, url.PathEscape(file.Name)),
 			ttl,
 		)
 	}
@@ -219,3 +259,8 @@ func (handler Driver) Source(
 func (handler Driver) Token(ctx context.Context, ttl int64, key string) (serializer.UploadCredential, error) {
 	return serializer.UploadCredential{}, nil
 }
+
+// Close 释放资源，此存储策略无需清理
+func (handler Driver) Close() error {
+	return nil
+}
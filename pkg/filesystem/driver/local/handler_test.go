@@ -2,12 +2,20 @@ package local
 
 import (
 	"context"
+	"image"
+	"image/png"
 	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
@@ -97,6 +105,79 @@ func TestHandler_Get(t *testing.T) {
 	asserts.Nil(rs)
 }
 
+func TestHandler_Get_Ranges(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{}
+	asserts.NoError(ioutil.WriteFile(util.RelativePath("TestHandler_Get_Ranges.txt"), []byte("0123456789abcdefghij"), 0644))
+	defer os.Remove(util.RelativePath("TestHandler_Get_Ranges.txt"))
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	serve := func(header http.Header) *httptest.ResponseRecorder {
+		rs, err := handler.Get(context.Background(), "TestHandler_Get_Ranges.txt")
+		asserts.NoError(err)
+		defer rs.Close()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header = header
+		rec := httptest.NewRecorder()
+		http.ServeContent(rec, req, "a.txt", modTime, rs)
+		return rec
+	}
+
+	// 多个范围，返回 multipart/byteranges
+	{
+		rec := serve(http.Header{"Range": {"bytes=10-12,0-1"}})
+		asserts.Equal(http.StatusPartialContent, rec.Code)
+		mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+		asserts.NoError(err)
+		asserts.Equal("multipart/byteranges", mediaType)
+
+		reader := multipart.NewReader(rec.Body, params["boundary"])
+		var parts []string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			asserts.NoError(err)
+			body, _ := ioutil.ReadAll(part)
+			parts = append(parts, part.Header.Get("Content-Range")+":"+string(body))
+		}
+		asserts.Equal([]string{"bytes 10-12/20:abc", "bytes 0-1/20:01"}, parts)
+	}
+
+	// If-Range 不匹配，返回完整内容
+	{
+		rec := serve(http.Header{
+			"Range":    {"bytes=0-1,10-12"},
+			"If-Range": {modTime.Add(time.Hour).Format(http.TimeFormat)},
+		})
+		asserts.Equal(http.StatusOK, rec.Code)
+		asserts.Equal("0123456789abcdefghij", rec.Body.String())
+	}
+}
+
+func TestHandler_Head(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{}
+	asserts.NoError(ioutil.WriteFile(util.RelativePath("TestHandler_Head.txt"), []byte("123"), 0644))
+	defer os.Remove(util.RelativePath("TestHandler_Head.txt"))
+
+	// 成功
+	{
+		res, err := handler.Head(context.Background(), "TestHandler_Head.txt")
+		asserts.NoError(err)
+		asserts.Equal("TestHandler_Head.txt", res.Name)
+		asserts.EqualValues(3, res.Size)
+		asserts.False(res.IsDir)
+		asserts.False(res.LastModify.IsZero())
+	}
+
+	// 不存在
+	{
+		_, err := handler.Head(context.Background(), "TestHandler_Head_notExist.txt")
+		asserts.Error(err)
+	}
+}
+
 func TestHandler_Thumb(t *testing.T) {
 	asserts := assert.New(t)
 	handler := Driver{}
@@ -117,6 +198,59 @@ func TestHandler_Thumb(t *testing.T) {
 		_, err := handler.Thumb(ctx, "not_exist")
 		asserts.Error(err)
 	}
+
+	// 无法生成时使用预生成的缩略图
+	{
+		ctx := context.WithValue(ctx, fsctx.ThumbSizeCtx, [2]uint{10, 10})
+		thumb, err := handler.Thumb(ctx, "TestHandler_Thumb")
+		asserts.NoError(err)
+		asserts.NotNil(thumb.Content)
+		thumb.Content.Close()
+	}
+}
+
+func TestHandler_Thumb_Generate(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{}
+	conf.ThumbConfig.CacheDir = "TestHandler_Thumb_Generate/thumb"
+	defer os.RemoveAll(util.RelativePath("TestHandler_Thumb_Generate"))
+
+	src := "TestHandler_Thumb_Generate/src.png"
+	out, err := util.CreatNestedFile(util.RelativePath(src))
+	asserts.NoError(err)
+	asserts.NoError(png.Encode(out, image.NewRGBA(image.Rect(0, 0, 400, 200))))
+	out.Close()
+	ctx := context.WithValue(context.Background(), fsctx.ThumbSizeCtx, [2]uint{100, 100})
+
+	// 生成缩略图并写入缓存
+	{
+		thumb, err := handler.Thumb(ctx, src)
+		asserts.NoError(err)
+		img, err := png.Decode(thumb.Content)
+		thumb.Content.Close()
+		asserts.NoError(err)
+		asserts.Equal(100, img.Bounds().Dx())
+		asserts.Equal(50, img.Bounds().Dy())
+		asserts.True(util.Exists(getThumbCachePath(src, 100, 100)))
+	}
+
+	// 复用缓存
+	{
+		cachePath := getThumbCachePath(src, 100, 100)
+		asserts.NoError(ioutil.WriteFile(cachePath, []byte("cached"), 0644))
+		thumb, err := handler.Thumb(ctx, src)
+		asserts.NoError(err)
+		content, _ := ioutil.ReadAll(thumb.Content)
+		thumb.Content.Close()
+		asserts.Equal("cached", string(content))
+	}
+
+	// 删除文件时清除缓存
+	{
+		_, err := handler.Delete(context.Background(), []string{src})
+		asserts.NoError(err)
+		asserts.False(util.Exists(getThumbCacheDir(src)))
+	}
 }
 
 func TestHandler_Source(t *testing.T) {
@@ -143,6 +277,30 @@ func TestHandler_Source(t *testing.T) {
 		asserts.NotEmpty(sourceURL)
 		asserts.Contains(sourceURL, "sign=")
 		asserts.Contains(sourceURL, "https://cloudreve.org")
+		asserts.Contains(sourceURL, "/api/v3/file/local/source/0/")
+	}
+
+	// 签名中包含有效期
+	{
+		file := model.File{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Name:       "test 1.jpg",
+			SourceName: "uploads/1/test 1.jpg",
+		}
+		ctx := context.WithValue(ctx, fsctx.FileModelCtx, file)
+		baseURL, err := url.Parse("https://cloudreve.org")
+		asserts.NoError(err)
+		sourceURL, err := handler.Source(ctx, "", *baseURL, 60, false, 1024)
+		asserts.NoError(err)
+		resURL, err := url.Parse(sourceURL)
+		asserts.NoError(err)
+		asserts.Equal("/api/v3/file/local/source/1024/dXBsb2Fkcy8xL3Rlc3QgMS5qcGc/test 1.jpg", resURL.Path)
+		sign := resURL.Query().Get("sign")
+		expires, _ := strconv.ParseInt(sign[strings.LastIndex(sign, ":")+1:], 10, 64)
+		asserts.True(expires > time.Now().Unix())
+		asserts.NoError(auth.CheckURI(auth.General, resURL))
 	}
 
 	// 无法获取上下文
@@ -212,6 +370,26 @@ func TestHandler_GetDownloadURL(t *testing.T) {
 		asserts.NoError(err)
 		asserts.Contains(downloadURL, "sign=")
 		asserts.Contains(downloadURL, "https://cloudreve.org")
+		asserts.Contains(downloadURL, "/api/v3/file/local/download/0/")
+	}
+
+	// 一次性下载使用下载会话
+	{
+		file := model.File{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Name: "test.jpg",
+		}
+		user := model.User{}
+		user.Group.OptionsSerialized.OneTimeDownload = true
+		ctx := context.WithValue(ctx, fsctx.FileModelCtx, file)
+		ctx = context.WithValue(ctx, fsctx.UserCtx, user)
+		baseURL, err := url.Parse("https://cloudreve.org")
+		asserts.NoError(err)
+		downloadURL, err := handler.Source(ctx, "", *baseURL, 10, true, 0)
+		asserts.NoError(err)
+		asserts.Contains(downloadURL, "/api/v3/file/download/")
 	}
 
 	// 无法获取上下文
@@ -261,4 +439,24 @@ func TestDriver_List(t *testing.T) {
 		asserts.NoError(err)
 		asserts.Len(res, 7)
 	}
+
+	// 仅列出文件
+	{
+		res, err := handler.List(context.WithValue(ctx, fsctx.ListFilterCtx, fsctx.ListFilesOnly), "test/TestDriver_List", true)
+		asserts.NoError(err)
+		asserts.Len(res, 4)
+		for _, object := range res {
+			asserts.False(object.IsDir)
+		}
+	}
+
+	// 仅列出目录
+	{
+		res, err := handler.List(context.WithValue(ctx, fsctx.ListFilterCtx, fsctx.ListFoldersOnly), "test/TestDriver_List", true)
+		asserts.NoError(err)
+		asserts.Len(res, 3)
+		for _, object := range res {
+			asserts.True(object.IsDir)
+		}
+	}
 }
@@ -0,0 +1,66 @@
+package local
+
+import (
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
+	"github.com/cloudreve/Cloudreve/v3/pkg/thumb"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// getThumbCacheDir 获取源文件对应的缩略图缓存目录
+func getThumbCacheDir(path string) string {
+	return util.RelativePath(filepath.Join(
+		conf.ThumbConfig.CacheDir,
+		fmt.Sprintf("%x", md5.Sum([]byte(filepath.ToSlash(path)))),
+	))
+}
+
+// getThumbCachePath 获取源文件给定尺寸缩略图的缓存路径
+func getThumbCachePath(path string, w, h uint) string {
+	return filepath.Join(getThumbCacheDir(path), fmt.Sprintf("%dx%d.png", w, h))
+}
+
+// generateThumb 生成给定尺寸的缩略图并写入缓存，缓存比源文件新时直接复用，
+// 返回缓存文件路径
+func generateThumb(path string, w, h uint) (string, error) {
+	src := util.RelativePath(filepath.FromSlash(path))
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+
+	cachePath := getThumbCachePath(path, w, h)
+	if cacheInfo, err := os.Stat(cachePath); err == nil && !cacheInfo.ModTime().Before(srcInfo.ModTime()) {
+		return cachePath, nil
+	}
+
+	file, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	image, err := thumb.NewThumbFromFile(file, path)
+	if err != nil {
+		return "", err
+	}
+	image.GetThumb(w, h)
+
+	// 先写入临时文件再重命名，避免并发请求读到不完整的缩略图
+	tempPath := fmt.Sprintf("%s.%d", cachePath, time.Now().UnixNano())
+	if err := image.Save(tempPath); err != nil {
+		_ = os.Remove(tempPath)
+		return "", err
+	}
+	if err := os.Rename(tempPath, cachePath); err != nil {
+		_ = os.Remove(tempPath)
+		return "", err
+	}
+
+	return cachePath, nil
+}
@@ -3,11 +3,12 @@ package onedrive
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"path"
@@ -25,18 +26,54 @@ import (
 const (
 	// SmallFileSize 单文件上传接口最大尺寸
 	SmallFileSize uint64 = 4 * 1024 * 1024
+	// MaxRelayThreshold 服务端中转阈值的上限，更大的文件应由客户端通过上传会话直传，
+	// 避免长时间占用服务端带宽及连接
+	MaxRelayThreshold uint64 = 100 * 1024 * 1024
 	// ChunkSize 服务端中转分片上传分片大小
 	ChunkSize uint64 = 10 * 1024 * 1024
+	// ChunkAlignment 上传会话分片大小须为此值的整数倍
+	ChunkAlignment uint64 = 320 * 1024
+	// MaxChunkSize 上传会话单个分片大小的上限，OneDrive 要求单个分片小于 60 MiB
+	MaxChunkSize uint64 = 60*1024*1024 - ChunkAlignment
+	// MaxUploadBuffers 服务端中转上传时分片缓冲区数量的上限
+	MaxUploadBuffers = 4
 	// ListRetry 列取请求重试次数
 	ListRetry = 1
+	// MaxRetryBackoff 限流重试的最长退避时间
+	MaxRetryBackoff = time.Duration(60) * time.Second
+	// MaxThumbRetryBackoff 缩略图后台重试的最长间隔
+	MaxThumbRetryBackoff = time.Duration(6) * time.Hour
+	// MaxBatchRequests 单个 $batch 请求最多包含的请求数
+	MaxBatchRequests = 20
+	// DefaultRequestTimeout 元数据、列取等控制类请求的默认超时时间
+	DefaultRequestTimeout = time.Duration(30) * time.Second
+	// DefaultMaxIdleConnsPerHost 每个主机保留的默认最大空闲连接数
+	DefaultMaxIdleConnsPerHost = 16
+	// DefaultMaxConnsPerHost 每个主机的默认最大连接数
+	DefaultMaxConnsPerHost = 32
+	// DefaultIdleConnTimeout 空闲连接默认保留的时间（秒）
+	DefaultIdleConnTimeout = 90
+	// DefaultListPageSize 分页列取时未指定每页数量使用的默认值
+	DefaultListPageSize = 200
+	// MaxListPageSize 分页列取时每页数量的上限
+	MaxListPageSize = 999
+	// PreviewCacheTTL 在线预览地址的缓存时间（秒），OneDrive 预览地址仅短时间内有效
+	PreviewCacheTTL = 600
 )
 
+// namedThumbSizes OneDrive 预定义的缩略图尺寸
+var namedThumbSizes = map[[2]uint]string{
+	{96, 96}:   "small",
+	{176, 176}: "medium",
+	{800, 800}: "large",
+}
+
 // GetSourcePath 获取文件的绝对路径
 func (info *FileInfo) GetSourcePath() string {
 	res, err := url.PathUnescape(
 		strings.TrimPrefix(
 			path.Join(
-				strings.TrimPrefix(info.ParentReference.Path, "/drive/root:"),
+				trimDriveRoot(info.ParentReference.Path),
 				info.Name,
 			),
 			"/",
@@ -48,11 +85,36 @@ func (info *FileInfo) GetSourcePath() string {
 	return res
 }
 
+// trimDriveRoot 去除 parentReference 路径中的驱动器根前缀，如 /drive/root: 或 /drives/{id}/root:
+func trimDriveRoot(parent string) string {
+	if i := strings.Index(parent, "root:"); i >= 0 {
+		return parent[i+len("root:"):]
+	}
+	return parent
+}
+
 // Error 实现error接口
 func (err RespError) Error() string {
 	return err.APIError.Message
 }
 
+// Error 实现error接口
+func (errs ListErrors) Error() string {
+	msg := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msg = append(msg, fmt.Sprintf("无法列取目录[%s]，%s", err.Path, err.Err))
+	}
+	return strings.Join(msg, "; ")
+}
+
+// add 添加子目录列取错误，子目录本身返回的 ListErrors 会被展开
+func (errs ListErrors) add(path string, err error) ListErrors {
+	if subErrs, ok := err.(ListErrors); ok {
+		return append(errs, subErrs...)
+	}
+	return append(errs, ListError{Path: path, Err: err})
+}
+
 func (client *Client) getRequestURL(api string) string {
 	base, _ := url.Parse(client.Endpoints.EndpointURL)
 	if base == nil {
@@ -62,43 +124,99 @@ func (client *Client) getRequestURL(api string) string {
 	return base.String()
 }
 
-//修复删除失败
-func (client *Client) getDeleteRequestURL(api string) string {
-	var Delete_URL string;
-	if client.Endpoints.isInChina{
-	Delete_URL = "https://microsoftgraph.chinacloudapi.cn/v1.0"
-	}else{
-	Delete_URL = "https://graph.microsoft.com/v1.0"
+// getDriveRequestURL 获取目标驱动器下给定接口的请求URL，未指定驱动器ID时使用当前用户的默认驱动器
+func (client *Client) getDriveRequestURL(api string) string {
+	if client.Endpoints.DriveID == "" {
+		return client.getRequestURL(path.Join("drive", api))
 	}
-	base, _ := url.Parse(Delete_URL)
+	return client.getDrivesRequestURL(client.Endpoints.DriveID, api)
+}
+
+// getDrivesRequestURL 获取给定ID的驱动器下接口的请求URL
+func (client *Client) getDrivesRequestURL(driveID, api string) string {
+	// 共享驱动器、SharePoint 文档库位于 /drives/{id}，不在 /me 之下
+	return client.getGraphRequestURL(path.Join("drives", driveID, api))
+}
+
+// getGraphRequestURL 获取 Graph 根路径下接口的请求URL，根路径由接口地址去除末尾的 /me 得到
+func (client *Client) getGraphRequestURL(api string) string {
+	base, _ := url.Parse(client.Endpoints.EndpointURL)
 	if base == nil {
 		return ""
 	}
-	base.Path = path.Join(base.Path, api)
+	base.Path = path.Join(strings.TrimSuffix(strings.TrimSuffix(base.Path, "/"), "/me"), api)
 	return base.String()
 }
 
-// ListChildren 根据路径列取子对象
+// getBatchRequestURL 获取 $batch 接口的请求URL，未指定接口地址时使用认证主机所属国家云的 Graph 接口
+func (client *Client) getBatchRequestURL() string {
+	if client.Endpoints.EndpointURL != "" {
+		return client.getGraphRequestURL("$batch")
+	}
+
+	graphURL := client.Endpoints.graphURL
+	if graphURL == "" {
+		graphURL = oauthClouds[len(oauthClouds)-1].graph
+	}
+	return graphURL + "/$batch"
+}
+
+// getDriveRootPath 获取目标驱动器根目录在 parentReference 中的路径
+func (client *Client) getDriveRootPath() string {
+	if client.Endpoints.DriveID == "" {
+		return "/drive/root:"
+	}
+	return "/drives/" + client.Endpoints.DriveID + "/root:"
+}
+
+// ListChildren 根据路径列取子对象，自动跟随 nextLink 获取所有分页
 func (client *Client) ListChildren(ctx context.Context, path string) ([]FileInfo, error) {
-	var requestURL string
 	dst := strings.TrimPrefix(path, "/")
-	if dst == "" {
-		requestURL = client.getRequestURL("drive/root/children")
-	} else {
-		requestURL = client.getRequestURL("drive/root:/" + dst + ":/children")
+	res, err := client.listAllChildren(ctx, path, client.getItemRequestURL(dst, "children"))
+	// 路径可能经过尚未记录的快捷方式
+	if IsNotFound(err) && client.discoverShortcuts(ctx, dst) {
+		res, err = client.listAllChildren(ctx, path, client.getItemRequestURL(dst, "children"))
 	}
-
-	res, err := client.requestWithStr(ctx, "GET", requestURL+"?$top=999999999", "", 200)
 	if err != nil {
-		retried := 0
-		if v, ok := ctx.Value(fsctx.RetryCtx).(int); ok {
-			retried = v
+		return nil, err
+	}
+
+	return client.resolveShortcuts(ctx, dst, res), nil
+}
+
+// listAllChildren 从 requestURL 开始列取子对象，自动跟随 nextLink 获取所有分页
+func (client *Client) listAllChildren(ctx context.Context, path, requestURL string) ([]FileInfo, error) {
+	requestURL += "?$top=999999999"
+	res := make([]FileInfo, 0)
+	for requestURL != "" {
+		select {
+		case <-ctx.Done():
+			util.Log().Debug("OneDrive 客户端取消")
+			return nil, ErrClientCanceled
+		default:
+		}
+
+		page, err := client.listChildrenPage(ctx, path, requestURL)
+		if err != nil {
+			return nil, err
 		}
+		res = append(res, page.Value...)
+		requestURL = page.NextLink
+	}
+
+	return res, nil
+}
+
+// listChildrenPage 列取单页子对象
+func (client *Client) listChildrenPage(ctx context.Context, path, requestURL string) (*ListResponse, error) {
+	res, err := client.getWithETag(ctx, requestURL)
+	if err != nil {
+		retried := fsctx.Retry(ctx)
 		if retried < ListRetry {
 			retried++
 			util.Log().Debug("路径[%s]列取请求失败[%s]，5秒钟后重试", path, err)
 			time.Sleep(time.Duration(5) * time.Second)
-			return client.ListChildren(context.WithValue(ctx, fsctx.RetryCtx, retried), path)
+			return client.listChildrenPage(context.WithValue(ctx, fsctx.RetryCtx, retried), path, requestURL)
 		}
 		return nil, err
 	}
@@ -112,20 +230,42 @@ func (client *Client) ListChildren(ctx context.Context, path string) ([]FileInfo
 		return nil, decodeErr
 	}
 
-	return fileInfo.Value, nil
+	return &fileInfo, nil
 }
 
 // Meta 根据资源ID或文件路径获取文件元信息
 func (client *Client) Meta(ctx context.Context, id string, path string) (*FileInfo, error) {
-	var requestURL string
 	if id != "" {
-		requestURL = client.getRequestURL("/drive/items/" + id)
-	} else {
-		dst := strings.TrimPrefix(path, "/")
-		requestURL = client.getRequestURL("drive/root:/" + dst)
+		return client.getItem(ctx, client.getDriveRequestURL("items/"+id))
 	}
 
-	res, err := client.requestWithStr(ctx, "GET", requestURL+"?expand=thumbnails", "", 200)
+	dst := strings.TrimPrefix(path, "/")
+	if client.isKnownNotFound(dst) {
+		return nil, errKnownNotFound(dst)
+	}
+	info, err := client.getItem(ctx, client.getItemRequestURL(dst, ""))
+	// 路径可能经过尚未记录的快捷方式
+	if IsNotFound(err) && client.discoverShortcuts(ctx, dst) {
+		info, err = client.getItem(ctx, client.getItemRequestURL(dst, ""))
+	}
+	if err != nil {
+		if IsNotFound(err) {
+			client.setNotFound(dst)
+		}
+		return nil, err
+	}
+
+	// 快捷方式本身，返回其指向的项目
+	if info.RemoteItem != nil {
+		return client.followShortcut(ctx, dst, info)
+	}
+	return info, nil
+}
+
+// getItem 获取 requestURL 所指项目的元信息。响应中的下载地址及缩略图地址很快过期，
+// 不使用 ETag 缓存，避免 304 时复用已失效的地址
+func (client *Client) getItem(ctx context.Context, requestURL string) (*FileInfo, error) {
+	res, err := client.request(ctx, "GET", requestURL+"?expand=thumbnails", nil, request.WithTimeout(client.requestTimeout()))
 	if err != nil {
 		return nil, err
 	}
@@ -152,12 +292,18 @@ func (client *Client) CreateUploadSession(ctx context.Context, dst string, opts
 	}
 
 	dst = strings.TrimPrefix(dst, "/")
-	requestURL := client.getRequestURL("drive/root:/" + dst + ":/createUploadSession")
+	requestURL := client.getDriveRequestURL("root:/" + dst + ":/createUploadSession")
 	body := map[string]map[string]interface{}{
 		"item": {
 			"@microsoft.graph.conflictBehavior": options.conflictBehavior,
 		},
 	}
+	if options.description != "" {
+		body["item"]["description"] = options.description
+	}
+	if !options.modTime.IsZero() {
+		body["item"]["fileSystemInfo"] = newFileSystemInfo(options.modTime)
+	}
 	bodyBytes, _ := json.Marshal(body)
 
 	res, err := client.requestWithStr(ctx, "POST", requestURL, string(bodyBytes), 200)
@@ -196,8 +342,54 @@ func (client *Client) GetUploadSessionStatus(ctx context.Context, uploadURL stri
 	return &uploadSession, nil
 }
 
+// GetUploadStatus 查询上传会话尚未接收的字节范围，如 ["0-999", "2000-"]。
+// 客户端上传分片失败后，可据此得知应从何处续传
+func (client *Client) GetUploadStatus(ctx context.Context, uploadURL string) ([]string, error) {
+	status, err := client.GetUploadSessionStatus(ctx, uploadURL)
+	if err != nil {
+		return nil, err
+	}
+	return status.NextExpectedRanges, nil
+}
+
+// ResumeOffset 返回续传的起始位置，即尚未接收的第一个字节范围的起点
+func ResumeOffset(nextRanges []string) (uint64, error) {
+	if len(nextRanges) == 0 {
+		return 0, ErrInvalidUploadRange
+	}
+	start := strings.SplitN(nextRanges[0], "-", 2)[0]
+	offset, err := strconv.ParseUint(strings.TrimSpace(start), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidUploadRange
+	}
+	return offset, nil
+}
+
 // UploadChunk 上传分片
 func (client *Client) UploadChunk(ctx context.Context, uploadURL string, chunk *Chunk) (*UploadSessionResponse, error) {
+	res, err := client.uploadChunk(ctx, uploadURL, chunk)
+	if err != nil {
+		return nil, err
+	}
+
+	if chunk.IsLast() {
+		return nil, nil
+	}
+
+	var (
+		decodeErr error
+		uploadRes UploadSessionResponse
+	)
+	decodeErr = json.Unmarshal([]byte(res), &uploadRes)
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	return &uploadRes, nil
+}
+
+// uploadChunk 上传分片，返回原始响应正文。最后一个分片的响应为上传完成的文件
+func (client *Client) uploadChunk(ctx context.Context, uploadURL string, chunk *Chunk) (string, error) {
 	res, err := client.request(
 		ctx, "PUT", uploadURL, bytes.NewReader(chunk.Data[0:chunk.ChunkSize]),
 		request.WithContentLength(int64(chunk.ChunkSize)),
@@ -213,49 +405,103 @@ func (client *Client) UploadChunk(ctx context.Context, uploadURL string, chunk *
 			chunk.Retried++
 			util.Log().Debug("分片偏移%d上传失败[%s]，5秒钟后重试", chunk.Offset, err)
 			time.Sleep(time.Duration(5) * time.Second)
-			return client.UploadChunk(ctx, uploadURL, chunk)
+			return client.uploadChunk(ctx, uploadURL, chunk)
 		}
-		return nil, err
+		return "", err
 	}
 
-	if chunk.IsLast() {
-		return nil, nil
-	}
+	return res, nil
+}
 
-	var (
-		decodeErr error
-		uploadRes UploadSessionResponse
-	)
-	decodeErr = json.Unmarshal([]byte(res), &uploadRes)
-	if decodeErr != nil {
-		return nil, decodeErr
+// Upload 上传文件，开启 onedrive_verify_upload 时会在上传完成后校验 quickXorHash。
+// 上下文中指定了 fsctx.ModTimeCtx 时，保留文件的原始修改时间
+func (client *Client) Upload(ctx context.Context, dst string, size int, file io.Reader) error {
+	progress, _ := fsctx.Progress(ctx)
+	modTime, _ := fsctx.ModTime(ctx)
+	description, err := metadataDescription(ctx)
+	if err != nil {
+		return err
 	}
 
-	return &uploadRes, nil
-}
+	// 边上传边计算校验值
+	var hasher hash.Hash
+	if model.IsTrueVal(model.GetSettingByName("onedrive_verify_upload")) {
+		hasher = NewQuickXorHash()
+		file = io.TeeReader(file, hasher)
+	}
 
-// Upload 上传文件
-func (client *Client) Upload(ctx context.Context, dst string, size int, file io.Reader) error {
-	// 小文件，使用简单上传接口上传
+	// 小文件，使用简单上传接口上传。读入内存，以便令牌失效时重试；
+	// 空文件不读取数据，以空正文创建，上传会话不接受空文件
 	if size <= int(SmallFileSize) {
-		_, err := client.SimpleUpload(ctx, dst, file, int64(size))
-		return err
+		var body io.Reader
+		if size > 0 {
+			content := make([]byte, size)
+			if _, err := io.ReadFull(file, content); err != nil {
+				return err
+			}
+			body = bytes.NewReader(content)
+		}
+		var res *UploadResult
+		err := client.withParentFolders(ctx, dst, func() error {
+			// 重试时重新读取正文
+			rewindBody(body)
+			var err error
+			res, err = client.SimpleUpload(ctx, dst, body, int64(size))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		// 简单上传接口无法附带项目属性，上传后单独写入
+		if description != "" {
+			if err := client.UpdateDescription(ctx, dst, description); err != nil {
+				return err
+			}
+		}
+		// 修改时间写入失败不影响已上传的文件，保留 OneDrive 接收文件的时间
+		if !modTime.IsZero() {
+			if err := client.UpdateModTime(ctx, dst, modTime); err != nil {
+				util.Log().Warning("无法保留文件[%s]的修改时间，%s", dst, err)
+			}
+		}
+		if progress != nil {
+			progress(uint64(size), uint64(size))
+		}
+		if hasher == nil {
+			return nil
+		}
+		return verifyUpload(dst, hasher, res)
 	}
 
 	// 大文件，进行分片
 	// 创建上传会话
-	uploadURL, err := client.CreateUploadSession(ctx, dst, WithConflictBehavior("replace"))
+	var uploadURL string
+	err = client.withParentFolders(ctx, dst, func() error {
+		var err error
+		uploadURL, err = client.CreateUploadSession(
+			ctx,
+			dst,
+			WithConflictBehavior("replace"),
+			WithDescription(description),
+			WithModTime(modTime),
+		)
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
 	offset := 0
-	chunkNum := size / int(ChunkSize)
-	if size%int(ChunkSize) != 0 {
+	alignedChunkSize := int(client.chunkSize())
+	chunkNum := size / alignedChunkSize
+	if size%alignedChunkSize != 0 {
 		chunkNum++
 	}
 
-	chunkData := make([]byte, ChunkSize)
+	// 因为后面需要错误重试，这里要把分片内容读到内存中；
+	// 上传当前分片的同时在后台预读后续分片
+	chunks := newChunkReader(file, size, alignedChunkSize, uploadBuffers())
+	defer chunks.Close()
 
 	for i := 0; i < chunkNum; i++ {
 		select {
@@ -263,15 +509,11 @@ func (client *Client) Upload(ctx context.Context, dst string, size int, file io.
 			util.Log().Debug("OneDrive 客户端取消")
 			return ErrClientCanceled
 		default:
-			// 分块
-			chunkSize := int(ChunkSize)
-			if size-offset < chunkSize {
-				chunkSize = size - offset
+			chunkContent, err := chunks.Next()
+			if err != nil {
+				return err
 			}
-
-			// 因为后面需要错误重试，这里要把分片内容读到内存中
-			chunkContent := chunkData[:chunkSize]
-			_, err := io.ReadFull(file, chunkContent)
+			chunkSize := len(chunkContent)
 
 			chunk := Chunk{
 				Offset:    offset,
@@ -280,18 +522,71 @@ func (client *Client) Upload(ctx context.Context, dst string, size int, file io.
 				Data:      chunkContent,
 			}
 
-			// 上传
-			_, err = client.UploadChunk(ctx, uploadURL, &chunk)
+			// 上传，完成后归还缓冲区以预读后续分片
+			res, err := client.uploadChunk(ctx, uploadURL, &chunk)
+			chunks.Release(chunkContent)
 			if err != nil {
 				return err
 			}
 			offset += chunkSize
+			if progress != nil {
+				progress(uint64(offset), uint64(size))
+			}
+
+			// 最后一个分片的响应为上传完成的文件
+			if chunk.IsLast() && hasher != nil {
+				var uploadRes UploadResult
+				if err := json.Unmarshal([]byte(res), &uploadRes); err != nil {
+					return err
+				}
+				return verifyUpload(dst, hasher, &uploadRes)
+			}
 		}
 
 	}
 	return nil
 }
 
+// verifyUpload 对比上传完成后 OneDrive 返回的 quickXorHash 与本地计算值，
+// 未返回 quickXorHash 时跳过校验
+func verifyUpload(dst string, hasher hash.Hash, res *UploadResult) error {
+	if res == nil || res.File == nil || res.File.Hashes.QuickXorHash == "" {
+		util.Log().Debug("OneDrive 未返回文件[%s]的 quickXorHash，跳过校验", dst)
+		return nil
+	}
+
+	if base64.StdEncoding.EncodeToString(hasher.Sum(nil)) != res.File.Hashes.QuickXorHash {
+		util.Log().Warning("文件[%s]上传后校验值不一致", dst)
+		return ErrChecksumMismatch
+	}
+
+	return nil
+}
+
+// alignChunkSize 将分片大小向下对齐到 ChunkAlignment 的整数倍，最小为 ChunkAlignment
+func alignChunkSize(size uint64) uint64 {
+	if size < ChunkAlignment {
+		return ChunkAlignment
+	}
+	return size - size%ChunkAlignment
+}
+
+// chunkSize 获取服务端中转时上传会话使用的分片大小，未设置时为 ChunkSize，
+// 超出 [ChunkAlignment, MaxChunkSize] 时取边界值，并向下对齐到 ChunkAlignment 的整数倍。
+// 分片越大，请求次数越少、吞吐越高，但单个分片失败后需要重传的数据也越多，
+// 且每个分片都需完整缓存在内存中（预读时同时缓存 onedrive_upload_buffers 个）；
+// 网络不稳定时宜使用较小的分片
+func (client *Client) chunkSize() uint64 {
+	size := ChunkSize
+	if client.Policy != nil && client.Policy.OptionsSerialized.OdChunkSize > 0 {
+		size = client.Policy.OptionsSerialized.OdChunkSize
+	}
+	if size > MaxChunkSize {
+		size = MaxChunkSize
+	}
+	return alignChunkSize(size)
+}
+
 // DeleteUploadSession 删除上传会话
 func (client *Client) DeleteUploadSession(ctx context.Context, uploadURL string) error {
 	_, err := client.requestWithStr(ctx, "DELETE", uploadURL, "", 204)
@@ -305,16 +600,13 @@ func (client *Client) DeleteUploadSession(ctx context.Context, uploadURL string)
 // SimpleUpload 上传小文件到dst
 func (client *Client) SimpleUpload(ctx context.Context, dst string, body io.Reader, size int64) (*UploadResult, error) {
 	dst = strings.TrimPrefix(dst, "/")
-	requestURL := client.getRequestURL("drive/root:/" + dst + ":/content")
+	requestURL := client.getDriveRequestURL("root:/" + dst + ":/content")
 
 	res, err := client.request(ctx, "PUT", requestURL, body, request.WithContentLength(int64(size)),
 		request.WithTimeout(time.Duration(150)*time.Second),
 	)
 	if err != nil {
-		retried := 0
-		if v, ok := ctx.Value(fsctx.RetryCtx).(int); ok {
-			retried = v
-		}
+		retried := fsctx.Retry(ctx)
 		if retried < model.GetIntSetting("onedrive_chunk_retries", 1) {
 			retried++
 			util.Log().Debug("文件[%s]上传失败[%s]，5秒钟后重试", dst, err)
@@ -336,32 +628,168 @@ func (client *Client) SimpleUpload(ctx context.Context, dst string, body io.Read
 	return &uploadRes, nil
 }
 
-// BatchDelete 并行删除给出的文件，返回删除失败的文件，及第一个遇到的错误。此方法将文件分为
-// 20个一组，调用Delete并行删除
-// TODO 测试
+// Move 将src移动或重命名为dst，dst所在目录需已存在
+func (client *Client) Move(ctx context.Context, src, dst string) (*FileInfo, error) {
+	src = strings.TrimPrefix(src, "/")
+	dst = strings.TrimPrefix(dst, "/")
+	requestURL := client.getDriveRequestURL("root:/" + src)
+
+	bodyBytes, _ := json.Marshal(client.getDestinationBody(dst))
+
+	res, err := client.requestWithStr(ctx, "PATCH", requestURL, string(bodyBytes), 200)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		decodeErr error
+		fileInfo  FileInfo
+	)
+	decodeErr = json.Unmarshal([]byte(res), &fileInfo)
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	return &fileInfo, nil
+}
+
+// Copy 在服务端将src异步复制为dst，返回用于查询进度的监控地址。可通过
+// WithConflictBehavior 指定目标已存在时的处理方式：fail、replace、rename
+func (client *Client) Copy(ctx context.Context, src, dst string, opts ...Option) (string, error) {
+	options := newDefaultOption()
+	for _, o := range opts {
+		o.apply(options)
+	}
+
+	src = strings.TrimPrefix(src, "/")
+	dst = strings.TrimPrefix(dst, "/")
+	requestURL := client.getDriveRequestURL("root:/"+src+":/copy") +
+		"?@microsoft.graph.conflictBehavior=" + url.QueryEscape(options.conflictBehavior)
+	bodyBytes, _ := json.Marshal(client.getDestinationBody(dst))
+	bodyReader := strings.NewReader(string(bodyBytes))
+
+	_, resp, err := client.requestWithResp(ctx, "POST", requestURL, bodyReader,
+		request.WithContentLength(int64(len(bodyBytes))),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	monitorURL := resp.Header.Get("Location")
+	if monitorURL == "" {
+		return "", ErrCopyFailed
+	}
+
+	return monitorURL, nil
+}
+
+// GetCopyStatus 查询异步复制任务的状态，监控地址无需认证
+func (client *Client) GetCopyStatus(ctx context.Context, monitorURL string) (*CopyStatus, error) {
+	res := client.Request.Request("GET", monitorURL, nil, request.WithContext(ctx), withUserAgent())
+	respBody, err := res.GetResponse()
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Response.StatusCode >= 300 {
+		var errResp RespError
+		if json.Unmarshal([]byte(respBody), &errResp) != nil || errResp.APIError.Code == "" {
+			return nil, ErrCopyFailed
+		}
+		return nil, errResp.withResponse(res.Response)
+	}
+
+	var status CopyStatus
+	if err := json.Unmarshal([]byte(respBody), &status); err != nil {
+		return nil, err
+	}
+
+	// 任务完成后，监控地址可能直接重定向到新文件
+	if status.Status == "" && res.Response.StatusCode == 200 {
+		status.Status = "completed"
+		status.PercentageComplete = 100
+	}
+
+	return &status, nil
+}
+
+// WaitCopy 轮询异步复制任务直到完成或失败
+func (client *Client) WaitCopy(ctx context.Context, monitorURL string) error {
+	interval := model.GetIntSetting("onedrive_copy_check", 2)
+	for {
+		status, err := client.GetCopyStatus(ctx, monitorURL)
+		if err != nil {
+			return err
+		}
+
+		switch status.Status {
+		case "completed":
+			return nil
+		case "failed":
+			if status.Error != nil {
+				return &RespError{APIError: *status.Error}
+			}
+			return ErrCopyFailed
+		}
+
+		util.Log().Debug("OneDrive 复制任务进行中[%.1f%%]", status.PercentageComplete)
+		select {
+		case <-ctx.Done():
+			return ErrClientCanceled
+		case <-time.After(time.Duration(interval) * time.Second):
+		}
+	}
+}
+
+// getDestinationBody 生成移动、复制请求中指定目标位置的请求正文
+func (client *Client) getDestinationBody(dst string) map[string]interface{} {
+	parent := client.getDriveRootPath()
+	if dir := path.Dir(dst); dir != "." {
+		parent += "/" + dir
+	}
+	return map[string]interface{}{
+		"parentReference": map[string]string{
+			"path": parent,
+		},
+		"name": path.Base(dst),
+	}
+}
+
+// BatchDelete 批量删除给出的文件，返回删除失败的文件，及最后一个遇到的错误。此方法将文件分为
+// MaxBatchRequests 个一组，依次调用Delete删除。ctx 结束时不再发送后续分组，
+// 未删除的文件视为删除失败，并返回 ctx.Err()
 func (client *Client) BatchDelete(ctx context.Context, dst []string) ([]string, error) {
-	groupNum := len(dst)/20 + 1
 	finalRes := make([]string, 0, len(dst))
-	res := make([]string, 0, 20)
-	var err error
+	var lastErr error
+
+	for start := 0; start < len(dst); start += MaxBatchRequests {
+		select {
+		case <-ctx.Done():
+			util.Log().Debug("OneDrive 批量删除已取消")
+			return append(finalRes, dst[start:]...), ctx.Err()
+		default:
+		}
 
-	for i := 0; i < groupNum; i++ {
-		end := 20*i + 20
-		if i == groupNum-1 {
+		end := start + MaxBatchRequests
+		if end > len(dst) {
 			end = len(dst)
 		}
-		res, err = client.Delete(ctx, dst[20*i:end])
+
+		res, err := client.Delete(ctx, dst[start:end])
 		finalRes = append(finalRes, res...)
+		if err != nil {
+			lastErr = err
+		}
 	}
 
-	return finalRes, err
+	return finalRes, lastErr
 }
 
 // Delete 并行删除文件，返回删除失败的文件，及第一个遇到的错误，
-// 由于API限制，最多删除20个
+// 由于API限制，最多删除 MaxBatchRequests 个
 func (client *Client) Delete(ctx context.Context, dst []string) ([]string, error) {
 	body := client.makeBatchDeleteRequestsBody(dst)
-	res, err := client.requestWithStr(ctx, "POST", client.getDeleteRequestURL("$batch"), body, 200)
+	res, err := client.requestWithStr(ctx, "POST", client.getBatchRequestURL(), body, 200)
 	if err != nil {
 		return dst, err
 	}
@@ -393,13 +821,23 @@ func getDeleteFailed(res *BatchResponses) []string {
 	return failed
 }
 
+// DeleteItem 删除 dst 处的文件或目录，删除目录时其下的全部内容一并删除
+func (client *Client) DeleteItem(ctx context.Context, dst string) error {
+	dst = strings.TrimPrefix(dst, "/")
+	requestURL := client.getDriveRequestURL("root:/" + dst)
+	if _, err := client.requestWithStr(ctx, "DELETE", requestURL, "", 204); err != nil {
+		return err
+	}
+	return nil
+}
+
 // makeBatchDeleteRequestsBody 生成批量删除请求正文
 func (client *Client) makeBatchDeleteRequestsBody(files []string) string {
 	req := BatchRequests{
 		Requests: make([]BatchRequest, len(files)),
 	}
 	//修复删除失败
-	var Delete_Full_URL string = client.Endpoints.EndpointURL + "/drive/root:/"
+	var Delete_Full_URL string = client.getDriveRequestURL("root:")
 	for i, v := range files {
 		v = strings.TrimPrefix(v, "/")
 		filePath, _ := url.Parse(Delete_Full_URL)
@@ -418,31 +856,34 @@ func (client *Client) makeBatchDeleteRequestsBody(files []string) string {
 
 // GetThumbURL 获取给定尺寸的缩略图URL
 func (client *Client) GetThumbURL(ctx context.Context, dst string, w, h uint) (string, error) {
-	dst = strings.TrimPrefix(dst, "/")
-	var (
-		cropOption string
-		requestURL string
-	)
-	if client.Endpoints.isInChina {
-		cropOption = "large"
-		requestURL = client.getRequestURL("drive/root:/"+dst+":/thumbnails/0") + "/" + cropOption
-	} else {
-		cropOption = fmt.Sprintf("c%dx%d_Crop", w, h)
-		requestURL = client.getRequestURL("drive/root:/"+dst+":/thumbnails") + "?select=" + cropOption
-	}
-
+	requestURL, cropOption := client.getThumbRequestURL(dst, w, h)
 	res, err := client.requestWithStr(ctx, "GET", requestURL, "", 200)
 	if err != nil {
 		return "", err
 	}
 
-	var (
-		decodeErr error
-		thumbRes  ThumbResponse
-	)
-	decodeErr = json.Unmarshal([]byte(res), &thumbRes)
-	if decodeErr != nil {
-		return "", decodeErr
+	return parseThumbURL([]byte(res), cropOption)
+}
+
+// getThumbRequestURL 获取 dst 处文件给定尺寸缩略图的请求URL，及响应中缩略图所在的字段
+func (client *Client) getThumbRequestURL(dst string, w, h uint) (string, string) {
+	dst = strings.TrimPrefix(dst, "/")
+	if client.Endpoints.isInChina {
+		return client.getDriveRequestURL("root:/"+dst+":/thumbnails/0") + "/large", "large"
+	}
+	if named, ok := namedThumbSizes[[2]uint{w, h}]; ok {
+		// 请求尺寸与预定义尺寸一致时，直接获取预定义缩略图
+		return client.getDriveRequestURL("root:/"+dst+":/thumbnails/0") + "/" + named, named
+	}
+	cropOption := fmt.Sprintf("c%dx%d_Crop", w, h)
+	return client.getDriveRequestURL("root:/"+dst+":/thumbnails") + "?select=" + cropOption, cropOption
+}
+
+// parseThumbURL 从获取缩略图的响应中取出缩略图URL，没有缩略图时返回 ErrThumbNotAvailable
+func parseThumbURL(res []byte, cropOption string) (string, error) {
+	var thumbRes ThumbResponse
+	if err := json.Unmarshal(res, &thumbRes); err != nil {
+		return "", err
 	}
 
 	if thumbRes.URL != "" {
@@ -450,59 +891,126 @@ func (client *Client) GetThumbURL(ctx context.Context, dst string, w, h uint) (s
 	}
 
 	if len(thumbRes.Value) == 1 {
-		if res, ok := thumbRes.Value[0][cropOption]; ok {
-			return res.(map[string]interface{})["url"].(string), nil
+		if res, ok := thumbRes.Value[0][cropOption].(map[string]interface{}); ok {
+			if thumbURL, ok := res["url"].(string); ok {
+				return thumbURL, nil
+			}
 		}
 	}
 
-	return "", errors.New("无法生成缩略图")
+	return "", ErrThumbNotAvailable
+}
+
+// MonitorUpload 监控客户端分片上传进度。ctx 被取消时视为上传已取消，
+// 取消上传会话并清除回调会话；上传会话到期或 ctx 超过截止时间时，取消上传会话
+func (client *Client) MonitorUpload(ctx context.Context, uploadURL, callbackKey, path string, size uint64, ttl int64) {
+	client.monitorUpload(ctx, nil, uploadURL, callbackKey, path, size, ttl)
 }
 
-// MonitorUpload 监控客户端分片上传进度
-func (client *Client) MonitorUpload(uploadURL, callbackKey, path string, size uint64, ttl int64) {
+// monitorUpload 同 MonitorUpload。stop 关闭时中断进行中的请求并结束监控，不取消上传会话，
+// 也保留持久化的监控会话，以便随后恢复
+func (client *Client) monitorUpload(ctx context.Context, stop <-chan struct{}, uploadURL, callbackKey, path string, size uint64, ttl int64) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(ttl)*time.Second)
+	defer cancel()
+	log := client.log(ctx)
+
+	// 查询上传会话的请求在监控停止时一并中断
+	requestCtx, cancelRequest := context.WithCancel(ctx)
+	defer cancelRequest()
+	go func() {
+		select {
+		case <-stop:
+			cancelRequest()
+		case <-requestCtx.Done():
+		}
+	}()
+	stopped := false
+	isStopped := func() bool {
+		select {
+		case <-stop:
+			log.Debug("上传监控已停止，保留上传会话以便恢复")
+			stopped = true
+		default:
+		}
+		return stopped
+	}
+
 	// 回调完成通知chan
 	callbackChan := make(chan bool)
 	callbackSignal.Store(callbackKey, callbackChan)
 	defer callbackSignal.Delete(callbackKey)
+
+	// 持久化监控会话，以便重启后恢复
+	var policyID uint
+	if client.Policy != nil {
+		policyID = client.Policy.ID
+	}
+	saveMonitorSession(MonitorSession{
+		PolicyID:    policyID,
+		UploadURL:   uploadURL,
+		Key:         callbackKey,
+		SavePath:    path,
+		Size:        size,
+		Expires:     time.Now().Unix() + ttl,
+		OperationID: OperationID(ctx),
+	})
+	defer func() {
+		if !stopped {
+			deleteMonitorSession(callbackKey)
+		}
+	}()
+
 	timeout := model.GetIntSetting("onedrive_monitor_timeout", 600)
 	interval := model.GetIntSetting("onedrive_callback_check", 20)
 
 	for {
+		if isStopped() {
+			return
+		}
 		select {
+		case <-stop:
+			continue
 		case <-callbackChan:
-			util.Log().Debug("客户端完成回调")
+			log.Debug("客户端完成回调")
+			invalidateNotFoundCache(policyID, path)
 			return
-		case <-time.After(time.Duration(ttl) * time.Second):
-			// 上传会话到期，仍未完成上传，创建占位符
-			client.DeleteUploadSession(context.Background(), uploadURL)
-			_, err := client.SimpleUpload(context.Background(), path, strings.NewReader(""), 0)
-			if err != nil {
-				util.Log().Debug("无法创建占位文件，%s", err)
+		case <-ctx.Done():
+			if ctx.Err() == context.Canceled {
+				log.Debug("上传已取消，结束上传监控")
+				cache.Deletes([]string{callbackKey}, "callback_")
 			}
+			// 上传会话到期，仍未完成上传，创建占位符
+			client.abortUploadSession(ctx, uploadURL, path)
 			return
 		case <-time.After(time.Duration(timeout) * time.Second):
-			util.Log().Debug("检查上传情况")
-			status, err := client.GetUploadSessionStatus(context.Background(), uploadURL)
+			log.Debug("检查上传情况")
+			status, err := client.GetUploadSessionStatus(requestCtx, uploadURL)
 
 			if err != nil {
 				if resErr, ok := err.(*RespError); ok {
 					if resErr.APIError.Code == "itemNotFound" {
-						util.Log().Debug("上传会话已完成，稍后检查回调")
-						time.Sleep(time.Duration(interval) * time.Second)
-						util.Log().Debug("开始检查回调")
+						log.Debug("上传会话已完成，稍后检查回调")
+						select {
+						case <-ctx.Done():
+							continue
+						case <-stop:
+							continue
+						case <-time.After(time.Duration(interval) * time.Second):
+						}
+						log.Debug("开始检查回调")
 						_, ok := cache.Get("callback_" + callbackKey)
 						if ok {
-							util.Log().Warning("未发送回调，删除文件")
+							log.Warning("未发送回调，删除文件")
 							cache.Deletes([]string{callbackKey}, "callback_")
-							_, err = client.Delete(context.Background(), []string{path})
+							_, err = client.Delete(WithOperationID(context.Background(), OperationID(ctx)), []string{path})
 							if err != nil {
-								util.Log().Warning("无法删除未回调的文件，%s", err)
+								log.Warning("无法删除未回调的文件，%s", err)
 							}
 						}
 						return
 					}
 				}
-				util.Log().Debug("无法获取上传会话状态，继续下一轮，%s", err.Error())
+				log.Debug("无法获取上传会话状态，继续下一轮，%s", err.Error())
 				continue
 			}
 
@@ -519,14 +1027,8 @@ func (client *Client) MonitorUpload(uploadURL, callbackKey, path string, size ui
 			}
 			uploadFullSize, _ := strconv.ParseUint(sizeRange[1], 10, 64)
 			if (sizeRange[0] == "0" && sizeRange[1] == "") || uploadFullSize+1 != size {
-				util.Log().Debug("未开始上传或文件大小不一致，取消上传会话")
-				// 取消上传会话，实测OneDrive取消上传会话后，客户端还是可以上传，
-				// 所以上传一个空文件占位，阻止客户端上传
-				client.DeleteUploadSession(context.Background(), uploadURL)
-				_, err := client.SimpleUpload(context.Background(), path, strings.NewReader(""), 0)
-				if err != nil {
-					util.Log().Debug("无法创建占位文件，%s", err)
-				}
+				log.Debug("未开始上传或文件大小不一致，取消上传会话")
+				client.abortUploadSession(ctx, uploadURL, path)
 				return
 			}
 
@@ -534,6 +1036,18 @@ func (client *Client) MonitorUpload(uploadURL, callbackKey, path string, size ui
 	}
 }
 
+// abortUploadSession 取消上传会话。实测OneDrive取消上传会话后，客户端还是
+// 可以上传，所以上传一个空文件占位，阻止客户端上传。ctx 通常已被取消，
+// 仅沿用其中的操作ID
+func (client *Client) abortUploadSession(ctx context.Context, uploadURL, path string) {
+	ctx = WithOperationID(context.Background(), OperationID(ctx))
+	client.DeleteUploadSession(ctx, uploadURL)
+	_, err := client.SimpleUpload(ctx, path, strings.NewReader(""), 0)
+	if err != nil {
+		client.log(ctx).Debug("无法创建占位文件，%s", err)
+	}
+}
+
 // FinishCallback 向Monitor发送回调结束信号
 func FinishCallback(key string) {
 	if signal, ok := callbackSignal.Load(key); ok {
@@ -550,22 +1064,87 @@ func sysError(err error) *RespError {
 	}}
 }
 
+// request 发送请求，遇到限流(429/503)时按 Retry-After 或指数退避重试；
+// 访问令牌被拒绝(401)时强制刷新令牌并重试一次
 func (client *Client) request(ctx context.Context, method string, url string, body io.Reader, option ...request.Option) (string, *RespError) {
+	respBody, _, err := client.requestWithResp(ctx, method, url, body, option...)
+	return respBody, err
+}
+
+// requestWithResp 同 request，同时返回原始响应。重试时需要重新读取请求正文，
+// 不可重置的正文不会被重试
+func (client *Client) requestWithResp(ctx context.Context, method string, url string, body io.Reader, option ...request.Option) (string, *http.Response, *RespError) {
+	ctx = withOperation(ctx)
+	maxRetry := model.GetIntSetting("onedrive_throttle_retries", 3)
+	refreshed := false
+	for retried := 0; ; retried++ {
+		respBody, resp, err := client.requestOnce(ctx, method, url, body, option...)
+
+		// 令牌可能在检查有效期之后、请求到达之前失效，刷新后重试不计入限流重试次数
+		if err != nil && resp != nil && resp.StatusCode == http.StatusUnauthorized &&
+			!refreshed && rewindBody(body) {
+			client.log(ctx).Debug("OneDrive 访问令牌被拒绝，刷新后重试")
+			refreshed = true
+			retried--
+			client.invalidateCredential()
+			if refreshErr := client.UpdateCredential(ctx); refreshErr != nil {
+				client.log(ctx).Warning("无法刷新 OneDrive 访问令牌，%s", refreshErr)
+				return respBody, resp, err
+			}
+			continue
+		}
+
+		if err == nil || resp == nil || !isThrottled(resp.StatusCode) ||
+			retried >= maxRetry || !rewindBody(body) {
+			return respBody, resp, err
+		}
+
+		wait := getRetryAfter(resp.Header, retried)
+		client.log(ctx).Debug("OneDrive 请求被限流[%d]，%s 后重试", resp.StatusCode, wait)
+		select {
+		case <-ctx.Done():
+			return "", nil, sysError(ErrClientCanceled)
+		case <-time.After(wait):
+		}
+	}
+}
+
+// requestOnce 发送单次请求，返回响应正文及原始响应。存储策略的熔断器已熔断时直接返回
+// ErrCircuitOpen，请求结果计入熔断器
+func (client *Client) requestOnce(ctx context.Context, method string, url string, body io.Reader, option ...request.Option) (string, *http.Response, *RespError) {
 	// 获取凭证
 	err := client.UpdateCredential(ctx)
 	if err != nil {
-		return "", sysError(err)
+		return "", nil, sysError(err)
 	}
 
+	breaker := client.breaker()
+	if !breaker.allow() {
+		return "", nil, sysError(ErrCircuitOpen)
+	}
+	respBody, resp, respErr := client.send(ctx, method, url, body, option...)
+	client.recordResult(ctx, breaker, resp, respErr)
+	return respBody, resp, respErr
+}
+
+// send 携带访问令牌发送请求。ctx 中的操作ID作为 client-request-id 头发送，
+// 请求结果连同 Graph 返回的 request-id 一并记录在日志中
+func (client *Client) send(ctx context.Context, method string, url string, body io.Reader, option ...request.Option) (string, *http.Response, *RespError) {
+	header := http.Header{
+		"Authorization": {"Bearer " + client.Credential.AccessToken},
+		"Content-Type":  {"application/json"},
+		"User-Agent":    {userAgent()},
+	}
+	if id := OperationID(ctx); id != "" {
+		header.Set("client-request-id", id)
+	}
 	option = append(option,
-		request.WithHeader(http.Header{
-			"Authorization": {"Bearer " + client.Credential.AccessToken},
-			"Content-Type":  {"application/json"},
-		}),
+		request.WithHeader(header),
 		request.WithContext(ctx),
 	)
 
 	// 发送请求
+	start := time.Now()
 	res := client.Request.Request(
 		method,
 		url,
@@ -574,12 +1153,14 @@ func (client *Client) request(ctx context.Context, method string, url string, bo
 	)
 
 	if res.Err != nil {
-		return "", sysError(res.Err)
+		client.logRequest(ctx, method, url, nil, res.Err, time.Since(start))
+		return "", nil, sysError(res.Err)
 	}
 
 	respBody, err := res.GetResponse()
 	if err != nil {
-		return "", sysError(err)
+		client.logRequest(ctx, method, url, nil, err, time.Since(start))
+		return "", res.Response, sysError(err)
 	}
 
 	// 解析请求响应
@@ -587,23 +1168,79 @@ func (client *Client) request(ctx context.Context, method string, url string, bo
 		errResp   RespError
 		decodeErr error
 	)
+	// 条件请求命中（304）时没有响应正文，由调用方复用已有数据
+	if res.Response.StatusCode == http.StatusNotModified {
+		client.logRequest(ctx, method, url, res.Response, nil, time.Since(start))
+		return "", res.Response, nil
+	}
+
 	// 如果有错误
 	if res.Response.StatusCode < 200 || res.Response.StatusCode >= 300 {
 		decodeErr = json.Unmarshal([]byte(respBody), &errResp)
 		if decodeErr != nil {
-			util.Log().Debug("Onedrive返回未知响应[%s]", respBody)
-			return "", sysError(decodeErr)
+			client.log(ctx).Debug("Onedrive返回未知响应[%s]", respBody)
+			errResp = *sysError(decodeErr)
 		}
-		return "", &errResp
+		respErr := errResp.withResponse(res.Response)
+		client.logRequest(ctx, method, url, res.Response, respErr, time.Since(start))
+		return "", res.Response, respErr
 	}
 
-	return respBody, nil
+	client.logRequest(ctx, method, url, res.Response, nil, time.Since(start))
+	return respBody, res.Response, nil
 }
 
 func (client *Client) requestWithStr(ctx context.Context, method string, url string, body string, expectedCode int) (string, *RespError) {
 	// 发送请求
-	bodyReader := ioutil.NopCloser(strings.NewReader(body))
+	bodyReader := strings.NewReader(body)
 	return client.request(ctx, method, url, bodyReader,
 		request.WithContentLength(int64(len(body))),
+		request.WithTimeout(client.requestTimeout()),
 	)
 }
+
+// requestTimeout 返回控制类请求的超时时间，存储策略未指定或指定值无效时使用默认值
+func (client *Client) requestTimeout() time.Duration {
+	if client.Policy != nil && client.Policy.OptionsSerialized.OdRequestTimeout > 0 {
+		return time.Duration(client.Policy.OptionsSerialized.OdRequestTimeout) * time.Second
+	}
+	return DefaultRequestTimeout
+}
+
+// isThrottled 返回响应状态码是否表示请求被限流
+func isThrottled(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// rewindBody 将请求正文重置到起始位置以便重发，无法重置时返回 false
+func rewindBody(body io.Reader) bool {
+	if body == nil {
+		return true
+	}
+	if seeker, ok := body.(io.Seeker); ok {
+		_, err := seeker.Seek(0, io.SeekStart)
+		return err == nil
+	}
+	return false
+}
+
+// getRetryAfter 根据 Retry-After 头获取重试等待时间，不存在时使用带抖动的指数退避
+func getRetryAfter(header http.Header, retried int) time.Duration {
+	if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			if wait := time.Until(date); wait > 0 {
+				return wait
+			}
+			return 0
+		}
+	}
+
+	backoff := time.Duration(1<<uint(retried)) * time.Second
+	if backoff > MaxRetryBackoff {
+		backoff = MaxRetryBackoff
+	}
+	return backoff + time.Duration(rand.Int63n(int64(time.Second)))
+}
@@ -2,16 +2,21 @@ package onedrive
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
 	"github.com/stretchr/testify/assert"
 	testMock "github.com/stretchr/testify/mock"
@@ -131,6 +136,165 @@ func TestRequest(t *testing.T) {
 	}
 }
 
+func TestRequest_Throttled(t *testing.T) {
+	asserts := assert.New(t)
+	client := Client{
+		Policy:   &model.Policy{},
+		ClientID: "TestRequest_Throttled",
+		Credential: &Credential{
+			ExpiresIn:    time.Now().Add(time.Duration(100) * time.Hour).Unix(),
+			AccessToken:  "AccessToken",
+			RefreshToken: "RefreshToken",
+		},
+	}
+	cache.Set("setting_onedrive_throttle_retries", "3", 0)
+
+	// 被限流后重试成功
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			"http://dev.com",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 429,
+				Header:     http.Header{"Retry-After": {"0"}},
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error":{"code":"tooManyRequests"}}`)),
+			},
+		}).Once()
+		clientMock.On(
+			"Request",
+			"GET",
+			"http://dev.com",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`ok`)),
+			},
+		}).Once()
+		client.Request = clientMock
+		res, err := client.requestWithStr(context.Background(), "GET", "http://dev.com", "body", 200)
+		clientMock.AssertExpectations(t)
+		asserts.Nil(err)
+		asserts.Equal("ok", res)
+	}
+
+	// 超出重试次数
+	{
+		cache.Set("setting_onedrive_throttle_retries", "1", 0)
+		clientMock := ClientMock{}
+		for i := 0; i < 2; i++ {
+			clientMock.On(
+				"Request",
+				"GET",
+				"http://dev.com",
+				testMock.Anything,
+				testMock.Anything,
+			).Return(&request.Response{
+				Err: nil,
+				Response: &http.Response{
+					StatusCode: 503,
+					Header:     http.Header{"Retry-After": {"0"}},
+					Body:       ioutil.NopCloser(strings.NewReader(`{"error":{"code":"serviceNotAvailable"}}`)),
+				},
+			}).Once()
+		}
+		client.Request = clientMock
+		res, err := client.requestWithStr(context.Background(), "GET", "http://dev.com", "", 200)
+		clientMock.AssertExpectations(t)
+		asserts.Error(err)
+		asserts.Equal("serviceNotAvailable", err.APIError.Code)
+		asserts.Empty(res)
+		cache.Set("setting_onedrive_throttle_retries", "3", 0)
+	}
+
+	// 等待重试时上下文取消
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			"http://dev.com",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 429,
+				Header:     http.Header{"Retry-After": {"3600"}},
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error":{"code":"tooManyRequests"}}`)),
+			},
+		}).Once()
+		client.Request = clientMock
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Millisecond)
+		defer cancel()
+		res, err := client.requestWithStr(ctx, "GET", "http://dev.com", "", 200)
+		clientMock.AssertExpectations(t)
+		asserts.Error(err)
+		asserts.Equal(ErrClientCanceled.Error(), err.Error())
+		asserts.Empty(res)
+	}
+
+	// 正文无法重置，不重试
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"PUT",
+			"http://dev.com",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 429,
+				Header:     http.Header{"Retry-After": {"0"}},
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error":{"code":"tooManyRequests"}}`)),
+			},
+		}).Once()
+		client.Request = clientMock
+		res, err := client.request(context.Background(), "PUT", "http://dev.com", ioutil.NopCloser(strings.NewReader("body")))
+		clientMock.AssertExpectations(t)
+		asserts.Error(err)
+		asserts.Empty(res)
+	}
+}
+
+func TestGetRetryAfter(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 秒数
+	asserts.Equal(time.Duration(5)*time.Second, getRetryAfter(http.Header{"Retry-After": {"5"}}, 0))
+
+	// HTTP 日期
+	{
+		date := time.Now().Add(time.Duration(10) * time.Second).UTC().Format(http.TimeFormat)
+		wait := getRetryAfter(http.Header{"Retry-After": {date}}, 0)
+		asserts.True(wait > time.Duration(8)*time.Second && wait <= time.Duration(10)*time.Second)
+	}
+
+	// 已过去的 HTTP 日期
+	{
+		date := time.Now().Add(-time.Duration(10) * time.Second).UTC().Format(http.TimeFormat)
+		asserts.Equal(time.Duration(0), getRetryAfter(http.Header{"Retry-After": {date}}, 0))
+	}
+
+	// 指数退避
+	{
+		wait := getRetryAfter(http.Header{}, 2)
+		asserts.True(wait >= time.Duration(4)*time.Second && wait < time.Duration(5)*time.Second)
+		wait = getRetryAfter(http.Header{"Retry-After": {"invalid"}}, 10)
+		asserts.True(wait >= MaxRetryBackoff && wait < MaxRetryBackoff+time.Second)
+	}
+}
+
 func TestFileInfo_GetSourcePath(t *testing.T) {
 	asserts := assert.New(t)
 
@@ -155,6 +319,17 @@ func TestFileInfo_GetSourcePath(t *testing.T) {
 		}
 		asserts.Equal("", fileInfo.GetSourcePath())
 	}
+
+	// 共享驱动器
+	{
+		fileInfo := FileInfo{
+			Name: "a.jpg",
+			ParentReference: parentReference{
+				Path: "/drives/b!abc/root:/123/321",
+			},
+		}
+		asserts.Equal("123/321/a.jpg", fileInfo.GetSourcePath())
+	}
 }
 
 func TestClient_GetRequestURL(t *testing.T) {
@@ -168,6 +343,44 @@ func TestClient_GetRequestURL(t *testing.T) {
 	}
 }
 
+func TestClient_GetDriveRequestURL(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{Server: "https://graph.microsoft.com/v1.0/me"})
+
+	// 默认驱动器
+	{
+		asserts.Equal(
+			"https://graph.microsoft.com/v1.0/me/drive/root:/a.txt:/createUploadSession",
+			client.getDriveRequestURL("root:/a.txt:/createUploadSession"),
+		)
+		asserts.Equal("https://graph.microsoft.com/v1.0/me/drive/items/123", client.getDriveRequestURL("items/123"))
+		asserts.Equal("/drive/root:", client.getDriveRootPath())
+	}
+
+	// 指定驱动器ID
+	{
+		client, _ := NewClient(&model.Policy{
+			Server:            "https://graph.microsoft.com/v1.0/me/",
+			OptionsSerialized: model.PolicyOption{OdDriveID: "b!abc"},
+		})
+		asserts.Equal(
+			"https://graph.microsoft.com/v1.0/drives/b%21abc/root:/a.txt:/content",
+			client.getDriveRequestURL("root:/a.txt:/content"),
+		)
+		asserts.Equal("https://graph.microsoft.com/v1.0/drives/b%21abc/root/children", client.getDriveRequestURL("root/children"))
+		asserts.Equal("https://graph.microsoft.com/v1.0/drives/b%21abc/items/123", client.getDriveRequestURL("items/123"))
+		asserts.Equal("/drives/b!abc/root:", client.getDriveRootPath())
+		asserts.Contains(client.makeBatchDeleteRequestsBody([]string{"dir/a.txt"}), `"url":"/drives/b%21abc/root:/dir/a.txt"`)
+	}
+
+	// 出错
+	{
+		client, _ := NewClient(&model.Policy{OptionsSerialized: model.PolicyOption{OdDriveID: "b!abc"}})
+		client.Endpoints.EndpointURL = string([]byte{0x7f})
+		asserts.Equal("", client.getDriveRequestURL("root:/a.txt"))
+	}
+}
+
 func TestClient_Meta(t *testing.T) {
 	asserts := assert.New(t)
 	client, _ := NewClient(&model.Policy{})
@@ -232,6 +445,270 @@ func TestClient_Meta(t *testing.T) {
 	}
 }
 
+func TestClient_Move(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.AccessToken = "AccessToken"
+
+	// 请求失败
+	{
+		client.Credential.ExpiresIn = 0
+		res, err := client.Move(context.Background(), "/a.txt", "/b.txt")
+		asserts.Error(err)
+		asserts.Nil(res)
+	}
+
+	// 移动到子目录并重命名
+	{
+		client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"PATCH",
+			"drive/root:/dir/a.txt",
+			testMock.MatchedBy(func(body io.Reader) bool {
+				content, _ := ioutil.ReadAll(body)
+				return strings.Contains(string(content), `"path":"/drive/root:/new/sub"`) &&
+					strings.Contains(string(content), `"name":"b.txt"`)
+			}),
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"name":"b.txt"}`)),
+			},
+		})
+		client.Request = clientMock
+		res, err := client.Move(context.Background(), "/dir/a.txt", "/new/sub/b.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("b.txt", res.Name)
+	}
+
+	// 在根目录下重命名
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"PATCH",
+			"drive/root:/a.txt",
+			testMock.MatchedBy(func(body io.Reader) bool {
+				content, _ := ioutil.ReadAll(body)
+				return strings.Contains(string(content), `"path":"/drive/root:"`)
+			}),
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"name":"b.txt"}`)),
+			},
+		})
+		client.Request = clientMock
+		_, err := client.Move(context.Background(), "a.txt", "b.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+	}
+
+	// 目标已存在
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"PATCH",
+			testMock.Anything,
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 409,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error":{"code":"nameAlreadyExists"}}`)),
+			},
+		})
+		client.Request = clientMock
+		res, err := client.Move(context.Background(), "a.txt", "b.txt")
+		clientMock.AssertExpectations(t)
+		asserts.Error(err)
+		asserts.Nil(res)
+	}
+}
+
+func TestClient_Copy(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	// 请求失败
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			"drive/root:/a.txt:/copy?@microsoft.graph.conflictBehavior=fail",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: errors.New("error"),
+		})
+		client.Request = clientMock
+		res, err := client.Copy(context.Background(), "/a.txt", "/b.txt")
+		clientMock.AssertExpectations(t)
+		asserts.Error(err)
+		asserts.Empty(res)
+	}
+
+	// 未返回监控地址
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			testMock.Anything,
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 202,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(strings.NewReader(``)),
+			},
+		})
+		client.Request = clientMock
+		res, err := client.Copy(context.Background(), "/a.txt", "/b.txt")
+		clientMock.AssertExpectations(t)
+		asserts.Equal(ErrCopyFailed, err)
+		asserts.Empty(res)
+	}
+
+	// 成功，指定重名处理方式
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			"drive/root:/a.txt:/copy?@microsoft.graph.conflictBehavior=rename",
+			testMock.MatchedBy(func(body io.Reader) bool {
+				content, _ := ioutil.ReadAll(body)
+				return strings.Contains(string(content), `"path":"/drive/root:/dir"`) &&
+					strings.Contains(string(content), `"name":"b.txt"`)
+			}),
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 202,
+				Header:     http.Header{"Location": {"http://monitor"}},
+				Body:       ioutil.NopCloser(strings.NewReader(``)),
+			},
+		})
+		client.Request = clientMock
+		res, err := client.Copy(context.Background(), "/a.txt", "/dir/b.txt", WithConflictBehavior("rename"))
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("http://monitor", res)
+	}
+}
+
+func TestClient_WaitCopy(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	cache.Set("setting_onedrive_copy_check", "0", 0)
+
+	monitorResponse := func(code int, body string) *request.Response {
+		return &request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: code,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			},
+		}
+	}
+
+	// 轮询直到完成
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "http://monitor", testMock.Anything, testMock.Anything).
+			Return(monitorResponse(202, `{"status":"inProgress","percentageComplete":50}`)).Once()
+		clientMock.On("Request", "GET", "http://monitor", testMock.Anything, testMock.Anything).
+			Return(monitorResponse(200, `{"status":"completed","resourceId":"123"}`)).Once()
+		client.Request = clientMock
+		err := client.WaitCopy(context.Background(), "http://monitor")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+	}
+
+	// 重定向到新文件
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "http://monitor", testMock.Anything, testMock.Anything).
+			Return(monitorResponse(200, `{"id":"123","name":"b.txt"}`))
+		client.Request = clientMock
+		err := client.WaitCopy(context.Background(), "http://monitor")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+	}
+
+	// 复制失败
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "http://monitor", testMock.Anything, testMock.Anything).
+			Return(monitorResponse(200, `{"status":"failed","error":{"code":"nameAlreadyExists"}}`))
+		client.Request = clientMock
+		err := client.WaitCopy(context.Background(), "http://monitor")
+		clientMock.AssertExpectations(t)
+		asserts.Error(err)
+		asserts.Equal("nameAlreadyExists", err.(*RespError).APIError.Code)
+	}
+
+	// 监控地址失效
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "http://monitor", testMock.Anything, testMock.Anything).
+			Return(monitorResponse(404, `{"error":{"code":"itemNotFound"}}`))
+		client.Request = clientMock
+		err := client.WaitCopy(context.Background(), "http://monitor")
+		asserts.Error(err)
+		asserts.Equal("itemNotFound", err.(*RespError).APIError.Code)
+	}
+
+	// 无法识别的错误响应
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "http://monitor", testMock.Anything, testMock.Anything).
+			Return(monitorResponse(500, `???`))
+		client.Request = clientMock
+		err := client.WaitCopy(context.Background(), "http://monitor")
+		asserts.Equal(ErrCopyFailed, err)
+	}
+
+	// 无法解析状态
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "http://monitor", testMock.Anything, testMock.Anything).
+			Return(monitorResponse(200, `???`))
+		client.Request = clientMock
+		err := client.WaitCopy(context.Background(), "http://monitor")
+		asserts.Error(err)
+	}
+
+	// 上下文取消
+	{
+		cache.Set("setting_onedrive_copy_check", "10", 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "http://monitor", testMock.Anything, testMock.Anything).
+			Return(monitorResponse(202, `{"status":"inProgress"}`))
+		client.Request = clientMock
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := client.WaitCopy(ctx, "http://monitor")
+		asserts.Equal(ErrClientCanceled, err)
+	}
+}
+
 func TestClient_CreateUploadSession(t *testing.T) {
 	asserts := assert.New(t)
 	client, _ := NewClient(&model.Policy{})
@@ -328,15 +805,65 @@ func TestClient_GetUploadSessionStatus(t *testing.T) {
 			},
 		})
 		client.Request = clientMock
-		res, err := client.GetUploadSessionStatus(context.Background(), "http://dev.com")
+		res, err := client.GetUploadSessionStatus(context.Background(), "http://dev.com")
+		clientMock.AssertExpectations(t)
+		asserts.Error(err)
+		asserts.Nil(res)
+	}
+
+	// 返回正常
+	{
+		client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			"http://dev.com",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"uploadUrl":"123321"}`)),
+			},
+		})
+		client.Request = clientMock
+		res, err := client.GetUploadSessionStatus(context.Background(), "http://dev.com")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.NotNil(res)
+		asserts.Equal("123321", res.UploadURL)
+	}
+}
+
+func TestClient_GetUploadStatus(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	// 请求失败
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			"http://dev.com",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: errors.New("error"),
+		})
+		client.Request = clientMock
+		res, err := client.GetUploadStatus(context.Background(), "http://dev.com")
 		clientMock.AssertExpectations(t)
 		asserts.Error(err)
 		asserts.Nil(res)
 	}
 
-	// 返回正常
+	// 中间有未接收的范围
 	{
-		client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
 		clientMock := ClientMock{}
 		clientMock.On(
 			"Request",
@@ -348,15 +875,50 @@ func TestClient_GetUploadSessionStatus(t *testing.T) {
 			Err: nil,
 			Response: &http.Response{
 				StatusCode: 200,
-				Body:       ioutil.NopCloser(strings.NewReader(`{"uploadUrl":"123321"}`)),
+				Body: ioutil.NopCloser(strings.NewReader(
+					`{"expirationDateTime":"2015-01-29T09:21:55.523Z","nextExpectedRanges":["1000-1999","3000-"]}`,
+				)),
 			},
 		})
 		client.Request = clientMock
-		res, err := client.GetUploadSessionStatus(context.Background(), "http://dev.com")
+		res, err := client.GetUploadStatus(context.Background(), "http://dev.com")
 		clientMock.AssertExpectations(t)
 		asserts.NoError(err)
-		asserts.NotNil(res)
-		asserts.Equal("123321", res.UploadURL)
+		asserts.Equal([]string{"1000-1999", "3000-"}, res)
+
+		offset, err := ResumeOffset(res)
+		asserts.NoError(err)
+		asserts.EqualValues(1000, offset)
+	}
+}
+
+func TestResumeOffset(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 未开始上传
+	{
+		offset, err := ResumeOffset([]string{"0-"})
+		asserts.NoError(err)
+		asserts.EqualValues(0, offset)
+	}
+
+	// 仅剩末尾
+	{
+		offset, err := ResumeOffset([]string{"12345-"})
+		asserts.NoError(err)
+		asserts.EqualValues(12345, offset)
+	}
+
+	// 无待接收范围
+	{
+		_, err := ResumeOffset(nil)
+		asserts.Equal(ErrInvalidUploadRange, err)
+	}
+
+	// 格式错误
+	{
+		_, err := ResumeOffset([]string{"abc-"})
+		asserts.Equal(ErrInvalidUploadRange, err)
 	}
 }
 
@@ -556,6 +1118,219 @@ func TestClient_Upload(t *testing.T) {
 		asserts.Error(err)
 	}
 
+	// 分片上传，分片边界对齐
+	{
+		client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		chunks := make([]int, 0)
+		client.Request = uploadChunkRecorder{chunks: &chunks}
+		size := 2*int(ChunkSize) + 1234
+		err := client.Upload(context.Background(), "123.jpg", size, strings.NewReader(strings.Repeat("1", size)))
+		asserts.NoError(err)
+		asserts.Equal([]int{int(ChunkSize), int(ChunkSize), 1234}, chunks)
+		offset := 0
+		for i, chunk := range chunks {
+			asserts.Zero(offset%int(ChunkAlignment), "Chunk #%d", i)
+			if i != len(chunks)-1 {
+				asserts.Zero(chunk%int(ChunkAlignment), "Chunk #%d", i)
+			}
+			offset += chunk
+		}
+		asserts.Equal(size, offset)
+	}
+
+	// 分片上传，文件流读取失败
+	{
+		client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		chunks := make([]int, 0)
+		client.Request = uploadChunkRecorder{chunks: &chunks}
+		err := client.Upload(context.Background(), "123.jpg", 15*1024*1024, strings.NewReader("123"))
+		asserts.Error(err)
+		asserts.Empty(chunks)
+	}
+}
+
+func TestClient_Upload_Progress(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	var reported [][2]uint64
+	ctx := context.WithValue(context.Background(), fsctx.ProgressCallbackCtx, fsctx.ProgressCallback(
+		func(transferred, total uint64) {
+			reported = append(reported, [2]uint64{transferred, total})
+		},
+	))
+
+	// 小文件，上传完成后报告一次
+	{
+		reported = nil
+		chunks := make([]int, 0)
+		client.Request = uploadChunkRecorder{chunks: &chunks}
+		err := client.Upload(ctx, "123.jpg", 3, strings.NewReader("123"))
+		asserts.NoError(err)
+		asserts.Equal([][2]uint64{{3, 3}}, reported)
+	}
+
+	// 分片上传，每个分片完成后报告
+	{
+		reported = nil
+		chunks := make([]int, 0)
+		client.Request = uploadChunkRecorder{chunks: &chunks}
+		size := uint64(2*ChunkSize + 1234)
+		err := client.Upload(ctx, "123.jpg", int(size), strings.NewReader(strings.Repeat("1", int(size))))
+		asserts.NoError(err)
+		asserts.Equal([][2]uint64{{ChunkSize, size}, {2 * ChunkSize, size}, {size, size}}, reported)
+	}
+
+	// 上传失败时不报告
+	{
+		reported = nil
+		client.Credential.ExpiresIn = 0
+		err := client.Upload(ctx, "123.jpg", 3, strings.NewReader("123"))
+		asserts.Error(err)
+		asserts.Empty(reported)
+	}
+}
+
+func TestClient_Upload_Verify(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_verify_upload", "1", 0)
+	defer cache.Set("setting_onedrive_verify_upload", "0", 0)
+
+	hashOf := func(content string) string {
+		hasher := NewQuickXorHash()
+		hasher.Write([]byte(content))
+		return base64.StdEncoding.EncodeToString(hasher.Sum(nil))
+	}
+	withHash := func(hash string) string {
+		return `{"id":"1","file":{"hashes":{"quickXorHash":"` + hash + `"}}}`
+	}
+
+	// 小文件，校验通过
+	{
+		chunks := make([]int, 0)
+		client.Request = uploadChunkRecorder{chunks: &chunks, putResponse: withHash(hashOf("123"))}
+		err := client.Upload(context.Background(), "123.jpg", 3, strings.NewReader("123"))
+		asserts.NoError(err)
+	}
+
+	// 小文件，校验值不一致
+	{
+		chunks := make([]int, 0)
+		client.Request = uploadChunkRecorder{chunks: &chunks, putResponse: withHash(hashOf("321"))}
+		err := client.Upload(context.Background(), "123.jpg", 3, strings.NewReader("123"))
+		asserts.Equal(ErrChecksumMismatch, err)
+	}
+
+	// 未返回校验值，跳过校验
+	{
+		chunks := make([]int, 0)
+		client.Request = uploadChunkRecorder{chunks: &chunks, putResponse: `{"id":"1"}`}
+		err := client.Upload(context.Background(), "123.jpg", 3, strings.NewReader("123"))
+		asserts.NoError(err)
+	}
+
+	// 分片上传，使用最后一个分片的响应校验
+	size := int(ChunkSize) + 1234
+	content := strings.Repeat("1", size)
+	{
+		chunks := make([]int, 0)
+		client.Request = uploadChunkRecorder{chunks: &chunks, putResponse: withHash(hashOf(content))}
+		err := client.Upload(context.Background(), "123.jpg", size, strings.NewReader(content))
+		asserts.NoError(err)
+		asserts.Len(chunks, 2)
+	}
+
+	// 分片上传，校验值不一致
+	{
+		chunks := make([]int, 0)
+		client.Request = uploadChunkRecorder{chunks: &chunks, putResponse: withHash(hashOf("1"))}
+		err := client.Upload(context.Background(), "123.jpg", size, strings.NewReader(content))
+		asserts.Equal(ErrChecksumMismatch, err)
+	}
+
+	// 未开启校验
+	{
+		cache.Set("setting_onedrive_verify_upload", "0", 0)
+		chunks := make([]int, 0)
+		client.Request = uploadChunkRecorder{chunks: &chunks, putResponse: withHash(hashOf("1"))}
+		err := client.Upload(context.Background(), "123.jpg", 3, strings.NewReader("123"))
+		asserts.NoError(err)
+	}
+}
+
+func TestAlignChunkSize(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.Equal(ChunkAlignment, alignChunkSize(0))
+	asserts.Equal(ChunkAlignment, alignChunkSize(ChunkAlignment+1))
+	asserts.Equal(2*ChunkAlignment, alignChunkSize(3*ChunkAlignment-1))
+	asserts.Equal(ChunkSize, alignChunkSize(ChunkSize))
+}
+
+func TestClient_ChunkSize(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+
+	// 未设置时使用默认值
+	asserts.Equal(ChunkSize, client.chunkSize())
+
+	// 向下对齐到 320 KiB
+	client.Policy.OptionsSerialized.OdChunkSize = 10 * 1000 * 1024
+	asserts.Equal(31*ChunkAlignment, client.chunkSize())
+	asserts.EqualValues(9.6875*1024*1024, client.chunkSize())
+
+	// 超出上下限
+	client.Policy.OptionsSerialized.OdChunkSize = 1
+	asserts.Equal(ChunkAlignment, client.chunkSize())
+	client.Policy.OptionsSerialized.OdChunkSize = 1 << 30
+	asserts.Equal(MaxChunkSize, client.chunkSize())
+	asserts.Zero(MaxChunkSize % ChunkAlignment)
+}
+
+func TestClient_Upload_ChunkSize(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{OptionsSerialized: model.PolicyOption{OdChunkSize: 10 * 1000 * 1024}})
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+
+	// 按对齐后的分片大小上传，最后一个分片为剩余部分
+	chunks := make([]int, 0)
+	client.Request = uploadChunkRecorder{chunks: &chunks}
+	aligned := int(31 * ChunkAlignment)
+	size := 2*aligned + 1234
+	err := client.Upload(context.Background(), "123.jpg", size, strings.NewReader(strings.Repeat("1", size)))
+	asserts.NoError(err)
+	asserts.Equal([]int{aligned, aligned, 1234}, chunks)
+}
+
+// uploadChunkRecorder 模拟上传会话，记录每次上传的分片大小
+type uploadChunkRecorder struct {
+	chunks *[]int
+	// 分片上传请求的响应正文，为空时返回 {}
+	putResponse string
+}
+
+func (m uploadChunkRecorder) Request(method, target string, body io.Reader, opts ...request.Option) *request.Response {
+	resBody := `{"uploadUrl":"http://upload.com"}`
+	if method == "PUT" {
+		data, _ := ioutil.ReadAll(body)
+		*m.chunks = append(*m.chunks, len(data))
+		resBody = `{}`
+		if m.putResponse != "" {
+			resBody = m.putResponse
+		}
+	}
+	return &request.Response{
+		Response: &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(resBody)),
+		},
+	}
 }
 
 func TestClient_SimpleUpload(t *testing.T) {
@@ -689,6 +1464,128 @@ func TestClient_BatchDelete(t *testing.T) {
 		asserts.Error(err)
 		asserts.Equal([]string{"2"}, res)
 	}
+
+	// 45个，分为三组
+	{
+		var batches []int
+		client.Request = batchDeleteRecorder{batches: &batches}
+		files := make([]string, 45)
+		for i := range files {
+			files[i] = fmt.Sprintf("%d.txt", i)
+		}
+		res, err := client.BatchDelete(context.Background(), files)
+		asserts.NoError(err)
+		asserts.Empty(res)
+		asserts.Equal([]int{20, 20, 5}, batches)
+	}
+
+	// 恰好40个，不发送空的分组
+	{
+		var batches []int
+		client.Request = batchDeleteRecorder{batches: &batches}
+		files := make([]string, 40)
+		for i := range files {
+			files[i] = fmt.Sprintf("%d.txt", i)
+		}
+		res, err := client.BatchDelete(context.Background(), files)
+		asserts.NoError(err)
+		asserts.Empty(res)
+		asserts.Equal([]int{20, 20}, batches)
+	}
+
+	// 无文件
+	{
+		var batches []int
+		client.Request = batchDeleteRecorder{batches: &batches}
+		res, err := client.BatchDelete(context.Background(), []string{})
+		asserts.NoError(err)
+		asserts.Empty(res)
+		asserts.Empty(batches)
+	}
+
+	// 前面的分组失败，后面的分组成功，仍返回错误及失败的文件
+	{
+		var batches []int
+		client.Request = batchDeleteRecorder{batches: &batches, failed: "3.txt"}
+		files := make([]string, 25)
+		for i := range files {
+			files[i] = fmt.Sprintf("%d.txt", i)
+		}
+		res, err := client.BatchDelete(context.Background(), files)
+		asserts.Equal(ErrDeleteFile, err)
+		asserts.Equal([]string{"3.txt"}, res)
+		asserts.Equal([]int{20, 5}, batches)
+	}
+
+	// 第一组完成后取消，不再发送后续分组
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			testMock.Anything,
+			testMock.Anything,
+			testMock.Anything,
+		).Run(func(args testMock.Arguments) {
+			cancel()
+		}).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"responses":[]}`)),
+			},
+		}).Once()
+		client.Request = clientMock
+		files := make([]string, 45)
+		for i := range files {
+			files[i] = fmt.Sprintf("%d.txt", i)
+		}
+		res, err := client.BatchDelete(ctx, files)
+		clientMock.AssertExpectations(t)
+		asserts.Equal(context.Canceled, err)
+		asserts.Equal(files[20:], res)
+	}
+
+	// 已取消时不发送请求
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		clientMock := ClientMock{}
+		client.Request = clientMock
+		res, err := client.BatchDelete(ctx, []string{"1.txt"})
+		clientMock.AssertExpectations(t)
+		asserts.Equal(context.Canceled, err)
+		asserts.Equal([]string{"1.txt"}, res)
+	}
+}
+
+// batchDeleteRecorder 记录每个批量删除请求中包含的请求数，文件 failed 删除失败
+type batchDeleteRecorder struct {
+	batches *[]int
+	failed  string
+}
+
+func (m batchDeleteRecorder) Request(method, target string, body io.Reader, opts ...request.Option) *request.Response {
+	var req BatchRequests
+	data, _ := ioutil.ReadAll(body)
+	json.Unmarshal(data, &req)
+	*m.batches = append(*m.batches, len(req.Requests))
+
+	responses := make([]string, 0, len(req.Requests))
+	for _, r := range req.Requests {
+		status := 204
+		if m.failed != "" && r.ID == m.failed {
+			status = 400
+		}
+		responses = append(responses, fmt.Sprintf(`{"id":"%s","status":%d}`, r.ID, status))
+	}
+	return &request.Response{
+		Response: &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"responses":[` + strings.Join(responses, ",") + `]}`)),
+		},
+	}
 }
 
 func TestClient_Delete(t *testing.T) {
@@ -753,6 +1650,49 @@ func TestClient_Delete(t *testing.T) {
 	}
 }
 
+func TestClient_requestTimeout(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 未指定或指定值无效时使用默认值
+	{
+		client := Client{}
+		asserts.Equal(DefaultRequestTimeout, client.requestTimeout())
+		for _, timeout := range []int{0, -5} {
+			client := Client{Policy: &model.Policy{}}
+			client.Policy.OptionsSerialized.OdRequestTimeout = timeout
+			asserts.Equal(DefaultRequestTimeout, client.requestTimeout())
+		}
+	}
+
+	// 使用存储策略指定的超时
+	{
+		client := Client{Policy: &model.Policy{}}
+		client.Policy.OptionsSerialized.OdRequestTimeout = 10
+		asserts.Equal(time.Duration(10)*time.Second, client.requestTimeout())
+	}
+
+	// 控制类请求超时
+	{
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Duration(2) * time.Second)
+			w.Write([]byte(`{"name":"123"}`))
+		}))
+		defer server.Close()
+
+		policy := &model.Policy{Server: server.URL}
+		policy.OptionsSerialized.OdRequestTimeout = 1
+		client, _ := NewClient(policy)
+		client.Credential.AccessToken = "AccessToken"
+		client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+		start := time.Now()
+		res, err := client.Meta(context.Background(), "", "123")
+		asserts.Error(err)
+		asserts.Nil(res)
+		asserts.True(time.Since(start) < time.Duration(2)*time.Second)
+	}
+}
+
 func TestClient_ListChildren(t *testing.T) {
 	asserts := assert.New(t)
 	client, _ := NewClient(&model.Policy{})
@@ -811,6 +1751,58 @@ func TestClient_ListChildren(t *testing.T) {
 		asserts.NoError(err)
 		asserts.Len(res, 1)
 	}
+
+	// 多页结果，成功
+	{
+		client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			"drive/root:/uploads:/children?$top=999999999",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"value":[{"name":"1"}],"@odata.nextLink":"https://graph.microsoft.com/v1.0/next"}`)),
+			},
+		})
+		clientMock.On(
+			"Request",
+			"GET",
+			"https://graph.microsoft.com/v1.0/next",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"value":[{"name":"2"},{"name":"3"}]}`)),
+			},
+		})
+		client.Request = clientMock
+		res, err := client.ListChildren(context.Background(), "/uploads")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Len(res, 3)
+		asserts.Equal("1", res[0].Name)
+		asserts.Equal("3", res[2].Name)
+	}
+
+	// 上下文已取消
+	{
+		client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		clientMock := ClientMock{}
+		client.Request = clientMock
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		res, err := client.ListChildren(ctx, "/uploads")
+		clientMock.AssertNotCalled(t, "Request", testMock.Anything, testMock.Anything, testMock.Anything, testMock.Anything)
+		asserts.Equal(ErrClientCanceled, err)
+		asserts.Empty(res)
+	}
 }
 
 func TestClient_GetThumbURL(t *testing.T) {
@@ -896,6 +1888,31 @@ func TestClient_GetThumbURL(t *testing.T) {
 		asserts.NoError(err)
 		asserts.Equal("thumb", res)
 	}
+
+	// 预定义尺寸 成功
+	{
+		client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		client.Endpoints.isInChina = false
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			"drive/root:/123,jpg:/thumbnails/0/medium",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"url":"thumb"}`)),
+			},
+		})
+		client.Request = clientMock
+		res, err := client.GetThumbURL(context.Background(), "123,jpg", 176, 176)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("thumb", res)
+	}
 }
 
 func TestClient_MonitorUpload(t *testing.T) {
@@ -912,7 +1929,7 @@ func TestClient_MonitorUpload(t *testing.T) {
 				time.Sleep(time.Duration(1) * time.Second)
 				FinishCallback("key")
 			}()
-			client.MonitorUpload("url", "key", "path", 10, 10)
+			client.MonitorUpload(context.Background(), "url", "key", "path", 10, 10)
 		})
 	}
 
@@ -921,7 +1938,7 @@ func TestClient_MonitorUpload(t *testing.T) {
 		cache.Set("setting_onedrive_monitor_timeout", "600", 0)
 		cache.Set("setting_onedrive_callback_check", "20", 0)
 		asserts.NotPanics(func() {
-			client.MonitorUpload("url", "key", "path", 10, 0)
+			client.MonitorUpload(context.Background(), "url", "key", "path", 10, 0)
 		})
 	}
 
@@ -964,7 +1981,7 @@ func TestClient_MonitorUpload(t *testing.T) {
 		cache.Set("callback_key3", "ok", 0)
 
 		asserts.NotPanics(func() {
-			client.MonitorUpload("url", "key3", "path", 10, 10)
+			client.MonitorUpload(context.Background(), "url", "key3", "path", 10, 10)
 		})
 
 		clientMock.AssertExpectations(t)
@@ -1021,7 +2038,7 @@ func TestClient_MonitorUpload(t *testing.T) {
 		client.Request = clientMock
 
 		asserts.NotPanics(func() {
-			client.MonitorUpload("url", "key4", "path", 10, 10)
+			client.MonitorUpload(context.Background(), "url", "key4", "path", 10, 10)
 		})
 
 		clientMock.AssertExpectations(t)
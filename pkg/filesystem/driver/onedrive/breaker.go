@@ -0,0 +1,197 @@
+package onedrive
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+)
+
+// circuitState 熔断器状态
+type circuitState int
+
+const (
+	// circuitClosed 正常放行请求
+	circuitClosed circuitState = iota
+	// circuitOpen 已熔断，冷却期内的请求直接失败
+	circuitOpen
+	// circuitHalfOpen 冷却期已过，放行一个试探请求以检测是否恢复
+	circuitHalfOpen
+)
+
+// circuitBreakers 各存储策略的熔断器，同一策略的所有客户端共享
+var circuitBreakers sync.Map
+
+// circuitBreaker 熔断器。窗口期内连续出现指定次数的可用性错误后熔断，冷却期内的请求
+// 直接返回 ErrCircuitOpen，而不必等待完整的超时时间；冷却期过后放行一个试探请求，
+// 成功则恢复，失败则重新进入冷却期
+type circuitBreaker struct {
+	mu    sync.Mutex
+	state circuitState
+	// failures 当前窗口期内连续失败的次数
+	failures    int
+	windowStart time.Time
+	openUntil   time.Time
+	// probing 半开状态下是否已有试探请求在进行
+	probing bool
+	now     func() time.Time
+}
+
+// breakerSettings 熔断器参数
+type breakerSettings struct {
+	// threshold 触发熔断的连续失败次数，为 0 时不熔断
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{now: time.Now}
+}
+
+// getBreakerSettings 获取熔断器参数
+func getBreakerSettings() breakerSettings {
+	return breakerSettings{
+		threshold: model.GetIntSetting("onedrive_breaker_threshold", 5),
+		window:    time.Duration(model.GetIntSetting("onedrive_breaker_window", 60)) * time.Second,
+		cooldown:  time.Duration(model.GetIntSetting("onedrive_breaker_cooldown", 30)) * time.Second,
+	}
+}
+
+// breaker 获取存储策略的熔断器。尚未保存的存储策略（如添加策略时测试连接）不使用熔断器
+func (client *Client) breaker() *circuitBreaker {
+	if client.Policy == nil || client.Policy.ID == 0 {
+		return nil
+	}
+	b, _ := circuitBreakers.LoadOrStore(client.Policy.ID, newCircuitBreaker())
+	return b.(*circuitBreaker)
+}
+
+// allow 返回是否放行请求。冷却期已过时转为半开状态，仅放行一个试探请求
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if b.now().Before(b.openUntil) {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		return true
+	case circuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// success 记录请求成功，熔断器恢复为闭合状态。返回熔断器是否由此恢复
+func (b *circuitBreaker) success() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	recovered := b.state != circuitClosed
+	b.state = circuitClosed
+	b.failures = 0
+	b.probing = false
+	return recovered
+}
+
+// failure 记录一次可用性错误，返回熔断器是否由此熔断
+func (b *circuitBreaker) failure(settings breakerSettings) bool {
+	if b == nil || settings.threshold <= 0 {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if b.state == circuitHalfOpen {
+		b.trip(now, settings.cooldown)
+		return true
+	}
+	if b.state == circuitOpen {
+		return false
+	}
+
+	if b.failures == 0 || now.Sub(b.windowStart) > settings.window {
+		b.failures = 0
+		b.windowStart = now
+	}
+	b.failures++
+	if b.failures >= settings.threshold {
+		b.trip(now, settings.cooldown)
+		return true
+	}
+	return false
+}
+
+// release 请求被取消，结果无法说明服务是否可用，仅释放试探请求的名额
+func (b *circuitBreaker) release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) trip(now time.Time, cooldown time.Duration) {
+	b.state = circuitOpen
+	b.openUntil = now.Add(cooldown)
+	b.failures = 0
+	b.probing = false
+}
+
+// isUnavailable 返回请求结果是否表示 OneDrive 不可用：未收到完整响应或服务端返回 5xx 错误。
+// 认证失败、文件不存在等客户端错误说明服务仍可正常响应，不计入熔断；带有 Retry-After
+// 的 503 响应表示请求被限流，同样不计入
+func isUnavailable(resp *http.Response, err *RespError) bool {
+	if err == nil {
+		return false
+	}
+	if resp == nil || resp.StatusCode < 300 {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusServiceUnavailable:
+		return resp.Header.Get("Retry-After") == ""
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// recordResult 将请求结果计入熔断器
+func (client *Client) recordResult(ctx context.Context, b *circuitBreaker, resp *http.Response, err *RespError) {
+	if b == nil {
+		return
+	}
+	if ctx.Err() != nil {
+		b.release()
+		return
+	}
+	if !isUnavailable(resp, err) {
+		if b.success() {
+			client.log(ctx).Debug("OneDrive 接口已恢复，存储策略[%d]的熔断器闭合", client.Policy.ID)
+		}
+		return
+	}
+	settings := getBreakerSettings()
+	if b.failure(settings) {
+		client.log(ctx).Warning("OneDrive 接口连续请求失败，存储策略[%d]的请求将暂停 %s", client.Policy.ID, settings.cooldown)
+	}
+}
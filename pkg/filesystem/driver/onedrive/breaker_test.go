@@ -0,0 +1,210 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	asserts := assert.New(t)
+	now := time.Now()
+	b := newCircuitBreaker()
+	b.now = func() time.Time { return now }
+	settings := breakerSettings{threshold: 3, window: time.Minute, cooldown: 30 * time.Second}
+
+	// 闭合状态下失败次数未达阈值，成功后重新计数
+	{
+		asserts.True(b.allow())
+		asserts.False(b.failure(settings))
+		asserts.False(b.failure(settings))
+		asserts.False(b.success())
+		asserts.False(b.failure(settings))
+		asserts.False(b.failure(settings))
+		asserts.Equal(circuitClosed, b.state)
+	}
+
+	// 超出窗口期的失败重新计数
+	{
+		now = now.Add(2 * time.Minute)
+		asserts.False(b.failure(settings))
+		asserts.Equal(circuitClosed, b.state)
+		asserts.Equal(1, b.failures)
+	}
+
+	// 连续失败达到阈值后熔断，冷却期内不放行请求
+	{
+		asserts.False(b.failure(settings))
+		asserts.True(b.failure(settings))
+		asserts.Equal(circuitOpen, b.state)
+		asserts.False(b.allow())
+		now = now.Add(29 * time.Second)
+		asserts.False(b.allow())
+	}
+
+	// 冷却期过后半开，仅放行一个试探请求，试探失败重新熔断
+	{
+		now = now.Add(time.Second)
+		asserts.True(b.allow())
+		asserts.Equal(circuitHalfOpen, b.state)
+		asserts.False(b.allow())
+		asserts.True(b.failure(settings))
+		asserts.Equal(circuitOpen, b.state)
+		asserts.False(b.allow())
+	}
+
+	// 试探请求被取消，放行下一个试探请求
+	{
+		now = now.Add(30 * time.Second)
+		asserts.True(b.allow())
+		b.release()
+		asserts.Equal(circuitHalfOpen, b.state)
+		asserts.True(b.allow())
+		asserts.False(b.allow())
+	}
+
+	// 试探成功后恢复闭合
+	{
+		asserts.True(b.success())
+		asserts.Equal(circuitClosed, b.state)
+		asserts.True(b.allow())
+		asserts.True(b.allow())
+		asserts.False(b.failure(settings))
+	}
+
+	// 阈值为 0 时不熔断
+	{
+		b := newCircuitBreaker()
+		for i := 0; i < 10; i++ {
+			asserts.False(b.failure(breakerSettings{}))
+		}
+		asserts.True(b.allow())
+	}
+
+	// 未保存的存储策略不使用熔断器
+	{
+		var nilBreaker *circuitBreaker
+		asserts.True(nilBreaker.allow())
+		asserts.False(nilBreaker.failure(settings))
+		client, _ := NewClient(&model.Policy{})
+		asserts.Nil(client.breaker())
+	}
+}
+
+func TestIsUnavailable(t *testing.T) {
+	asserts := assert.New(t)
+	response := func(status int, header http.Header) *http.Response {
+		return &http.Response{StatusCode: status, Header: header}
+	}
+	asserts.False(isUnavailable(response(500, nil), nil))
+	asserts.True(isUnavailable(nil, sysError(errors.New("timeout"))))
+	asserts.True(isUnavailable(response(200, nil), sysError(errors.New("unexpected EOF"))))
+	asserts.True(isUnavailable(response(500, nil), &RespError{}))
+	asserts.True(isUnavailable(response(504, nil), &RespError{}))
+	asserts.True(isUnavailable(response(503, http.Header{}), &RespError{}))
+	asserts.False(isUnavailable(response(503, http.Header{"Retry-After": {"10"}}), &RespError{}))
+	asserts.False(isUnavailable(response(401, nil), &RespError{}))
+	asserts.False(isUnavailable(response(403, nil), &RespError{}))
+	asserts.False(isUnavailable(response(404, nil), &RespError{}))
+	asserts.False(isUnavailable(response(429, nil), &RespError{}))
+}
+
+// countingClientMock 记录请求次数，每次请求返回 respond 生成的响应
+type countingClientMock struct {
+	calls   *int32
+	respond func() *request.Response
+}
+
+func (m countingClientMock) Request(method, target string, body io.Reader, opts ...request.Option) *request.Response {
+	atomic.AddInt32(m.calls, 1)
+	return m.respond()
+}
+
+func TestClient_Request_CircuitBreaker(t *testing.T) {
+	asserts := assert.New(t)
+	policy := &model.Policy{}
+	policy.ID = 86
+	client, _ := NewClient(policy)
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_etag_cache_ttl", "0", 0)
+	cache.Set("setting_onedrive_breaker_threshold", "2", 0)
+	cache.Set("setting_onedrive_breaker_window", "60", 0)
+	cache.Set("setting_onedrive_breaker_cooldown", "30", 0)
+	now := time.Now()
+	client.breaker().now = func() time.Time { return now }
+	respond := func(status int, body string) func() *request.Response {
+		return func() *request.Response {
+			return &request.Response{
+				Response: &http.Response{
+					StatusCode: status,
+					Header:     http.Header{},
+					Body:       ioutil.NopCloser(strings.NewReader(body)),
+				},
+			}
+		}
+	}
+
+	// 认证错误不触发熔断
+	{
+		var calls int32
+		client.Request = countingClientMock{calls: &calls, respond: respond(403, `{"error":{"code":"accessDenied","message":"denied"}}`)}
+		for i := 0; i < 3; i++ {
+			_, err := client.Meta(context.Background(), "", "auth.txt")
+			asserts.Error(err)
+		}
+		asserts.EqualValues(3, calls)
+		asserts.Equal(circuitClosed, client.breaker().state)
+	}
+
+	// 连续的可用性错误触发熔断，此后请求直接失败
+	{
+		var calls int32
+		clientMock := countingClientMock{calls: &calls, respond: func() *request.Response {
+			return &request.Response{Err: errors.New("timeout")}
+		}}
+		client.Request = clientMock
+		for i := 0; i < 3; i++ {
+			_, err := client.Meta(context.Background(), "", "a.txt")
+			asserts.Error(err)
+		}
+		asserts.EqualValues(2, calls)
+		_, err := client.Meta(context.Background(), "", "a.txt")
+		asserts.Contains(err.Error(), ErrCircuitOpen.Error())
+		asserts.Equal(circuitOpen, client.breaker().state)
+
+		// 同一存储策略的其他客户端共享熔断状态
+		other, _ := NewClient(policy)
+		other.Credential = client.Credential
+		other.Request = clientMock
+		_, err = other.Meta(context.Background(), "", "a.txt")
+		asserts.Contains(err.Error(), ErrCircuitOpen.Error())
+		asserts.EqualValues(2, calls)
+	}
+
+	// 冷却期过后试探请求成功，恢复闭合
+	{
+		now = now.Add(31 * time.Second)
+		var calls int32
+		client.Request = countingClientMock{calls: &calls, respond: respond(200, `{"name":"a.txt"}`)}
+		res, err := client.Meta(context.Background(), "", "a.txt")
+		asserts.NoError(err)
+		asserts.Equal("a.txt", res.Name)
+		asserts.Equal(circuitClosed, client.breaker().state)
+		_, err = client.Meta(context.Background(), "", "a.txt")
+		asserts.NoError(err)
+		asserts.EqualValues(2, calls)
+	}
+}
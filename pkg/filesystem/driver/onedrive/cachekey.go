@@ -0,0 +1,26 @@
+package onedrive
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// 驱动的各类缓存键均由下列方法构建，格式为“<类型前缀><存储策略ID>_<标识>”，
+// 以存储策略ID区分不同策略下的同名对象。多个站点共用同一 Redis 数据库时，
+// 由配置文件 [Redis] 中的 Namespace 为所有键统一加上命名空间前缀，此处无需处理
+
+// policyCacheKey 构建存储策略 policyID 下由 parts 标识的缓存键（不含类型前缀）
+func policyCacheKey(policyID uint, parts ...string) string {
+	if len(parts) == 0 {
+		return fmt.Sprintf("%d", policyID)
+	}
+	return fmt.Sprintf("%d_%s", policyID, strings.Join(parts, "_"))
+}
+
+// policyPathCacheKey 构建存储策略 policyID 下 p 处对象的缓存键（不含类型前缀），
+// 路径经过规范化，有无首尾斜杠的同一路径对应同一个键。kinds 置于路径之前，
+// 用于区分同一对象的多种缓存
+func policyPathCacheKey(policyID uint, p string, kinds ...string) string {
+	return policyCacheKey(policyID, append(kinds, strings.Trim(path.Clean("/"+p), "/"))...)
+}
@@ -0,0 +1,195 @@
+package onedrive
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestPolicyCacheKey(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.Equal("1", policyCacheKey(1))
+	asserts.Equal("1_a.txt", policyCacheKey(1, "a.txt"))
+	asserts.Equal("1_abc_10", policyCacheKey(1, "abc", "10"))
+	asserts.Equal("1_", policyPathCacheKey(1, "/"))
+	asserts.Equal("1_a/b.txt", policyPathCacheKey(1, "/a//b.txt"))
+	asserts.Equal(policyPathCacheKey(1, "a/b"), policyPathCacheKey(1, "/a/b/"))
+}
+
+func TestDriver_CacheKeys(t *testing.T) {
+	asserts := assert.New(t)
+	backend := &sharedBackend{values: make(map[string][]byte)}
+	origin := cache.Store
+	defer func() { cache.Store = origin }()
+	cache.Store = sharedNode{backend: backend}
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_etag_cache_ttl", "0", 0)
+	cache.Set("setting_onedrive_source_timeout", "1800", 0)
+	cache.Set("setting_onedrive_list_cache_ttl", "60", 0)
+	cache.Set("setting_onedrive_notfound_cache_ttl", "10", 0)
+
+	handler := Driver{Policy: &model.Policy{}}
+	handler.Policy.ID = 100
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Policy.ID = 100
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	clientMock := ClientMock{}
+	clientMock.On("Request", "GET", "drive/root:/dir/a.jpg?expand=thumbnails", testMock.Anything, testMock.Anything).
+		Return(shortcutResponse(200, `{"name":"a.jpg","file":{},"@microsoft.graph.downloadUrl":"https://cqu.edu.cn/a"}`))
+	clientMock.On("Request", "GET", "drive/root:/dir/a.jpg:/thumbnails?select=c400x300_Crop", testMock.Anything, testMock.Anything).
+		Return(shortcutResponse(200, `{"value":[{"c400x300_Crop":{"url":"https://cqu.edu.cn/thumb"}}]}`))
+	clientMock.On("Request", "GET", "drive/root:/dir:/children?$top=999999999", testMock.Anything, testMock.Anything).
+		Return(shortcutResponse(200, `{"value":[{"name":"a.jpg","file":{}}]}`))
+	clientMock.On("Request", "GET", "drive/root:/missing.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+		Return(shortcutResponse(404, `{"error":{"code":"itemNotFound","message":"not found"}}`))
+	handler.Client.Request = clientMock
+
+	_, err := handler.Source(context.Background(), "/dir/a.jpg", url.URL{}, 60, false, 0)
+	asserts.NoError(err)
+	_, err = handler.Thumb(context.Background(), "/dir/a.jpg")
+	asserts.NoError(err)
+	_, err = handler.List(context.Background(), "/dir", false)
+	asserts.NoError(err)
+	_, err = handler.Client.Meta(context.Background(), "", "missing.txt")
+	asserts.True(IsNotFound(err))
+	clientMock.AssertExpectations(t)
+
+	// 外链、缩略图、列取结果、不存在记录的缓存键均以类型前缀及存储策略ID开头
+	expected := map[string]bool{
+		sourceCachePrefix + "100_preview_dir/a.jpg": false,
+		thumbCachePrefix + "100_dir/a.jpg":          false,
+		listCachePrefix + "100_dir":                 false,
+		notFoundCachePrefix + "100_missing.txt":     false,
+	}
+	for key := range backend.values {
+		if strings.HasPrefix(key, "setting_") {
+			continue
+		}
+		_, ok := expected[key]
+		asserts.True(ok, key)
+		expected[key] = true
+	}
+	for key, found := range expected {
+		asserts.True(found, key)
+	}
+}
+
+// fakeRedis 仅支持驱动所需少量命令的 Redis 服务端，记录写入的键
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (server *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		var argc int
+		if _, err := fmt.Fscanf(reader, "*%d\r\n", &argc); err != nil {
+			return
+		}
+		args := make([]string, argc)
+		for i := range args {
+			var size int
+			if _, err := fmt.Fscanf(reader, "$%d\r\n", &size); err != nil {
+				return
+			}
+			buf := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, buf); err != nil {
+				return
+			}
+			args[i] = string(buf[:size])
+		}
+
+		server.mu.Lock()
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			server.values[args[1]] = args[2]
+			fmt.Fprint(conn, "+OK\r\n")
+		case "SETEX":
+			server.values[args[1]] = args[3]
+			fmt.Fprint(conn, "+OK\r\n")
+		case "GET":
+			if value, ok := server.values[args[1]]; ok {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+			} else {
+				fmt.Fprint(conn, "$-1\r\n")
+			}
+		case "DEL":
+			for _, key := range args[1:] {
+				delete(server.values, key)
+			}
+			fmt.Fprintf(conn, ":%d\r\n", len(args)-1)
+		default:
+			fmt.Fprint(conn, "+PONG\r\n")
+		}
+		server.mu.Unlock()
+	}
+}
+
+func TestDriver_CacheKeys_Namespace(t *testing.T) {
+	asserts := assert.New(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	asserts.NoError(err)
+	defer listener.Close()
+	server := &fakeRedis{values: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	origin := cache.Store
+	defer func() { cache.Store = origin }()
+	cache.Store = cache.NewRedisStore(10, "tcp", listener.Addr().String(), "", "0").WithNamespace("site1_")
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_etag_cache_ttl", "0", 0)
+	cache.Set("setting_onedrive_list_cache_ttl", "60", 0)
+	cache.Set("setting_onedrive_notfound_cache_ttl", "10", 0)
+
+	handler := Driver{Policy: &model.Policy{}}
+	handler.Policy.ID = 100
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Policy.ID = 100
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	clientMock := ClientMock{}
+	clientMock.On("Request", "GET", "drive/root:/dir:/children?$top=999999999", testMock.Anything, testMock.Anything).
+		Return(shortcutResponse(200, `{"value":[{"name":"a.jpg","file":{}}]}`))
+	clientMock.On("Request", "GET", "drive/root:/missing.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+		Return(shortcutResponse(404, `{"error":{"code":"itemNotFound","message":"not found"}}`))
+	handler.Client.Request = clientMock
+
+	_, err = handler.List(context.Background(), "/dir", false)
+	asserts.NoError(err)
+	_, err = handler.Client.Meta(context.Background(), "", "missing.txt")
+	asserts.True(IsNotFound(err))
+	clientMock.AssertExpectations(t)
+
+	// 所有缓存键均带有配置的命名空间前缀
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	asserts.Contains(server.values, "site1_"+listCachePrefix+"100_dir")
+	asserts.Contains(server.values, "site1_"+notFoundCachePrefix+"100_missing.txt")
+	for key := range server.values {
+		asserts.True(strings.HasPrefix(key, "site1_"), key)
+	}
+}
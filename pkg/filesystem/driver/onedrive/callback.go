@@ -0,0 +1,34 @@
+package onedrive
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+)
+
+// getCallbackSignContent 获取上传完成回调的待签名内容，
+// 绑定回调 key、存储路径及文件大小，防止回调被伪造或挪用到其他上传会话
+func getCallbackSignContent(key, savePath string, size uint64) string {
+	return fmt.Sprintf("onedrive/finish:%s:%s:%d", key, savePath, size)
+}
+
+// SignCallback 使用站点密钥为上传完成回调生成 ttl 秒后过期的签名
+func SignCallback(key, savePath string, size uint64, ttl int64) string {
+	return auth.General.Sign(
+		getCallbackSignContent(key, savePath, size),
+		time.Now().Unix()+ttl,
+	)
+}
+
+// CheckCallbackSign 验证上传完成回调携带的签名与回调会话是否一致且未过期
+func CheckCallbackSign(sign string, session *serializer.UploadSession) error {
+	if sign == "" {
+		return auth.ErrAuthFailed
+	}
+	return auth.General.Check(
+		getCallbackSignContent(session.Key, session.SavePath, session.Size),
+		sign,
+	)
+}
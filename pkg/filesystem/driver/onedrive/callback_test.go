@@ -0,0 +1,63 @@
+package onedrive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCallbackSign(t *testing.T) {
+	asserts := assert.New(t)
+	auth.General = auth.HMACAuth{SecretKey: []byte("test")}
+	session := func() *serializer.UploadSession {
+		return &serializer.UploadSession{Key: "key", SavePath: "/dir/a.txt", Size: 1024}
+	}
+
+	// 签名有效
+	{
+		sign := SignCallback("key", "/dir/a.txt", 1024, 60)
+		asserts.NoError(CheckCallbackSign(sign, session()))
+	}
+
+	// 会话与签名不一致
+	{
+		sign := SignCallback("key", "/dir/a.txt", 1024, 60)
+		tampered := session()
+		tampered.SavePath = "/dir/b.txt"
+		asserts.Equal(auth.ErrAuthFailed, CheckCallbackSign(sign, tampered))
+		tampered = session()
+		tampered.Size = 2048
+		asserts.Equal(auth.ErrAuthFailed, CheckCallbackSign(sign, tampered))
+		tampered = session()
+		tampered.Key = "other"
+		asserts.Equal(auth.ErrAuthFailed, CheckCallbackSign(sign, tampered))
+	}
+
+	// 签名被篡改
+	{
+		sign := SignCallback("key", "/dir/a.txt", 1024, 60)
+		asserts.Equal(auth.ErrAuthFailed, CheckCallbackSign("x"+sign, session()))
+		asserts.Equal(auth.ErrAuthFailed, CheckCallbackSign("", session()))
+	}
+
+	// 签名已过期
+	{
+		sign := auth.General.Sign(
+			getCallbackSignContent("key", "/dir/a.txt", 1024),
+			time.Now().Unix()-10,
+		)
+		asserts.Equal(auth.ErrExpired, CheckCallbackSign(sign, session()))
+	}
+
+	// 使用其他密钥签名
+	{
+		sign := auth.HMACAuth{SecretKey: []byte("other")}.Sign(
+			getCallbackSignContent("key", "/dir/a.txt", 1024),
+			time.Now().Unix()+60,
+		)
+		asserts.Equal(auth.ErrAuthFailed, CheckCallbackSign(sign, session()))
+	}
+}
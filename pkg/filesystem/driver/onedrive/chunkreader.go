@@ -0,0 +1,100 @@
+package onedrive
+
+import (
+	"io"
+	"sync"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+)
+
+// chunkReader 在后台协程中按顺序读取分片，上传当前分片的同时预读后续分片，
+// 使读取文件与上传分片互相重叠。分片始终按偏移顺序返回
+type chunkReader struct {
+	ready chan prefetchedChunk
+	free  chan []byte
+	done  chan struct{}
+	// exited 预读协程结束后关闭
+	exited chan struct{}
+	once   sync.Once
+}
+
+// prefetchedChunk 预读的分片内容
+type prefetchedChunk struct {
+	data []byte
+	err  error
+}
+
+// uploadBuffers 获取服务端中转上传时使用的分片缓冲区数量，为 1 时读取与上传交替进行。
+// 每个缓冲区都需完整容纳一个分片，占用的内存随缓冲区数量成倍增加
+func uploadBuffers() int {
+	buffers := model.GetIntSetting("onedrive_upload_buffers", 2)
+	if buffers < 1 {
+		buffers = 1
+	}
+	if buffers > MaxUploadBuffers {
+		buffers = MaxUploadBuffers
+	}
+	return buffers
+}
+
+// newChunkReader 启动预读协程，自 file 中读取共 size 字节，每 chunkSize 字节为一个分片，
+// 最多同时持有 buffers 个分片
+func newChunkReader(file io.Reader, size, chunkSize, buffers int) *chunkReader {
+	r := &chunkReader{
+		ready:  make(chan prefetchedChunk, buffers),
+		free:   make(chan []byte, buffers),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	for i := 0; i < buffers; i++ {
+		r.free <- make([]byte, chunkSize)
+	}
+
+	go func() {
+		defer close(r.exited)
+		for offset := 0; offset < size; offset += chunkSize {
+			var buf []byte
+			select {
+			case buf = <-r.free:
+			case <-r.done:
+				return
+			}
+
+			if size-offset < chunkSize {
+				buf = buf[:size-offset]
+			}
+			_, err := io.ReadFull(file, buf)
+
+			select {
+			case r.ready <- prefetchedChunk{data: buf, err: err}:
+			case <-r.done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return r
+}
+
+// Next 按顺序获取下一个分片，读取文件出错时返回错误。返回的分片上传完成后
+// 需通过 Release 归还，以便读取后续分片
+func (r *chunkReader) Next() ([]byte, error) {
+	chunk := <-r.ready
+	return chunk.data, chunk.err
+}
+
+// Release 归还已上传完成的分片缓冲区
+func (r *chunkReader) Release(buf []byte) {
+	r.free <- buf[:cap(buf)]
+}
+
+// Close 终止预读并等待预读协程结束，此后不会再读取文件
+func (r *chunkReader) Close() {
+	r.once.Do(func() {
+		close(r.done)
+	})
+	<-r.exited
+}
@@ -0,0 +1,203 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowReader 模拟读取较慢的文件，每读取 chunkSize 字节耗时 delay，
+// 每个字节的值为其所在分片的序号
+type slowReader struct {
+	delay     time.Duration
+	chunkSize int
+	read      int64
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay * time.Duration(len(p)) / time.Duration(r.chunkSize))
+	offset := atomic.LoadInt64(&r.read)
+	for i := range p {
+		p[i] = byte((offset + int64(i)) / int64(r.chunkSize))
+	}
+	atomic.AddInt64(&r.read, int64(len(p)))
+	return len(p), nil
+}
+
+// chunkSessionClientMock 模拟上传会话接口，每个分片上传耗时 delay
+type chunkSessionClientMock struct {
+	delay time.Duration
+	// onChunk 收到分片时调用，返回错误时分片上传失败
+	onChunk func(content []byte) error
+}
+
+func (m chunkSessionClientMock) Request(method, target string, body io.Reader, opts ...request.Option) *request.Response {
+	resBody := `{}`
+	if method == "POST" {
+		resBody = `{"uploadUrl":"upload_session"}`
+	} else {
+		time.Sleep(m.delay)
+		content, _ := ioutil.ReadAll(body)
+		if m.onChunk != nil {
+			if err := m.onChunk(content); err != nil {
+				return &request.Response{Err: err}
+			}
+		}
+	}
+	return &request.Response{
+		Response: &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(resBody)),
+		},
+	}
+}
+
+func TestChunkReader(t *testing.T) {
+	asserts := assert.New(t)
+	content := []byte("0123456789")
+
+	// 按顺序返回分片，最后一个分片不足 chunkSize
+	for _, buffers := range []int{1, 2} {
+		r := newChunkReader(bytes.NewReader(content), len(content), 4, buffers)
+		var res []string
+		for i := 0; i < 3; i++ {
+			chunk, err := r.Next()
+			asserts.NoError(err)
+			res = append(res, string(chunk))
+			r.Release(chunk)
+		}
+		r.Close()
+		asserts.Equal([]string{"0123", "4567", "89"}, res)
+	}
+
+	// 读取出错
+	{
+		r := newChunkReader(bytes.NewReader(content[:6]), len(content), 4, 2)
+		chunk, err := r.Next()
+		asserts.NoError(err)
+		asserts.Equal("0123", string(chunk))
+		r.Release(chunk)
+		_, err = r.Next()
+		asserts.Error(err)
+		r.Close()
+	}
+
+	// 未读完时关闭，不再读取文件
+	{
+		file := &slowReader{chunkSize: 4}
+		r := newChunkReader(file, 400, 4, 2)
+		chunk, err := r.Next()
+		asserts.NoError(err)
+		asserts.Len(chunk, 4)
+		r.Close()
+		read := atomic.LoadInt64(&file.read)
+		asserts.True(read <= 12)
+		time.Sleep(10 * time.Millisecond)
+		asserts.Equal(read, atomic.LoadInt64(&file.read))
+		r.Close()
+	}
+}
+
+func TestUploadBuffers(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_upload_buffers", "0", 0)
+	asserts.Equal(1, uploadBuffers())
+	cache.Set("setting_onedrive_upload_buffers", "100", 0)
+	asserts.Equal(MaxUploadBuffers, uploadBuffers())
+	cache.Set("setting_onedrive_upload_buffers", "2", 0)
+	asserts.Equal(2, uploadBuffers())
+}
+
+func TestClient_Upload_Prefetch(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	client.Policy.OptionsSerialized.OdChunkSize = ChunkAlignment
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+	cache.Set("setting_onedrive_chunk_retries", "0", 0)
+	cache.Set("setting_onedrive_upload_buffers", "2", 0)
+	size := int(16*ChunkAlignment + 1)
+
+	// 上传分片时已预读下一分片，分片按顺序上传
+	{
+		file := &slowReader{chunkSize: int(ChunkAlignment)}
+		var chunks []int
+		prefetched, ordered := true, true
+		client.Request = chunkSessionClientMock{onChunk: func(content []byte) error {
+			index := len(chunks)
+			end := int64(index+2) * int64(ChunkAlignment)
+			if end > int64(size) {
+				end = int64(size)
+			}
+			deadline := time.Now().Add(time.Second)
+			for atomic.LoadInt64(&file.read) < end && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			prefetched = prefetched && atomic.LoadInt64(&file.read) >= end
+			ordered = ordered && len(content) > 0 &&
+				bytes.Count(content, []byte{byte(index)}) == len(content)
+			chunks = append(chunks, len(content))
+			return nil
+		}}
+		err := client.Upload(context.Background(), "prefetch.txt", size, file)
+		asserts.NoError(err)
+		asserts.True(prefetched)
+		asserts.True(ordered)
+		asserts.Len(chunks, 17)
+		asserts.Equal(int(ChunkAlignment), chunks[0])
+		asserts.Equal(1, chunks[16])
+	}
+
+	// 分片上传失败，停止预读
+	{
+		file := &slowReader{chunkSize: int(ChunkAlignment)}
+		client.Request = chunkSessionClientMock{onChunk: func(content []byte) error {
+			return errors.New("error")
+		}}
+		err := client.Upload(context.Background(), "prefetch.txt", size, file)
+		asserts.Error(err)
+		read := atomic.LoadInt64(&file.read)
+		asserts.True(read <= 3*int64(ChunkAlignment))
+		time.Sleep(10 * time.Millisecond)
+		asserts.Equal(read, atomic.LoadInt64(&file.read))
+	}
+}
+
+func BenchmarkClient_Upload(b *testing.B) {
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	client.Policy.OptionsSerialized.OdChunkSize = ChunkAlignment
+	client.Request = chunkSessionClientMock{delay: time.Duration(2) * time.Millisecond}
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+	cache.Set("setting_onedrive_chunk_retries", "0", 0)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	size := int(16 * ChunkAlignment)
+
+	for _, buffers := range []int{1, 2} {
+		b.Run(fmt.Sprintf("buffers-%d", buffers), func(b *testing.B) {
+			cache.Set("setting_onedrive_upload_buffers", fmt.Sprintf("%d", buffers), 0)
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				file := &slowReader{delay: time.Duration(2) * time.Millisecond, chunkSize: int(ChunkAlignment)}
+				if err := client.Upload(context.Background(), "bench.txt", size, file); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
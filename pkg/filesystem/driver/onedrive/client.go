@@ -2,6 +2,9 @@ package onedrive
 
 import (
 	"errors"
+	"net/url"
+	"strconv"
+	"time"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
@@ -16,6 +19,46 @@ var (
 	ErrDeleteFile = errors.New("无法删除文件")
 	// ErrClientCanceled 客户端取消操作
 	ErrClientCanceled = errors.New("客户端取消操作")
+	// ErrCopyFailed 复制文件失败
+	ErrCopyFailed = errors.New("复制文件失败")
+	// ErrChecksumMismatch 上传后文件校验值不一致
+	ErrChecksumMismatch = errors.New("上传后文件校验值不一致")
+	// ErrDeltaExpired 增量同步的 deltaLink 已失效，需要重新完整同步
+	ErrDeltaExpired = errors.New("增量同步标记已失效，需要重新完整同步")
+	// ErrNotFolder 目标不是目录
+	ErrNotFolder = errors.New("目标不是目录")
+	// ErrObjectExists 目标位置已存在同名文件或目录
+	ErrObjectExists = errors.New("同名文件或目录已存在")
+	// ErrThumbNotAvailable 文件没有可用的缩略图
+	ErrThumbNotAvailable = errors.New("无法生成缩略图")
+	// ErrCircuitOpen OneDrive 接口连续请求失败，已暂停请求
+	ErrCircuitOpen = errors.New("OneDrive 接口暂时不可用，请稍后再试")
+	// ErrInvalidProxyURL 存储策略的反代地址无效
+	ErrInvalidProxyURL = errors.New("无效的反代地址，应为 http 或 https 地址")
+	// ErrInvalidPageToken 分页标记无效或不属于当前目录
+	ErrInvalidPageToken = errors.New("分页标记无效")
+	// ErrVaultLocked 访问的项目位于已锁定的个人保管库中
+	ErrVaultLocked = errors.New("OneDrive 个人保管库已锁定，请解锁后重试")
+	// ErrReadOnly 目标驱动器为只读，无法写入
+	ErrReadOnly = errors.New("OneDrive 驱动器为只读，无法写入")
+	// ErrTooManyRedirects 下载地址的重定向次数超过上限
+	ErrTooManyRedirects = errors.New("下载地址重定向次数过多")
+	// ErrRedirectLoop 下载地址重定向回已访问过的地址
+	ErrRedirectLoop = errors.New("下载地址出现循环重定向")
+	// ErrInvalidUploadRange 上传会话返回的待接收范围无法解析
+	ErrInvalidUploadRange = errors.New("无法解析上传会话的待接收范围")
+	// ErrMonitorNotFound 上传监控会话不存在
+	ErrMonitorNotFound = errors.New("上传会话不存在或已结束")
+	// ErrNoSavePathCtx 上下文中缺少存储路径
+	ErrNoSavePathCtx = errors.New("无法获取存储路径：上下文中缺少 string 类型的 SavePathCtx")
+	// ErrNoFileSizeCtx 上下文中缺少文件大小
+	ErrNoFileSizeCtx = errors.New("无法获取文件大小：上下文中缺少 uint64 类型的 FileSizeCtx")
+	// ErrNoFileModelCtx 上下文中缺少文件记录
+	ErrNoFileModelCtx = errors.New("无法获取文件记录：上下文中缺少 model.File 类型的 FileModelCtx")
+	// ErrEncryptedDirectLink 存储策略启用了加密，无法提供直链
+	ErrEncryptedDirectLink = errors.New("存储策略启用了加密，文件只能经由服务端中转下载")
+	// ErrUnexpectedNotModified 未发送条件请求却收到 304 响应
+	ErrUnexpectedNotModified = errors.New("OneDrive 返回了未预期的 304 响应")
 )
 
 // Client OneDrive客户端
@@ -29,6 +72,8 @@ type Client struct {
 	Redirect     string
 
 	Request request.Client
+	// Logger 输出日志使用的接口，为空时使用全局日志
+	Logger Logger
 }
 
 // Endpoints OneDrive客户端相关设置
@@ -36,15 +81,26 @@ type Endpoints struct {
 	OAuthURL       string // OAuth认证的基URL
 	OAuthEndpoints *oauthEndpoint
 	EndpointURL    string // 接口请求的基URL
+	DriveID        string // 目标驱动器ID，为空时使用当前用户的默认驱动器
 	isInChina      bool   // 是否为世纪互联
+	graphURL       string // 认证主机所属国家云的 Graph 接口地址
 }
 
 // NewClient 根据存储策略获取新的client
 func NewClient(policy *model.Policy) (*Client, error) {
+	httpClient, err := NewHTTPClient(policy)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateProxyURL(policy.OptionsSerialized.OdProxy); err != nil {
+		return nil, err
+	}
+
 	client := &Client{
 		Endpoints: &Endpoints{
 			OAuthURL:    policy.BaseURL,
 			EndpointURL: policy.Server,
+			DriveID:     policy.OptionsSerialized.OdDriveID,
 		},
 		Credential: &Credential{
 			RefreshToken: policy.AccessKey,
@@ -53,7 +109,7 @@ func NewClient(policy *model.Policy) (*Client, error) {
 		ClientID:     policy.BucketName,
 		ClientSecret: policy.SecretKey,
 		Redirect:     policy.OptionsSerialized.OdRedirect,
-		Request:      request.HTTPClient{},
+		Request:      httpClient,
 	}
 
 	oauthBase := client.getOAuthEndpoint()
@@ -62,5 +118,55 @@ func NewClient(policy *model.Policy) (*Client, error) {
 	}
 	client.Endpoints.OAuthEndpoints = oauthBase
 
+	// 未指定接口地址时，使用认证主机所属国家云的 Graph 接口
+	if client.Endpoints.EndpointURL == "" && policy.BaseURL != "" {
+		client.Endpoints.EndpointURL = client.Endpoints.graphURL + "/me"
+	}
+
+	return client, nil
+}
+
+// validateProxyURL 校验下载使用的反代地址，为空时不使用反代
+func validateProxyURL(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	cdn, err := url.Parse(proxy)
+	if err != nil || (cdn.Scheme != "http" && cdn.Scheme != "https") || cdn.Host == "" {
+		return ErrInvalidProxyURL
+	}
+	return nil
+}
+
+// NewHTTPClient 根据存储策略中的代理设置及连接池设置创建发送请求使用的 HTTPClient
+func NewHTTPClient(policy *model.Policy) (request.HTTPClient, error) {
+	client, err := request.NewProxiedClient(policy.OptionsSerialized.OdOutboundProxy)
+	if err != nil {
+		return client, err
+	}
+	client.Pool = poolOptions()
 	return client, nil
 }
+
+// poolOptions 获取连接池设置。Graph 接口支持 HTTP/2，同一连接上可并发多个请求，
+// 默认值较 http.DefaultTransport 每个主机仅保留 2 个空闲连接有所放宽，并限制最大连接数
+func poolOptions() request.PoolOptions {
+	settings := model.GetSettingByNames(
+		"onedrive_max_idle_conns_per_host",
+		"onedrive_max_conns_per_host",
+		"onedrive_idle_conn_timeout",
+	)
+	intSetting := func(name string, defaultVal int) int {
+		val, err := strconv.Atoi(settings[name])
+		if err != nil || val < 0 {
+			return defaultVal
+		}
+		return val
+	}
+
+	return request.PoolOptions{
+		MaxIdleConnsPerHost: intSetting("onedrive_max_idle_conns_per_host", DefaultMaxIdleConnsPerHost),
+		MaxConnsPerHost:     intSetting("onedrive_max_conns_per_host", DefaultMaxConnsPerHost),
+		IdleConnTimeout:     time.Duration(intSetting("onedrive_idle_conn_timeout", DefaultIdleConnTimeout)) * time.Second,
+	}
+}
@@ -1,10 +1,23 @@
 package onedrive
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
 	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
 )
 
 func TestNewClient(t *testing.T) {
@@ -29,4 +42,258 @@ func TestNewClient(t *testing.T) {
 		asserts.NotNil(res.Endpoints)
 		asserts.NotNil(res.Endpoints.OAuthEndpoints)
 	}
+
+	// 反代地址无效
+	for _, proxy := range []string{string([]byte{0x7f}), "ftp://cdn.cloudreve.org", "cdn.cloudreve.org", "https://"} {
+		policy := model.Policy{}
+		policy.OptionsSerialized.OdProxy = proxy
+		res, err := NewClient(&policy)
+		asserts.Equal(ErrInvalidProxyURL, err, proxy)
+		asserts.Nil(res)
+	}
+
+	// 反代地址有效
+	{
+		policy := model.Policy{}
+		policy.OptionsSerialized.OdProxy = "https://cdn.cloudreve.org/onedrive/"
+		res, err := NewClient(&policy)
+		asserts.NoError(err)
+		asserts.NotNil(res)
+	}
+}
+
+func TestNewClient_OutboundProxy(t *testing.T) {
+	asserts := assert.New(t)
+	var (
+		mu        sync.Mutex
+		proxied   []string
+		proxyAuth []string
+	)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxyAuth = append(proxyAuth, r.Header.Get("Proxy-Authorization"))
+		mu.Unlock()
+		if r.Method == "CONNECT" {
+			// HTTPS 请求通过 CONNECT 建立隧道，此处直接拒绝
+			mu.Lock()
+			proxied = append(proxied, "CONNECT "+r.Host)
+			mu.Unlock()
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		mu.Lock()
+		proxied = append(proxied, r.Method+" "+r.URL.String())
+		mu.Unlock()
+		switch r.URL.Host {
+		case "graph.cloudreve.invalid":
+			w.Write([]byte(`{"name":"a.txt","size":7,"file":{},"@microsoft.graph.downloadUrl":"http://download.cloudreve.invalid/a.txt"}`))
+		case "download.cloudreve.invalid":
+			w.Write([]byte("content"))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer proxy.Close()
+
+	policy := &model.Policy{
+		BaseURL:    "https://login.microsoftonline.com/common/oauth2/v2.0",
+		Server:     "http://graph.cloudreve.invalid/v1.0/me",
+		AccessKey:  "refresh_token",
+		BucketName: "proxied_client",
+		OptionsSerialized: model.PolicyOption{
+			OdOutboundProxy: "http://user:pass@" + strings.TrimPrefix(proxy.URL, "http://"),
+		},
+	}
+	policy.ID = 74
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+
+	// 代理地址无效
+	{
+		invalid := *policy
+		invalid.OptionsSerialized.OdOutboundProxy = "ftp://127.0.0.1"
+		res, err := NewClient(&invalid)
+		asserts.Error(err)
+		asserts.Nil(res)
+	}
+
+	client, err := NewClient(policy)
+	asserts.NoError(err)
+	handler := Driver{
+		Policy: policy,
+		Client: client,
+	}
+	handler.HTTPClient, err = NewHTTPClient(policy)
+	asserts.NoError(err)
+
+	// 刷新凭证经由代理发出
+	{
+		err := client.UpdateCredential(context.Background())
+		asserts.Error(err)
+		asserts.Contains(proxied, "CONNECT login.microsoftonline.com:443")
+	}
+
+	// 获取元数据、下载文件经由代理发出
+	{
+		client.Credential.AccessToken = "AccessToken"
+		client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		res, err := handler.Get(context.Background(), "/a.txt")
+		asserts.NoError(err)
+		content := make([]byte, 7)
+		_, err = io.ReadFull(res, content)
+		asserts.NoError(err)
+		res.Close()
+		asserts.Equal("content", string(content))
+		asserts.Contains(proxied, "GET http://graph.cloudreve.invalid/v1.0/me/drive/root:/a.txt?expand=thumbnails")
+		asserts.Contains(proxied, "GET http://download.cloudreve.invalid/a.txt")
+	}
+
+	// 所有请求均附带代理认证信息
+	{
+		asserts.NotEmpty(proxyAuth)
+		for _, auth := range proxyAuth {
+			asserts.Equal("Basic dXNlcjpwYXNz", auth)
+		}
+	}
+}
+
+func TestNewClient_SovereignEndpoint(t *testing.T) {
+	asserts := assert.New(t)
+	testCases := []struct {
+		OAuthURL string
+		graph    string
+	}{
+		{"https://login.microsoftonline.com/common/oauth2/v2.0", "https://graph.microsoft.com/v1.0"},
+		{"https://login.live.com", "https://graph.microsoft.com/v1.0"},
+		{"https://login.chinacloudapi.cn/common/oauth2", "https://microsoftgraph.chinacloudapi.cn/v1.0"},
+		{"https://login.microsoftonline.us", "https://graph.microsoft.us/v1.0"},
+		{"https://login.microsoftonline.de", "https://graph.microsoft.de/v1.0"},
+	}
+
+	// 未指定接口地址时，按认证主机选择国家云的 Graph 接口
+	for i, testCase := range testCases {
+		client, err := NewClient(&model.Policy{BaseURL: testCase.OAuthURL})
+		asserts.NoError(err)
+		asserts.Equal(testCase.graph+"/me", client.Endpoints.EndpointURL, "Test Case #%d", i)
+		asserts.Equal(testCase.graph+"/me/drive/root:/a.txt", client.getDriveRequestURL("root:/a.txt"), "Test Case #%d", i)
+		asserts.Equal(testCase.graph+"/drives/123/items/1", client.getDrivesRequestURL("123", "items/1"), "Test Case #%d", i)
+		asserts.Equal(testCase.graph+"/$batch", client.getBatchRequestURL(), "Test Case #%d", i)
+
+		// 各类请求均发往该接口
+		client.Credential.AccessToken = "AccessToken"
+		client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		cache.Set("setting_onedrive_throttle_retries", "0", 0)
+		clientMock := ClientMock{}
+		for _, requestURL := range []string{
+			testCase.graph + "/me/drive/root:/a.txt?expand=thumbnails",
+			testCase.graph + "/me/drive/root:/dir:/children?$top=999999999",
+			testCase.graph + "/me/drive/root:/a.txt:/createUploadSession",
+		} {
+			clientMock.On("Request", testMock.Anything, requestURL, testMock.Anything, testMock.Anything).
+				Return(&request.Response{Err: errors.New("error")}).Once()
+		}
+		clientMock.On("Request", "GET", testMock.MatchedBy(func(requestURL string) bool {
+			return strings.HasPrefix(requestURL, testCase.graph+"/me/drive/root:/a.jpg:/thumbnails")
+		}), testMock.Anything, testMock.Anything).Return(&request.Response{Err: errors.New("error")}).Once()
+		clientMock.On("Request", "POST", testCase.graph+"/$batch", testMock.Anything, testMock.Anything).
+			Return(&request.Response{Err: errors.New("error")}).Once()
+		client.Request = clientMock
+		ctx := context.WithValue(context.Background(), fsctx.RetryCtx, ListRetry)
+		_, err = client.Meta(ctx, "", "a.txt")
+		asserts.Error(err)
+		_, err = client.ListChildren(ctx, "dir")
+		asserts.Error(err)
+		_, err = client.CreateUploadSession(ctx, "a.txt")
+		asserts.Error(err)
+		_, err = client.GetThumbURL(ctx, "a.jpg", 100, 100)
+		asserts.Error(err)
+		_, err = client.BatchDelete(ctx, []string{"a.txt"})
+		asserts.Error(err)
+		clientMock.AssertExpectations(t)
+	}
+
+	// 指定的接口地址及驱动器优先
+	{
+		client, err := NewClient(&model.Policy{
+			BaseURL: "https://login.chinacloudapi.cn",
+			Server:  "https://proxy.cloudreve.org/v1.0/me",
+			OptionsSerialized: model.PolicyOption{
+				OdDriveID: "123",
+			},
+		})
+		asserts.NoError(err)
+		asserts.Equal("https://proxy.cloudreve.org/v1.0/drives/123/root:/a.txt", client.getDriveRequestURL("root:/a.txt"))
+		asserts.Equal("https://proxy.cloudreve.org/v1.0/$batch", client.getBatchRequestURL())
+	}
+}
+
+func TestNewHTTPClient_Pool(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 使用设置中的连接池参数
+	{
+		cache.Set("setting_onedrive_max_idle_conns_per_host", "64", 0)
+		cache.Set("setting_onedrive_max_conns_per_host", "0", 0)
+		cache.Set("setting_onedrive_idle_conn_timeout", "30", 0)
+		client, err := NewHTTPClient(&model.Policy{})
+		asserts.NoError(err)
+		asserts.Equal(request.PoolOptions{
+			MaxIdleConnsPerHost: 64,
+			MaxConnsPerHost:     0,
+			IdleConnTimeout:     time.Duration(30) * time.Second,
+		}, client.Pool)
+	}
+
+	// 设置无效时使用默认值
+	{
+		cache.Set("setting_onedrive_max_idle_conns_per_host", "-1", 0)
+		cache.Set("setting_onedrive_max_conns_per_host", "invalid", 0)
+		cache.Set("setting_onedrive_idle_conn_timeout", "", 0)
+		client, err := NewHTTPClient(&model.Policy{})
+		asserts.NoError(err)
+		asserts.Equal(request.PoolOptions{
+			MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+			MaxConnsPerHost:     DefaultMaxConnsPerHost,
+			IdleConnTimeout:     time.Duration(DefaultIdleConnTimeout) * time.Second,
+		}, client.Pool)
+	}
+
+	// 同时使用代理
+	{
+		client, err := NewHTTPClient(&model.Policy{OptionsSerialized: model.PolicyOption{OdOutboundProxy: "http://127.0.0.1:8080"}})
+		asserts.NoError(err)
+		asserts.NotNil(client.Proxy)
+		asserts.Equal(DefaultMaxConnsPerHost, client.Pool.MaxConnsPerHost)
+	}
+}
+
+func BenchmarkHTTPClient_Pool(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		w.Write([]byte(`{"name":"a.txt"}`))
+	}))
+	defer server.Close()
+
+	for _, size := range []int{2, 8, 32} {
+		b.Run(fmt.Sprintf("conns-%d", size), func(b *testing.B) {
+			cache.Set("setting_onedrive_max_idle_conns_per_host", fmt.Sprintf("%d", size), 0)
+			cache.Set("setting_onedrive_max_conns_per_host", fmt.Sprintf("%d", size), 0)
+			cache.Set("setting_onedrive_idle_conn_timeout", "90", 0)
+			client, err := NewHTTPClient(&model.Policy{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer client.CloseIdleConnections()
+
+			b.SetParallelism(8)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					resp := client.Request("GET", server.URL, nil)
+					if _, err := resp.GetResponse(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
 }
@@ -0,0 +1,118 @@
+package onedrive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"strconv"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// dedupCachePrefix 去重索引的缓存键前缀，记录内容摘要对应的已上传文件路径
+const dedupCachePrefix = "onedrive_dedup_"
+
+// contentDigest 文件内容的摘要。去重以 SHA-256 判断内容是否相同，quickXorHash 仅用于
+// 确认索引中的文件在 OneDrive 上未被修改，其可被轻易构造碰撞，不能单独作为去重依据
+type contentDigest struct {
+	sha256   string
+	quickXor string
+	size     int64
+}
+
+// getDedupCacheKey 获取去重索引的缓存键
+func getDedupCacheKey(policyID uint, sha256 string, size int64) string {
+	return policyCacheKey(policyID, sha256, strconv.FormatInt(size, 10))
+}
+
+// digestContent 读取 file 的全部内容计算摘要，完成后将 file 重置到起始位置
+func digestContent(file io.ReadSeeker) (contentDigest, error) {
+	shaHasher, xorHasher := sha256.New(), NewQuickXorHash()
+	size, err := io.Copy(io.MultiWriter(shaHasher, xorHasher), file)
+	if err != nil {
+		return contentDigest{}, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return contentDigest{}, err
+	}
+	return contentDigest{
+		sha256:   hex.EncodeToString(shaHasher.Sum(nil)),
+		quickXor: base64.StdEncoding.EncodeToString(xorHasher.Sum(nil)),
+		size:     size,
+	}, nil
+}
+
+// putDeduplicated 按内容去重上传文件。可重置读取位置的文件（如服务端中转时的临时文件）在上传前
+// 计算摘要，去重索引中已有内容相同的文件时，以服务端复制代替上传；无法重置的文件流只能在上传的
+// 同时计算摘要，上传完成后写入去重索引，供之后的上传使用。origin 为未经流量计量包装的原始文件
+func (handler Driver) putDeduplicated(ctx context.Context, origin, file io.Reader, dst string, size uint64) error {
+	var (
+		key       string
+		shaHasher hash.Hash
+	)
+	if seeker, ok := origin.(io.ReadSeeker); ok {
+		digest, err := digestContent(seeker)
+		if err != nil {
+			return err
+		}
+		if digest.size == int64(size) {
+			key = getDedupCacheKey(handler.Policy.ID, digest.sha256, digest.size)
+			if handler.copyDuplicate(ctx, key, digest, dst) {
+				return nil
+			}
+		}
+	} else {
+		shaHasher = sha256.New()
+		file = io.TeeReader(file, shaHasher)
+	}
+
+	if err := handler.Client.Upload(ctx, dst, int(size), file); err != nil {
+		return err
+	}
+
+	if shaHasher != nil {
+		key = getDedupCacheKey(handler.Policy.ID, hex.EncodeToString(shaHasher.Sum(nil)), int64(size))
+	}
+	if key != "" {
+		cache.Set(dedupCachePrefix+key, dst, model.GetIntSetting("onedrive_dedup_ttl", 604800))
+	}
+	return nil
+}
+
+// copyDuplicate 查找去重索引，存在内容相同且未被修改的文件时将其复制到 dst，返回是否已复制。
+// 索引中的文件已删除或已变化时清除该索引；复制失败时返回 false，由调用方正常上传
+func (handler Driver) copyDuplicate(ctx context.Context, key string, digest contentDigest, dst string) bool {
+	cached, ok := cache.Get(dedupCachePrefix + key)
+	if !ok {
+		return false
+	}
+	src, ok := cached.(string)
+	if !ok || src == dst {
+		return false
+	}
+
+	info, err := handler.Client.Meta(ctx, "", src)
+	if err != nil || info.File == nil || int64(info.Size) != digest.size ||
+		info.File.Hashes.QuickXorHash != digest.quickXor {
+		util.Log().Debug("去重索引中的文件[%s]已不存在或已变化", src)
+		cache.Deletes([]string{key}, dedupCachePrefix)
+		return false
+	}
+
+	monitorURL, err := handler.Client.Copy(ctx, src, dst, WithConflictBehavior("replace"))
+	if err == nil {
+		err = handler.Client.WaitCopy(ctx, monitorURL)
+	}
+	if err != nil {
+		util.Log().Warning("无法复制内容相同的文件[%s]至[%s]，改为上传，%s", src, dst, err)
+		return false
+	}
+
+	util.Log().Debug("文件[%s]与已有文件[%s]内容相同，已在服务端复制", dst, src)
+	return true
+}
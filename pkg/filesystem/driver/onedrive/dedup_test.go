@@ -0,0 +1,172 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+// dedupDriveMock 模拟支持上传、复制及获取元信息的驱动器
+type dedupDriveMock struct {
+	files   map[string][]byte
+	uploads *int
+	copies  *int
+}
+
+func newDedupDriveMock() dedupDriveMock {
+	return dedupDriveMock{files: make(map[string][]byte), uploads: new(int), copies: new(int)}
+}
+
+func (m dedupDriveMock) Request(method, target string, body io.Reader, opts ...request.Option) *request.Response {
+	respond := func(status int, header http.Header, resBody string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: status,
+				Header:     header,
+				Body:       ioutil.NopCloser(strings.NewReader(resBody)),
+			},
+		}
+	}
+	fileJSON := func(name string, content []byte) string {
+		hasher := NewQuickXorHash()
+		hasher.Write(content)
+		return fmt.Sprintf(`{"name":"%s","size":%d,"file":{"hashes":{"quickXorHash":"%s"}}}`,
+			name, len(content), base64.StdEncoding.EncodeToString(hasher.Sum(nil)))
+	}
+	itemPath := func(suffix string) string {
+		return strings.TrimSuffix(strings.TrimPrefix(target, "drive/root:/"), suffix)
+	}
+
+	switch {
+	case method == "PUT" && strings.HasSuffix(target, ":/content"):
+		p := itemPath(":/content")
+		content, _ := ioutil.ReadAll(body)
+		m.files[p] = content
+		*m.uploads++
+		return respond(201, http.Header{}, fileJSON(p, content))
+	case method == "POST" && strings.Contains(target, ":/copy?"):
+		src := target[len("drive/root:/"):strings.Index(target, ":/copy?")]
+		var req struct {
+			ParentReference struct {
+				Path string `json:"path"`
+			} `json:"parentReference"`
+			Name string `json:"name"`
+		}
+		content, _ := ioutil.ReadAll(body)
+		json.Unmarshal(content, &req)
+		dst := strings.TrimPrefix(strings.TrimPrefix(req.ParentReference.Path, "/drive/root:"), "/")
+		if dst != "" {
+			dst += "/"
+		}
+		m.files[dst+req.Name] = m.files[src]
+		*m.copies++
+		return respond(202, http.Header{"Location": {"monitor"}}, "")
+	case method == "GET" && target == "monitor":
+		return respond(200, http.Header{}, `{"status":"completed"}`)
+	case method == "GET":
+		p := itemPath("?expand=thumbnails")
+		if content, ok := m.files[p]; ok {
+			return respond(200, http.Header{}, fileJSON(p, content))
+		}
+		return respond(404, http.Header{}, `{"error":{"code":"itemNotFound","message":"not found"}}`)
+	}
+	return respond(400, http.Header{}, `{"error":{"code":"invalidRequest","message":"unexpected request"}}`)
+}
+
+// seekableFile 可重置读取位置的上传文件
+type seekableFile struct {
+	*bytes.Reader
+}
+
+func (seekableFile) Close() error {
+	return nil
+}
+
+func TestDriver_Put_Dedup(t *testing.T) {
+	asserts := assert.New(t)
+	policy := &model.Policy{}
+	policy.ID = 93
+	policy.OptionsSerialized.OdDedup = true
+	handler := Driver{Policy: policy}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_etag_cache_ttl", "0", 0)
+	cache.Set("setting_onedrive_dedup_ttl", "0", 0)
+	drive := newDedupDriveMock()
+	handler.Client.Request = drive
+	put := func(dst, content string, seekable bool) error {
+		var file io.ReadCloser = ioutil.NopCloser(strings.NewReader(content))
+		if seekable {
+			file = seekableFile{bytes.NewReader([]byte(content))}
+		}
+		return handler.Put(context.Background(), file, dst, uint64(len(content)))
+	}
+
+	// 首次上传，未命中去重索引
+	{
+		asserts.NoError(put("user1/a.txt", "content", true))
+		asserts.Equal(1, *drive.uploads)
+		asserts.Zero(*drive.copies)
+	}
+
+	// 内容相同，以服务端复制代替上传
+	{
+		asserts.NoError(put("user2/b.txt", "content", true))
+		asserts.Equal(1, *drive.uploads)
+		asserts.Equal(1, *drive.copies)
+		asserts.Equal("content", string(drive.files["user2/b.txt"]))
+	}
+
+	// 内容不同，正常上传
+	{
+		asserts.NoError(put("user2/c.txt", "another", true))
+		asserts.Equal(2, *drive.uploads)
+		asserts.Equal(1, *drive.copies)
+	}
+
+	// 索引中的文件已变化，正常上传并更新索引
+	{
+		drive.files["user1/a.txt"] = []byte("changed")
+		asserts.NoError(put("user3/d.txt", "content", true))
+		asserts.Equal(3, *drive.uploads)
+		asserts.Equal(1, *drive.copies)
+		asserts.NoError(put("user3/e.txt", "content", true))
+		asserts.Equal(3, *drive.uploads)
+		asserts.Equal(2, *drive.copies)
+		asserts.Equal("content", string(drive.files["user3/e.txt"]))
+	}
+
+	// 无法重置的文件流上传后写入索引，之后的上传可以去重
+	{
+		asserts.NoError(put("user4/f.txt", "streamed", false))
+		asserts.Equal(4, *drive.uploads)
+		asserts.NoError(put("user4/g.txt", "streamed", true))
+		asserts.Equal(4, *drive.uploads)
+		asserts.Equal(3, *drive.copies)
+		asserts.Equal("streamed", string(drive.files["user4/g.txt"]))
+	}
+
+	// 未启用去重
+	{
+		policy.OptionsSerialized.OdDedup = false
+		asserts.NoError(put("user5/h.txt", "content", true))
+		asserts.Equal(5, *drive.uploads)
+		asserts.Equal(3, *drive.copies)
+	}
+}
@@ -0,0 +1,78 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// Delta 获取自 deltaLink 以来发生变更的项目，deltaLink 为空时从头列举整个驱动器。
+// 返回变更项目及下次查询使用的 deltaLink；deltaLink 已失效时返回 ErrDeltaExpired
+func (client *Client) Delta(ctx context.Context, deltaLink string) ([]FileInfo, string, error) {
+	requestURL := deltaLink
+	if requestURL == "" {
+		requestURL = client.getDriveRequestURL("root/delta")
+	}
+
+	res := make([]FileInfo, 0)
+	for {
+		select {
+		case <-ctx.Done():
+			util.Log().Debug("OneDrive 客户端取消")
+			return nil, "", ErrClientCanceled
+		default:
+		}
+
+		body, err := client.request(ctx, "GET", requestURL, nil,
+			request.WithTimeout(client.requestTimeout()),
+		)
+		if err != nil {
+			if err.Status == http.StatusGone {
+				return nil, "", ErrDeltaExpired
+			}
+			return nil, "", err
+		}
+
+		var page DeltaResponse
+		if decodeErr := json.Unmarshal([]byte(body), &page); decodeErr != nil {
+			return nil, "", decodeErr
+		}
+		res = append(res, page.Value...)
+
+		if page.DeltaLink != "" {
+			return res, page.DeltaLink, nil
+		}
+		if page.NextLink == "" {
+			return nil, "", ErrDeltaExpired
+		}
+		requestURL = page.NextLink
+	}
+}
+
+// Changes 获取自上次调用以来发生变更的项目，并记录新的同步位置。首次调用或
+// 同步位置已失效时返回驱动器中的全部项目，此时 resync 为 true，调用方应以返回
+// 结果重建索引。已删除的项目 Deleted 不为空，且通常只有 ID 可用于定位
+func (handler Driver) Changes(ctx context.Context) (changes []FileInfo, resync bool, err error) {
+	deltaLink := handler.Policy.OptionsSerialized.OdDeltaLink
+	resync = deltaLink == ""
+
+	changes, next, err := handler.Client.Delta(ctx, deltaLink)
+	if err == ErrDeltaExpired && !resync {
+		util.Log().Info("存储策略[%s]的增量同步标记已失效，重新完整同步", handler.Policy.Name)
+		resync = true
+		changes, next, err = handler.Client.Delta(ctx, "")
+	}
+	if err != nil {
+		return nil, resync, err
+	}
+
+	handler.Policy.OptionsSerialized.OdDeltaLink = next
+	if err := handler.Policy.UpdateOptions(); err != nil {
+		util.Log().Warning("无法保存存储策略[%s]的增量同步标记，%s", handler.Policy.Name, err)
+	}
+
+	return changes, resync, nil
+}
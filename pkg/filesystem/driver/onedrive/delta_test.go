@@ -0,0 +1,149 @@
+package onedrive
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func mockDeltaResponses(responses map[string][2]interface{}) ClientMock {
+	clientMock := ClientMock{}
+	for requestURL, res := range responses {
+		clientMock.On(
+			"Request",
+			"GET",
+			requestURL,
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: res[0].(int),
+				Body:       ioutil.NopCloser(strings.NewReader(res[1].(string))),
+			},
+		})
+	}
+	return clientMock
+}
+
+func TestClient_Delta(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	client.Credential.AccessToken = "AccessToken"
+
+	// 从头列举，跟随分页直至获得 deltaLink
+	{
+		clientMock := mockDeltaResponses(map[string][2]interface{}{
+			"drive/root/delta": {200, `{"value":[{"id":"1","name":"a.txt"}],"@odata.nextLink":"next1"}`},
+			"next1":            {200, `{"value":[{"id":"2","deleted":{"state":"deleted"}}],"@odata.deltaLink":"delta1"}`},
+		})
+		client.Request = clientMock
+		items, next, err := client.Delta(context.Background(), "")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("delta1", next)
+		asserts.Len(items, 2)
+		asserts.Equal("a.txt", items[0].Name)
+		asserts.Nil(items[0].Deleted)
+		asserts.Equal("2", items[1].ID)
+		asserts.NotNil(items[1].Deleted)
+	}
+
+	// deltaLink 已失效
+	{
+		client.Request = mockDeltaResponses(map[string][2]interface{}{
+			"expired": {410, `{"error":{"code":"resyncRequired"}}`},
+		})
+		_, _, err := client.Delta(context.Background(), "expired")
+		asserts.Equal(ErrDeltaExpired, err)
+	}
+
+	// 其他错误
+	{
+		client.Request = mockDeltaResponses(map[string][2]interface{}{
+			"denied": {403, `{"error":{"code":"accessDenied"}}`},
+		})
+		_, _, err := client.Delta(context.Background(), "denied")
+		asserts.Error(err)
+		asserts.NotEqual(ErrDeltaExpired, err)
+	}
+
+	// 响应缺少 deltaLink 与 nextLink
+	{
+		client.Request = mockDeltaResponses(map[string][2]interface{}{
+			"broken": {200, `{"value":[]}`},
+		})
+		_, _, err := client.Delta(context.Background(), "broken")
+		asserts.Equal(ErrDeltaExpired, err)
+	}
+}
+
+func TestDriver_Changes(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	handler := Driver{Policy: &model.Policy{}}
+	handler.Policy.ID = 1
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	handler.Client.Credential.AccessToken = "AccessToken"
+
+	// 增量同步
+	{
+		handler.Policy.OptionsSerialized.OdDeltaLink = "delta1"
+		handler.Client.Request = mockDeltaResponses(map[string][2]interface{}{
+			"delta1": {200, `{"value":[{"id":"1","name":"a.txt"}],"@odata.deltaLink":"delta2"}`},
+		})
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		changes, resync, err := handler.Changes(context.Background())
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.False(resync)
+		asserts.Len(changes, 1)
+		asserts.Equal("delta2", handler.Policy.OptionsSerialized.OdDeltaLink)
+		asserts.Contains(handler.Policy.Options, `"od_delta_link":"delta2"`)
+	}
+
+	// 同步标记失效，重新完整同步
+	{
+		handler.Policy.OptionsSerialized.OdDeltaLink = "expired"
+		handler.Client.Request = mockDeltaResponses(map[string][2]interface{}{
+			"expired":          {410, `{"error":{"code":"resyncRequired"}}`},
+			"drive/root/delta": {200, `{"value":[{"id":"1"},{"id":"2"}],"@odata.deltaLink":"delta3"}`},
+		})
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		changes, resync, err := handler.Changes(context.Background())
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.True(resync)
+		asserts.Len(changes, 2)
+		asserts.Equal("delta3", handler.Policy.OptionsSerialized.OdDeltaLink)
+	}
+
+	// 请求失败时不更新同步标记
+	{
+		handler.Policy.OptionsSerialized.OdDeltaLink = "denied"
+		handler.Client.Request = mockDeltaResponses(map[string][2]interface{}{
+			"denied": {403, `{"error":{"code":"accessDenied"}}`},
+		})
+		_, _, err := handler.Changes(context.Background())
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+		asserts.Equal("denied", handler.Policy.OptionsSerialized.OdDeltaLink)
+	}
+}
@@ -0,0 +1,400 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+)
+
+/*
+	加密后的文件由若干分块组成，每个分块为不超过 EncryptChunkSize 的明文经
+	AES-256-GCM 加密后的密文及 16 字节认证标签。各分块的 nonce 由文件的随机
+	nonce 与分块序号异或得到，最后一个分块使用不同的附加数据，以便发现被截断的文件。
+	按范围读取时，只需获取覆盖该范围的分块
+*/
+
+const (
+	// EncryptChunkSize 加密分块的明文大小
+	EncryptChunkSize = 64 * 1024
+	// encryptCipherName 元数据中记录的加密算法
+	encryptCipherName = "aes-256-gcm"
+	// encryptTagSize 每个分块附带的认证标签大小
+	encryptTagSize = 16
+	// encryptCipherChunkSize 加密分块的密文大小
+	encryptCipherChunkSize = EncryptChunkSize + encryptTagSize
+
+	metadataCipherKey = "cipher"
+	metadataNonceKey  = "nonce"
+)
+
+var (
+	// ErrInvalidEncryptionKey 存储策略中的加密密钥无效
+	ErrInvalidEncryptionKey = errors.New("加密密钥无效，应为 base64 编码的 32 字节密钥")
+	// ErrDecryptFailed 密文被篡改或密钥不匹配
+	ErrDecryptFailed = errors.New("无法解密文件，密文已损坏或密钥不匹配")
+)
+
+// encryptionAEAD 获取存储策略的加密器，未启用加密时返回 nil
+func (handler Driver) encryptionAEAD() (cipher.AEAD, error) {
+	encoded := handler.Policy.OptionsSerialized.OdEncryptionKey
+	if encoded == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidEncryptionKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptionNonce 从项目的 description 中获取加密时使用的 nonce，未加密的文件返回 false
+func encryptionNonce(description string, aead cipher.AEAD) ([]byte, bool) {
+	metadata := decodeMetadata(description)
+	if metadata[metadataCipherKey] != encryptCipherName {
+		return nil, false
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(metadata[metadataNonceKey])
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, false
+	}
+	return nonce, true
+}
+
+// withEncryptionMetadata 将加密信息合并到上下文中待写入的自定义元数据
+func withEncryptionMetadata(ctx context.Context, nonce []byte) context.Context {
+	metadata := map[string]string{
+		metadataCipherKey: encryptCipherName,
+		metadataNonceKey:  base64.StdEncoding.EncodeToString(nonce),
+	}
+	if origin, ok := fsctx.Metadata(ctx); ok {
+		for k, v := range origin {
+			if _, reserved := metadata[k]; !reserved {
+				metadata[k] = v
+			}
+		}
+	}
+	return context.WithValue(ctx, fsctx.MetadataCtx, metadata)
+}
+
+// encryptedSize 获取明文加密后的大小，空文件也包含一个分块
+func encryptedSize(size int64) int64 {
+	chunks := (size + EncryptChunkSize - 1) / EncryptChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return size + chunks*encryptTagSize
+}
+
+// decryptedSize 根据密文大小获取明文大小
+func decryptedSize(size int64) int64 {
+	chunks := (size + encryptCipherChunkSize - 1) / encryptCipherChunkSize
+	if size < chunks*encryptTagSize {
+		return 0
+	}
+	return size - chunks*encryptTagSize
+}
+
+// chunkNonce 获取第 index 个分块使用的 nonce
+func chunkNonce(nonce []byte, index int64) []byte {
+	res := make([]byte, len(nonce))
+	copy(res, nonce)
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(index))
+	for i := range counter {
+		res[len(res)-8+i] ^= counter[i]
+	}
+	return res
+}
+
+// chunkAdditionalData 获取分块的附加数据，用于区分最后一个分块
+func chunkAdditionalData(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// newNonce 生成文件的随机 nonce
+func newNonce(aead cipher.AEAD) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// encryptReader 将大小为 remaining 的明文流逐块加密
+type encryptReader struct {
+	src       io.Reader
+	aead      cipher.AEAD
+	nonce     []byte
+	remaining int64
+	index     int64
+	plain     []byte
+	sealed    []byte
+	buf       []byte
+	done      bool
+}
+
+func newEncryptReader(src io.Reader, aead cipher.AEAD, nonce []byte, size int64) *encryptReader {
+	return &encryptReader{
+		src:       src,
+		aead:      aead,
+		nonce:     nonce,
+		remaining: size,
+		plain:     make([]byte, EncryptChunkSize),
+		sealed:    make([]byte, 0, encryptCipherChunkSize),
+	}
+}
+
+// Read 读取密文
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		size := int64(EncryptChunkSize)
+		if r.remaining < size {
+			size = r.remaining
+		}
+		if _, err := io.ReadFull(r.src, r.plain[:size]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+
+		r.remaining -= size
+		r.done = r.remaining == 0
+		r.buf = r.aead.Seal(r.sealed[:0], chunkNonce(r.nonce, r.index), r.plain[:size], chunkAdditionalData(r.done))
+		r.index++
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// decryptReader 逐块解密从分块边界开始的密文流，只输出请求范围内的明文。
+// Seek 的行为与 request.NopRSCloser 一致，仅供 http.ServeContent 确定正文大小及起始偏移
+type decryptReader struct {
+	body       io.ReadCloser
+	aead       cipher.AEAD
+	nonce      []byte
+	cipherSize int64
+	// index 下一个待解密的分块序号
+	index int64
+	// skip 首个分块中位于请求范围之前的明文字节数
+	skip int64
+	// remaining 剩余待输出的明文字节数
+	remaining int64
+	// size 明文总大小
+	size int64
+	// offset 输出的明文在文件中的起始位置
+	offset int64
+	// ignoreFirst 首次 Seek 前，忽略 http.ServeContent 用于探测类型的读取
+	ignoreFirst bool
+	sealed      []byte
+	plain       []byte
+	buf         []byte
+}
+
+// Read 读取明文
+func (r *decryptReader) Read(p []byte) (int, error) {
+	if r.ignoreFirst && len(p) == 512 {
+		return 0, io.EOF
+	}
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	for len(r.buf) == 0 {
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.remaining -= int64(n)
+	return n, nil
+}
+
+// next 读取并解密下一个分块
+func (r *decryptReader) next() error {
+	chunkSize := r.cipherSize - r.index*encryptCipherChunkSize
+	if chunkSize > encryptCipherChunkSize {
+		chunkSize = encryptCipherChunkSize
+	}
+	if chunkSize < encryptTagSize {
+		return io.ErrUnexpectedEOF
+	}
+
+	if _, err := io.ReadFull(r.body, r.sealed[:chunkSize]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	last := (r.index+1)*encryptCipherChunkSize >= r.cipherSize
+	plain, err := r.aead.Open(r.plain[:0], chunkNonce(r.nonce, r.index), r.sealed[:chunkSize], chunkAdditionalData(last))
+	if err != nil {
+		return ErrDecryptFailed
+	}
+	r.index++
+
+	if r.skip > 0 {
+		plain = plain[r.skip:]
+		r.skip = 0
+	}
+	r.buf = plain
+	return nil
+}
+
+// Seek 只实现 seek 至开头、结尾及请求范围的起始位置
+func (r *decryptReader) Seek(offset int64, whence int) (int64, error) {
+	r.ignoreFirst = false
+	if whence == io.SeekStart && offset == r.offset {
+		return offset, nil
+	}
+	if offset == 0 {
+		switch whence {
+		case io.SeekStart:
+			return 0, nil
+		case io.SeekEnd:
+			return r.size, nil
+		}
+	}
+	return 0, errors.New("未实现")
+}
+
+// Close 关闭密文流
+func (r *decryptReader) Close() error {
+	return r.body.Close()
+}
+
+// parsePlainRange 解析单个字节范围，返回闭区间 [start, end]，
+// 多重范围或无法满足的范围返回 false
+func parsePlainRange(rangeHeader string, size int64) (int64, int64, bool) {
+	spec := strings.TrimPrefix(rangeHeader, "bytes=")
+	if spec == rangeHeader || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+
+	bounds := strings.SplitN(strings.TrimSpace(spec), "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, false
+	}
+
+	// 形如 -n 的后缀范围
+	if bounds[0] == "" {
+		n, err := strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, size > 0
+	}
+
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if bounds[1] != "" {
+		end, err = strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+// getDecrypted 获取并解密已加密的文件，按范围获取时只下载覆盖该范围的分块
+func (handler Driver) getDecrypted(ctx context.Context, path string, aead cipher.AEAD, nonce []byte, cipherSize int64) (response.RSCloser, error) {
+	size := decryptedSize(cipherSize)
+	start, end := int64(0), size-1
+	if rangeHeader, ok := fsctx.Range(ctx); ok {
+		if rangeStart, rangeEnd, ok := parsePlainRange(rangeHeader, size); ok {
+			start, end = rangeStart, rangeEnd
+		}
+	}
+
+	reader := &decryptReader{
+		aead:        aead,
+		nonce:       nonce,
+		cipherSize:  cipherSize,
+		size:        size,
+		offset:      start,
+		remaining:   end - start + 1,
+		ignoreFirst: true,
+		sealed:      make([]byte, encryptCipherChunkSize),
+		plain:       make([]byte, 0, EncryptChunkSize),
+	}
+
+	// 空文件及无法满足的范围无需下载
+	if start > end || start >= size {
+		reader.remaining = 0
+		reader.body = ioutil.NopCloser(bytes.NewReader(nil))
+		return reader, nil
+	}
+
+	reader.index = start / EncryptChunkSize
+	reader.skip = start % EncryptChunkSize
+	cipherStart := reader.index * encryptCipherChunkSize
+	cipherEnd := (end/EncryptChunkSize + 1) * encryptCipherChunkSize
+	if cipherEnd > cipherSize {
+		cipherEnd = cipherSize
+	}
+
+	res, err := handler.download(ctx, path, fmt.Sprintf("bytes=%d-%d", cipherStart, cipherEnd-1))
+	if err != nil {
+		return nil, err
+	}
+	reader.body = res.Response.Body
+
+	// 存储端忽略范围返回完整文件时，跳过之前的分块
+	if res.Response.StatusCode != http.StatusPartialContent && cipherStart > 0 {
+		if _, err := io.CopyN(ioutil.Discard, reader.body, cipherStart); err != nil {
+			reader.body.Close()
+			return nil, err
+		}
+	}
+
+	// 服务端中转时计量用户流量，限速由文件系统统一处理
+	if user, ok := fsctx.User(ctx); ok {
+		return response.MeterDownload(reader, user.ID), nil
+	}
+	return reader, nil
+}
@@ -0,0 +1,374 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+var testEncryptionKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+
+func testAEAD(t *testing.T) cipher.AEAD {
+	handler := Driver{Policy: &model.Policy{OptionsSerialized: model.PolicyOption{
+		OdEncryptionKey: testEncryptionKey,
+	}}}
+	aead, err := handler.encryptionAEAD()
+	assert.NoError(t, err)
+	return aead
+}
+
+func TestEncryptedSize(t *testing.T) {
+	asserts := assert.New(t)
+	for _, size := range []int64{0, 1, EncryptChunkSize - 1, EncryptChunkSize, EncryptChunkSize + 1, 3*EncryptChunkSize + 5} {
+		asserts.Equal(size, decryptedSize(encryptedSize(size)), size)
+	}
+	asserts.EqualValues(encryptTagSize, encryptedSize(0))
+	asserts.EqualValues(EncryptChunkSize+2*encryptTagSize+1, encryptedSize(EncryptChunkSize+1))
+	asserts.EqualValues(0, decryptedSize(3))
+}
+
+func TestDriver_EncryptionAEAD(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 未启用
+	{
+		handler := Driver{Policy: &model.Policy{}}
+		aead, err := handler.encryptionAEAD()
+		asserts.NoError(err)
+		asserts.Nil(aead)
+	}
+
+	// 密钥无效
+	{
+		for _, key := range []string{"???", base64.StdEncoding.EncodeToString([]byte("short"))} {
+			handler := Driver{Policy: &model.Policy{OptionsSerialized: model.PolicyOption{OdEncryptionKey: key}}}
+			aead, err := handler.encryptionAEAD()
+			asserts.Equal(ErrInvalidEncryptionKey, err)
+			asserts.Nil(aead)
+		}
+	}
+}
+
+func TestEncryptReader(t *testing.T) {
+	asserts := assert.New(t)
+	aead := testAEAD(t)
+	nonce, err := newNonce(aead)
+	asserts.NoError(err)
+
+	// 加密后可逐块解密
+	for _, size := range []int{0, 10, EncryptChunkSize, 2*EncryptChunkSize + 100} {
+		content := bytes.Repeat([]byte("a"), size)
+		sealed, err := ioutil.ReadAll(newEncryptReader(bytes.NewReader(content), aead, nonce, int64(size)))
+		asserts.NoError(err)
+		asserts.EqualValues(encryptedSize(int64(size)), len(sealed))
+
+		reader := &decryptReader{
+			body:       ioutil.NopCloser(bytes.NewReader(sealed)),
+			aead:       aead,
+			nonce:      nonce,
+			cipherSize: int64(len(sealed)),
+			size:       int64(size),
+			remaining:  int64(size),
+			sealed:     make([]byte, encryptCipherChunkSize),
+		}
+		plain, err := ioutil.ReadAll(reader)
+		asserts.NoError(err)
+		asserts.Equal(content, append([]byte{}, plain...))
+	}
+
+	// 明文流提前结束
+	{
+		_, err := ioutil.ReadAll(newEncryptReader(strings.NewReader("123"), aead, nonce, 10))
+		asserts.Equal(io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestParsePlainRange(t *testing.T) {
+	asserts := assert.New(t)
+	testCases := []struct {
+		header     string
+		start, end int64
+		ok         bool
+	}{
+		{"bytes=0-9", 0, 9, true},
+		{"bytes=5-", 5, 99, true},
+		{"bytes=-10", 90, 99, true},
+		{"bytes=-200", 0, 99, true},
+		{"bytes=10-500", 10, 99, true},
+		{"bytes=100-", 0, 0, false},
+		{"bytes=9-1", 0, 0, false},
+		{"bytes=0-1,5-6", 0, 0, false},
+		{"items=0-1", 0, 0, false},
+	}
+	for _, testCase := range testCases {
+		start, end, ok := parsePlainRange(testCase.header, 100)
+		asserts.Equal(testCase.ok, ok, testCase.header)
+		if ok {
+			asserts.Equal(testCase.start, start, testCase.header)
+			asserts.Equal(testCase.end, end, testCase.header)
+		}
+	}
+}
+
+func TestDriver_Encryption(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+	content := strings.Repeat("0123456789", EncryptChunkSize/4)
+	handler := Driver{
+		Policy: &model.Policy{OptionsSerialized: model.PolicyOption{
+			OdEncryptionKey: testEncryptionKey,
+		}},
+		HTTPClient: request.HTTPClient{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	// 上传时加密，并记录 nonce
+	var sealed []byte
+	var description string
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "PUT", "drive/root:/enc.txt:/content", testMock.MatchedBy(func(body io.Reader) bool {
+			if len(sealed) == 0 {
+				sealed, _ = ioutil.ReadAll(body)
+			}
+			return true
+		}), testMock.Anything).Return(&request.Response{
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"name":"enc.txt"}`)),
+			},
+		})
+		clientMock.On("Request", "PATCH", "drive/root:/enc.txt", testMock.MatchedBy(func(body io.Reader) bool {
+			var req map[string]string
+			json.NewDecoder(body).Decode(&req)
+			description = req["description"]
+			return true
+		}), testMock.Anything).Return(&request.Response{
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{}`)),
+			},
+		})
+		handler.Client.Request = clientMock
+		ctx := context.WithValue(context.Background(), fsctx.MetadataCtx, map[string]string{"hash": "123"})
+		err := handler.Put(ctx, ioutil.NopCloser(strings.NewReader(content)), "enc.txt", uint64(len(content)))
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.EqualValues(encryptedSize(int64(len(content))), len(sealed))
+		asserts.NotContains(string(sealed), "0123456789")
+
+		metadata := decodeMetadata(description)
+		asserts.Equal("123", metadata["hash"])
+		asserts.Equal(encryptCipherName, metadata[metadataCipherKey])
+		asserts.NotEmpty(metadata[metadataNonceKey])
+	}
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(sealed))
+	}))
+	defer server.Close()
+	cache.Set("onedrive_source_0_preview_enc.txt", server.URL, 0)
+	metaBody, _ := json.Marshal(map[string]interface{}{
+		"name":        "enc.txt",
+		"size":        len(sealed),
+		"description": description,
+	})
+	mockMeta := func() {
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/enc.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(&request.Response{
+				Response: &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader(metaBody)),
+				},
+			})
+		handler.Client.Request = clientMock
+	}
+	serve := func(rangeHeader string) *httptest.ResponseRecorder {
+		mockMeta()
+		ctx := context.Background()
+		if rangeHeader != "" {
+			ctx = context.WithValue(ctx, fsctx.RangeCtx, rangeHeader)
+		}
+		res, err := handler.Get(ctx, "enc.txt")
+		asserts.NoError(err)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		http.ServeContent(rec, req, "enc.txt", time.Time{}, res)
+		res.Close()
+		return rec
+	}
+
+	// 获取时解密
+	{
+		rec := serve("")
+		asserts.Equal(http.StatusOK, rec.Code)
+		asserts.Equal(content, rec.Body.String())
+	}
+
+	// 跨越分块的范围，只获取覆盖范围的分块
+	{
+		ranges = nil
+		start, end := EncryptChunkSize-5, EncryptChunkSize+4
+		rec := serve("bytes=65531-65540")
+		asserts.Equal(http.StatusPartialContent, rec.Code)
+		asserts.Equal("10", rec.Header().Get("Content-Length"))
+		asserts.Equal(content[start:end+1], rec.Body.String())
+		asserts.Equal([]string{"bytes=0-131103"}, ranges)
+	}
+
+	// 位于最后一个分块的范围
+	{
+		ranges = nil
+		rec := serve("bytes=-3")
+		asserts.Equal(http.StatusPartialContent, rec.Code)
+		asserts.Equal(content[len(content)-3:], rec.Body.String())
+		asserts.Equal([]string{"bytes=131104-163887"}, ranges)
+	}
+
+	// 列取时使用明文大小
+	{
+		mockMeta()
+		res, err := handler.Head(context.Background(), "enc.txt")
+		asserts.NoError(err)
+		asserts.EqualValues(len(content), res.Size)
+	}
+
+	// 密文被篡改
+	{
+		sealed[10] ^= 1
+		mockMeta()
+		res, err := handler.Get(context.Background(), "enc.txt")
+		asserts.NoError(err)
+		res.Seek(0, io.SeekEnd)
+		_, err = ioutil.ReadAll(res)
+		asserts.Equal(ErrDecryptFailed, err)
+		sealed[10] ^= 1
+	}
+
+	// 启用加密前上传的文件原样返回
+	{
+		plainMeta, _ := json.Marshal(map[string]interface{}{"name": "enc.txt", "size": len(sealed)})
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/enc.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(&request.Response{
+				Response: &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader(plainMeta)),
+				},
+			})
+		handler.Client.Request = clientMock
+		ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, model.File{Size: uint64(len(sealed))})
+		res, err := handler.Get(ctx, "enc.txt")
+		asserts.NoError(err)
+		res.Seek(0, io.SeekEnd)
+		body, err := ioutil.ReadAll(res)
+		asserts.NoError(err)
+		asserts.Equal(sealed, body)
+	}
+}
+
+func TestDriver_Token_Encryption(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{Policy: &model.Policy{OptionsSerialized: model.PolicyOption{
+		OdEncryptionKey: testEncryptionKey,
+	}}}
+	handler.Client, _ = NewClient(&model.Policy{})
+
+	// 需要加密的文件由服务端中转
+	ctx := context.WithValue(context.Background(), fsctx.SavePathCtx, "/enc.txt")
+	ctx = context.WithValue(ctx, fsctx.FileSizeCtx, uint64(1<<30))
+	res, err := handler.Token(ctx, 10, "key")
+	asserts.NoError(err)
+	asserts.Empty(res.Policy)
+	asserts.Empty(res.Token)
+}
+
+func TestDriver_Source_Encryption(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{Policy: &model.Policy{OptionsSerialized: model.PolicyOption{
+		OdEncryptionKey: testEncryptionKey,
+	}}}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	// 未设置期望的请求均会导致失败，确保不会获取直链
+	handler.Client.Request = ClientMock{}
+	auth.General = auth.HMACAuth{SecretKey: []byte("test")}
+	baseURL, _ := url.Parse("https://cloudreve.org")
+	cache.Set("onedrive_source_0_preview_enc.txt", "https://graph.invalid/enc.txt", 0)
+	cache.Set("onedrive_source_0_download_enc.txt", "https://graph.invalid/enc.txt", 0)
+
+	// 预览、下载均经由服务端中转，忽略已缓存的直链
+	for _, isDownload := range []bool{false, true} {
+		ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, model.File{Name: "1.txt", SourceName: "enc.txt"})
+		res, err := handler.Source(ctx, "enc.txt", *baseURL, 60, isDownload, 0)
+		asserts.NoError(err)
+		asserts.True(strings.HasPrefix(res, "https://cloudreve.org/api/v3/file/download/"), res)
+		asserts.NotContains(res, "graph.invalid")
+
+		sessionURL, _ := url.Parse(res)
+		file, ok := cache.Get("download_" + path.Base(sessionURL.Path))
+		asserts.True(ok)
+		asserts.Equal("1.txt", file.(model.File).Name)
+		asserts.Equal("enc.txt", file.(model.File).SourceName)
+	}
+
+	// 指定下载文件名
+	{
+		ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, model.File{Name: "1.txt", SourceName: "enc.txt"})
+		ctx = context.WithValue(ctx, fsctx.DownloadFileNameCtx, "文件.txt")
+		res, err := handler.Source(ctx, "enc.txt", *baseURL, 60, true, 0)
+		asserts.NoError(err)
+		sessionURL, _ := url.Parse(res)
+		file, _ := cache.Get("download_" + path.Base(sessionURL.Path))
+		asserts.Equal("文件.txt", file.(model.File).Name)
+	}
+
+	// 批量获取时没有可用的直链
+	{
+		res, err := handler.SourceBatch(context.Background(), []string{"enc.txt", "b.txt"}, 60)
+		asserts.Empty(res)
+		asserts.Equal(ErrEncryptedDirectLink, err.(*SourceBatchError).Errors["b.txt"])
+	}
+}
+
+func TestDriver_PreviewURL_Encryption(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{Policy: &model.Policy{OptionsSerialized: model.PolicyOption{
+		OdEncryptionKey: testEncryptionKey,
+	}}}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Request = ClientMock{}
+
+	res, err := handler.PreviewURL(context.Background(), "enc.docx")
+	asserts.Empty(res)
+	asserts.Equal(ErrEncryptedDirectLink, err)
+}
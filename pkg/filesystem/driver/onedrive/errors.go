@@ -0,0 +1,98 @@
+package onedrive
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// withResponse 记录产生错误的响应状态码及请求ID
+func (err *RespError) withResponse(resp *http.Response) *RespError {
+	err.Status = resp.StatusCode
+	err.RequestID = resp.Header.Get("request-id")
+	if err.RequestID == "" {
+		err.RequestID = err.APIError.InnerError.RequestID
+	}
+	return err
+}
+
+// asRespError 从错误链中取出 OneDrive 接口错误
+func asRespError(err error) (*RespError, bool) {
+	var respErr *RespError
+	if errors.As(err, &respErr) {
+		return respErr, respErr != nil
+	}
+	var respErrValue RespError
+	if errors.As(err, &respErrValue) {
+		return &respErrValue, true
+	}
+	return nil, false
+}
+
+// IsNotFound 返回错误是否表示文件或目录不存在
+func IsNotFound(err error) bool {
+	respErr, ok := asRespError(err)
+	return ok && (respErr.Status == http.StatusNotFound || respErr.APIError.Code == "itemNotFound")
+}
+
+// IsNameConflict 返回错误是否表示目标位置已存在同名项目
+func IsNameConflict(err error) bool {
+	if errors.Is(err, ErrObjectExists) {
+		return true
+	}
+	respErr, ok := asRespError(err)
+	return ok && (respErr.Status == http.StatusConflict || respErr.APIError.Code == "nameAlreadyExists")
+}
+
+// IsQuotaExceeded 返回错误是否表示 OneDrive 存储空间不足
+func IsQuotaExceeded(err error) bool {
+	respErr, ok := asRespError(err)
+	return ok && (respErr.Status == http.StatusInsufficientStorage || respErr.APIError.Code == "quotaLimitReached")
+}
+
+// IsThrottled 返回错误是否表示请求被限流，重试次数用尽后仍被限流时返回此错误
+func IsThrottled(err error) bool {
+	respErr, ok := asRespError(err)
+	return ok && (isThrottled(respErr.Status) || respErr.APIError.Code == "activityLimitReached")
+}
+
+// IsUnauthorized 返回错误是否表示访问令牌无效或已过期，通常需要重新授权
+func IsUnauthorized(err error) bool {
+	respErr, ok := asRespError(err)
+	if !ok {
+		return false
+	}
+	switch respErr.APIError.Code {
+	case "InvalidAuthenticationToken", "unauthenticated":
+		return true
+	}
+	return respErr.Status == http.StatusUnauthorized
+}
+
+// Is 使接口错误可由 errors.Is 与 ErrVaultLocked、ErrReadOnly 比较
+func (err RespError) Is(target error) bool {
+	switch target {
+	case ErrVaultLocked:
+		return err.hasCode("vaultLocked") ||
+			(err.APIError.Code == "accessDenied" && strings.Contains(strings.ToLower(err.APIError.Message), "vault"))
+	case ErrReadOnly:
+		return err.hasCode("serviceReadOnly") || err.hasCode("readOnly")
+	}
+	return false
+}
+
+// hasCode 返回错误码或更具体的错误码是否为 code，不区分大小写
+func (err RespError) hasCode(code string) bool {
+	return strings.EqualFold(err.APIError.Code, code) || strings.EqualFold(err.APIError.InnerError.Code, code)
+}
+
+// IsVaultLocked 返回错误是否表示访问的项目位于已锁定的个人保管库中，需由用户在 OneDrive 中解锁。
+// 该错误未见于 Graph 文档，按错误码 vaultLocked 或提及保管库的 accessDenied 识别
+func IsVaultLocked(err error) bool {
+	return errors.Is(err, ErrVaultLocked)
+}
+
+// IsReadOnly 返回错误是否表示目标驱动器或服务处于只读状态
+func IsReadOnly(err error) bool {
+	return errors.Is(err, ErrReadOnly)
+}
@@ -0,0 +1,301 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestErrorPredicates(t *testing.T) {
+	asserts := assert.New(t)
+	testCases := []struct {
+		err          error
+		notFound     bool
+		quota        bool
+		throttled    bool
+		unauthorized bool
+	}{
+		{&RespError{Status: 404, APIError: APIError{Code: "itemNotFound"}}, true, false, false, false},
+		{RespError{APIError: APIError{Code: "itemNotFound"}}, true, false, false, false},
+		{&RespError{Status: 507, APIError: APIError{Code: "quotaLimitReached"}}, false, true, false, false},
+		{&RespError{Status: 429, APIError: APIError{Code: "tooManyRequests"}}, false, false, true, false},
+		{&RespError{Status: 503}, false, false, true, false},
+		{&RespError{Status: 401, APIError: APIError{Code: "InvalidAuthenticationToken"}}, false, false, false, true},
+		{&RespError{Status: 403, APIError: APIError{Code: "accessDenied"}}, false, false, false, false},
+		// 被包装的错误
+		{fmt.Errorf("wrapped: %w", &RespError{Status: 404}), true, false, false, false},
+		// 非接口错误
+		{errors.New("error"), false, false, false, false},
+		{nil, false, false, false, false},
+	}
+
+	for i, testCase := range testCases {
+		asserts.Equal(testCase.notFound, IsNotFound(testCase.err), "Test Case #%d", i)
+		asserts.Equal(testCase.quota, IsQuotaExceeded(testCase.err), "Test Case #%d", i)
+		asserts.Equal(testCase.throttled, IsThrottled(testCase.err), "Test Case #%d", i)
+		asserts.Equal(testCase.unauthorized, IsUnauthorized(testCase.err), "Test Case #%d", i)
+	}
+}
+
+func TestClient_Request_RespError(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	client.Credential.AccessToken = "AccessToken"
+
+	mockResponse := func(code int, header http.Header, body string) {
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			testMock.Anything,
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: code,
+				Header:     header,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			},
+		})
+		client.Request = clientMock
+	}
+
+	// 从响应头中获取请求ID
+	{
+		mockResponse(507, http.Header{"Request-Id": {"header-id"}}, `{"error":{"code":"quotaLimitReached","message":"full","innerError":{"request-id":"body-id"}}}`)
+		_, err := client.request(context.Background(), "GET", "url", nil)
+		asserts.Error(err)
+		asserts.Equal(507, err.Status)
+		asserts.Equal("header-id", err.RequestID)
+		asserts.Equal("full", err.Error())
+		asserts.True(IsQuotaExceeded(err))
+	}
+
+	// 从响应正文中获取请求ID
+	{
+		mockResponse(404, nil, `{"error":{"code":"itemNotFound","innerError":{"request-id":"body-id"}}}`)
+		_, err := client.request(context.Background(), "GET", "url", nil)
+		asserts.Error(err)
+		asserts.Equal("body-id", err.RequestID)
+		asserts.True(IsNotFound(err))
+	}
+
+	// 无法解析的错误响应仍保留状态码
+	{
+		mockResponse(401, nil, `???`)
+		_, err := client.request(context.Background(), "GET", "url", nil)
+		asserts.Error(err)
+		asserts.Equal("system", err.APIError.Code)
+		asserts.True(IsUnauthorized(err))
+	}
+}
+
+func TestDriver_Get_RespError(t *testing.T) {
+	asserts := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("request-id", "download-id")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	handler := Driver{
+		Policy:     &model.Policy{},
+		HTTPClient: request.HTTPClient{},
+	}
+	cache.Set("onedrive_source_0_preview_missing.txt", server.URL, 0)
+	res, err := handler.Get(context.Background(), "missing.txt")
+	asserts.Nil(res)
+	asserts.True(IsNotFound(err))
+	asserts.Equal("download-id", err.(*RespError).RequestID)
+}
+
+func TestDriver_Get_Deleted(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	handler := Driver{
+		Policy:     &model.Policy{},
+		HTTPClient: request.HTTPClient{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	// 缓存的下载地址返回 404，清除缓存
+	{
+		cache.Set("onedrive_source_0_preview_deleted.txt", server.URL, 0)
+		setCachedThumb(0, "deleted.txt", 400, 300, "thumb", 60)
+		res, err := handler.Get(context.Background(), "deleted.txt")
+		asserts.Nil(res)
+		asserts.True(IsNotFound(err))
+		_, ok := cache.Get("onedrive_source_0_preview_deleted.txt")
+		asserts.False(ok)
+		_, ok = getCachedThumb(0, "deleted.txt", 400, 300)
+		asserts.False(ok)
+	}
+
+	// 缓存清除后重新获取元信息，文件不存在
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/deleted.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(&request.Response{
+				Response: &http.Response{
+					StatusCode: 404,
+					Body:       ioutil.NopCloser(strings.NewReader(`{"error":{"code":"itemNotFound","message":"not found"}}`)),
+				},
+			})
+		handler.Client.Request = clientMock
+		res, err := handler.Get(context.Background(), "deleted.txt")
+		clientMock.AssertExpectations(t)
+		asserts.Nil(res)
+		asserts.True(IsNotFound(err))
+		_, ok := cache.Get("onedrive_source_0_preview_deleted.txt")
+		asserts.False(ok)
+	}
+
+	// 其他错误不清除缓存
+	{
+		errServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer errServer.Close()
+		cache.Set("onedrive_source_0_preview_error.txt", errServer.URL, 0)
+		res, err := handler.Get(context.Background(), "error.txt")
+		asserts.Nil(res)
+		asserts.Error(err)
+		asserts.False(IsNotFound(err))
+		_, ok := cache.Get("onedrive_source_0_preview_error.txt")
+		asserts.True(ok)
+	}
+}
+
+func TestVaultLockedAndReadOnly(t *testing.T) {
+	asserts := assert.New(t)
+	testCases := []struct {
+		body     string
+		vault    bool
+		readOnly bool
+	}{
+		{`{"error":{"code":"accessDenied","message":"Access denied","innerError":{"code":"vaultLocked"}}}`, true, false},
+		{`{"error":{"code":"accessDenied","message":"The Personal Vault is locked"}}`, true, false},
+		{`{"error":{"code":"VaultLocked","message":"locked"}}`, true, false},
+		{`{"error":{"code":"notAllowed","message":"read only","innerError":{"code":"serviceReadOnly"}}}`, false, true},
+		{`{"error":{"code":"serviceReadOnly","message":"read only"}}`, false, true},
+		{`{"error":{"code":"accessDenied","message":"Access denied"}}`, false, false},
+		{`{"error":{"code":"itemNotFound","message":"not found"}}`, false, false},
+	}
+
+	for i, testCase := range testCases {
+		var respErr RespError
+		asserts.NoError(json.Unmarshal([]byte(testCase.body), &respErr))
+		respErr.Status = 403
+		asserts.Equal(testCase.vault, IsVaultLocked(&respErr), "Test Case #%d", i)
+		asserts.Equal(testCase.readOnly, IsReadOnly(&respErr), "Test Case #%d", i)
+		asserts.Equal(testCase.vault, IsVaultLocked(fmt.Errorf("wrapped: %w", respErr)), "Test Case #%d", i)
+	}
+
+	asserts.True(IsReadOnly(ErrReadOnly))
+	asserts.True(IsVaultLocked(ErrVaultLocked))
+	asserts.False(IsReadOnly(errors.New("error")))
+}
+
+func TestDriver_Put_ReadOnly(t *testing.T) {
+	asserts := assert.New(t)
+	policy := &model.Policy{}
+	policy.ID = 97
+	handler := Driver{Policy: policy}
+	handler.Client, _ = NewClient(policy)
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_chunk_retries", "0", 0)
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+	cache.Set("setting_onedrive_readonly_cache_ttl", "300", 0)
+	respond := func(body string) func() *request.Response {
+		return func() *request.Response {
+			return &request.Response{
+				Response: &http.Response{
+					StatusCode: 403,
+					Header:     http.Header{},
+					Body:       ioutil.NopCloser(strings.NewReader(body)),
+				},
+			}
+		}
+	}
+	put := func() error {
+		return handler.Put(context.Background(), ioutil.NopCloser(strings.NewReader("content")), "a.txt", 7)
+	}
+
+	// 个人保管库已锁定
+	{
+		var calls int32
+		handler.Client.Request = countingClientMock{calls: &calls, respond: respond(
+			`{"error":{"code":"accessDenied","message":"Access denied","innerError":{"code":"vaultLocked"}}}`,
+		)}
+		asserts.Equal(ErrVaultLocked, put())
+		asserts.EqualValues(1, calls)
+		// 保管库锁定不影响其他路径的写入
+		asserts.NoError(handler.checkWritable())
+	}
+
+	// 驱动器只读，此后的写入直接失败
+	{
+		var calls int32
+		handler.Client.Request = countingClientMock{calls: &calls, respond: respond(
+			`{"error":{"code":"notAllowed","message":"read only","innerError":{"code":"serviceReadOnly"}}}`,
+		)}
+		asserts.Equal(ErrReadOnly, put())
+		asserts.EqualValues(1, calls)
+
+		asserts.Equal(ErrReadOnly, put())
+		failed, err := handler.Delete(context.Background(), []string{"a.txt"})
+		asserts.Equal(ErrReadOnly, err)
+		asserts.Equal([]string{"a.txt"}, failed)
+		failed, err = handler.DeletePrefix(context.Background(), "/dir")
+		asserts.Equal(ErrReadOnly, err)
+		asserts.Equal([]string{"dir"}, failed)
+		asserts.Equal(ErrReadOnly, handler.Move(context.Background(), "a.txt", "b.txt"))
+		asserts.Equal(ErrReadOnly, handler.Copy(context.Background(), "a.txt", "b.txt"))
+		asserts.Equal(ErrReadOnly, handler.MakeDir(context.Background(), "dir"))
+		asserts.Equal(ErrReadOnly, handler.Rename(context.Background(), "a.txt", "b.txt"))
+		asserts.EqualValues(1, calls)
+	}
+
+	// 其他写入操作遇到只读错误时同样记录只读状态
+	{
+		cache.Deletes([]string{"97"}, readOnlyCachePrefix)
+		var calls int32
+		handler.Client.Request = countingClientMock{calls: &calls, respond: respond(
+			`{"error":{"code":"notAllowed","message":"read only","innerError":{"code":"serviceReadOnly"}}}`,
+		)}
+		asserts.Equal(ErrReadOnly, handler.Rename(context.Background(), "a.txt", "b.txt"))
+		asserts.EqualValues(1, calls)
+		asserts.Equal(ErrReadOnly, handler.checkWritable())
+	}
+
+	// 只读记录过期后恢复写入
+	{
+		cache.Deletes([]string{"97"}, readOnlyCachePrefix)
+		asserts.NoError(handler.checkWritable())
+	}
+}
@@ -0,0 +1,95 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+)
+
+// conditionalCachePrefix 条件请求响应缓存在缓存中的键前缀
+const conditionalCachePrefix = "onedrive_etag_"
+
+// getWithETag 发送 GET 请求并缓存带 ETag 的响应。已有缓存时附带 If-None-Match 头，
+// 服务端返回 304 时复用缓存的响应正文，仅刷新缓存有效期。仅用于不含短期有效地址的响应，
+// 如列取目录结果
+func (client *Client) getWithETag(ctx context.Context, requestURL string) (string, *RespError) {
+	cacheKey := conditionalCachePrefix + policyCacheKey(client.policyID(), requestURL)
+	ttl := model.GetIntSetting("onedrive_etag_cache_ttl", 3600)
+
+	var cached *ConditionalCache
+	if raw, ok := cache.Get(cacheKey); ok {
+		if res, ok := raw.(ConditionalCache); ok && res.ETag != "" {
+			cached = &res
+		}
+	}
+
+	option := []request.Option{request.WithTimeout(client.requestTimeout())}
+	if cached != nil {
+		option = append(option, request.WithHeader(http.Header{"If-None-Match": {cached.ETag}}))
+	}
+
+	body, resp, err := client.requestWithResp(ctx, "GET", requestURL, nil, option...)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		if cached == nil {
+			return "", sysError(ErrUnexpectedNotModified)
+		}
+		_ = cache.Set(cacheKey, *cached, ttl)
+		return cached.Body, nil
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" && ttl > 0 {
+		_ = cache.Set(cacheKey, ConditionalCache{ETag: etag, Body: body}, ttl)
+	}
+
+	return body, nil
+}
+
+// ListChildrenIfChanged 以目录自身的 ETag 发送条件请求，目录未变更（304）时返回 changed=false，
+// 不再列取子项目；已变更或 knownETag 为空时列取全部子项目，并返回目录新的 ETag
+func (client *Client) ListChildrenIfChanged(ctx context.Context, path, knownETag string) ([]FileInfo, bool, string, error) {
+	dst := strings.TrimPrefix(path, "/")
+	requestURL := client.getItemRequestURL(dst, "")
+
+	option := []request.Option{request.WithTimeout(client.requestTimeout())}
+	if knownETag != "" {
+		option = append(option, request.WithHeader(http.Header{"If-None-Match": {knownETag}}))
+	}
+
+	body, resp, respErr := client.requestWithResp(ctx, "GET", requestURL, nil, option...)
+	if respErr != nil {
+		return nil, false, "", respErr
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		if knownETag == "" {
+			return nil, false, "", sysError(ErrUnexpectedNotModified)
+		}
+		return nil, false, knownETag, nil
+	}
+
+	var info FileInfo
+	if err := json.Unmarshal([]byte(body), &info); err != nil {
+		return nil, false, "", err
+	}
+	if info.Folder == nil {
+		return nil, false, "", ErrNotFolder
+	}
+
+	objects, err := client.ListChildren(ctx, path)
+	if err != nil {
+		return nil, false, "", err
+	}
+
+	newETag := info.ETag
+	if newETag == "" {
+		newETag = resp.Header.Get("ETag")
+	}
+	return objects, true, newETag, nil
+}
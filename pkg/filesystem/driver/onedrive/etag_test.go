@@ -0,0 +1,299 @@
+package onedrive
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+// etagResponse 构造带 ETag 头的响应
+func etagResponse(status int, etag, body string) *request.Response {
+	return &request.Response{
+		Err: nil,
+		Response: &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Etag": {etag}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		},
+	}
+}
+
+func TestClient_GetWithETag(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_etag_cache_ttl", "3600", 0)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	// 元信息含有短期有效的下载地址，不使用 ETag 缓存
+	{
+		cache.Deletes([]string{policyCacheKey(0, "drive/root:/etag/a.txt?expand=thumbnails")}, conditionalCachePrefix)
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			"drive/root:/etag/a.txt?expand=thumbnails",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(etagResponse(200, `"v1"`, `{"id":"1","name":"a.txt","size":10}`)).Once()
+		clientMock.On(
+			"Request",
+			"GET",
+			"drive/root:/etag/a.txt?expand=thumbnails",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(etagResponse(200, `"v1"`, `{"id":"1","name":"a.txt","size":10}`)).Once()
+		client.Request = clientMock
+
+		res, err := client.Meta(context.Background(), "", "/etag/a.txt")
+		asserts.NoError(err)
+		asserts.Equal("a.txt", res.Name)
+		_, ok := cache.Get(conditionalCachePrefix + policyCacheKey(0, "drive/root:/etag/a.txt?expand=thumbnails"))
+		asserts.False(ok)
+
+		res, err = client.Meta(context.Background(), "", "/etag/a.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.EqualValues(10, res.Size)
+	}
+
+	// 列取目录：304 时复用缓存的子项目
+	{
+		requestURL := "drive/root:/etag/dir:/children?$top=999999999"
+		cache.Deletes([]string{policyCacheKey(0, requestURL)}, conditionalCachePrefix)
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			requestURL,
+			testMock.Anything,
+			testMock.Anything,
+		).Return(etagResponse(200, `"dir1"`, `{"value":[{"name":"b.txt"},{"name":"c.txt"}]}`)).Once()
+		clientMock.On(
+			"Request",
+			"GET",
+			requestURL,
+			testMock.Anything,
+			testMock.Anything,
+		).Return(etagResponse(304, `"dir1"`, ``)).Once()
+		client.Request = clientMock
+
+		res, err := client.ListChildren(context.Background(), "/etag/dir")
+		asserts.NoError(err)
+		asserts.Len(res, 2)
+
+		res, err = client.ListChildren(context.Background(), "/etag/dir")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Len(res, 2)
+		asserts.Equal("c.txt", res[1].Name)
+	}
+
+	// 内容变更时使用新的响应并更新缓存
+	{
+		requestURL := "drive/root:/etag/b:/children?$top=999999999"
+		cache.Set(conditionalCachePrefix+policyCacheKey(0, requestURL), ConditionalCache{ETag: `"old"`, Body: `{"value":[{"name":"old.txt"}]}`}, 0)
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			requestURL,
+			testMock.Anything,
+			testMock.Anything,
+		).Return(etagResponse(200, `"new"`, `{"value":[{"name":"b.txt"}]}`))
+		client.Request = clientMock
+
+		res, err := client.ListChildren(context.Background(), "/etag/b")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("b.txt", res[0].Name)
+		cached, _ := cache.Get(conditionalCachePrefix + policyCacheKey(0, requestURL))
+		asserts.Equal(`"new"`, cached.(ConditionalCache).ETag)
+	}
+
+	// 无缓存时收到 304
+	{
+		requestURL := "drive/root:/etag/c:/children?$top=999999999"
+		cache.Deletes([]string{policyCacheKey(0, requestURL)}, conditionalCachePrefix)
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			requestURL,
+			testMock.Anything,
+			testMock.Anything,
+		).Return(etagResponse(304, `"v1"`, ``))
+		client.Request = clientMock
+
+		_, respErr := client.getWithETag(context.Background(), requestURL)
+		clientMock.AssertExpectations(t)
+		asserts.NotNil(respErr)
+	}
+}
+
+func TestClient_ListChildrenIfChanged(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	// 目录未变更，不列取子项目
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/changed", testMock.Anything, testMock.Anything).
+			Return(etagResponse(http.StatusNotModified, `"v1"`, ``))
+		client.Request = clientMock
+		res, changed, etag, err := client.ListChildrenIfChanged(context.Background(), "/changed", `"v1"`)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.False(changed)
+		asserts.Nil(res)
+		asserts.Equal(`"v1"`, etag)
+	}
+
+	// 目录已变更，列取子项目并返回新的 ETag
+	{
+		cache.Deletes([]string{policyCacheKey(0, "drive/root:/changed:/children?$top=999999999")}, conditionalCachePrefix)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/changed", testMock.Anything, testMock.Anything).
+			Return(etagResponse(200, `"v2"`, `{"name":"changed","eTag":"\"v2\"","folder":{}}`))
+		clientMock.On("Request", "GET", "drive/root:/changed:/children?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(etagResponse(200, "", `{"value":[{"name":"a.txt"}]}`))
+		client.Request = clientMock
+		res, changed, etag, err := client.ListChildrenIfChanged(context.Background(), "changed", `"v1"`)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.True(changed)
+		asserts.Len(res, 1)
+		asserts.Equal(`"v2"`, etag)
+	}
+
+	// 目标不是目录
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root", testMock.Anything, testMock.Anything).
+			Return(etagResponse(200, `"v1"`, `{"name":"root"}`))
+		client.Request = clientMock
+		_, changed, _, err := client.ListChildrenIfChanged(context.Background(), "/", "")
+		clientMock.AssertExpectations(t)
+		asserts.Equal(ErrNotFolder, err)
+		asserts.False(changed)
+	}
+
+	// 请求失败
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/changed", testMock.Anything, testMock.Anything).
+			Return(etagResponse(http.StatusNotFound, "", `{"error":{"code":"itemNotFound"}}`))
+		client.Request = clientMock
+		_, changed, _, err := client.ListChildrenIfChanged(context.Background(), "changed", `"v1"`)
+		clientMock.AssertExpectations(t)
+		asserts.True(IsNotFound(err))
+		asserts.False(changed)
+	}
+}
+
+func TestDriver_ListIfChanged(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{Policy: &model.Policy{}}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	// 未变更
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/dir", testMock.Anything, testMock.Anything).
+			Return(etagResponse(http.StatusNotModified, `"v1"`, ``))
+		handler.Client.Request = clientMock
+		res, changed, etag, err := handler.ListIfChanged(context.Background(), "/dir", `"v1"`)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.False(changed)
+		asserts.Empty(res)
+		asserts.Equal(`"v1"`, etag)
+	}
+
+	// 已变更
+	{
+		cache.Deletes([]string{policyCacheKey(0, "drive/root:/dir:/children?$top=999999999")}, conditionalCachePrefix)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/dir", testMock.Anything, testMock.Anything).
+			Return(etagResponse(200, `"v2"`, `{"name":"dir","eTag":"\"v2\"","folder":{}}`))
+		clientMock.On("Request", "GET", "drive/root:/dir:/children?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(etagResponse(200, "", `{"value":[{"name":"a.txt"}]}`))
+		handler.Client.Request = clientMock
+		res, changed, etag, err := handler.ListIfChanged(context.Background(), "/dir", `"v1"`)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.True(changed)
+		asserts.Equal(`"v2"`, etag)
+		asserts.Len(res, 1)
+		asserts.Equal("dir/a.txt", res[0].Source)
+		asserts.Equal("a.txt", res[0].RelativePath)
+	}
+}
+
+func TestDriver_Get_ExpiredSourceNotModified(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_etag_cache_ttl", "3600", 0)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_source_timeout", "1800", 0)
+	expired := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer expired.Close()
+	fresh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer fresh.Close()
+	// 项目未变更，带 If-None-Match 的请求一律返回 304
+	var conditional int32
+	graph := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			atomic.AddInt32(&conditional, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"name":"a.txt","file":{},"@microsoft.graph.downloadUrl":"` + fresh.URL + `"}`))
+	}))
+	defer graph.Close()
+
+	handler := Driver{Policy: &model.Policy{}, HTTPClient: request.HTTPClient{}}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Endpoints.EndpointURL = graph.URL
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	handler.Client.Request = request.HTTPClient{}
+
+	// 缓存的下载地址已失效，即使存在旧的元信息缓存，也重新获取有效的地址
+	metaURL := handler.Client.getRequestURL("drive/root:/a.txt") + "?expand=thumbnails"
+	cache.Set(conditionalCachePrefix+policyCacheKey(0, metaURL), ConditionalCache{
+		ETag: `"v1"`,
+		Body: `{"name":"a.txt","file":{},"@microsoft.graph.downloadUrl":"` + expired.URL + `"}`,
+	}, 0)
+	cache.Set(sourceCachePrefix+getSourceCacheKey(0, "a.txt", false), expired.URL, 0)
+	res, err := handler.Get(context.Background(), "a.txt")
+	asserts.NoError(err)
+	defer res.Close()
+	_, err = res.Seek(0, io.SeekStart)
+	asserts.NoError(err)
+	content, err := ioutil.ReadAll(res)
+	asserts.NoError(err)
+	asserts.Equal("content", string(content))
+	asserts.EqualValues(0, atomic.LoadInt32(&conditional))
+	cache.Deletes([]string{policyCacheKey(0, metaURL)}, conditionalCachePrefix)
+}
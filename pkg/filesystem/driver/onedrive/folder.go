@@ -0,0 +1,130 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+)
+
+// CreateFolder 在 parent 下创建名为 name 的目录。同名目录已存在时（如并发的上传
+// 同时创建同一个上级目录）视为创建成功，返回已存在的目录；同名项目不是目录时返回 ErrNotFolder
+func (client *Client) CreateFolder(ctx context.Context, parent, name string) (*FileInfo, error) {
+	info, err := client.createFolder(ctx, parent, name)
+	if err == nil || !IsNameConflict(err) {
+		return info, err
+	}
+
+	existing, err := client.Meta(ctx, "", path.Join(parent, name))
+	if err != nil {
+		return nil, err
+	}
+	if existing.Folder == nil {
+		return nil, ErrNotFolder
+	}
+	return existing, nil
+}
+
+// createFolder 在 parent 下创建名为 name 的目录，已存在同名项目时返回 OneDrive 的冲突错误
+func (client *Client) createFolder(ctx context.Context, parent, name string) (*FileInfo, error) {
+	requestURL := client.getItemRequestURL(strings.TrimPrefix(parent, "/"), "children")
+	bodyBytes, _ := json.Marshal(map[string]interface{}{
+		"name":                              name,
+		"folder":                            map[string]interface{}{},
+		"@microsoft.graph.conflictBehavior": "fail",
+	})
+
+	res, err := client.requestWithStr(ctx, "POST", requestURL, string(bodyBytes), 201)
+	if err != nil {
+		return nil, err
+	}
+
+	var info FileInfo
+	if err := json.Unmarshal([]byte(res), &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// EnsureFolder 确保 dir 处的目录存在，自最深的已存在目录起逐级创建缺失的上级目录，
+// 并清除所在目录的列取结果缓存。可被多个上传并发调用
+func (client *Client) EnsureFolder(ctx context.Context, dir string) error {
+	dir = strings.Trim(dir, "/")
+	if dir == "" || dir == "." {
+		return nil
+	}
+
+	info, err := client.Meta(ctx, "", dir)
+	if err == nil {
+		if info.Folder == nil {
+			return ErrNotFolder
+		}
+		return nil
+	}
+	if !IsNotFound(err) {
+		return err
+	}
+
+	parent := path.Dir(dir)
+	if parent == "." {
+		parent = ""
+	}
+	if err := client.EnsureFolder(ctx, parent); err != nil {
+		return err
+	}
+	if _, err := client.CreateFolder(ctx, parent, path.Base(dir)); err != nil {
+		return err
+	}
+	if client.Policy != nil {
+		invalidateListCache(client.Policy.ID, dir)
+		invalidateNotFoundCache(client.Policy.ID, dir)
+	}
+	return nil
+}
+
+// withParentFolders 执行按路径寻址 dst 的上传请求 upload。OneDrive 个人版及商业版
+// 上传时通常会自动创建缺失的上级目录，但该行为未见于文档，部分驱动器会返回
+// itemNotFound；此时创建 dst 的上级目录后重试一次
+func (client *Client) withParentFolders(ctx context.Context, dst string, upload func() error) error {
+	err := upload()
+	if err == nil || !IsNotFound(err) {
+		return err
+	}
+
+	client.log(ctx).Debug("文件[%s]的上级目录不存在，创建后重试", dst)
+	if folderErr := client.EnsureFolder(ctx, path.Dir(strings.Trim(dst, "/"))); folderErr != nil {
+		return folderErr
+	}
+	return upload()
+}
+
+// MakeDir 创建 dir 处的空目录，缺失的上级目录将被逐级创建。dir 处已存在同名文件或目录时
+// 返回 ErrObjectExists
+func (handler Driver) MakeDir(ctx context.Context, dir string) error {
+	dir = strings.Trim(dir, "/")
+	if dir == "" {
+		return ErrObjectExists
+	}
+	if err := handler.checkWritable(); err != nil {
+		return err
+	}
+	parent := path.Dir(dir)
+	if parent == "." {
+		parent = ""
+	}
+
+	err := handler.Client.withParentFolders(ctx, dir, func() error {
+		_, err := handler.Client.createFolder(ctx, parent, path.Base(dir))
+		return err
+	})
+	if err != nil {
+		if IsNameConflict(err) {
+			return ErrObjectExists
+		}
+		return handler.writeError(ctx, err)
+	}
+
+	invalidateListCache(handler.Policy.ID, dir)
+	invalidateNotFoundCache(handler.Policy.ID, dir)
+	return nil
+}
@@ -0,0 +1,246 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+// folderTreeClientMock 模拟不会自动创建上级目录的驱动器，items 记录已存在的项目及其是否为目录
+type folderTreeClientMock struct {
+	mu    *sync.Mutex
+	items map[string]bool
+	// created 各目录的创建请求次数
+	created map[string]int
+	// createDelay 创建目录前等待的时间，用于模拟并发创建
+	createDelay time.Duration
+}
+
+func newFolderTreeClientMock() folderTreeClientMock {
+	return folderTreeClientMock{
+		mu:      &sync.Mutex{},
+		items:   map[string]bool{"": true},
+		created: make(map[string]int),
+	}
+}
+
+func (m folderTreeClientMock) exists(p string) (isDir, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	isDir, ok = m.items[p]
+	return
+}
+
+func (m folderTreeClientMock) Request(method, target string, body io.Reader, opts ...request.Option) *request.Response {
+	respond := func(status int, resBody string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: status,
+				Body:       ioutil.NopCloser(strings.NewReader(resBody)),
+			},
+		}
+	}
+	notFound := respond(404, `{"error":{"code":"itemNotFound","message":"not found"}}`)
+	itemPath := func(api string) string {
+		p := strings.TrimPrefix(target, "drive/root")
+		p = strings.TrimPrefix(strings.TrimSuffix(p, api), ":")
+		return strings.Trim(strings.TrimSuffix(p, ":"), "/")
+	}
+
+	switch {
+	case method == "GET":
+		p := itemPath("?expand=thumbnails")
+		isDir, ok := m.exists(p)
+		if !ok {
+			return notFound
+		}
+		if isDir {
+			return respond(200, `{"name":"`+path.Base(p)+`","folder":{}}`)
+		}
+		return respond(200, `{"name":"`+path.Base(p)+`","file":{}}`)
+	case method == "POST" && strings.HasSuffix(target, "/children"):
+		parent := itemPath("/children")
+		var req struct {
+			Name string `json:"name"`
+		}
+		content, _ := ioutil.ReadAll(body)
+		json.Unmarshal(content, &req)
+		time.Sleep(m.createDelay)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if isDir, ok := m.items[parent]; !ok || !isDir {
+			return notFound
+		}
+		p := strings.Trim(path.Join(parent, req.Name), "/")
+		m.created[p]++
+		if _, ok := m.items[p]; ok {
+			return respond(409, `{"error":{"code":"nameAlreadyExists","message":"exists"}}`)
+		}
+		m.items[p] = true
+		return respond(201, `{"name":"`+req.Name+`","folder":{}}`)
+	case method == "PUT" && strings.HasSuffix(target, ":/content"):
+		p := itemPath("/content")
+		if isDir, ok := m.exists(path.Dir(p)); (!ok || !isDir) && path.Dir(p) != "." {
+			return notFound
+		}
+		m.mu.Lock()
+		m.items[p] = false
+		m.mu.Unlock()
+		return respond(201, `{"name":"`+path.Base(p)+`","file":{}}`)
+	}
+	return respond(400, `{"error":{"code":"invalidRequest","message":"unexpected request"}}`)
+}
+
+func TestIsNameConflict(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.True(IsNameConflict(&RespError{Status: 409}))
+	asserts.True(IsNameConflict(RespError{APIError: APIError{Code: "nameAlreadyExists"}}))
+	asserts.False(IsNameConflict(&RespError{Status: 404}))
+	asserts.False(IsNameConflict(errors.New("error")))
+}
+
+func TestClient_Upload_CreateParents(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+	cache.Set("setting_onedrive_chunk_retries", "0", 0)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_etag_cache_ttl", "0", 0)
+
+	// 上传到不存在的深层目录，逐级创建上级目录
+	{
+		drive := newFolderTreeClientMock()
+		drive.items["a"] = true
+		client.Request = drive
+		err := client.Upload(context.Background(), "/a/b/c/d/file.txt", 3, bytes.NewReader([]byte("123")))
+		asserts.NoError(err)
+		for _, dir := range []string{"a/b", "a/b/c", "a/b/c/d"} {
+			isDir, ok := drive.exists(dir)
+			asserts.True(ok, dir)
+			asserts.True(isDir, dir)
+			asserts.Equal(1, drive.created[dir], dir)
+		}
+		isDir, ok := drive.exists("a/b/c/d/file.txt")
+		asserts.True(ok)
+		asserts.False(isDir)
+		asserts.Zero(drive.created["a"])
+	}
+
+	// 上级目录已存在，不创建目录
+	{
+		drive := newFolderTreeClientMock()
+		drive.items["a"] = true
+		client.Request = drive
+		err := client.Upload(context.Background(), "a/file.txt", 3, bytes.NewReader([]byte("123")))
+		asserts.NoError(err)
+		asserts.Empty(drive.created)
+		_, ok := drive.exists("a/file.txt")
+		asserts.True(ok)
+	}
+
+	// 并发上传同时创建同一上级目录
+	{
+		drive := newFolderTreeClientMock()
+		drive.createDelay = time.Duration(20) * time.Millisecond
+		client.Request = drive
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				name := []string{"1.txt", "2.txt"}[i]
+				errs[i] = client.Upload(context.Background(), "x/y/"+name, 3, bytes.NewReader([]byte("123")))
+			}(i)
+		}
+		wg.Wait()
+		asserts.NoError(errs[0])
+		asserts.NoError(errs[1])
+		for _, p := range []string{"x", "x/y", "x/y/1.txt", "x/y/2.txt"} {
+			_, ok := drive.exists(p)
+			asserts.True(ok, p)
+		}
+	}
+
+	// 路径中的同名项目不是目录
+	{
+		drive := newFolderTreeClientMock()
+		drive.items["a"] = false
+		client.Request = drive
+		err := client.Upload(context.Background(), "a/b/file.txt", 3, bytes.NewReader([]byte("123")))
+		asserts.Equal(ErrNotFolder, err)
+	}
+}
+
+func TestDriver_MakeDir(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{Policy: &model.Policy{}}
+	handler.Client, _ = NewClient(handler.Policy)
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_etag_cache_ttl", "0", 0)
+
+	// 创建新目录
+	{
+		drive := newFolderTreeClientMock()
+		handler.Client.Request = drive
+		asserts.NoError(handler.MakeDir(context.Background(), "/new"))
+		isDir, ok := drive.exists("new")
+		asserts.True(ok)
+		asserts.True(isDir)
+		asserts.Equal(1, drive.created["new"])
+	}
+
+	// 同名目录或文件已存在
+	{
+		drive := newFolderTreeClientMock()
+		drive.items["dir"] = true
+		drive.items["dir/file"] = false
+		handler.Client.Request = drive
+		err := handler.MakeDir(context.Background(), "/dir")
+		asserts.Equal(ErrObjectExists, err)
+		asserts.True(IsNameConflict(err))
+		asserts.Equal(ErrObjectExists, handler.MakeDir(context.Background(), "dir/file"))
+		asserts.Equal(ErrObjectExists, handler.MakeDir(context.Background(), "/"))
+	}
+
+	// 逐级创建缺失的上级目录
+	{
+		drive := newFolderTreeClientMock()
+		drive.items["a"] = true
+		handler.Client.Request = drive
+		asserts.NoError(handler.MakeDir(context.Background(), "/a/b/c/"))
+		for _, dir := range []string{"a/b", "a/b/c"} {
+			isDir, ok := drive.exists(dir)
+			asserts.True(ok, dir)
+			asserts.True(isDir, dir)
+		}
+		asserts.Zero(drive.created["a"])
+	}
+
+	// 路径中的同名项目不是目录
+	{
+		drive := newFolderTreeClientMock()
+		drive.items["a"] = false
+		handler.Client.Request = drive
+		asserts.Equal(ErrNotFolder, handler.MakeDir(context.Background(), "a/b"))
+	}
+}
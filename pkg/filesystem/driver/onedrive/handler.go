@@ -2,23 +2,33 @@ package onedrive
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
 	"net/url"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 )
 
+// sourceCachePrefix 外链地址缓存的键前缀
+const sourceCachePrefix = "onedrive_source_"
+
 // Driver OneDrive 适配器
 type Driver struct {
 	Policy     *model.Policy
@@ -26,124 +36,686 @@ type Driver struct {
 	HTTPClient request.Client
 }
 
-// List 列取项目
-func (handler Driver) List(ctx context.Context, base string, recursive bool) ([]response.Object, error) {
+// MetadataTruncatedKey 对象元数据中标记目录因达到最大列取深度而未被列取的键，
+// 值为 "true"，该目录下可能还有未返回的项目
+const MetadataTruncatedKey = "onedrive_list_truncated"
+
+// List 列取项目。递归列取时最多进入的目录层数由上下文中的 fsctx.ListDepthCtx 指定，
+// 未指定时使用设置项 onedrive_list_max_depth，不大于 0 时不限制
+func (handler Driver) List(ctx context.Context, base string, recursive bool) (res []response.Object, err error) {
+	defer beginOperation(opList).end(ctx, &err)
 	base = strings.TrimPrefix(base, "/")
-	// 列取子项目
-	objects, _ := handler.Client.ListChildren(ctx, base)
 
-	// 获取真实的列取起始根目录
-	rootPath := base
-	if realBase, ok := ctx.Value(fsctx.PathCtx).(string); ok {
-		rootPath = realBase
-	} else {
-		ctx = context.WithValue(ctx, fsctx.PathCtx, base)
+	maxDepth, ok := fsctx.ListDepth(ctx)
+	if !ok {
+		maxDepth = model.GetIntSetting("onedrive_list_max_depth", 0)
 	}
 
-	// 整理结果
+	// 限制同时进行的列取请求数量
+	parallel := model.GetIntSetting("onedrive_list_concurrency", 4)
+	if parallel < 1 {
+		parallel = 1
+	}
+	worker := make(chan int, parallel)
+	for i := 0; i < parallel; i++ {
+		worker <- i
+	}
+
+	return handler.list(ctx, base, base, recursive, 1, maxDepth, worker)
+}
+
+// list 列取 base 下的项目，返回的对象路径以 rootPath 作为起始根目录。
+// depth 为 base 下项目所在的层数，达到 maxDepth 时不再进入子目录，并标记这些目录
+func (handler Driver) list(ctx context.Context, base, rootPath string, recursive bool, depth, maxDepth int, worker chan int) ([]response.Object, error) {
+	// 列取子项目
+	<-worker
+	objects, err := handler.listLevel(ctx, base)
+	worker <- 1
+	if err != nil {
+		return nil, err
+	}
+
+	// 整理结果，过滤掉的目录仍会被递归列取
+	truncated := recursive && maxDepth > 0 && depth >= maxDepth
+	filter := fsctx.ListFilter(ctx)
 	res := make([]response.Object, 0, len(objects))
-	for _, object := range objects {
-		source := path.Join(base, object.Name)
-		rel, err := filepath.Rel(rootPath, source)
+	for _, obj := range objects {
+		rel, err := filepath.Rel(rootPath, obj.Source)
 		if err != nil {
 			continue
 		}
-		res = append(res, response.Object{
-			Name:         object.Name,
-			RelativePath: filepath.ToSlash(rel),
-			Source:       source,
-			Size:         object.Size,
-			IsDir:        object.Folder != nil,
-			LastModify:   time.Now(),
-		})
-	}
-
-	// 递归列取子目录
-	if recursive {
-		for _, object := range objects {
-			if object.Folder != nil {
-				sub, _ := handler.List(ctx, path.Join(base, object.Name), recursive)
-				res = append(res, sub...)
+		obj.RelativePath = filepath.ToSlash(rel)
+		if truncated && obj.IsDir {
+			obj.Metadata = withMetadata(obj.Metadata, MetadataTruncatedKey, "true")
+		}
+		if filter.Match(obj.IsDir) {
+			res = append(res, obj)
+		}
+	}
+
+	// 并行递归列取子目录，结果按子目录原有顺序合并，
+	// 单个子目录列取失败时不影响其他目录
+	var listErrs ListErrors
+	if recursive && !truncated {
+		var (
+			wg     sync.WaitGroup
+			subRes = make([][]response.Object, len(objects))
+			subErr = make([]error, len(objects))
+		)
+		for i, object := range objects {
+			if !object.IsDir {
+				continue
+			}
+			wg.Add(1)
+			go func(i int, dir string) {
+				defer wg.Done()
+				subRes[i], subErr[i] = handler.list(ctx, dir, rootPath, recursive, depth+1, maxDepth, worker)
+			}(i, path.Join(base, object.Name))
+		}
+		wg.Wait()
+
+		for i, sub := range subRes {
+			res = append(res, sub...)
+			if subErr[i] != nil {
+				listErrs = listErrs.add(path.Join(base, objects[i].Name), subErr[i])
 			}
 		}
 	}
 
+	if len(listErrs) > 0 {
+		return res, listErrs
+	}
 	return res, nil
 }
 
-// Get 获取文件
-func (handler Driver) Get(ctx context.Context, path string) (response.RSCloser, error) {
-	// 获取文件源地址
-	downloadURL, err := handler.Source(
-		ctx,
-		path,
-		url.URL{},
-		60,
-		false,
-		0,
-	)
+// withMetadata 返回加入键值对后的元数据副本，不修改可能被列取缓存共用的原元数据
+func withMetadata(metadata map[string]string, key, value string) map[string]string {
+	res := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		res[k] = v
+	}
+	res[key] = value
+	return res
+}
+
+// ListIfChanged 列取 base 下的直接子项目，目录的 ETag 与 knownETag 一致时返回 changed=false，
+// 以便客户端确认目录未变更后跳过刷新
+func (handler Driver) ListIfChanged(ctx context.Context, base, knownETag string) ([]response.Object, bool, string, error) {
+	base = strings.TrimPrefix(base, "/")
+	objects, changed, etag, err := handler.Client.ListChildrenIfChanged(ctx, base, knownETag)
+	if err != nil || !changed {
+		return nil, changed, etag, err
+	}
+
+	res := make([]response.Object, 0, len(objects))
+	for _, object := range objects {
+		if obj, ok := toObject(base, base, object); ok {
+			res = append(res, obj)
+		}
+	}
+	return res, true, etag, nil
+}
+
+// Walk 递归遍历 base 下的项目，每发现一个对象即调用 fn，不在内存中保留整个目录树。
+// fn 返回错误或上下文被取消时停止遍历，并返回该错误
+func (handler Driver) Walk(ctx context.Context, base string, fn func(response.Object) error) error {
+	base = strings.TrimPrefix(base, "/")
+	return handler.walk(ctx, base, base, fn)
+}
+
+// walk 遍历 dir 下的项目，返回的对象路径以 rootPath 作为起始根目录
+func (handler Driver) walk(ctx context.Context, dir, rootPath string, fn func(response.Object) error) error {
+	select {
+	case <-ctx.Done():
+		return ErrClientCanceled
+	default:
+	}
+
+	objects, err := handler.Client.ListChildren(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	// 只保留子目录路径，本层的对象在处理后即可释放
+	var subDirs []string
+	for _, object := range objects {
+		obj, ok := toObject(dir, rootPath, object)
+		if !ok {
+			continue
+		}
+		if err := fn(obj); err != nil {
+			return err
+		}
+		if obj.IsDir {
+			subDirs = append(subDirs, obj.Source)
+		}
+	}
+
+	for _, subDir := range subDirs {
+		if err := handler.walk(ctx, subDir, rootPath, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DirSize 统计 base 下文件的总大小及数量。OneDrive 的目录项已包含汇总后的大小，
+// 只需遍历统计文件数量，空目录无需遍历
+func (handler Driver) DirSize(ctx context.Context, base string) (int64, int64, error) {
+	base = strings.TrimPrefix(base, "/")
+	info, err := handler.Client.Meta(ctx, "", base)
+	if err != nil {
+		return 0, 0, err
+	}
+	if info.Folder == nil {
+		return 0, 0, ErrNotFolder
+	}
+	if info.Folder.ChildCount == 0 {
+		return 0, 0, nil
+	}
+
+	var count int64
+	err = handler.Walk(ctx, base, func(object response.Object) error {
+		if !object.IsDir {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int64(info.Size), count, nil
+}
+
+// isValidName 返回 OneDrive 项目名称能否安全地拼接为路径。通过接口创建的项目名称可能包含
+// 路径分隔符、控制字符或用于伪装扩展名的双向文本控制符，为 "." 或 ".." 时还会造成路径穿越
+func isValidName(name string) bool {
+	if name == "." || name == ".." || !utf8.ValidString(name) ||
+		strings.ContainsAny(name, `/\`) {
+		return false
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// toObject 将 base 下的 OneDrive 项目转换为以 rootPath 为根目录的对象，
+// 名称无效或所得路径不在 rootPath 下的项目被忽略
+func toObject(base, rootPath string, object FileInfo) (response.Object, bool) {
+	if !isValidName(object.Name) {
+		util.Log().Warning("忽略名称无效的 OneDrive 项目[%q]，所在目录[%s]", object.Name, base)
+		return response.Object{}, false
+	}
+	source := path.Join(base, object.Name)
+	rel, err := filepath.Rel(rootPath, source)
+	if err != nil {
+		return response.Object{}, false
+	}
+	if rel = filepath.ToSlash(rel); rel == ".." || strings.HasPrefix(rel, "../") {
+		return response.Object{}, false
+	}
+
+	// 接口未返回修改时间时，使用当前时间
+	lastModify := object.LastModify
+	if lastModify.IsZero() {
+		lastModify = time.Now()
+	}
+
+	// 优先使用 OneDrive 识别的 MIME 类型，未返回时根据扩展名推断
+	var mimeType string
+	if object.Folder == nil {
+		if object.File != nil && object.File.MimeType != "" {
+			mimeType = object.File.MimeType
+		} else {
+			mimeType = mime.TypeByExtension(path.Ext(object.Name))
+		}
+	}
+
+	// 加密的文件使用明文大小
+	metadata := decodeMetadata(object.Description)
+	if object.Shortcut != "" {
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[MetadataShortcutKey] = object.Shortcut
+	}
+	size := object.Size
+	if object.Folder == nil && metadata[metadataCipherKey] == encryptCipherName {
+		size = uint64(decryptedSize(int64(object.Size)))
+	}
+
+	return response.Object{
+		Name:         object.Name,
+		RelativePath: rel,
+		Source:       source,
+		Size:         size,
+		IsDir:        object.Folder != nil,
+		LastModify:   lastModify,
+		MimeType:     mimeType,
+		Metadata:     metadata,
+	}, true
+}
+
+// Head 获取文件元信息
+func (handler Driver) Head(ctx context.Context, path string) (response.Object, error) {
+	info, err := handler.Client.Meta(ctx, "", path)
+	if err != nil {
+		return response.Object{}, err
+	}
+
+	base := filepath.ToSlash(filepath.Dir(path))
+	object, _ := toObject(base, base, *info)
+	object.ETag = info.ETag
+	return object, nil
+}
+
+// Exists 判断 path 处是否已存在文件或目录，仅 OneDrive 返回 404 或 itemNotFound 时
+// 视为不存在，鉴权失败等其他错误原样返回
+func (handler Driver) Exists(ctx context.Context, path string) (bool, error) {
+	_, err := handler.Client.Meta(ctx, "", path)
+	if err == nil {
+		return true, nil
+	}
+	if IsNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// Get 获取文件，文件已在存储端被删除时返回可由 IsNotFound 识别的错误
+func (handler Driver) Get(ctx context.Context, path string) (rs response.RSCloser, err error) {
+	defer beginOperation(opGet).end(ctx, &err)
+
+	// 存储策略启用加密时，透明解密已加密的文件
+	aead, err := handler.encryptionAEAD()
 	if err != nil {
 		return nil, err
 	}
+	if aead != nil {
+		info, err := handler.Client.Meta(ctx, "", path)
+		if err != nil {
+			return nil, err
+		}
+		if nonce, ok := encryptionNonce(info.Description, aead); ok {
+			return handler.getDecrypted(ctx, path, aead, nonce, int64(info.Size))
+		}
+	}
 
-	// 获取文件数据流
-	resp, err := handler.HTTPClient.Request(
-		"GET",
-		downloadURL,
-		nil,
-		request.WithContext(ctx),
-		request.WithTimeout(time.Duration(0)),
-	).CheckHTTPResponse(200).GetRSCloser()
+	// 转发请求的字节范围
+	rangeHeader, _ := fsctx.Range(ctx)
+	res, err := handler.download(ctx, path, rangeHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := res.GetRSCloser()
 	if err != nil {
 		return nil, err
 	}
 
 	resp.SetFirstFakeChunk()
 
-	// 尝试自主获取文件大小
-	if file, ok := ctx.Value(fsctx.FileModelCtx).(model.File); ok {
-		resp.SetContentLength(int64(file.Size))
+	// 无法根据扩展名确定内容类型时，探测正文开头以确定内容类型，以便在线预览。
+	// 分段响应的正文不从文件开头开始，无法探测
+	if res.Response.StatusCode != http.StatusPartialContent && mime.TypeByExtension(filepath.Ext(path)) == "" {
+		resp.SniffContentType()
+	}
+
+	// 尝试自主获取文件大小，缺少文件记录时通过元信息获取，均无法获取时沿用存储端
+	// 返回的 Content-Length；仍未知时 response.ServeContent 以分块传输编码发送。
+	// 分段响应已由 Content-Range 给出完整大小，不再覆盖，以免与实际返回的范围不一致
+	if res.Response.StatusCode != http.StatusPartialContent {
+		if file, ok := fsctx.FileModel(ctx); ok {
+			resp.SetContentLength(int64(file.Size))
+		} else if object, err := handler.Head(ctx, path); err == nil {
+			resp.SetContentLength(int64(object.Size))
+		} else {
+			util.Log().Debug("无法获取文件[%s]的元信息，%s", path, err)
+		}
+	}
+
+	// 服务端中转时计量用户流量，限速由文件系统统一处理
+	if user, ok := fsctx.User(ctx); ok {
+		return response.MeterDownload(resp, user.ID), nil
 	}
 
 	return resp, nil
 }
 
+// download 获取文件数据流，rangeHeader 非空时按范围获取。返回的响应正文在下载地址
+// 中途过期时自动续传
+func (handler Driver) download(ctx context.Context, path, rangeHeader string) (*request.Response, error) {
+	res, err := handler.requestDownload(ctx, path, rangeHeader)
+	// 缓存的下载地址可能已经过期，重新获取地址后重试一次，
+	// 客户端续传时请求的范围保持不变
+	if isSourceExpired(err) {
+		util.Log().Debug("文件[%s]的下载地址已失效，%s，重新获取", path, err)
+		invalidateSourceCache(handler.Policy.ID, path)
+		res, err = handler.requestDownload(ctx, path, rangeHeader)
+	}
+	if err != nil {
+		// 文件已在存储端被删除时，缓存的下载地址也已失效，一并清除
+		if IsNotFound(err) {
+			invalidateSourceCache(handler.Policy.ID, path)
+			invalidateThumbCache(handler.Policy.ID, path)
+		}
+		return nil, err
+	}
+
+	// 下载地址中途过期时自动续传
+	res.Response.Body = newResumableBody(ctx, handler, path, res.Response)
+	return res, nil
+}
+
+// isSourceExpired 返回获取文件数据流时的错误是否表示下载地址已失效
+func isSourceExpired(err error) bool {
+	respErr, ok := asRespError(err)
+	if !ok || respErr.APIError.Code != "download" {
+		return false
+	}
+
+	// 文件确实不存在时返回 404，无需重新获取地址
+	switch respErr.Status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusGone:
+		return true
+	}
+	return false
+}
+
+// requestDownload 获取文件源地址，并按范围请求文件数据流
+func (handler Driver) requestDownload(ctx context.Context, path, rangeHeader string) (*request.Response, error) {
+	// 获取文件源地址
+	downloadURL, err := handler.directURL(ctx, path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// 获取文件数据流
+	res, err := handler.getFollowingRedirects(ctx, downloadURL, rangeHeader)
+	if err != nil {
+		return nil, err
+	}
+	// 按范围获取时，存储端返回 206 分段响应
+	if rangeHeader == "" || res.Err != nil || res.Response.StatusCode != http.StatusPartialContent {
+		res = res.CheckHTTPResponse(200)
+	}
+
+	// 存储端返回错误状态时，保留状态码以便上层区分
+	if res.Err != nil && res.Response != nil {
+		res.Response.Body.Close()
+		respErr := &RespError{APIError: APIError{Code: "download", Message: res.Err.Error()}}
+		return nil, respErr.withResponse(res.Response)
+	}
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return res, nil
+}
+
+// getFollowingRedirects 请求 downloadURL 处的文件数据流。OneDrive 的下载地址可能经由多个 CDN
+// 节点重定向，逐跳跟随重定向，并对每一跳的地址按存储策略替换为反代地址。重定向次数超过设置项
+// onedrive_download_max_redirects 时返回 ErrTooManyRedirects，重定向回已访问过的地址时返回 ErrRedirectLoop
+func (handler Driver) getFollowingRedirects(ctx context.Context, downloadURL, rangeHeader string) (*request.Response, error) {
+	maxRedirects := model.GetIntSetting("onedrive_download_max_redirects", 5)
+	visited := map[string]bool{downloadURL: true}
+	target := downloadURL
+	for redirects := 0; ; redirects++ {
+		options := append(handler.downloadOptions(ctx, target, rangeHeader), request.WithoutRedirect())
+		res := handler.HTTPClient.Request("GET", target, nil, options...)
+		if res.Err != nil || !isRedirect(res.Response.StatusCode) || res.Response.Header.Get("Location") == "" {
+			return res, nil
+		}
+		res.Response.Body.Close()
+
+		base, err := url.Parse(target)
+		if err != nil {
+			return nil, err
+		}
+		location, err := base.Parse(res.Response.Header.Get("Location"))
+		if err != nil {
+			return nil, err
+		}
+		if redirects >= maxRedirects {
+			return nil, ErrTooManyRedirects
+		}
+
+		next := handler.replaceSourceHost(location.String())
+		if visited[next] {
+			return nil, ErrRedirectLoop
+		}
+		visited[next] = true
+		handler.Client.log(ctx).Debug("文件下载地址重定向至 %s", redactURL(next))
+		target = next
+	}
+}
+
+// isRedirect 返回状态码是否表示重定向
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// downloadOptions 构建获取文件数据流的请求选项，rangeHeader 为空时获取完整文件
+func (handler Driver) downloadOptions(ctx context.Context, downloadURL, rangeHeader string) []request.Option {
+	options := []request.Option{
+		request.WithContext(ctx),
+		request.WithTimeout(time.Duration(0)),
+	}
+	if header := handler.proxyHeaders(downloadURL); header != nil {
+		options = append(options, request.WithHeader(header))
+	}
+	if rangeHeader != "" {
+		options = append(options, request.WithHeader(http.Header{"Range": {rangeHeader}}))
+	}
+	return options
+}
+
 // Put 将文件流保存到指定目录
-func (handler Driver) Put(ctx context.Context, file io.ReadCloser, dst string, size uint64) error {
+func (handler Driver) Put(ctx context.Context, file io.ReadCloser, dst string, size uint64) (err error) {
+	defer beginOperation(opPut).end(ctx, &err)
+	defer func() { err = handler.writeError(ctx, err) }()
+	if err = handler.checkWritable(); err != nil {
+		file.Close()
+		return err
+	}
+
+	// 上传过程中的所有请求使用同一操作ID
+	ctx = withOperation(ctx)
+	origin := file
+	// 计量用户上传流量，关闭文件流时报告实际上传的字节数
+	if user, ok := fsctx.User(ctx); ok {
+		file = response.MeterUpload(file, user.ID)
+	}
 	defer file.Close()
+	defer invalidateListCache(handler.Policy.ID, dst)
+	defer invalidateThumbCache(handler.Policy.ID, dst)
+	defer invalidateNotFoundCache(handler.Policy.ID, dst)
+
+	// 去除图片中的位置等元数据。仅作用于服务端中转的上传，客户端直传的文件无法在服务端处理
+	if handler.Policy.OptionsSerialized.OdStripMetadata && supportsMetadataStrip(dst) {
+		file = ioutil.NopCloser(newMetadataStripper(file, dst))
+		origin = file
+	}
+
+	// 存储策略启用加密时，逐块加密后上传，并将 nonce 记录在元数据中
+	aead, err := handler.encryptionAEAD()
+	if err != nil {
+		return err
+	}
+	if aead != nil {
+		nonce, err := newNonce(aead)
+		if err != nil {
+			return err
+		}
+		ctx = withEncryptionMetadata(ctx, nonce)
+		return handler.Client.Upload(
+			ctx,
+			dst,
+			int(encryptedSize(int64(size))),
+			newEncryptReader(file, aead, nonce, int64(size)),
+		)
+	}
+
+	// 加密后的内容即使明文相同也各不相同，仅未加密的存储策略去重
+	if handler.Policy.OptionsSerialized.OdDedup {
+		return handler.putDeduplicated(ctx, origin, file, dst, size)
+	}
+
 	return handler.Client.Upload(ctx, dst, int(size), file)
 }
 
 // Delete 删除一个或多个文件，
 // 返回未删除的文件，及遇到的最后一个错误
-func (handler Driver) Delete(ctx context.Context, files []string) ([]string, error) {
-	return handler.Client.BatchDelete(ctx, files)
+func (handler Driver) Delete(ctx context.Context, files []string) (failed []string, err error) {
+	defer beginOperation(opDelete).end(ctx, &err)
+	if err = handler.checkWritable(); err != nil {
+		return files, err
+	}
+	failed, err = handler.Client.BatchDelete(ctx, files)
+	err = handler.writeError(ctx, err)
+	invalidateSourceCache(handler.Policy.ID, files...)
+	invalidateListCache(handler.Policy.ID, files...)
+	invalidateThumbCache(handler.Policy.ID, files...)
+	invalidateShortcutCache(handler.Policy.ID, files...)
+	return failed, err
+}
+
+// DeletePrefix 以单个请求删除 prefix 目录及其下的全部内容，
+// 失败时返回 prefix 本身，及遇到的错误
+func (handler Driver) DeletePrefix(ctx context.Context, prefix string) ([]string, error) {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return []string{prefix}, ErrDeleteFile
+	}
+	if err := handler.checkWritable(); err != nil {
+		return []string{prefix}, err
+	}
+
+	err := handler.Client.DeleteItem(ctx, prefix)
+	invalidateSourceCache(handler.Policy.ID, prefix)
+	invalidateListCache(handler.Policy.ID, prefix)
+	invalidateThumbCache(handler.Policy.ID, prefix)
+	invalidateShortcutCache(handler.Policy.ID, prefix)
+	if err != nil {
+		return []string{prefix}, handler.writeError(ctx, err)
+	}
+	return []string{}, nil
+}
+
+// Move 移动或重命名文件
+func (handler Driver) Move(ctx context.Context, src, dst string) error {
+	if err := handler.checkWritable(); err != nil {
+		return err
+	}
+
+	_, err := handler.Client.Move(ctx, src, dst)
+	if err != nil {
+		return handler.writeError(ctx, err)
+	}
+
+	invalidateSourceCache(handler.Policy.ID, src)
+	invalidateListCache(handler.Policy.ID, src, dst)
+	invalidateThumbCache(handler.Policy.ID, src, dst)
+	invalidateShortcutCache(handler.Policy.ID, src)
+	invalidateNotFoundCache(handler.Policy.ID, dst)
+	return nil
+}
+
+// conflictBehavior 获取目标已存在时的处理方式，上下文中指定的值优先于存储策略设置，
+// 无效值一律按 fail 处理
+func (handler Driver) conflictBehavior(ctx context.Context) string {
+	behavior := handler.Policy.OptionsSerialized.OdConflictBehavior
+	if override, ok := fsctx.ConflictBehavior(ctx); ok && override != "" {
+		behavior = override
+	}
+
+	switch behavior {
+	case "replace", "rename":
+		return behavior
+	default:
+		return "fail"
+	}
+}
+
+// Copy 在服务端复制文件，等待复制完成后返回
+func (handler Driver) Copy(ctx context.Context, src, dst string) error {
+	if err := handler.checkWritable(); err != nil {
+		return err
+	}
+
+	monitorURL, err := handler.Client.Copy(ctx, src, dst, WithConflictBehavior(handler.conflictBehavior(ctx)))
+	if err != nil {
+		return handler.writeError(ctx, err)
+	}
+
+	if err := handler.Client.WaitCopy(ctx, monitorURL); err != nil {
+		return handler.writeError(ctx, err)
+	}
+
+	invalidateSourceCache(handler.Policy.ID, dst)
+	invalidateListCache(handler.Policy.ID, dst)
+	invalidateThumbCache(handler.Policy.ID, dst)
+	invalidateNotFoundCache(handler.Policy.ID, dst)
+	return nil
 }
 
 // Thumb 获取文件缩略图
 func (handler Driver) Thumb(ctx context.Context, path string) (*response.ContentResponse, error) {
-	var (
-		thumbSize = [2]uint{400, 300}
-		ok        = false
-	)
-	if thumbSize, ok = ctx.Value(fsctx.ThumbSizeCtx).([2]uint); !ok {
-		return nil, errors.New("无法获取缩略图尺寸设置")
+	// 未指定尺寸时使用默认尺寸
+	width, height, ok := fsctx.ThumbSize(ctx)
+	if !ok {
+		width, height = 400, 300
 	}
 
-	res, err := handler.Client.GetThumbURL(ctx, path, thumbSize[0], thumbSize[1])
+	// 尝试从缓存中查找
+	if cachedURL, ok := getCachedThumb(handler.Policy.ID, path, width, height); ok {
+		return &response.ContentResponse{
+			Redirect: true,
+			URL:      cachedURL,
+		}, nil
+	}
+
+	res, err := handler.Client.GetThumbURL(ctx, path, width, height)
+	retryKey := getThumbRetryKey(handler.Policy.ID, path, width, height)
 	if err != nil {
-		// 如果出现异常，就清空文件的pic_info
-		if file, ok := ctx.Value(fsctx.FileModelCtx).(model.File); ok {
-			file.UpdatePicInfo("")
+		// 文件确实没有缩略图时，清空文件的pic_info；暂时性错误在后台稍后重试，
+		// 多次重试仍失败后才清空。客户端断开导致的失败无需重试
+		if file, ok := fsctx.FileModel(ctx); ok {
+			if isThumbUnavailable(err) {
+				file.UpdatePicInfo("")
+			} else if ctx.Err() == nil {
+				scheduleThumbRetry(ThumbRetry{
+					Key:      retryKey,
+					PolicyID: handler.Policy.ID,
+					FileID:   file.ID,
+					Path:     path,
+					Width:    width,
+					Height:   height,
+				})
+			}
 		}
+	} else {
+		setCachedThumb(handler.Policy.ID, path, width, height, res, model.GetIntSetting("onedrive_source_timeout", 1800))
+		cancelThumbRetry(retryKey)
 	}
+
 	return &response.ContentResponse{
 		Redirect: true,
 		URL:      res,
 	}, err
 }
 
-// Source 获取外链URL
+// Source 获取外链URL。直链由 OneDrive 直接提供，无法限速，speed 参数会被忽略；
+// 经由服务端中转的下载仍受用户组限速约束
 func (handler Driver) Source(
 	ctx context.Context,
 	path string,
@@ -152,9 +724,34 @@ func (handler Driver) Source(
 	isDownload bool,
 	speed int,
 ) (string, error) {
-	// 尝试从缓存中查找
-	if cachedURL, ok := cache.Get(fmt.Sprintf("onedrive_source_%d_%s", handler.Policy.ID, path)); ok {
-		return handler.replaceSourceHost(cachedURL.(string))
+	// 存储策略启用加密时，OneDrive 直链只能下载到密文，一律经由服务端中转并解密，
+	// 直链也不进入缓存
+	aead, err := handler.encryptionAEAD()
+	if err != nil {
+		return "", err
+	}
+	if aead != nil {
+		fileName, _ := fsctx.DownloadFileName(ctx)
+		return handler.proxiedDownloadURL(ctx, fileName, baseURL, ttl)
+	}
+
+	// 需要使用指定文件名下载时，经由服务端中转
+	if isDownload && handler.Policy.OptionsSerialized.OdProxyDownload {
+		if fileName, ok := fsctx.DownloadFileName(ctx); ok && fileName != filepath.Base(path) {
+			return handler.proxiedDownloadURL(ctx, fileName, baseURL, ttl)
+		}
+	}
+
+	return handler.directURL(ctx, path, isDownload)
+}
+
+// directURL 获取 OneDrive 提供的文件直链，启用加密时为密文的地址，仅供服务端获取文件数据。
+// 尝试从缓存中查找，经由服务端中转的下载地址与文件名相关，不会进入缓存。
+// 配置 Redis 时各节点共用缓存，缓存键包含存储策略ID以区分不同策略
+func (handler Driver) directURL(ctx context.Context, path string, isDownload bool) (string, error) {
+	cacheKey := sourceCachePrefix + getSourceCacheKey(handler.Policy.ID, path, isDownload)
+	if cachedURL, ok := cache.Get(cacheKey); ok {
+		return handler.replaceSourceHost(cachedURL.(string)), nil
 	}
 
 	// 缓存不存在，重新获取
@@ -162,69 +759,247 @@ func (handler Driver) Source(
 	if err == nil {
 		// 写入新的缓存
 		cache.Set(
-			fmt.Sprintf("onedrive_source_%d_%s", handler.Policy.ID, path),
+			cacheKey,
 			res.DownloadURL,
 			model.GetIntSetting("onedrive_source_timeout", 1800),
 		)
-		return handler.replaceSourceHost(res.DownloadURL)
+		return handler.replaceSourceHost(res.DownloadURL), nil
 	}
 	return "", err
 }
 
-func (handler Driver) replaceSourceHost(origin string) (string, error) {
-	if handler.Policy.OptionsSerialized.OdProxy != "" {
+// proxiedDownloadURL 创建下载会话，返回由服务端中转并以 fileName 为文件名的下载地址，
+// fileName 为空时沿用文件记录中的文件名
+func (handler Driver) proxiedDownloadURL(ctx context.Context, fileName string, baseURL url.URL, ttl int64) (string, error) {
+	file, ok := fsctx.FileModel(ctx)
+	if !ok {
+		return "", ErrNoFileModelCtx
+	}
+	if fileName != "" {
+		file.Name = fileName
+	}
+
+	downloadSessionID := util.RandStringRunes(16)
+	err := cache.Set("download_"+downloadSessionID, file, int(ttl))
+	if err != nil {
+		return "", serializer.NewError(serializer.CodeCacheOperation, "无法创建下载会话", err)
+	}
+
+	signedURI, err := auth.SignURI(
+		auth.General,
+		fmt.Sprintf("/api/v3/file/download/%s", downloadSessionID),
+		ttl,
+	)
+	if err != nil {
+		return "", serializer.NewError(serializer.CodeEncryptError, "无法对URL进行签名", err)
+	}
+
+	return baseURL.ResolveReference(signedURI).String(), nil
+}
+
+// getSourceCacheKey 获取外链地址的缓存键（不含前缀），预览与下载分开缓存
+func getSourceCacheKey(policyID uint, path string, isDownload bool) string {
+	if isDownload {
+		return policyPathCacheKey(policyID, path, "download")
+	}
+	return policyPathCacheKey(policyID, path, "preview")
+}
+
+// invalidateSourceCache 清除给定文件的外链地址及在线预览地址缓存，
+// 删除、移动等会使原有地址失效的操作后应调用此方法
+func invalidateSourceCache(policyID uint, paths ...string) {
+	keys := make([]string, 0, 2*len(paths))
+	for _, path := range paths {
+		keys = append(keys,
+			getSourceCacheKey(policyID, path, false),
+			getSourceCacheKey(policyID, path, true),
+		)
+	}
+	cache.Deletes(keys, sourceCachePrefix)
+
+	previewKeys := make([]string, 0, len(paths))
+	for _, path := range paths {
+		previewKeys = append(previewKeys, getPreviewCacheKey(policyID, path))
+	}
+	cache.Deletes(previewKeys, previewCachePrefix)
+}
+
+// replaceSourceHost 将 OneDrive 返回的下载地址替换为反代地址。反代地址已在创建客户端时校验，
+// 替换仍失败时记录警告并返回原始地址，避免反代配置问题导致无法下载
+func (handler Driver) replaceSourceHost(origin string) string {
+	// 反代地址误填为 OAuth 认证端点时，不进行替换
+	options := handler.Policy.OptionsSerialized
+	if options.OdProxy != "" && isCDNEndpoint(options.OdProxy, options.OdCDNHosts) {
 		source, err := url.Parse(origin)
 		if err != nil {
-			return "", err
+			util.Log().Warning("无法解析 OneDrive 下载地址，不替换为反代地址，%s", err)
+			return origin
 		}
 
-		cdn, err := url.Parse(handler.Policy.OptionsSerialized.OdProxy)
+		cdn, err := url.Parse(options.OdProxy)
 		if err != nil {
-			return "", err
+			util.Log().Warning("存储策略[%s]的反代地址无效，使用原始下载地址，%s", handler.Policy.Name, err)
+			return origin
 		}
 
-		// 替换反代地址
-		source.Scheme = cdn.Scheme
-		source.Host = cdn.Host
-		return source.String(), nil
+		// 替换反代地址，保留反代地址中的路径前缀
+		util.ReplaceURLBase(source, cdn)
+		return source.String()
+	}
+
+	return origin
+}
+
+// proxyHeaders 获取请求 target 时需附加的反代请求头，仅当 target 已被替换为
+// 反代地址时返回，避免认证信息泄露至 OneDrive 原始地址
+func (handler Driver) proxyHeaders(target string) http.Header {
+	options := handler.Policy.OptionsSerialized
+	if len(options.OdProxyHeaders) == 0 || options.OdProxy == "" || !isCDNEndpoint(options.OdProxy, options.OdCDNHosts) {
+		return nil
+	}
+
+	cdn, err := url.Parse(options.OdProxy)
+	if err != nil {
+		return nil
+	}
+	source, err := url.Parse(target)
+	if err != nil || source.Scheme != cdn.Scheme || source.Host != cdn.Host {
+		return nil
+	}
+
+	header := http.Header{}
+	for k, v := range options.OdProxyHeaders {
+		header.Set(k, v)
+	}
+	return header
+}
+
+// relayThreshold 获取由服务端中转上传的文件大小上限，未设置时为 SmallFileSize，
+// 超过 MaxRelayThreshold 时按 MaxRelayThreshold 处理。大于 SmallFileSize 的文件
+// 中转时由服务端通过上传会话分片上传，不受简单上传接口尺寸限制
+func (handler Driver) relayThreshold() uint64 {
+	threshold := handler.Policy.OptionsSerialized.OdRelayThreshold
+	if threshold == 0 {
+		return SmallFileSize
+	}
+	if threshold > MaxRelayThreshold {
+		return MaxRelayThreshold
+	}
+	return threshold
+}
+
+// GetUploadCredential 按统一直传约定获取上传凭证，大文件由客户端按分片
+// 上传至上传会话地址，完成后请求带签名的回调地址
+func (handler Driver) GetUploadCredential(ctx context.Context, TTL int64, key string) (serializer.UploadCredential, error) {
+	credential, err := handler.Token(ctx, TTL, key)
+	if err != nil {
+		return credential, err
+	}
+
+	if credential.Policy == "" {
+		credential.Mode = serializer.UploadModeRelay
+		return credential, nil
 	}
 
-	return origin, nil
+	credential.Mode = serializer.UploadModeChunk
+	credential.UploadURL = credential.Policy
+	credential.Callback = credential.Token
+	credential.Expires = time.Now().Unix() + TTL
+	return credential, nil
 }
 
 // Token 获取上传会话URL
 func (handler Driver) Token(ctx context.Context, TTL int64, key string) (serializer.UploadCredential, error) {
+	// 上传监控沿用创建上传会话时的操作ID
+	ctx = withOperation(ctx)
 
 	// 读取上下文中生成的存储路径和文件大小
-	savePath, ok := ctx.Value(fsctx.SavePathCtx).(string)
+	savePath, ok := fsctx.SavePath(ctx)
 	if !ok {
-		return serializer.UploadCredential{}, errors.New("无法获取存储路径")
+		return serializer.UploadCredential{}, ErrNoSavePathCtx
 	}
-	fileSize, ok := ctx.Value(fsctx.FileSizeCtx).(uint64)
+	fileSize, ok := fsctx.FileSize(ctx)
 	if !ok {
-		return serializer.UploadCredential{}, errors.New("无法获取文件大小")
+		return serializer.UploadCredential{}, ErrNoFileSizeCtx
 	}
 
-	// 如果小于4MB，则由服务端中转
-	if fileSize <= SmallFileSize {
+	// 空文件、不超过中转阈值或需要加密的文件由服务端中转，上传会话不接受空文件
+	if fileSize == 0 || fileSize <= handler.relayThreshold() || handler.Policy.OptionsSerialized.OdEncryptionKey != "" {
 		return serializer.UploadCredential{}, nil
 	}
 
-	// 生成回调地址
+	// 生成带签名的回调地址
 	siteURL := model.GetSiteURL()
 	apiBaseURI, _ := url.Parse("/api/v3/callback/onedrive/finish/" + key)
 	apiURL := siteURL.ResolveReference(apiBaseURI)
+	apiURL.RawQuery = url.Values{"sign": {SignCallback(key, savePath, fileSize, TTL)}}.Encode()
 
-	uploadURL, err := handler.Client.CreateUploadSession(ctx, savePath, WithConflictBehavior("fail"))
+	description, err := metadataDescription(ctx)
+	if err != nil {
+		return serializer.UploadCredential{}, err
+	}
+	modTime, _ := fsctx.ModTime(ctx)
+
+	var uploadURL string
+	err = handler.Client.withParentFolders(ctx, savePath, func() error {
+		var err error
+		uploadURL, err = handler.Client.CreateUploadSession(
+			ctx,
+			savePath,
+			WithConflictBehavior(handler.conflictBehavior(ctx)),
+			WithDescription(description),
+			WithModTime(modTime),
+		)
+		return err
+	})
 	if err != nil {
 		return serializer.UploadCredential{}, err
 	}
 
 	// 监控回调及上传
-	go handler.Client.MonitorUpload(uploadURL, key, savePath, fileSize, TTL)
+	handler.Client.startMonitor(ctx, uploadURL, key, savePath, fileSize, TTL)
 
 	return serializer.UploadCredential{
 		Policy: uploadURL,
 		Token:  apiURL.String(),
 	}, nil
 }
+
+// Close 释放存储策略持有的资源：以最新配置重启运行中的上传监控，清除该存储策略缓存的
+// 访问凭证、刷新锁及容量信息，关闭空闲连接。目录、缩略图、外链等缓存到期后自动失效
+func (handler Driver) Close() error {
+	restartPolicyMonitors(handler.Policy.ID)
+	cache.Deletes([]string{getQuotaCacheKey(handler.Policy.ID)}, quotaCachePrefix)
+
+	clients := []request.Client{handler.HTTPClient}
+	if handler.Client != nil {
+		handler.Client.ClearCredentialCache()
+		refreshLocks.Delete(handler.Client.credentialKey())
+		clients = append(clients, handler.Client.Request)
+	}
+
+	for _, client := range clients {
+		if closer, ok := client.(interface{ CloseIdleConnections() }); ok {
+			closer.CloseIdleConnections()
+		}
+	}
+	return nil
+}
+
+// Capabilities 返回 OneDrive 适配器支持的功能
+func (handler Driver) Capabilities() response.Capabilities {
+	return response.Capabilities{
+		NativeMove:   true,
+		NativeCopy:   true,
+		Rename:       true,
+		Thumbnail:    true,
+		RangeRead:    true,
+		Upload:       response.UploadDirectChunked,
+		URLUpload:    true,
+		Quota:        true,
+		Search:       true,
+		Versioning:   true,
+		DirSize:      true,
+		PrefixDelete: true,
+	}
+}
@@ -2,18 +2,24 @@ package onedrive
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"path"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
 	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/stretchr/testify/assert"
@@ -22,6 +28,7 @@ import (
 
 func TestDriver_Token(t *testing.T) {
 	asserts := assert.New(t)
+	auth.General = auth.HMACAuth{SecretKey: []byte("test")}
 	handler := Driver{
 		Policy: &model.Policy{
 			AccessKey:  "ak",
@@ -35,7 +42,7 @@ func TestDriver_Token(t *testing.T) {
 	{
 		ctx := context.WithValue(context.Background(), fsctx.FileSizeCtx, uint64(10))
 		res, err := handler.Token(ctx, 10, "key")
-		asserts.Error(err)
+		asserts.Equal(ErrNoSavePathCtx, err)
 		asserts.Equal(serializer.UploadCredential{}, res)
 	}
 
@@ -43,7 +50,16 @@ func TestDriver_Token(t *testing.T) {
 	{
 		ctx := context.WithValue(context.Background(), fsctx.SavePathCtx, "/123")
 		res, err := handler.Token(ctx, 10, "key")
-		asserts.Error(err)
+		asserts.Equal(ErrNoFileSizeCtx, err)
+		asserts.Equal(serializer.UploadCredential{}, res)
+	}
+
+	// 文件大小类型不符
+	{
+		ctx := context.WithValue(context.Background(), fsctx.SavePathCtx, "/123")
+		ctx = context.WithValue(ctx, fsctx.FileSizeCtx, 10)
+		res, err := handler.Token(ctx, 10, "key")
+		asserts.Equal(ErrNoFileSizeCtx, err)
 		asserts.Equal(serializer.UploadCredential{}, res)
 	}
 
@@ -115,6 +131,220 @@ func TestDriver_Token(t *testing.T) {
 		res, err := handler.Token(ctx, 10, "key")
 		asserts.NoError(err)
 		asserts.Equal("123321", res.Policy)
+
+		// 回调地址携带签名
+		callbackURL, err := url.Parse(res.Token)
+		asserts.NoError(err)
+		asserts.Equal("/api/v3/callback/onedrive/finish/key", callbackURL.Path)
+		asserts.NoError(CheckCallbackSign(callbackURL.Query().Get("sign"), &serializer.UploadSession{
+			Key:      "key",
+			SavePath: "/123",
+			Size:     20 * 1024 * 1024,
+		}))
+	}
+}
+
+func TestDriver_GetUploadCredential(t *testing.T) {
+	asserts := assert.New(t)
+	auth.General = auth.HMACAuth{SecretKey: []byte("test")}
+	cache.Set("setting_siteURL", "http://test.cloudreve.org", 0)
+	cache.Set("setting_onedrive_monitor_timeout", "600", 0)
+	cache.Set("setting_onedrive_callback_check", "20", 0)
+	handler := Driver{Policy: &model.Policy{}}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	handler.Client.Credential.AccessToken = "1"
+
+	// 小文件由服务端中转
+	{
+		ctx := context.WithValue(context.Background(), fsctx.SavePathCtx, "/123")
+		ctx = context.WithValue(ctx, fsctx.FileSizeCtx, uint64(10))
+		res, err := handler.GetUploadCredential(ctx, 10, "key")
+		asserts.NoError(err)
+		asserts.Equal(serializer.UploadCredential{Mode: serializer.UploadModeRelay}, res)
+	}
+
+	// 大文件分片上传至上传会话
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", "drive/root:/123:/createUploadSession", testMock.Anything, testMock.Anything).
+			Return(&request.Response{
+				Response: &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(strings.NewReader(`{"uploadUrl":"123321"}`)),
+				},
+			})
+		handler.Client.Request = clientMock
+		ctx := context.WithValue(context.Background(), fsctx.SavePathCtx, "/123")
+		ctx = context.WithValue(ctx, fsctx.FileSizeCtx, uint64(20*1024*1024))
+		go func() {
+			time.Sleep(time.Duration(1) * time.Second)
+			FinishCallback("credentialKey")
+		}()
+		res, err := handler.GetUploadCredential(ctx, 10, "credentialKey")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal(serializer.UploadModeChunk, res.Mode)
+		asserts.Equal("123321", res.UploadURL)
+		asserts.Equal(res.Token, res.Callback)
+		asserts.True(strings.HasPrefix(res.Callback, "http://test.cloudreve.org/api/v3/callback/onedrive/finish/credentialKey?sign="))
+		asserts.True(res.Expires > time.Now().Unix())
+		asserts.Empty(res.Fields)
+	}
+
+	// 失败
+	{
+		_, err := handler.GetUploadCredential(context.Background(), 10, "key")
+		asserts.Equal(ErrNoSavePathCtx, err)
+	}
+}
+
+func TestDriver_Token_RelayThreshold(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_siteURL", "http://test.cloudreve.org", 0)
+	cache.Set("setting_onedrive_monitor_timeout", "600", 0)
+	cache.Set("setting_onedrive_callback_check", "20", 0)
+	threshold := uint64(10 * 1024 * 1024)
+
+	testCases := []struct {
+		threshold uint64
+		size      uint64
+		relay     bool
+	}{
+		// 未设置时使用默认阈值
+		{0, SmallFileSize, true},
+		{0, SmallFileSize + 1, false},
+		// 自定义阈值
+		{threshold, threshold - 1, true},
+		{threshold, threshold, true},
+		{threshold, threshold + 1, false},
+		// 超出上限时按上限处理
+		{MaxRelayThreshold * 2, MaxRelayThreshold, true},
+		{MaxRelayThreshold * 2, MaxRelayThreshold + 1, false},
+	}
+
+	for i, testCase := range testCases {
+		handler := Driver{
+			Policy: &model.Policy{
+				OptionsSerialized: model.PolicyOption{OdRelayThreshold: testCase.threshold},
+			},
+		}
+		handler.Client, _ = NewClient(&model.Policy{})
+		handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		handler.Client.Credential.AccessToken = "1"
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			"drive/root:/123:/createUploadSession",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"uploadUrl":"123321"}`)),
+			},
+		})
+		handler.Client.Request = clientMock
+
+		key := fmt.Sprintf("relay_%d", i)
+		ctx := context.WithValue(context.Background(), fsctx.SavePathCtx, "/123")
+		ctx = context.WithValue(ctx, fsctx.FileSizeCtx, testCase.size)
+		res, err := handler.Token(ctx, 10, key)
+		asserts.NoError(err)
+
+		if testCase.relay {
+			// 由服务端中转，不创建上传会话
+			clientMock.AssertNotCalled(t, "Request", "POST", "drive/root:/123:/createUploadSession", testMock.Anything, testMock.Anything)
+			asserts.Equal(serializer.UploadCredential{}, res)
+			continue
+		}
+
+		// 客户端直传
+		asserts.Equal("123321", res.Policy)
+		for {
+			if _, ok := callbackSignal.Load(key); ok {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		FinishCallback(key)
+	}
+}
+
+func TestDriver_Token_ConflictBehavior(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_siteURL", "http://test.cloudreve.org", 0)
+	cache.Set("setting_onedrive_monitor_timeout", "600", 0)
+	cache.Set("setting_onedrive_callback_check", "20", 0)
+
+	testCases := []struct {
+		policy   string
+		override string
+		expected string
+	}{
+		// 默认不覆盖
+		{"", "", "fail"},
+		// 存储策略指定
+		{"fail", "", "fail"},
+		{"replace", "", "replace"},
+		{"rename", "", "rename"},
+		// 上下文覆盖存储策略
+		{"fail", "replace", "replace"},
+		// 无效值回退为 fail
+		{"overwrite", "", "fail"},
+	}
+
+	for i, testCase := range testCases {
+		handler := Driver{
+			Policy: &model.Policy{
+				OptionsSerialized: model.PolicyOption{OdConflictBehavior: testCase.policy},
+			},
+		}
+		handler.Client, _ = NewClient(&model.Policy{})
+		handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		handler.Client.Credential.AccessToken = "1"
+
+		var sentBody string
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			"drive/root:/123:/createUploadSession",
+			testMock.MatchedBy(func(body io.Reader) bool {
+				content, _ := ioutil.ReadAll(body)
+				sentBody = string(content)
+				return true
+			}),
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"uploadUrl":"123321"}`)),
+			},
+		})
+		handler.Client.Request = clientMock
+
+		key := fmt.Sprintf("conflict_%d", i)
+		ctx := context.WithValue(context.Background(), fsctx.SavePathCtx, "/123")
+		ctx = context.WithValue(ctx, fsctx.FileSizeCtx, uint64(20*1024*1024))
+		if testCase.override != "" {
+			ctx = context.WithValue(ctx, fsctx.ConflictBehaviorCtx, testCase.override)
+		}
+		_, err := handler.Token(ctx, 10, key)
+		asserts.NoError(err)
+		asserts.Contains(sentBody, fmt.Sprintf(`"@microsoft.graph.conflictBehavior":"%s"`, testCase.expected))
+
+		// 结束上传监控
+		for {
+			if _, ok := callbackSignal.Load(key); ok {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		FinishCallback(key)
 	}
 }
 
@@ -143,13 +373,26 @@ func TestDriver_Source(t *testing.T) {
 	{
 		handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
 		handler.Client.Credential.AccessToken = "1"
-		cache.Set("onedrive_source_0_123.jpg", "res", 0)
+		cache.Set("onedrive_source_0_download_123.jpg", "res", 0)
 		res, err := handler.Source(context.Background(), "123.jpg", url.URL{}, 0, true, 0)
-		cache.Deletes([]string{"0_123.jpg"}, "onedrive_source_")
+		cache.Deletes([]string{"0_download_123.jpg"}, "onedrive_source_")
 		asserts.NoError(err)
 		asserts.Equal("res", res)
 	}
 
+	// 预览与下载分开缓存
+	{
+		cache.Set("onedrive_source_0_preview_123.jpg", "preview", 0)
+		cache.Set("onedrive_source_0_download_123.jpg", "download", 0)
+		res, err := handler.Source(context.Background(), "123.jpg", url.URL{}, 0, false, 0)
+		asserts.NoError(err)
+		asserts.Equal("preview", res)
+		res, err = handler.Source(context.Background(), "123.jpg", url.URL{}, 0, true, 0)
+		asserts.NoError(err)
+		asserts.Equal("download", res)
+		cache.Deletes([]string{"0_preview_123.jpg", "0_download_123.jpg"}, "onedrive_source_")
+	}
+
 	// 成功
 	{
 		handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
@@ -173,6 +416,44 @@ func TestDriver_Source(t *testing.T) {
 		asserts.NoError(err)
 		asserts.Equal("123321", res)
 	}
+
+	// 经由服务端中转，使用指定文件名下载
+	{
+		auth.General = auth.HMACAuth{SecretKey: []byte("test")}
+		handler.Policy.OptionsSerialized.OdProxyDownload = true
+		ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, model.File{Name: "1.txt", SourceName: "abc_1.txt"})
+		ctx = context.WithValue(ctx, fsctx.DownloadFileNameCtx, "文件.txt")
+		baseURL, _ := url.Parse("https://cloudreve.org")
+		res, err := handler.Source(ctx, "abc_1.txt", *baseURL, 60, true, 0)
+		asserts.NoError(err)
+		asserts.Contains(res, "https://cloudreve.org/api/v3/file/download/")
+
+		sessionURL, _ := url.Parse(res)
+		sessionID := path.Base(sessionURL.Path)
+		file, ok := cache.Get("download_" + sessionID)
+		asserts.True(ok)
+		asserts.Equal("文件.txt", file.(model.File).Name)
+		asserts.Equal("abc_1.txt", file.(model.File).SourceName)
+	}
+
+	// 经由服务端中转，缺少文件上下文
+	{
+		ctx := context.WithValue(context.Background(), fsctx.DownloadFileNameCtx, "文件.txt")
+		res, err := handler.Source(ctx, "abc_1.txt", url.URL{}, 60, true, 0)
+		asserts.Error(err)
+		asserts.Empty(res)
+	}
+
+	// 文件名相同时不中转
+	{
+		cache.Set("onedrive_source_0_download_1.txt", "res", 0)
+		ctx := context.WithValue(context.Background(), fsctx.DownloadFileNameCtx, "1.txt")
+		res, err := handler.Source(ctx, "1.txt", url.URL{}, 60, true, 0)
+		cache.Deletes([]string{"0_download_1.txt"}, "onedrive_source_")
+		asserts.NoError(err)
+		asserts.Equal("res", res)
+		handler.Policy.OptionsSerialized.OdProxyDownload = false
+	}
 }
 
 func TestDriver_List(t *testing.T) {
@@ -217,7 +498,7 @@ func TestDriver_List(t *testing.T) {
 		clientMock.On(
 			"Request",
 			"GET",
-			"me/drive/root/children?$top=999999999",
+			"drive/root/children?$top=999999999",
 			testMock.Anything,
 			testMock.Anything,
 		).Return(&request.Response{
@@ -230,7 +511,7 @@ func TestDriver_List(t *testing.T) {
 		clientMock.On(
 			"Request",
 			"GET",
-			"me/drive/root:/1:/children?$top=999999999",
+			"drive/root:/1:/children?$top=999999999",
 			testMock.Anything,
 			testMock.Anything,
 		).Return(&request.Response{
@@ -245,110 +526,1045 @@ func TestDriver_List(t *testing.T) {
 		asserts.NoError(err)
 		asserts.Len(res, 2)
 	}
+
+	// 使用接口返回的修改时间
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			testMock.Anything,
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"value":[{"name":"1","lastModifiedDateTime":"2020-03-04T05:06:07Z"},{"name":"2"}]}`)),
+			},
+		})
+		handler.Client.Request = clientMock
+		res, err := handler.List(context.Background(), "/", false)
+		asserts.NoError(err)
+		asserts.Len(res, 2)
+		asserts.Equal(time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC), res[0].LastModify.UTC())
+		asserts.False(res[1].LastModify.IsZero())
+	}
 }
 
-func TestDriver_Thumb(t *testing.T) {
+func TestDriver_List_MimeType(t *testing.T) {
 	asserts := assert.New(t)
 	handler := Driver{
-		Policy: &model.Policy{
-			AccessKey:  "ak",
-			SecretKey:  "sk",
-			BucketName: "test",
-			Server:     "test.com",
+		Policy: &model.Policy{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	clientMock := ClientMock{}
+	clientMock.On(
+		"Request",
+		"GET",
+		"drive/root:/mime:/children?$top=999999999",
+		testMock.Anything,
+		testMock.Anything,
+	).Return(&request.Response{
+		Err: nil,
+		Response: &http.Response{
+			StatusCode: 200,
+			Body: ioutil.NopCloser(strings.NewReader(`{"value":[
+				{"name":"a.bin","file":{"mimeType":"image/png"}},
+				{"name":"b.png","file":{}},
+				{"name":"c","file":{}},
+				{"name":"dir","folder":{}}
+			]}`)),
 		},
+	})
+	handler.Client.Request = clientMock
+
+	res, err := handler.List(context.Background(), "/mime", false)
+	clientMock.AssertExpectations(t)
+	asserts.NoError(err)
+	asserts.Len(res, 4)
+	// 使用 OneDrive 返回的类型
+	asserts.Equal("image/png", res[0].MimeType)
+	// 根据扩展名推断
+	asserts.Equal("image/png", res[1].MimeType)
+	// 无法推断
+	asserts.Empty(res[2].MimeType)
+	// 目录无类型
+	asserts.Empty(res[3].MimeType)
+}
+
+func TestDriver_List_InvalidName(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
 	}
 	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
 	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
 
-	// 失败
-	{
-		ctx := context.WithValue(context.Background(), fsctx.ThumbSizeCtx, [2]uint{10, 20})
-		ctx = context.WithValue(ctx, fsctx.FileModelCtx, model.File{})
-		mock.ExpectBegin()
-		mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
-		mock.ExpectCommit()
-		res, err := handler.Thumb(ctx, "123.jpg")
-		asserts.NoError(mock.ExpectationsWereMet())
-		asserts.Error(err)
-		asserts.Empty(res.URL)
+	clientMock := ClientMock{}
+	clientMock.On(
+		"Request",
+		"GET",
+		"drive/root:/dir:/children?$top=999999999",
+		testMock.Anything,
+		testMock.Anything,
+	).Return(&request.Response{
+		Err: nil,
+		Response: &http.Response{
+			StatusCode: 200,
+			Body: ioutil.NopCloser(strings.NewReader(`{"value":[
+				{"name":"..","folder":{}},
+				{"name":"../etc","folder":{}},
+				{"name":"a/b.txt","file":{}},
+				{"name":"a\\b.txt","file":{}},
+				{"name":"invoice\u202ecod.exe","file":{}},
+				{"name":"line\nbreak.txt","file":{}},
+				{"name":"文档 1.txt","file":{}},
+				{"name":"..hidden","file":{}}
+			]}`)),
+		},
+	})
+	handler.Client.Request = clientMock
+
+	// 名称含路径分隔符、控制字符或 ".." 的项目被忽略，不会进入上级目录
+	res, err := handler.List(context.Background(), "/dir", true)
+	clientMock.AssertExpectations(t)
+	asserts.NoError(err)
+	asserts.Len(res, 2)
+	asserts.Equal("dir/文档 1.txt", res[0].Source)
+	asserts.Equal("文档 1.txt", res[0].RelativePath)
+	asserts.Equal("..hidden", res[1].RelativePath)
+}
+
+func TestIsValidName(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.True(isValidName("a.txt"))
+	asserts.True(isValidName("..a"))
+	asserts.True(isValidName("עברית.txt"))
+	asserts.False(isValidName("."))
+	asserts.False(isValidName(".."))
+	asserts.False(isValidName("a/b"))
+	asserts.False(isValidName("a\\b"))
+	asserts.False(isValidName("a\x00b"))
+	asserts.False(isValidName("a\u202egpj.exe"))
+	asserts.False(isValidName("a\u2066b"))
+	asserts.False(isValidName("\xff"))
+}
+
+func TestDriver_List_Parallel(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
 	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	handler.Client.Request = listTreeClientMock{folders: 8}
+	cache.Set("setting_onedrive_list_concurrency", "4", 0)
 
-	// 上下文错误
-	{
-		_, err := handler.Thumb(context.Background(), "123.jpg")
-		asserts.NoError(mock.ExpectationsWereMet())
-		asserts.Error(err)
+	res, err := handler.List(context.Background(), "/", true)
+	asserts.NoError(err)
+	asserts.Len(res, 16)
+	// 结果顺序与串行列取一致
+	for i := 0; i < 8; i++ {
+		asserts.Equal(fmt.Sprintf("%d", i), res[i].RelativePath)
+		asserts.Equal(fmt.Sprintf("%d/file", i), res[8+i].RelativePath)
 	}
 }
 
-func TestDriver_Delete(t *testing.T) {
+func TestDriver_List_Filter(t *testing.T) {
 	asserts := assert.New(t)
 	handler := Driver{
-		Policy: &model.Policy{
-			AccessKey:  "ak",
-			SecretKey:  "sk",
-			BucketName: "test",
-			Server:     "test.com",
-		},
+		Policy: &model.Policy{},
 	}
 	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
 	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	handler.Client.Request = listTreeClientMock{folders: 4}
+	cache.Set("setting_onedrive_list_concurrency", "4", 0)
 
-	// 失败
-	{
-		_, err := handler.Delete(context.Background(), []string{"1"})
-		asserts.NoError(mock.ExpectationsWereMet())
-		asserts.Error(err)
+	testCases := []struct {
+		filter    fsctx.ListFilterType
+		recursive bool
+		expected  []string
+	}{
+		{fsctx.ListAll, true, []string{"0", "1", "2", "3", "0/file", "1/file", "2/file", "3/file"}},
+		// 仅返回文件时仍递归列取子目录
+		{fsctx.ListFilesOnly, true, []string{"0/file", "1/file", "2/file", "3/file"}},
+		{fsctx.ListFoldersOnly, true, []string{"0", "1", "2", "3"}},
+		{fsctx.ListFilesOnly, false, []string{}},
+		{fsctx.ListFoldersOnly, false, []string{"0", "1", "2", "3"}},
 	}
 
+	for i, testCase := range testCases {
+		ctx := context.WithValue(context.Background(), fsctx.ListFilterCtx, testCase.filter)
+		res, err := handler.List(ctx, "/", testCase.recursive)
+		asserts.NoError(err, "Test Case #%d", i)
+		paths := make([]string, 0, len(res))
+		for _, object := range res {
+			paths = append(paths, object.RelativePath)
+		}
+		asserts.Equal(testCase.expected, paths, "Test Case #%d", i)
+	}
 }
 
-func TestDriver_Put(t *testing.T) {
+func TestDriver_List_Error(t *testing.T) {
 	asserts := assert.New(t)
 	handler := Driver{
-		Policy: &model.Policy{
-			AccessKey:  "ak",
-			SecretKey:  "sk",
-			BucketName: "test",
-			Server:     "test.com",
-		},
+		Policy: &model.Policy{},
 	}
 	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
 	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_list_concurrency", "4", 0)
+	// 跳过列取失败后的重试
+	ctx := context.WithValue(context.Background(), fsctx.RetryCtx, ListRetry)
 
-	// 失败
+	// 根目录列取失败
 	{
-		err := handler.Put(context.Background(), ioutil.NopCloser(strings.NewReader("")), "dst", 0)
+		handler.Client.Request = listTreeClientMock{folders: 3, failed: "drive/root/children"}
+		res, err := handler.List(ctx, "/", true)
+		asserts.Error(err)
+		asserts.Empty(res)
+	}
+
+	// 子目录列取失败，返回其余结果
+	{
+		handler.Client.Request = listTreeClientMock{folders: 3, failed: "drive/root:/1:/children"}
+		res, err := handler.List(ctx, "/", true)
 		asserts.Error(err)
+		asserts.Len(res, 5)
+		listErrs, ok := err.(ListErrors)
+		asserts.True(ok)
+		asserts.Len(listErrs, 1)
+		asserts.Equal("1", listErrs[0].Path)
+		asserts.Equal("not found", listErrs[0].Err.Error())
 	}
 }
 
-func TestDriver_Get(t *testing.T) {
+func TestDriver_Walk(t *testing.T) {
 	asserts := assert.New(t)
 	handler := Driver{
-		Policy: &model.Policy{
-			AccessKey:  "ak",
-			SecretKey:  "sk",
-			BucketName: "test",
-			Server:     "test.com",
-		},
+		Policy: &model.Policy{},
 	}
 	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
 	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	ctx := context.WithValue(context.Background(), fsctx.RetryCtx, ListRetry)
 
-	// 无法获取source
+	// 遍历全部对象，子目录紧随其父目录的同级对象之后
 	{
-		res, err := handler.Get(context.Background(), "123.txt")
-		asserts.Error(err)
-		asserts.Nil(res)
+		handler.Client.Request = listTreeClientMock{folders: 3}
+		var paths []string
+		err := handler.Walk(ctx, "/", func(object response.Object) error {
+			paths = append(paths, object.RelativePath)
+			return nil
+		})
+		asserts.NoError(err)
+		asserts.Equal([]string{"0", "1", "2", "0/file", "1/file", "2/file"}, paths)
 	}
 
-	// 成功
-	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
-	clientMock := ClientMock{}
-	clientMock.On(
-		"Request",
-		"GET",
+	// fn 返回错误时提前停止
+	{
+		handler.Client.Request = listTreeClientMock{folders: 3}
+		count := 0
+		stopErr := errors.New("stop")
+		err := handler.Walk(ctx, "/", func(object response.Object) error {
+			count++
+			if object.RelativePath == "0/file" {
+				return stopErr
+			}
+			return nil
+		})
+		asserts.Equal(stopErr, err)
+		asserts.Equal(4, count)
+	}
+
+	// 列取失败
+	{
+		handler.Client.Request = listTreeClientMock{folders: 3, failed: "drive/root:/1:/children"}
+		var paths []string
+		err := handler.Walk(ctx, "/", func(object response.Object) error {
+			paths = append(paths, object.RelativePath)
+			return nil
+		})
+		asserts.Error(err)
+		asserts.Equal([]string{"0", "1", "2", "0/file"}, paths)
+	}
+
+	// 上下文取消
+	{
+		handler.Client.Request = listTreeClientMock{folders: 3}
+		cancelCtx, cancel := context.WithCancel(ctx)
+		count := 0
+		err := handler.Walk(cancelCtx, "/", func(object response.Object) error {
+			count++
+			cancel()
+			return nil
+		})
+		asserts.Equal(ErrClientCanceled, err)
+		asserts.Equal(3, count)
+	}
+}
+
+func TestListErrors_add(t *testing.T) {
+	asserts := assert.New(t)
+	var errs ListErrors
+	errs = errs.add("1", errors.New("error 1"))
+	errs = errs.add("2", ListErrors{{Path: "2/3", Err: errors.New("error 3")}})
+	asserts.Len(errs, 2)
+	asserts.Equal("1", errs[0].Path)
+	asserts.Equal("2/3", errs[1].Path)
+	asserts.Equal("无法列取目录[1]，error 1; 无法列取目录[2/3]，error 3", errs.Error())
+}
+
+// listTreeClientMock 模拟一个根目录下有 folders 个子目录，每个子目录下有一个文件的目录树，
+// 每次请求耗时 delay，请求地址以 failed 开头时返回错误
+type listTreeClientMock struct {
+	folders int
+	delay   time.Duration
+	failed  string
+}
+
+func (m listTreeClientMock) Request(method, target string, body io.Reader, opts ...request.Option) *request.Response {
+	time.Sleep(m.delay)
+	if m.failed != "" && strings.HasPrefix(target, m.failed) {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: 404,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error":{"code":"itemNotFound","message":"not found"}}`)),
+			},
+		}
+	}
+	resBody := `{"value":[{"name":"file"}]}`
+	if strings.HasPrefix(target, "drive/root/children") {
+		items := make([]string, 0, m.folders)
+		for i := 0; i < m.folders; i++ {
+			items = append(items, fmt.Sprintf(`{"name":"%d","folder":{}}`, i))
+		}
+		resBody = `{"value":[` + strings.Join(items, ",") + `]}`
+	}
+	return &request.Response{
+		Response: &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(resBody)),
+		},
+	}
+}
+
+// endlessTreeClientMock 每个目录下都有一个子目录 d 和一个文件 f，模拟无限深的目录树
+type endlessTreeClientMock struct {
+	requests *int32
+}
+
+func (m endlessTreeClientMock) Request(method, target string, body io.Reader, opts ...request.Option) *request.Response {
+	atomic.AddInt32(m.requests, 1)
+	return &request.Response{
+		Response: &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"value":[{"name":"d","folder":{}},{"name":"f","file":{}}]}`)),
+		},
+	}
+}
+
+func TestDriver_List_MaxDepth(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_list_concurrency", "4", 0)
+	cache.Set("setting_onedrive_list_cache_ttl", "0", 0)
+	var requests int32
+	handler.Client.Request = endlessTreeClientMock{requests: &requests}
+	list := func(ctx context.Context, recursive bool) ([]string, []string) {
+		atomic.StoreInt32(&requests, 0)
+		res, err := handler.List(ctx, "/", recursive)
+		asserts.NoError(err)
+		var paths, truncated []string
+		for _, object := range res {
+			paths = append(paths, object.RelativePath)
+			if object.Metadata[MetadataTruncatedKey] == "true" {
+				truncated = append(truncated, object.RelativePath)
+			}
+		}
+		return paths, truncated
+	}
+
+	// 达到上下文指定的深度后不再进入子目录，并标记未列取的目录
+	{
+		ctx := context.WithValue(context.Background(), fsctx.ListDepthCtx, 3)
+		paths, truncated := list(ctx, true)
+		asserts.Equal([]string{"d", "f", "d/d", "d/f", "d/d/d", "d/d/f"}, paths)
+		asserts.Equal([]string{"d/d/d"}, truncated)
+		asserts.EqualValues(3, atomic.LoadInt32(&requests))
+	}
+
+	// 深度为 1 时只列取直接子项目
+	{
+		ctx := context.WithValue(context.Background(), fsctx.ListDepthCtx, 1)
+		paths, truncated := list(ctx, true)
+		asserts.Equal([]string{"d", "f"}, paths)
+		asserts.Equal([]string{"d"}, truncated)
+		asserts.EqualValues(1, atomic.LoadInt32(&requests))
+	}
+
+	// 未指定时使用设置项，上下文中的值优先
+	{
+		cache.Set("setting_onedrive_list_max_depth", "2", 0)
+		defer cache.Set("setting_onedrive_list_max_depth", "0", 0)
+		paths, truncated := list(context.Background(), true)
+		asserts.Equal([]string{"d", "f", "d/d", "d/f"}, paths)
+		asserts.Equal([]string{"d/d"}, truncated)
+
+		ctx := context.WithValue(context.Background(), fsctx.ListDepthCtx, 1)
+		paths, _ = list(ctx, true)
+		asserts.Len(paths, 2)
+	}
+
+	// 非递归列取不标记目录
+	{
+		ctx := context.WithValue(context.Background(), fsctx.ListDepthCtx, 1)
+		paths, truncated := list(ctx, false)
+		asserts.Equal([]string{"d", "f"}, paths)
+		asserts.Empty(truncated)
+	}
+}
+
+func BenchmarkDriver_List(b *testing.B) {
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	handler.Client.Request = listTreeClientMock{folders: 16, delay: time.Duration(10) * time.Millisecond}
+
+	for _, parallel := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrency-%d", parallel), func(b *testing.B) {
+			cache.Set("setting_onedrive_list_concurrency", fmt.Sprintf("%d", parallel), 0)
+			for i := 0; i < b.N; i++ {
+				handler.List(context.Background(), "/", true)
+			}
+		})
+	}
+}
+
+func TestDriver_Thumb(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{
+			AccessKey:  "ak",
+			SecretKey:  "sk",
+			BucketName: "test",
+			Server:     "test.com",
+		},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	// 失败，授权失效等错误不清空pic_info
+	{
+		ctx := context.WithValue(context.Background(), fsctx.ThumbSizeCtx, [2]uint{10, 20})
+		ctx = context.WithValue(ctx, fsctx.FileModelCtx, model.File{})
+		res, err := handler.Thumb(ctx, "123.jpg")
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+		asserts.Empty(res.URL)
+	}
+
+	// 上下文中无尺寸设置，使用默认尺寸
+	{
+		handler.Client.Credential.AccessToken = "1"
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			"drive/root:/123.jpg:/thumbnails?select=c400x300_Crop",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"value":[{"c400x300_Crop":{"url":"thumb"}}]}`)),
+			},
+		})
+		handler.Client.Request = clientMock
+		res, err := handler.Thumb(context.Background(), "123.jpg")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.True(res.Redirect)
+		asserts.Equal("thumb", res.URL)
+	}
+
+	// 请求预定义尺寸
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			"drive/root:/123.jpg:/thumbnails/0/large",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"url":"large"}`)),
+			},
+		})
+		handler.Client.Request = clientMock
+		ctx := context.WithValue(context.Background(), fsctx.ThumbSizeCtx, [2]uint{800, 800})
+		res, err := handler.Thumb(ctx, "123.jpg")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("large", res.URL)
+	}
+}
+
+func TestDriver_Delete(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{
+			AccessKey:  "ak",
+			SecretKey:  "sk",
+			BucketName: "test",
+			Server:     "test.com",
+		},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	// 失败
+	{
+		_, err := handler.Delete(context.Background(), []string{"1"})
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+	}
+
+	// 清除外链缓存
+	{
+		cache.Set("onedrive_source_0_preview_1.txt", "url1", 0)
+		cache.Set("onedrive_source_0_preview_2.txt", "url2", 0)
+		cache.Set("onedrive_source_0_preview_3.txt", "url3", 0)
+		cache.Set("onedrive_source_0_download_1.txt", "url1", 0)
+		handler.Delete(context.Background(), []string{"1.txt", "2.txt"})
+		_, ok := cache.Get("onedrive_source_0_preview_1.txt")
+		asserts.False(ok)
+		_, ok = cache.Get("onedrive_source_0_download_1.txt")
+		asserts.False(ok)
+		_, ok = cache.Get("onedrive_source_0_preview_2.txt")
+		asserts.False(ok)
+		_, ok = cache.Get("onedrive_source_0_preview_3.txt")
+		asserts.True(ok)
+	}
+
+}
+
+func TestDriver_Move(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	// 失败
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"PATCH",
+			testMock.Anything,
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: errors.New("error"),
+		})
+		handler.Client.Request = clientMock
+		cache.Set("onedrive_source_0_preview_1.txt", "url1", 0)
+		err := handler.Move(context.Background(), "1.txt", "2.txt")
+		clientMock.AssertExpectations(t)
+		asserts.Error(err)
+		_, ok := cache.Get("onedrive_source_0_preview_1.txt")
+		asserts.True(ok)
+	}
+
+	// 成功，清除外链缓存
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"PATCH",
+			testMock.Anything,
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"name":"2.txt"}`)),
+			},
+		})
+		handler.Client.Request = clientMock
+		err := handler.Move(context.Background(), "1.txt", "2.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		_, ok := cache.Get("onedrive_source_0_preview_1.txt")
+		asserts.False(ok)
+	}
+}
+
+func TestDriver_Copy(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_copy_check", "0", 0)
+
+	// 创建复制任务失败
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			"drive/root:/1.txt:/copy?@microsoft.graph.conflictBehavior=fail",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: errors.New("error"),
+		})
+		handler.Client.Request = clientMock
+		err := handler.Copy(context.Background(), "1.txt", "2.txt")
+		clientMock.AssertExpectations(t)
+		asserts.Error(err)
+	}
+
+	// 成功，使用存储策略指定的重名处理方式
+	{
+		handler.Policy.OptionsSerialized.OdConflictBehavior = "replace"
+		cache.Set("onedrive_source_0_preview_2.txt", "url", 0)
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			"drive/root:/1.txt:/copy?@microsoft.graph.conflictBehavior=replace",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 202,
+				Header:     http.Header{"Location": {"http://monitor"}},
+				Body:       ioutil.NopCloser(strings.NewReader(``)),
+			},
+		})
+		clientMock.On(
+			"Request",
+			"GET",
+			"http://monitor",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"status":"completed"}`)),
+			},
+		})
+		handler.Client.Request = clientMock
+		err := handler.Copy(context.Background(), "1.txt", "2.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		_, ok := cache.Get("onedrive_source_0_preview_2.txt")
+		asserts.False(ok)
+	}
+}
+
+func TestDriver_Exists(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_etag_cache_ttl", "3600", 0)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	handler := Driver{Policy: &model.Policy{}}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	handler.Client.Credential.AccessToken = "1"
+
+	mockMeta := func(path string, code int, body string) {
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"GET",
+			"drive/root:/"+path+"?expand=thumbnails",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: code,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			},
+		})
+		handler.Client.Request = clientMock
+	}
+
+	// 已存在
+	{
+		mockMeta("exist.txt", 200, `{"name":"exist.txt"}`)
+		exist, err := handler.Exists(context.Background(), "/exist.txt")
+		asserts.NoError(err)
+		asserts.True(exist)
+	}
+
+	// 不存在
+	{
+		mockMeta("not_exist.txt", 404, `{"error":{"code":"itemNotFound"}}`)
+		exist, err := handler.Exists(context.Background(), "/not_exist.txt")
+		asserts.NoError(err)
+		asserts.False(exist)
+	}
+
+	// 不存在，响应中没有错误代码
+	{
+		mockMeta("no_code.txt", 404, ``)
+		exist, err := handler.Exists(context.Background(), "/no_code.txt")
+		asserts.NoError(err)
+		asserts.False(exist)
+	}
+
+	// 鉴权失败时返回错误
+	{
+		mockMeta("denied.txt", 403, `{"error":{"code":"accessDenied"}}`)
+		_, err := handler.Exists(context.Background(), "/denied.txt")
+		asserts.Error(err)
+
+		mockMeta("unauthorized.txt", 401, `{"error":{"code":"InvalidAuthenticationToken"}}`)
+		_, err = handler.Exists(context.Background(), "/unauthorized.txt")
+		asserts.Error(err)
+	}
+}
+
+func TestDriver_Get_Range(t *testing.T) {
+	asserts := assert.New(t)
+	content := strings.Repeat("0123456789", 200)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	handler := Driver{
+		Policy:     &model.Policy{},
+		HTTPClient: request.HTTPClient{},
+	}
+	cache.Set("onedrive_source_0_preview_range.txt", server.URL, 0)
+	file := model.File{Size: uint64(len(content))}
+
+	serve := func(rangeHeader string) *httptest.ResponseRecorder {
+		ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, file)
+		ctx = context.WithValue(ctx, fsctx.RangeCtx, rangeHeader)
+		res, err := handler.Get(ctx, "range.txt")
+		asserts.NoError(err)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Range", rangeHeader)
+		http.ServeContent(rec, req, "range.txt", time.Time{}, res)
+		return rec
+	}
+
+	// 文件中间的范围
+	{
+		rec := serve("bytes=1005-1014")
+		asserts.Equal(http.StatusPartialContent, rec.Code)
+		asserts.Equal("bytes 1005-1014/2000", rec.Header().Get("Content-Range"))
+		asserts.Equal("10", rec.Header().Get("Content-Length"))
+		asserts.Equal("5678901234", rec.Body.String())
+	}
+
+	// 不指定结束位置的范围
+	{
+		rec := serve("bytes=1000-")
+		asserts.Equal(http.StatusPartialContent, rec.Code)
+		asserts.Equal("bytes 1000-1999/2000", rec.Header().Get("Content-Range"))
+		asserts.Equal("1000", rec.Header().Get("Content-Length"))
+		asserts.Equal(content[1000:], rec.Body.String())
+	}
+
+	// 不按范围获取
+	{
+		ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, file)
+		res, err := handler.Get(ctx, "range.txt")
+		asserts.NoError(err)
+		rec := httptest.NewRecorder()
+		http.ServeContent(rec, httptest.NewRequest("GET", "/", nil), "range.txt", time.Time{}, res)
+		asserts.Equal(http.StatusOK, rec.Code)
+		asserts.Equal(content, rec.Body.String())
+	}
+
+	// 范围无法满足
+	{
+		ctx := context.WithValue(context.Background(), fsctx.RangeCtx, "bytes=5000-")
+		res, err := handler.Get(ctx, "range.txt")
+		asserts.Error(err)
+		asserts.Nil(res)
+	}
+}
+
+func TestDriver_Get_SniffContentType(t *testing.T) {
+	asserts := assert.New(t)
+	png := "\x89PNG\x0D\x0A\x1A\x0A" + strings.Repeat("\x00", 600)
+	pdf := "%PDF-1.4\n" + strings.Repeat("0", 600)
+	text := "hello, Cloudreve"
+	contents := map[string]string{"/png": png, "/pdf": pdf, "/text": text, "/known.png": pdf}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte(contents[r.URL.Path]))
+	}))
+	defer server.Close()
+
+	handler := Driver{
+		Policy:     &model.Policy{},
+		HTTPClient: request.HTTPClient{},
+	}
+	serve := func(name string) (string, *httptest.ResponseRecorder) {
+		cache.Set("onedrive_source_0_preview_"+name, server.URL+"/"+name, 0)
+		ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, model.File{Size: uint64(len(contents["/"+name]))})
+		res, err := handler.Get(ctx, name)
+		asserts.NoError(err)
+
+		contentType := response.ContentType(res)
+		rec := httptest.NewRecorder()
+		if contentType != "" {
+			rec.Header().Set("Content-Type", contentType)
+		}
+		http.ServeContent(rec, httptest.NewRequest("GET", "/", nil), name, time.Time{}, res)
+		return contentType, rec
+	}
+
+	// 无扩展名的 PNG 图像
+	{
+		contentType, rec := serve("png")
+		asserts.Equal("image/png", contentType)
+		asserts.Equal(png, rec.Body.String())
+	}
+
+	// 无扩展名的 PDF 文档
+	{
+		contentType, rec := serve("pdf")
+		asserts.Equal("application/pdf", contentType)
+		asserts.Equal(pdf, rec.Body.String())
+	}
+
+	// 无扩展名的文本文件，正文不足 512 字节
+	{
+		contentType, rec := serve("text")
+		asserts.Equal("text/plain; charset=utf-8", contentType)
+		asserts.Equal(text, rec.Body.String())
+	}
+
+	// 扩展名可识别时不探测
+	{
+		contentType, rec := serve("known.png")
+		asserts.Empty(contentType)
+		asserts.Equal("image/png", rec.Header().Get("Content-Type"))
+		asserts.Equal(pdf, rec.Body.String())
+	}
+}
+
+func TestDriver_Put(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{
+			AccessKey:  "ak",
+			SecretKey:  "sk",
+			BucketName: "test",
+			Server:     "test.com",
+		},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	// 失败
+	{
+		err := handler.Put(context.Background(), ioutil.NopCloser(strings.NewReader("")), "dst", 0)
+		asserts.Error(err)
+	}
+}
+
+func TestDriver_Put_Empty(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_verify_upload", "1", 0)
+	defer cache.Set("setting_onedrive_verify_upload", "0", 0)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	// 以空正文创建文件，不读取文件流
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "PUT", "drive/root:/dir/empty.txt:/content", nil, testMock.Anything).
+			Return(&request.Response{
+				Response: &http.Response{
+					StatusCode: 201,
+					Body: ioutil.NopCloser(strings.NewReader(
+						`{"name":"empty.txt","size":0,"file":{"hashes":{"quickXorHash":"AAAAAAAAAAAAAAAAAAAAAAAAAAA="}}}`,
+					)),
+				},
+			})
+		handler.Client.Request = clientMock
+		err := handler.Put(context.Background(), ioutil.NopCloser(failedReader{}), "dir/empty.txt", 0)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+	}
+
+	// 上传后可在列取结果中找到
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/dir:/children?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(&request.Response{
+				Response: &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(strings.NewReader(`{"value":[{"name":"empty.txt","size":0,"file":{}}]}`)),
+				},
+			})
+		handler.Client.Request = clientMock
+		res, err := handler.List(context.Background(), "dir", false)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Len(res, 1)
+		asserts.Equal("empty.txt", res[0].Name)
+		asserts.False(res[0].IsDir)
+		asserts.EqualValues(0, res[0].Size)
+	}
+
+	// 空文件使用服务端中转
+	{
+		ctx := context.WithValue(context.Background(), fsctx.SavePathCtx, "/empty.txt")
+		ctx = context.WithValue(ctx, fsctx.FileSizeCtx, uint64(0))
+		handler.Policy.OptionsSerialized.OdRelayThreshold = 1
+		res, err := handler.Token(ctx, 10, "key")
+		asserts.NoError(err)
+		asserts.Equal(serializer.UploadCredential{}, res)
+	}
+}
+
+// failedReader 读取时总是返回错误
+type failedReader struct{}
+
+func (failedReader) Read(p []byte) (int, error) {
+	return 0, errors.New("should not be read")
+}
+
+func TestDriver_Get_ProxyHeaders(t *testing.T) {
+	asserts := assert.New(t)
+	var originAuth, cdnAuth, cdnRange []string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		originAuth = append(originAuth, r.Header.Get("Authorization"))
+		w.Write([]byte("origin"))
+	}))
+	defer origin.Close()
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnAuth = append(cdnAuth, r.Header.Get("Authorization"))
+		cdnRange = append(cdnRange, r.Header.Get("Range"))
+		w.Write([]byte("cdn"))
+	}))
+	defer cdn.Close()
+
+	cache.Set("onedrive_source_0_preview_proxy.txt", origin.URL+"/proxy.txt?token=1", 0)
+	file := model.File{Size: 3}
+	ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, file)
+	headers := map[string]string{"authorization": "Bearer cdn"}
+
+	// 使用反代地址时附加请求头，同时转发字节范围
+	{
+		handler := Driver{
+			Policy: &model.Policy{OptionsSerialized: model.PolicyOption{
+				OdProxy:        cdn.URL,
+				OdProxyHeaders: headers,
+			}},
+			HTTPClient: request.HTTPClient{},
+		}
+		res, err := handler.Get(context.WithValue(ctx, fsctx.RangeCtx, "bytes=0-1"), "proxy.txt")
+		asserts.NoError(err)
+		res.Close()
+		asserts.Equal([]string{"Bearer cdn"}, cdnAuth)
+		asserts.Equal([]string{"bytes=0-1"}, cdnRange)
+		asserts.Empty(originAuth)
+	}
+
+	// 未设置反代地址时不附加请求头
+	{
+		handler := Driver{
+			Policy: &model.Policy{OptionsSerialized: model.PolicyOption{
+				OdProxyHeaders: headers,
+			}},
+			HTTPClient: request.HTTPClient{},
+		}
+		res, err := handler.Get(ctx, "proxy.txt")
+		asserts.NoError(err)
+		res.Close()
+		asserts.Equal([]string{""}, originAuth)
+		asserts.Len(cdnAuth, 1)
+	}
+
+	// 反代地址为 OAuth 端点时不替换，也不附加请求头
+	{
+		handler := Driver{
+			Policy: &model.Policy{OptionsSerialized: model.PolicyOption{
+				OdProxy:        "https://login.microsoftonline.com",
+				OdProxyHeaders: headers,
+			}},
+		}
+		asserts.Nil(handler.proxyHeaders("https://login.microsoftonline.com/a.txt"))
+		asserts.Nil(handler.proxyHeaders(origin.URL + "/proxy.txt"))
+
+		// 配置为 CDN 主机后附加请求头
+		handler.Policy.OptionsSerialized.OdCDNHosts = []string{"login.microsoftonline.com"}
+		asserts.NotNil(handler.proxyHeaders("https://login.microsoftonline.com/a.txt"))
+		asserts.Nil(handler.proxyHeaders(origin.URL + "/proxy.txt"))
+	}
+}
+
+func TestDriver_Get(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{
+			AccessKey:  "ak",
+			SecretKey:  "sk",
+			BucketName: "test",
+			Server:     "test.com",
+		},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+
+	// 无法获取source
+	{
+		res, err := handler.Get(context.Background(), "123.txt")
+		asserts.Error(err)
+		asserts.Nil(res)
+	}
+
+	// 成功
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	clientMock := ClientMock{}
+	clientMock.On(
+		"Request",
+		"GET",
 		testMock.Anything,
 		testMock.Anything,
 		testMock.Anything,
@@ -386,3 +1602,505 @@ func TestDriver_Get(t *testing.T) {
 	asserts.NoError(err)
 	asserts.Equal("123", string(content))
 }
+
+func TestDriver_Get_ContentLength(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Policy.ID = 76
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	handler.Client.Credential.AccessToken = "1"
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	downloadResponse := func() *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode:    200,
+				ContentLength: -1,
+				Body:          ioutil.NopCloser(strings.NewReader(`123`)),
+			},
+		}
+	}
+	driverClientMock := ClientMock{}
+	driverClientMock.On("Request", "GET", "https://cqu.edu.cn/download", testMock.Anything, testMock.Anything).
+		Return(downloadResponse())
+	handler.HTTPClient = driverClientMock
+
+	// 由文件记录获取大小
+	{
+		cache.Set(sourceCachePrefix+getSourceCacheKey(76, "model.txt", false), "https://cqu.edu.cn/download", 0)
+		ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, model.File{Size: 3})
+		res, err := handler.Get(ctx, "model.txt")
+		asserts.NoError(err)
+		asserts.True(response.SizeKnown(res))
+		size, err := res.Seek(0, io.SeekEnd)
+		asserts.NoError(err)
+		asserts.EqualValues(3, size)
+	}
+
+	// 由元信息获取大小
+	{
+		cache.Set(sourceCachePrefix+getSourceCacheKey(76, "head.txt", false), "https://cqu.edu.cn/download", 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/head.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"name":"head.txt","size":3,"file":{}}`))
+		handler.Client.Request = clientMock
+		res, err := handler.Get(context.Background(), "head.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.True(response.SizeKnown(res))
+		size, err := res.Seek(0, io.SeekEnd)
+		asserts.NoError(err)
+		asserts.EqualValues(3, size)
+	}
+
+	// 无法获取大小，存储端也未返回 Content-Length
+	{
+		cache.Set(sourceCachePrefix+getSourceCacheKey(76, "unknown.txt", false), "https://cqu.edu.cn/download", 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/unknown.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(500, `{"error":{"code":"generalException"}}`))
+		handler.Client.Request = clientMock
+		res, err := handler.Get(context.Background(), "unknown.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.False(response.SizeKnown(res))
+	}
+}
+
+func TestDriver_Head(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	handler.Client.Credential.AccessToken = "1"
+	metaResponse := func() *request.Response {
+		return &request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body: ioutil.NopCloser(strings.NewReader(
+					`{"name":"a.txt","size":1024,"eTag":"etag1","lastModifiedDateTime":"2020-01-02T03:04:05Z"}`,
+				)),
+			},
+		}
+	}
+
+	// 成功
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/dir/a.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(metaResponse())
+		handler.Client.Request = clientMock
+		res, err := handler.Head(context.Background(), "dir/a.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("a.txt", res.Name)
+		asserts.Equal("dir/a.txt", res.Source)
+		asserts.EqualValues(1024, res.Size)
+		asserts.Equal("etag1", res.ETag)
+		asserts.False(res.IsDir)
+		asserts.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), res.LastModify.UTC())
+	}
+
+	// 失败
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", testMock.Anything, testMock.Anything, testMock.Anything).
+			Return(&request.Response{Err: errors.New("error")})
+		handler.Client.Request = clientMock
+		_, err := handler.Head(context.Background(), "dir/a.txt")
+		asserts.Error(err)
+	}
+
+	// 缺少文件记录时，Get 通过元信息获取文件大小
+	{
+		cache.Set("onedrive_source_0_preview_dir/a.txt", "http://download.com/a.txt", 0)
+		defer cache.Deletes([]string{"0_dir/a.txt"}, "onedrive_source_")
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/dir/a.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(metaResponse())
+		handler.Client.Request = clientMock
+		driverClientMock := ClientMock{}
+		driverClientMock.On("Request", "GET", "http://download.com/a.txt", testMock.Anything, testMock.Anything).
+			Return(&request.Response{
+				Err: nil,
+				Response: &http.Response{
+					StatusCode:    200,
+					ContentLength: -1,
+					Body:          ioutil.NopCloser(strings.NewReader(`123`)),
+				},
+			})
+		handler.HTTPClient = driverClientMock
+		res, err := handler.Get(context.Background(), "dir/a.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		size, err := res.Seek(0, io.SeekEnd)
+		asserts.NoError(err)
+		asserts.EqualValues(1024, size)
+	}
+}
+
+func TestDriver_Get_SpeedLimit(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	cache.Set("onedrive_source_0_preview_speed.txt", "http://download.com/speed.txt", 0)
+	defer cache.Deletes([]string{"0_speed.txt"}, "onedrive_source_")
+
+	speed := 10 * 1024
+	driverClientMock := ClientMock{}
+	driverClientMock.On("Request", "GET", "http://download.com/speed.txt", testMock.Anything, testMock.Anything).
+		Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(strings.Repeat("1", 2*speed))),
+			},
+		})
+	handler.HTTPClient = driverClientMock
+
+	ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, model.File{Size: uint64(2 * speed)})
+	ctx = context.WithValue(ctx, fsctx.UserCtx, model.User{Group: model.Group{SpeedLimit: speed}})
+	res, err := handler.Get(ctx, "speed.txt")
+	asserts.NoError(err)
+	_, err = res.Seek(0, io.SeekStart)
+	asserts.NoError(err)
+
+	start := time.Now()
+	content, err := ioutil.ReadAll(res)
+	elapsed := time.Since(start)
+	asserts.NoError(err)
+	asserts.Len(content, 2*speed)
+	// 用户组限速由文件系统处理，适配器不再重复限速
+	asserts.True(elapsed < 500*time.Millisecond, "elapsed %s", elapsed)
+}
+
+// meterMock 记录报告的用户流量
+type meterMock struct {
+	reports []string
+}
+
+func (m *meterMock) Report(userID uint, direction response.TrafficDirection, bytes int64) {
+	m.reports = append(m.reports, fmt.Sprintf("%d:%d:%d", userID, direction, bytes))
+}
+
+func TestDriver_Metering(t *testing.T) {
+	asserts := assert.New(t)
+	meter := &meterMock{}
+	response.DefaultMeter = meter
+	defer func() { response.DefaultMeter = nil }()
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+
+	content := strings.Repeat("0123456789", 200)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	handler := Driver{
+		Policy:     &model.Policy{},
+		HTTPClient: request.HTTPClient{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("onedrive_source_0_preview_meter.txt", server.URL, 0)
+	user := model.User{}
+	user.ID = 69
+	ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, model.File{Size: uint64(len(content))})
+	ctx = context.WithValue(ctx, fsctx.UserCtx, user)
+
+	// 完整下载
+	{
+		meter.reports = nil
+		res, err := handler.Get(ctx, "meter.txt")
+		asserts.NoError(err)
+		rec := httptest.NewRecorder()
+		http.ServeContent(rec, httptest.NewRequest("GET", "/", nil), "meter.txt", time.Time{}, res)
+		asserts.Equal(content, rec.Body.String())
+		asserts.Empty(meter.reports)
+		asserts.NoError(res.Close())
+		asserts.Equal([]string{"69:0:2000"}, meter.reports)
+	}
+
+	// 按范围下载
+	{
+		meter.reports = nil
+		res, err := handler.Get(context.WithValue(ctx, fsctx.RangeCtx, "bytes=1000-1099"), "meter.txt")
+		asserts.NoError(err)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Range", "bytes=1000-1099")
+		http.ServeContent(rec, req, "meter.txt", time.Time{}, res)
+		asserts.Equal(content[1000:1100], rec.Body.String())
+		asserts.NoError(res.Close())
+		asserts.Equal([]string{"69:0:100"}, meter.reports)
+	}
+
+	// 客户端中途断开
+	{
+		meter.reports = nil
+		res, err := handler.Get(ctx, "meter.txt")
+		asserts.NoError(err)
+		_, err = res.Seek(0, io.SeekStart)
+		asserts.NoError(err)
+		buf := make([]byte, 300)
+		_, err = io.ReadFull(res, buf)
+		asserts.NoError(err)
+		asserts.NoError(res.Close())
+		asserts.Equal([]string{"69:0:300"}, meter.reports)
+	}
+
+	// 无用户时不计量
+	{
+		meter.reports = nil
+		res, err := handler.Get(context.Background(), "meter.txt")
+		asserts.NoError(err)
+		asserts.NoError(res.Close())
+		asserts.Empty(meter.reports)
+	}
+
+	// 完整上传
+	{
+		meter.reports = nil
+		clientMock := ClientMock{}
+		clientMock.On("Request", "PUT", "drive/root:/meter.txt:/content", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(201, `{"name":"meter.txt","size":10,"file":{}}`))
+		handler.Client.Request = clientMock
+		err := handler.Put(ctx, ioutil.NopCloser(strings.NewReader("1234567890")), "meter.txt", 10)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal([]string{"69:1:10"}, meter.reports)
+	}
+
+	// 客户端上传中途断开
+	{
+		meter.reports = nil
+		file := ioutil.NopCloser(io.MultiReader(strings.NewReader("12345"), failedReader{}))
+		err := handler.Put(ctx, file, "meter.txt", 10)
+		asserts.Error(err)
+		asserts.Equal([]string{"69:1:5"}, meter.reports)
+	}
+}
+
+func TestDriver_DirSize(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	jsonResponse := func(body string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			},
+		}
+	}
+
+	// 使用目录项的汇总大小，遍历统计文件数量
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/sized?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(jsonResponse(`{"name":"sized","size":30,"folder":{"childCount":2}}`))
+		clientMock.On("Request", "GET", "drive/root:/sized:/children?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(jsonResponse(`{"value":[{"name":"a.txt","size":10,"file":{}},{"name":"sub","size":20,"folder":{"childCount":1}}]}`))
+		clientMock.On("Request", "GET", "drive/root:/sized/sub:/children?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(jsonResponse(`{"value":[{"name":"b.txt","size":20,"file":{}}]}`))
+		handler.Client.Request = clientMock
+		size, count, err := handler.DirSize(context.Background(), "/sized")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.EqualValues(30, size)
+		asserts.EqualValues(2, count)
+	}
+
+	// 空目录无需遍历
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/empty?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(jsonResponse(`{"name":"empty","size":0,"folder":{"childCount":0}}`))
+		handler.Client.Request = clientMock
+		size, count, err := handler.DirSize(context.Background(), "empty")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.EqualValues(0, size)
+		asserts.EqualValues(0, count)
+	}
+
+	// 目标不是目录
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/sized.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(jsonResponse(`{"name":"sized.txt","size":10,"file":{}}`))
+		handler.Client.Request = clientMock
+		_, _, err := handler.DirSize(context.Background(), "sized.txt")
+		asserts.Equal(ErrNotFolder, err)
+	}
+
+	// 无法获取目录信息
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/missing?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(&request.Response{Err: errors.New("error")})
+		handler.Client.Request = clientMock
+		_, _, err := handler.DirSize(context.Background(), "missing")
+		asserts.Error(err)
+	}
+}
+
+func TestDriver_DeletePrefix(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	deleteResponse := func(status int, body string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: status,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			},
+		}
+	}
+
+	// 以单个请求删除目录及其内容，不逐个列取
+	{
+		cache.Set("onedrive_source_0_preview_dir", "url", 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "DELETE", "drive/root:/dir", testMock.Anything, testMock.Anything).
+			Return(deleteResponse(204, ""))
+		handler.Client.Request = clientMock
+		failed, err := handler.DeletePrefix(context.Background(), "/dir/")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Empty(failed)
+		_, ok := cache.Get("onedrive_source_0_preview_dir")
+		asserts.False(ok)
+	}
+
+	// 删除失败时返回目录本身
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "DELETE", "drive/root:/dir", testMock.Anything, testMock.Anything).
+			Return(deleteResponse(404, `{"error":{"code":"itemNotFound"}}`))
+		handler.Client.Request = clientMock
+		failed, err := handler.DeletePrefix(context.Background(), "dir")
+		clientMock.AssertExpectations(t)
+		asserts.True(IsNotFound(err))
+		asserts.Equal([]string{"dir"}, failed)
+	}
+
+	// 禁止删除根目录
+	{
+		clientMock := ClientMock{}
+		handler.Client.Request = clientMock
+		failed, err := handler.DeletePrefix(context.Background(), "/")
+		clientMock.AssertExpectations(t)
+		asserts.Equal(ErrDeleteFile, err)
+		asserts.Equal([]string{""}, failed)
+	}
+
+	// 按文件列表删除时使用批量请求
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", "https://graph.microsoft.com/v1.0/$batch", testMock.Anything, testMock.Anything).
+			Return(deleteResponse(200, `{"responses":[{"id":"dir/a.txt","status":204},{"id":"dir/b.txt","status":404}]}`))
+		handler.Client.Request = clientMock
+		failed, err := handler.Delete(context.Background(), []string{"dir/a.txt", "dir/b.txt"})
+		clientMock.AssertExpectations(t)
+		asserts.Equal(ErrDeleteFile, err)
+		asserts.Equal([]string{"dir/b.txt"}, failed)
+	}
+}
+
+func TestDriver_Capabilities(t *testing.T) {
+	asserts := assert.New(t)
+	res := Driver{}.Capabilities()
+	asserts.Equal(response.Capabilities{
+		NativeMove:   true,
+		NativeCopy:   true,
+		Rename:       true,
+		Thumbnail:    true,
+		RangeRead:    true,
+		Upload:       response.UploadDirectChunked,
+		URLUpload:    true,
+		Quota:        true,
+		Search:       true,
+		Versioning:   true,
+		DirSize:      true,
+		PrefixDelete: true,
+	}, res)
+}
+
+func TestDriver_Get_Redirect(t *testing.T) {
+	asserts := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "http://cdn.invalid/c", http.StatusTemporaryRedirect)
+		case "/c":
+			w.Write([]byte("content"))
+		case "/l1":
+			http.Redirect(w, r, "/l2", http.StatusFound)
+		case "/l2":
+			http.Redirect(w, r, "/l1", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	policy := &model.Policy{}
+	policy.OptionsSerialized.OdProxy = server.URL
+	handler := Driver{
+		Policy:     policy,
+		HTTPClient: request.HTTPClient{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, model.File{Size: 7})
+	cache.Set("setting_onedrive_download_max_redirects", "5", 0)
+
+	// 经两次重定向获取文件，每一跳均替换为反代地址
+	{
+		cache.Set("onedrive_source_0_preview_redirect.txt", "http://origin.invalid/a", 0)
+		res, err := handler.Get(ctx, "redirect.txt")
+		asserts.NoError(err)
+		_, err = res.Seek(0, io.SeekStart)
+		asserts.NoError(err)
+		content, err := ioutil.ReadAll(res)
+		asserts.NoError(err)
+		asserts.Equal("content", string(content))
+		res.Close()
+	}
+
+	// 重定向循环
+	{
+		cache.Set("onedrive_source_0_preview_loop.txt", server.URL+"/l1", 0)
+		res, err := handler.Get(ctx, "loop.txt")
+		asserts.Nil(res)
+		asserts.Equal(ErrRedirectLoop, err)
+	}
+
+	// 超过重定向次数上限
+	{
+		cache.Set("setting_onedrive_download_max_redirects", "1", 0)
+		res, err := handler.Get(ctx, "redirect.txt")
+		asserts.Nil(res)
+		asserts.Equal(ErrTooManyRedirects, err)
+		cache.Set("setting_onedrive_download_max_redirects", "5", 0)
+	}
+}
@@ -1,22 +1,34 @@
 package onedrive
 
 import (
-	model "github.com/cloudreve/Cloudreve/v3/models"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
 )
 
 func TestDriver_replaceSourceHost(t *testing.T) {
 	tests := []struct {
-		name    string
-		origin  string
-		cdn     string
-		want    string
-		wantErr bool
+		name   string
+		origin string
+		cdn    string
+		want   string
 	}{
-		{"TestNoReplace", "http://1dr.ms/download.aspx?123456", "", "http://1dr.ms/download.aspx?123456", false},
-		{"TestReplaceCorrect", "http://1dr.ms/download.aspx?123456", "https://test.com:8080", "https://test.com:8080/download.aspx?123456", false},
-		{"TestCdnFormatError", "http://1dr.ms/download.aspx?123456", string([]byte{0x7f}), "", true},
-		{"TestSrcFormatError", string([]byte{0x7f}), "https://test.com:8080", "", true},
+		{"TestNoReplace", "http://1dr.ms/download.aspx?123456", "", "http://1dr.ms/download.aspx?123456"},
+		{"TestReplaceCorrect", "http://1dr.ms/download.aspx?123456", "https://test.com:8080", "https://test.com:8080/download.aspx?123456"},
+		{"TestCdnFormatErrorFallback", "http://1dr.ms/download.aspx?123456", string([]byte{0x7f}), "http://1dr.ms/download.aspx?123456"},
+		{"TestSrcFormatErrorFallback", string([]byte{0x7f}), "https://test.com:8080", string([]byte{0x7f})},
+		{"TestReplaceWithPathPrefix", "http://1dr.ms/personal/download.aspx?123456", "https://test.com/onedrive/", "https://test.com/onedrive/personal/download.aspx?123456"},
+		{"TestOAuthEndpointNoReplace", "http://1dr.ms/download.aspx?123456", "https://login.microsoftonline.us", "http://1dr.ms/download.aspx?123456"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -25,14 +37,57 @@ func TestDriver_replaceSourceHost(t *testing.T) {
 			handler := Driver{
 				Policy: policy,
 			}
-			got, err := handler.replaceSourceHost(tt.origin)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("replaceSourceHost() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
+			got := handler.replaceSourceHost(tt.origin)
 			if got != tt.want {
 				t.Errorf("replaceSourceHost() got = %v, want %v", got, tt.want)
 			}
 		})
 	}
+
+	// 运营者将反代主机配置为 CDN 时，即使与认证主机同名也进行替换
+	t.Run("TestConfiguredCDNHostReplace", func(t *testing.T) {
+		policy := &model.Policy{}
+		policy.OptionsSerialized.OdProxy = "https://od.login.microsoftonline.us"
+		policy.OptionsSerialized.OdCDNHosts = []string{"od.login.microsoftonline.us"}
+		handler := Driver{Policy: policy}
+		want := "https://od.login.microsoftonline.us/download.aspx?123456"
+		if got := handler.replaceSourceHost("http://1dr.ms/download.aspx?123456"); got != want {
+			t.Errorf("replaceSourceHost() got = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestDriver_Source_InvalidProxy(t *testing.T) {
+	asserts := assert.New(t)
+	policy := &model.Policy{}
+	policy.ID = 92
+	policy.OptionsSerialized.OdProxy = string([]byte{0x7f})
+	handler := Driver{Policy: policy}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_source_timeout", "1800", 0)
+	cache.Set("setting_onedrive_etag_cache_ttl", "0", 0)
+
+	// 反代地址无效时使用原始下载地址
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/fallback.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(&request.Response{Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"name":"fallback.txt","@microsoft.graph.downloadUrl":"https://1dr.ms/download.aspx?fallback"}`)),
+			}})
+		handler.Client.Request = clientMock
+		res, err := handler.Source(context.Background(), "/fallback.txt", url.URL{}, 0, false, 0)
+		asserts.NoError(err)
+		asserts.Equal("https://1dr.ms/download.aspx?fallback", res)
+		clientMock.AssertExpectations(t)
+	}
+
+	// 缓存命中时同样使用原始下载地址
+	{
+		res, err := handler.Source(context.Background(), "/fallback.txt", url.URL{}, 0, false, 0)
+		asserts.NoError(err)
+		asserts.Equal("https://1dr.ms/download.aspx?fallback", res)
+	}
 }
@@ -0,0 +1,67 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/gob"
+	"path"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+)
+
+// listCachePrefix 目录列取结果缓存的键前缀
+const listCachePrefix = "onedrive_list_"
+
+func init() {
+	gob.Register([]response.Object{})
+}
+
+// getListCacheKey 获取目录列取结果的缓存键（不含前缀）
+func getListCacheKey(policyID uint, dir string) string {
+	return policyPathCacheKey(policyID, dir)
+}
+
+// listLevel 列取 dir 下的直接子项目，返回的对象路径以 dir 作为起始根目录。
+// 设定了缓存有效期时优先使用缓存，递归列取时每层目录分别缓存
+func (handler Driver) listLevel(ctx context.Context, dir string) ([]response.Object, error) {
+	ttl := model.GetIntSetting("onedrive_list_cache_ttl", 0)
+	key := getListCacheKey(handler.Policy.ID, dir)
+	if ttl > 0 {
+		if cached, ok := cache.Get(listCachePrefix + key); ok {
+			if objects, ok := cached.([]response.Object); ok {
+				return objects, nil
+			}
+		}
+	}
+
+	objects, err := handler.Client.ListChildren(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]response.Object, 0, len(objects))
+	for _, object := range objects {
+		if obj, ok := toObject(dir, dir, object); ok {
+			res = append(res, obj)
+		}
+	}
+
+	if ttl > 0 {
+		cache.Set(listCachePrefix+key, res, ttl)
+	}
+	return res, nil
+}
+
+// invalidateListCache 清除给定路径及其所在目录的列取结果缓存，
+// 上传、删除、移动等会改变目录内容的操作后应调用此方法
+func invalidateListCache(policyID uint, paths ...string) {
+	keys := make([]string, 0, 2*len(paths))
+	for _, p := range paths {
+		keys = append(keys,
+			getListCacheKey(policyID, p),
+			getListCacheKey(policyID, path.Dir(path.Clean("/"+p))),
+		)
+	}
+	cache.Deletes(keys, listCachePrefix)
+}
@@ -0,0 +1,120 @@
+package onedrive
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestGetListCacheKey(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.Equal("1_", getListCacheKey(1, ""))
+	asserts.Equal("1_", getListCacheKey(1, "/"))
+	asserts.Equal("1_a/b", getListCacheKey(1, "/a/b/"))
+	asserts.Equal("1_a/b", getListCacheKey(1, "a/b"))
+}
+
+func TestDriver_List_Cache(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Policy.ID = 50
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_list_cache_ttl", "60", 0)
+	defer cache.Set("setting_onedrive_list_cache_ttl", "0", 0)
+
+	listResponse := func(body string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			},
+		}
+	}
+
+	// 首次列取时发出请求
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/dir:/children?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(listResponse(`{"value":[{"name":"a.txt","size":1},{"name":"sub","folder":{}}]}`))
+		handler.Client.Request = clientMock
+		res, err := handler.List(context.Background(), "/dir", false)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Len(res, 2)
+	}
+
+	// 有效期内再次列取时使用缓存，不发出请求
+	{
+		clientMock := ClientMock{}
+		handler.Client.Request = clientMock
+		res, err := handler.List(context.Background(), "dir/", false)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Len(res, 2)
+		asserts.Equal("a.txt", res[0].RelativePath)
+		asserts.Equal("dir/a.txt", res[0].Source)
+	}
+
+	// 递归列取时只有直接子项目使用缓存，相对路径以列取的目录为根
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root/children?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(listResponse(`{"value":[{"name":"dir","folder":{}}]}`))
+		clientMock.On("Request", "GET", "drive/root:/dir/sub:/children?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(listResponse(`{"value":[{"name":"b.txt"}]}`))
+		handler.Client.Request = clientMock
+		res, err := handler.List(context.Background(), "/", true)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Len(res, 4)
+		asserts.Equal("dir", res[0].RelativePath)
+		asserts.Equal("dir/a.txt", res[1].RelativePath)
+		asserts.Equal("dir/sub/b.txt", res[3].RelativePath)
+	}
+
+	// 删除目录下的文件后缓存失效
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", "https://graph.microsoft.com/v1.0/$batch", testMock.Anything, testMock.Anything).
+			Return(listResponse(`{"responses":[{"id":"dir/a.txt","status":204}]}`))
+		clientMock.On("Request", "GET", "drive/root:/dir:/children?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(listResponse(`{"value":[{"name":"sub","folder":{}}]}`))
+		handler.Client.Request = clientMock
+		_, err := handler.Delete(context.Background(), []string{"dir/a.txt"})
+		asserts.NoError(err)
+		res, err := handler.List(context.Background(), "dir", false)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Len(res, 1)
+	}
+
+	// 移动后源目录及目标目录的缓存均失效
+	{
+		cache.Set(listCachePrefix+getListCacheKey(50, "dir/sub"), []interface{}{}, 0)
+		cache.Set(listCachePrefix+getListCacheKey(50, "other"), []interface{}{}, 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "PATCH", "drive/root:/dir/sub/b.txt", testMock.Anything, testMock.Anything).
+			Return(listResponse(`{"name":"b.txt"}`))
+		handler.Client.Request = clientMock
+		err := handler.Move(context.Background(), "dir/sub/b.txt", "other/b.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		_, ok := cache.Get(listCachePrefix + getListCacheKey(50, "dir/sub"))
+		asserts.False(ok)
+		_, ok = cache.Get(listCachePrefix + getListCacheKey(50, "other"))
+		asserts.False(ok)
+	}
+}
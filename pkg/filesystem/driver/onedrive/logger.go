@@ -0,0 +1,166 @@
+package onedrive
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// Logger 客户端输出日志使用的接口，*util.Logger 实现了此接口
+type Logger interface {
+	Debug(format string, v ...interface{})
+	Warning(format string, v ...interface{})
+	Error(format string, v ...interface{})
+}
+
+// operationIDKey 上下文中操作ID的键
+type operationIDKey struct{}
+
+// WithOperationID 为 ctx 指定操作ID，同一操作发出的所有请求及由其启动的上传监控使用相同的ID，
+// 便于在日志中关联
+func WithOperationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, operationIDKey{}, id)
+}
+
+// OperationID 获取 ctx 中的操作ID，未指定时返回空字符串
+func OperationID(ctx context.Context) string {
+	id, _ := ctx.Value(operationIDKey{}).(string)
+	return id
+}
+
+// withOperation 确保 ctx 中带有操作ID，未指定时生成新的ID
+func withOperation(ctx context.Context) context.Context {
+	if OperationID(ctx) != "" {
+		return ctx
+	}
+	return WithOperationID(ctx, newOperationID())
+}
+
+// newOperationID 生成 GUID 格式的操作ID。操作ID作为 client-request-id 头发送，
+// Graph 仅接受 GUID 格式的值
+func newOperationID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return util.RandStringRunes(16)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// logger 获取客户端输出日志使用的 Logger，未指定时使用全局日志
+func (client *Client) logger() Logger {
+	if client.Logger != nil {
+		return client.Logger
+	}
+	return util.Log()
+}
+
+// log 获取在每条日志前附加 ctx 中操作ID的日志对象
+func (client *Client) log(ctx context.Context) operationLogger {
+	return operationLogger{logger: client.logger(), id: OperationID(ctx)}
+}
+
+// operationLogger 在每条日志前附加操作ID
+type operationLogger struct {
+	logger Logger
+	id     string
+}
+
+func (l operationLogger) prefix(format string) string {
+	if l.id == "" {
+		return format
+	}
+	return "[op=" + l.id + "] " + format
+}
+
+// Debug 输出调试日志
+func (l operationLogger) Debug(format string, v ...interface{}) {
+	l.logger.Debug(l.prefix(format), v...)
+}
+
+// Warning 输出警告日志
+func (l operationLogger) Warning(format string, v ...interface{}) {
+	l.logger.Warning(l.prefix(format), v...)
+}
+
+// Error 输出错误日志
+func (l operationLogger) Error(format string, v ...interface{}) {
+	l.logger.Error(l.prefix(format), v...)
+}
+
+// logFields 将键值对格式化为 key=value 形式，值为空的键被忽略，值中的空白字符会被转义
+func logFields(kv ...string) string {
+	fields := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] == "" {
+			continue
+		}
+		value := kv[i+1]
+		if strings.ContainsAny(value, " \t\r\n\"") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fields = append(fields, kv[i]+"="+value)
+	}
+	return strings.Join(fields, " ")
+}
+
+// redactURL 去除地址中的查询参数，上传会话及下载地址的查询参数中含有访问凭证
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		if i := strings.IndexByte(rawURL, '?'); i >= 0 {
+			return rawURL[:i]
+		}
+		return rawURL
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.User = nil
+	return u.String()
+}
+
+// logRequest 记录单次请求的结果。请求成功、文件不存在及请求被取消时输出调试日志，
+// 其余错误响应输出警告，未收到响应时输出错误
+func (client *Client) logRequest(ctx context.Context, method, rawURL string, resp *http.Response, err error, latency time.Duration) {
+	fields := []string{
+		"method", method,
+		"url", redactURL(rawURL),
+		"latency", latency.Round(time.Millisecond).String(),
+	}
+	log := client.log(ctx)
+
+	if resp == nil {
+		if err != nil {
+			fields = append(fields, "error", err.Error())
+		}
+		// 客户端主动取消的请求不视为错误
+		if ctx.Err() != nil {
+			log.Debug("OneDrive 请求取消 %s", logFields(fields...))
+			return
+		}
+		log.Error("OneDrive 请求失败 %s", logFields(fields...))
+		return
+	}
+
+	fields = append(fields,
+		"status", fmt.Sprint(resp.StatusCode),
+		"request-id", resp.Header.Get("request-id"),
+		"client-request-id", resp.Header.Get("client-request-id"),
+	)
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300, resp.StatusCode == http.StatusNotFound:
+		log.Debug("OneDrive 请求 %s", logFields(fields...))
+	default:
+		if err != nil {
+			fields = append(fields, "error", err.Error())
+		}
+		log.Warning("OneDrive 请求出错 %s", logFields(fields...))
+	}
+}
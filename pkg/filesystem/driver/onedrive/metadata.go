@@ -0,0 +1,69 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+)
+
+const (
+	// metadataPrefix 写入 description 字段的自定义元数据前缀，用于区分用户自行填写的描述
+	metadataPrefix = "cloudreve:"
+	// MaxDescriptionLength OneDrive 项目 description 字段的最大长度
+	MaxDescriptionLength = 1024
+)
+
+// ErrMetadataTooLarge 自定义元数据编码后超出 description 字段的长度限制
+var ErrMetadataTooLarge = errors.New("自定义元数据过大")
+
+// encodeMetadata 将自定义元数据编码为项目的 description 字段
+func encodeMetadata(metadata map[string]string) (string, error) {
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+
+	description := metadataPrefix + string(content)
+	if len(description) > MaxDescriptionLength {
+		return "", ErrMetadataTooLarge
+	}
+	return description, nil
+}
+
+// decodeMetadata 从项目的 description 字段中解析自定义元数据，
+// 不是由 encodeMetadata 写入的描述返回 nil
+func decodeMetadata(description string) map[string]string {
+	if !strings.HasPrefix(description, metadataPrefix) {
+		return nil
+	}
+
+	var metadata map[string]string
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(description, metadataPrefix)), &metadata); err != nil {
+		return nil
+	}
+	return metadata
+}
+
+// metadataDescription 获取上下文中需要写入的自定义元数据，未指定时返回空字符串
+func metadataDescription(ctx context.Context) (string, error) {
+	metadata, ok := fsctx.Metadata(ctx)
+	if !ok || len(metadata) == 0 {
+		return "", nil
+	}
+	return encodeMetadata(metadata)
+}
+
+// UpdateDescription 更新 dst 处项目的 description 字段
+func (client *Client) UpdateDescription(ctx context.Context, dst, description string) error {
+	dst = strings.TrimPrefix(dst, "/")
+	requestURL := client.getDriveRequestURL("root:/" + dst)
+
+	bodyBytes, _ := json.Marshal(map[string]string{"description": description})
+	if _, err := client.requestWithStr(ctx, "PATCH", requestURL, string(bodyBytes), 200); err != nil {
+		return err
+	}
+	return nil
+}
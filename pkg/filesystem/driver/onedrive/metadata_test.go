@@ -0,0 +1,143 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+// bodyContains 匹配请求正文中包含 s 的请求
+func bodyContains(s string) interface{} {
+	return testMock.MatchedBy(func(body io.Reader) bool {
+		if body == nil {
+			return false
+		}
+		content, _ := ioutil.ReadAll(body)
+		if seeker, ok := body.(io.Seeker); ok {
+			seeker.Seek(0, io.SeekStart)
+		}
+		return strings.Contains(string(content), s)
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 编码后可解析
+	{
+		description, err := encodeMetadata(map[string]string{"hash": "123"})
+		asserts.NoError(err)
+		asserts.Equal(`cloudreve:{"hash":"123"}`, description)
+		asserts.Equal(map[string]string{"hash": "123"}, decodeMetadata(description))
+	}
+
+	// 超出长度限制
+	{
+		_, err := encodeMetadata(map[string]string{"hash": strings.Repeat("1", MaxDescriptionLength)})
+		asserts.Equal(ErrMetadataTooLarge, err)
+	}
+
+	// 用户自行填写的描述
+	{
+		asserts.Nil(decodeMetadata(""))
+		asserts.Nil(decodeMetadata("my file"))
+		asserts.Nil(decodeMetadata("cloudreve:???"))
+	}
+
+	// 上下文中未指定
+	{
+		description, err := metadataDescription(context.Background())
+		asserts.NoError(err)
+		asserts.Empty(description)
+	}
+}
+
+func TestClient_Upload_Metadata(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+	ctx := context.WithValue(context.Background(), fsctx.MetadataCtx, map[string]string{"hash": "123"})
+	okResponse := func(body string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			},
+		}
+	}
+
+	// 小文件上传后写入描述
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "PUT", "drive/root:/meta.txt:/content", testMock.Anything, testMock.Anything).
+			Return(okResponse(`{"name":"meta.txt"}`))
+		clientMock.On("Request", "PATCH", "drive/root:/meta.txt", bodyContains(`cloudreve:{\"hash\":\"123\"}`), testMock.Anything).
+			Return(okResponse(`{}`))
+		client.Request = clientMock
+		err := client.Upload(ctx, "meta.txt", 3, bytes.NewReader([]byte("123")))
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+	}
+
+	// 创建上传会话时附带描述
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", "drive/root:/meta.txt:/createUploadSession", bodyContains(`"description":"cloudreve:`), testMock.Anything).
+			Return(okResponse(`{"uploadUrl":"123321"}`))
+		client.Request = clientMock
+		res, err := client.CreateUploadSession(ctx, "meta.txt", WithDescription(`cloudreve:{"hash":"123"}`))
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("123321", res)
+	}
+
+	// 元数据过大时不上传
+	{
+		clientMock := ClientMock{}
+		client.Request = clientMock
+		ctx := context.WithValue(context.Background(), fsctx.MetadataCtx, map[string]string{
+			"hash": strings.Repeat("1", MaxDescriptionLength),
+		})
+		err := client.Upload(ctx, "meta.txt", 3, bytes.NewReader([]byte("123")))
+		asserts.Equal(ErrMetadataTooLarge, err)
+		clientMock.AssertExpectations(t)
+	}
+}
+
+func TestDriver_Head_Metadata(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	handler.Client.Credential.AccessToken = "1"
+
+	clientMock := ClientMock{}
+	clientMock.On("Request", "GET", "drive/root:/dir/meta.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+		Return(&request.Response{
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"name":"meta.txt","description":"cloudreve:{\"hash\":\"123\"}"}`)),
+			},
+		})
+	handler.Client.Request = clientMock
+	res, err := handler.Head(context.Background(), "dir/meta.txt")
+	clientMock.AssertExpectations(t)
+	asserts.NoError(err)
+	asserts.Equal(map[string]string{"hash": "123"}, res.Metadata)
+}
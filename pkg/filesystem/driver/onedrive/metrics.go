@@ -0,0 +1,155 @@
+package onedrive
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// operation 计入统计的适配器操作
+type operation int
+
+const (
+	opList operation = iota
+	opGet
+	opPut
+	opDelete
+	opCount
+)
+
+var operationNames = [opCount]string{"list", "get", "put", "delete"}
+
+// outcome 操作结果
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeError
+	outcomeCanceled
+	outcomeCount
+)
+
+var outcomeNames = [outcomeCount]string{"success", "error", "canceled"}
+
+// latencyBuckets 操作耗时直方图的桶上界（秒）
+var latencyBuckets = [...]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// operationMetrics 单个操作的统计数据，均以原子操作更新
+type operationMetrics struct {
+	inFlight int64
+	outcomes [outcomeCount]uint64
+	// buckets 各桶内的次数（非累计），最后一个桶为 +Inf
+	buckets [len(latencyBuckets) + 1]uint64
+	// sum 总耗时（纳秒）
+	sum uint64
+}
+
+// driverMetrics 适配器各操作的统计数据，为所有存储策略共享
+var driverMetrics [opCount]operationMetrics
+
+// operationTimer 记录一次进行中的操作
+type operationTimer struct {
+	op    operation
+	start time.Time
+}
+
+// beginOperation 开始统计一次操作，操作结束时调用返回值的 end。用法：
+//
+//	defer beginOperation(opList).end(ctx, &err)
+func beginOperation(op operation) operationTimer {
+	atomic.AddInt64(&driverMetrics[op].inFlight, 1)
+	return operationTimer{op: op, start: time.Now()}
+}
+
+// end 结束统计，按 *err 及 ctx 记录操作结果和耗时
+func (t operationTimer) end(ctx context.Context, err *error) {
+	m := &driverMetrics[t.op]
+	elapsed := time.Since(t.start)
+	atomic.AddInt64(&m.inFlight, -1)
+
+	result := outcomeSuccess
+	if *err != nil {
+		result = outcomeError
+		if ctx.Err() != nil || errors.Is(*err, ErrClientCanceled) || errors.Is(*err, context.Canceled) {
+			result = outcomeCanceled
+		}
+	}
+	atomic.AddUint64(&m.outcomes[result], 1)
+
+	bucket := len(latencyBuckets)
+	seconds := elapsed.Seconds()
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			bucket = i
+			break
+		}
+	}
+	atomic.AddUint64(&m.buckets[bucket], 1)
+	atomic.AddUint64(&m.sum, uint64(elapsed))
+}
+
+// WriteMetrics 以 Prometheus 文本格式输出 OneDrive 适配器的操作统计：
+// 按操作及结果计数的 cloudreve_onedrive_operations_total、
+// 耗时直方图 cloudreve_onedrive_operation_duration_seconds 及
+// 进行中操作数 cloudreve_onedrive_operations_in_flight
+func WriteMetrics(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+
+	buf.WriteString("# HELP cloudreve_onedrive_operations_total OneDrive 适配器操作次数\n")
+	buf.WriteString("# TYPE cloudreve_onedrive_operations_total counter\n")
+	for op := operation(0); op < opCount; op++ {
+		for result := outcome(0); result < outcomeCount; result++ {
+			buf.WriteString(`cloudreve_onedrive_operations_total{operation="` + operationNames[op] +
+				`",outcome="` + outcomeNames[result] + `"} `)
+			buf.WriteString(strconv.FormatUint(atomic.LoadUint64(&driverMetrics[op].outcomes[result]), 10))
+			buf.WriteByte('\n')
+		}
+	}
+
+	buf.WriteString("# HELP cloudreve_onedrive_operation_duration_seconds OneDrive 适配器操作耗时\n")
+	buf.WriteString("# TYPE cloudreve_onedrive_operation_duration_seconds histogram\n")
+	for op := operation(0); op < opCount; op++ {
+		m := &driverMetrics[op]
+		label := `{operation="` + operationNames[op] + `"`
+		var count uint64
+		for i := range m.buckets {
+			count += atomic.LoadUint64(&m.buckets[i])
+			le := "+Inf"
+			if i < len(latencyBuckets) {
+				le = strconv.FormatFloat(latencyBuckets[i], 'g', -1, 64)
+			}
+			buf.WriteString("cloudreve_onedrive_operation_duration_seconds_bucket" + label + `,le="` + le + `"} `)
+			buf.WriteString(strconv.FormatUint(count, 10))
+			buf.WriteByte('\n')
+		}
+		buf.WriteString("cloudreve_onedrive_operation_duration_seconds_sum" + label + "} ")
+		buf.WriteString(strconv.FormatFloat(time.Duration(atomic.LoadUint64(&m.sum)).Seconds(), 'g', -1, 64))
+		buf.WriteByte('\n')
+		buf.WriteString("cloudreve_onedrive_operation_duration_seconds_count" + label + "} ")
+		buf.WriteString(strconv.FormatUint(count, 10))
+		buf.WriteByte('\n')
+	}
+
+	buf.WriteString("# HELP cloudreve_onedrive_operations_in_flight 进行中的 OneDrive 适配器操作数\n")
+	buf.WriteString("# TYPE cloudreve_onedrive_operations_in_flight gauge\n")
+	for op := operation(0); op < opCount; op++ {
+		buf.WriteString(`cloudreve_onedrive_operations_in_flight{operation="` + operationNames[op] + `"} `)
+		buf.WriteString(strconv.FormatInt(atomic.LoadInt64(&driverMetrics[op].inFlight), 10))
+		buf.WriteByte('\n')
+	}
+
+	return buf.Flush()
+}
+
+// MetricsHandler 返回以 Prometheus 文本格式输出操作统计的 http.Handler，可供 Prometheus 抓取
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteMetrics(w)
+	})
+}
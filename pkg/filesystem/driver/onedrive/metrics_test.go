@@ -0,0 +1,128 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestDriver_Metrics(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{Policy: &model.Policy{}}
+	handler.Client, _ = NewClient(handler.Policy)
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_etag_cache_ttl", "0", 0)
+	cache.Set("setting_onedrive_list_cache_ttl", "0", 0)
+	cache.Set("setting_onedrive_list_max_depth", "0", 0)
+	cache.Set("setting_onedrive_list_concurrency", "4", 0)
+	count := func(op operation, result outcome) uint64 {
+		return atomic.LoadUint64(&driverMetrics[op].outcomes[result])
+	}
+	observed := func(op operation) uint64 {
+		var total uint64
+		for i := range driverMetrics[op].buckets {
+			total += atomic.LoadUint64(&driverMetrics[op].buckets[i])
+		}
+		return total
+	}
+	listSuccess, listError, listObserved := count(opList, outcomeSuccess), count(opList, outcomeError), observed(opList)
+	deleteSuccess := count(opDelete, outcomeSuccess)
+	getCanceled := count(opGet, outcomeCanceled)
+
+	// 列取成功及失败
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/ok:/children?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(&request.Response{Response: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(`{"value":[]}`))}})
+		clientMock.On("Request", "GET", "drive/root:/error:/children?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(&request.Response{Response: &http.Response{StatusCode: 400, Body: ioutil.NopCloser(strings.NewReader(`{"error":{"code":"invalidRequest"}}`))}})
+		handler.Client.Request = clientMock
+		_, err := handler.List(context.Background(), "/ok", false)
+		asserts.NoError(err)
+		_, err = handler.List(context.WithValue(context.Background(), fsctx.RetryCtx, ListRetry), "/error", false)
+		asserts.Error(err)
+		asserts.Equal(listSuccess+1, count(opList, outcomeSuccess))
+		asserts.Equal(listError+1, count(opList, outcomeError))
+		asserts.Equal(listObserved+2, observed(opList))
+		asserts.Zero(atomic.LoadInt64(&driverMetrics[opList].inFlight))
+	}
+
+	// 删除成功
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", testMock.Anything, testMock.Anything, testMock.Anything).
+			Return(&request.Response{Response: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(`{"responses":[{"id":"1","status":204}]}`))}})
+		handler.Client.Request = clientMock
+		failed, err := handler.Delete(context.Background(), []string{"a.txt"})
+		asserts.NoError(err)
+		asserts.Empty(failed)
+		asserts.Equal(deleteSuccess+1, count(opDelete, outcomeSuccess))
+	}
+
+	// 下载被取消
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", testMock.Anything, testMock.Anything, testMock.Anything, testMock.Anything).
+			Return(&request.Response{Err: context.Canceled})
+		handler.Client.Request = clientMock
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := handler.Get(ctx, "a.txt")
+		asserts.Error(err)
+		asserts.Equal(getCanceled+1, count(opGet, outcomeCanceled))
+	}
+
+	// 以 Prometheus 文本格式输出
+	{
+		var buf bytes.Buffer
+		asserts.NoError(WriteMetrics(&buf))
+		output := buf.String()
+		asserts.Contains(output, "# TYPE cloudreve_onedrive_operations_total counter")
+		asserts.Contains(output, `cloudreve_onedrive_operations_total{operation="list",outcome="error"} `)
+		asserts.Contains(output, `cloudreve_onedrive_operation_duration_seconds_bucket{operation="list",le="+Inf"} `)
+		asserts.Contains(output, `cloudreve_onedrive_operations_in_flight{operation="put"} 0`)
+
+		rec := httptest.NewRecorder()
+		MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		asserts.Equal(200, rec.Code)
+		asserts.Contains(rec.Header().Get("Content-Type"), "text/plain")
+		asserts.Contains(rec.Body.String(), `operation="delete",outcome="success"`)
+	}
+}
+
+func TestOperationTimer(t *testing.T) {
+	asserts := assert.New(t)
+	inFlight := atomic.LoadInt64(&driverMetrics[opPut].inFlight)
+	failed := atomic.LoadUint64(&driverMetrics[opPut].outcomes[outcomeError])
+
+	// 进行中的操作计入 in-flight
+	timer := beginOperation(opPut)
+	asserts.Equal(inFlight+1, atomic.LoadInt64(&driverMetrics[opPut].inFlight))
+	err := errors.New("error")
+	timer.end(context.Background(), &err)
+	asserts.Equal(inFlight, atomic.LoadInt64(&driverMetrics[opPut].inFlight))
+	asserts.Equal(failed+1, atomic.LoadUint64(&driverMetrics[opPut].outcomes[outcomeError]))
+
+	// 统计不分配内存
+	allocs := testing.AllocsPerRun(100, func() {
+		var err error
+		beginOperation(opPut).end(context.Background(), &err)
+	})
+	asserts.Zero(allocs)
+}
@@ -0,0 +1,30 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// fileSystemInfo 项目在客户端上的时间属性，写入后覆盖 OneDrive 接收文件的时间
+type fileSystemInfo struct {
+	LastModifiedDateTime string `json:"lastModifiedDateTime"`
+}
+
+// newFileSystemInfo 以 modTime 作为修改时间构建项目的 fileSystemInfo 属性，精确到秒
+func newFileSystemInfo(modTime time.Time) fileSystemInfo {
+	return fileSystemInfo{LastModifiedDateTime: modTime.UTC().Format(time.RFC3339)}
+}
+
+// UpdateModTime 将 dst 处项目的修改时间设为 modTime
+func (client *Client) UpdateModTime(ctx context.Context, dst string, modTime time.Time) error {
+	dst = strings.TrimPrefix(dst, "/")
+	requestURL := client.getDriveRequestURL("root:/" + dst)
+
+	bodyBytes, _ := json.Marshal(map[string]fileSystemInfo{"fileSystemInfo": newFileSystemInfo(modTime)})
+	if _, err := client.requestWithStr(ctx, "PATCH", requestURL, string(bodyBytes), 200); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestClient_Upload_ModTime(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("CST", 8*3600))
+	ctx := context.WithValue(context.Background(), fsctx.ModTimeCtx, modTime)
+	okResponse := func(body string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			},
+		}
+	}
+
+	// 小文件上传后写入修改时间
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "PUT", "drive/root:/mtime.txt:/content", testMock.Anything, testMock.Anything).
+			Return(okResponse(`{"name":"mtime.txt"}`))
+		clientMock.On("Request", "PATCH", "drive/root:/mtime.txt", bodyContains(`{"fileSystemInfo":{"lastModifiedDateTime":"2020-01-01T19:04:05Z"}}`), testMock.Anything).
+			Return(okResponse(`{}`))
+		client.Request = clientMock
+		err := client.Upload(ctx, "mtime.txt", 3, bytes.NewReader([]byte("123")))
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+	}
+
+	// 写入修改时间失败，不影响上传结果
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "PUT", "drive/root:/mtime.txt:/content", testMock.Anything, testMock.Anything).
+			Return(okResponse(`{"name":"mtime.txt"}`))
+		clientMock.On("Request", "PATCH", "drive/root:/mtime.txt", testMock.Anything, testMock.Anything).
+			Return(&request.Response{Err: errors.New("error")})
+		client.Request = clientMock
+		err := client.Upload(ctx, "mtime.txt", 3, bytes.NewReader([]byte("123")))
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+	}
+
+	// 未指定修改时间，不发送 PATCH
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "PUT", "drive/root:/mtime.txt:/content", testMock.Anything, testMock.Anything).
+			Return(okResponse(`{"name":"mtime.txt"}`))
+		client.Request = clientMock
+		err := client.Upload(context.Background(), "mtime.txt", 3, bytes.NewReader([]byte("123")))
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		clientMock.AssertNotCalled(t, "Request", "PATCH", testMock.Anything, testMock.Anything, testMock.Anything)
+	}
+
+	// 创建上传会话时附带修改时间
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", "drive/root:/mtime.txt:/createUploadSession", bodyContains(`"fileSystemInfo":{"lastModifiedDateTime":"2020-01-01T19:04:05Z"}`), testMock.Anything).
+			Return(okResponse(`{"uploadUrl":"123321"}`))
+		client.Request = clientMock
+		res, err := client.CreateUploadSession(ctx, "mtime.txt", WithModTime(modTime))
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("123321", res)
+	}
+
+	// 未指定修改时间，上传会话不附带 fileSystemInfo
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", "drive/root:/mtime.txt:/createUploadSession", testMock.MatchedBy(func(body io.Reader) bool {
+			content, _ := ioutil.ReadAll(body)
+			return !strings.Contains(string(content), "fileSystemInfo")
+		}), testMock.Anything).
+			Return(okResponse(`{"uploadUrl":"123321"}`))
+		client.Request = clientMock
+		_, err := client.CreateUploadSession(context.Background(), "mtime.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+	}
+}
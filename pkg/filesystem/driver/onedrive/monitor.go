@@ -0,0 +1,190 @@
+package onedrive
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// monitorSessionsKey 持久化的上传监控会话在缓存中的键
+const monitorSessionsKey = "onedrive_monitor_sessions"
+
+// monitorSessionsLock 读写持久化上传监控会话时使用的锁
+var monitorSessionsLock sync.Mutex
+
+// monitorCancels 运行中的上传监控，键为回调会话ID，值为 *monitorHandle
+var monitorCancels sync.Map
+
+// monitorHandle 运行中的上传监控
+type monitorHandle struct {
+	policyID uint
+	// cancel 中止上传，取消上传会话并清除回调会话
+	cancel context.CancelFunc
+	// stop 关闭后仅停止监控，保留持久化的监控会话
+	stop     chan struct{}
+	stopOnce sync.Once
+	// done 监控协程结束后关闭
+	done chan struct{}
+}
+
+// startMonitor 在新协程中启动上传监控，可通过 CancelMonitor 终止。监控不随 ctx 取消，
+// 仅沿用其中的操作ID，以便在日志中关联发起上传的请求
+func (client *Client) startMonitor(ctx context.Context, uploadURL, callbackKey, path string, size uint64, ttl int64) {
+	ctx, cancel := context.WithCancel(WithOperationID(context.Background(), OperationID(ctx)))
+	handle := &monitorHandle{cancel: cancel, stop: make(chan struct{}), done: make(chan struct{})}
+	if client.Policy != nil {
+		handle.policyID = client.Policy.ID
+	}
+	monitorCancels.Store(callbackKey, handle)
+	go func() {
+		defer func() {
+			monitorCancels.Delete(callbackKey)
+			cancel()
+			close(handle.done)
+		}()
+		client.monitorUpload(ctx, handle.stop, uploadURL, callbackKey, path, size, ttl)
+	}()
+}
+
+// CancelMonitor 用户中止上传时调用，终止对应的上传监控，监控随即取消上传会话
+// 并清除回调会话。监控不存在时返回 false
+func CancelMonitor(callbackKey string) bool {
+	handle, ok := monitorCancels.Load(callbackKey)
+	if !ok {
+		return false
+	}
+	handle.(*monitorHandle).cancel()
+	return true
+}
+
+// restartPolicyMonitors 存储策略被修改或删除后调用，停止其下所有运行中的上传监控并等待
+// 监控协程结束，上传会话及持久化的监控会话均保留，随后以存储策略的最新配置恢复监控。
+// 存储策略已被删除时，恢复时清除其监控会话
+func restartPolicyMonitors(policyID uint) {
+	var handles []*monitorHandle
+	monitorCancels.Range(func(key, value interface{}) bool {
+		if handle := value.(*monitorHandle); handle.policyID == policyID {
+			handle.stopOnce.Do(func() { close(handle.stop) })
+			handles = append(handles, handle)
+		}
+		return true
+	})
+	if len(handles) == 0 {
+		return
+	}
+
+	for _, handle := range handles {
+		<-handle.done
+	}
+	for _, session := range getMonitorSessions() {
+		if session.PolicyID == policyID {
+			resumeMonitor(session)
+		}
+	}
+}
+
+// saveMonitorSession 持久化上传监控会话
+func saveMonitorSession(session MonitorSession) {
+	monitorSessionsLock.Lock()
+	defer monitorSessionsLock.Unlock()
+
+	sessions := getMonitorSessions()
+	sessions[session.Key] = session
+	if err := cache.Set(monitorSessionsKey, sessions, 0); err != nil {
+		util.Log().Warning("无法保存上传监控会话，%s", err)
+	}
+}
+
+// deleteMonitorSession 删除持久化的上传监控会话
+func deleteMonitorSession(key string) {
+	monitorSessionsLock.Lock()
+	defer monitorSessionsLock.Unlock()
+
+	sessions := getMonitorSessions()
+	if _, ok := sessions[key]; !ok {
+		return
+	}
+	delete(sessions, key)
+	if err := cache.Set(monitorSessionsKey, sessions, 0); err != nil {
+		util.Log().Warning("无法删除上传监控会话，%s", err)
+	}
+}
+
+// getMonitorSessions 获取所有持久化的上传监控会话
+func getMonitorSessions() map[string]MonitorSession {
+	res := make(map[string]MonitorSession)
+	if raw, ok := cache.Get(monitorSessionsKey); ok {
+		if sessions, ok := raw.(map[string]MonitorSession); ok {
+			for k, v := range sessions {
+				res[k] = v
+			}
+		}
+	}
+	return res
+}
+
+// ResumeMonitors 恢复重启前未结束的上传监控，已过期的会话会按上传会话
+// 到期的流程清理。缓存不能跨重启保留时（如使用内存缓存），不会恢复任何会话
+func ResumeMonitors() {
+	for _, session := range getMonitorSessions() {
+		resumeMonitor(session)
+	}
+}
+
+// resumeMonitor 以存储策略的最新配置恢复持久化的上传监控会话
+func resumeMonitor(session MonitorSession) {
+	policy, err := model.GetPolicyByID(session.PolicyID)
+	if err != nil {
+		util.Log().Warning("无法恢复上传监控[%s]，存储策略不存在，%s", session.SavePath, err)
+		deleteMonitorSession(session.Key)
+		return
+	}
+
+	client, err := NewClient(&policy)
+	if err != nil {
+		util.Log().Warning("无法恢复上传监控[%s]，%s", session.SavePath, err)
+		deleteMonitorSession(session.Key)
+		return
+	}
+
+	ttl := session.Expires - time.Now().Unix()
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	util.Log().Info("恢复 OneDrive 上传监控[%s]，操作ID %s", session.SavePath, session.OperationID)
+	ctx := WithOperationID(context.Background(), session.OperationID)
+	client.startMonitor(ctx, session.UploadURL, session.Key, session.SavePath, session.Size, ttl)
+}
+
+// UploadStatus 查询回调会话 callbackKey 对应的上传会话，返回尚未接收的字节范围及
+// 客户端应续传的起始位置。上传监控已结束时返回 ErrMonitorNotFound
+func UploadStatus(ctx context.Context, callbackKey string) ([]string, uint64, error) {
+	session, ok := getMonitorSessions()[callbackKey]
+	if !ok {
+		return nil, 0, ErrMonitorNotFound
+	}
+
+	policy, err := model.GetPolicyByID(session.PolicyID)
+	if err != nil {
+		return nil, 0, err
+	}
+	client, err := NewClient(&policy)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	nextRanges, err := client.GetUploadStatus(ctx, session.UploadURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset, err := ResumeOffset(nextRanges)
+	if err != nil {
+		return nil, 0, err
+	}
+	return nextRanges, offset, nil
+}
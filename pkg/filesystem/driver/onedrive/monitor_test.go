@@ -0,0 +1,359 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestMonitorSession(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Deletes([]string{monitorSessionsKey}, "")
+
+	// 无已保存的会话
+	{
+		asserts.Len(getMonitorSessions(), 0)
+	}
+
+	// 保存、删除会话
+	{
+		saveMonitorSession(MonitorSession{Key: "key1", SavePath: "/1.txt"})
+		saveMonitorSession(MonitorSession{Key: "key2", SavePath: "/2.txt"})
+		sessions := getMonitorSessions()
+		asserts.Len(sessions, 2)
+		asserts.Equal("/1.txt", sessions["key1"].SavePath)
+
+		deleteMonitorSession("key1")
+		deleteMonitorSession("not_exist")
+		sessions = getMonitorSessions()
+		asserts.Len(sessions, 1)
+		asserts.Contains(sessions, "key2")
+		deleteMonitorSession("key2")
+	}
+
+	// 监控期间持久化会话，结束后删除
+	{
+		cache.Set("setting_onedrive_monitor_timeout", "600", 0)
+		client, _ := NewClient(&model.Policy{Model: gorm.Model{ID: 5}})
+		go func() {
+			time.Sleep(time.Duration(500) * time.Millisecond)
+			sessions := getMonitorSessions()
+			asserts.Contains(sessions, "monitor_key")
+			asserts.EqualValues(5, sessions["monitor_key"].PolicyID)
+			asserts.Equal("url", sessions["monitor_key"].UploadURL)
+			asserts.EqualValues(10, sessions["monitor_key"].Size)
+			asserts.True(sessions["monitor_key"].Expires > time.Now().Unix())
+			FinishCallback("monitor_key")
+		}()
+		client.MonitorUpload(context.Background(), "url", "monitor_key", "path", 10, 100)
+		asserts.NotContains(getMonitorSessions(), "monitor_key")
+	}
+}
+
+func TestResumeMonitors(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Deletes([]string{monitorSessionsKey}, "")
+
+	// 存储策略不存在，删除会话
+	{
+		mock.ExpectQuery("SELECT(.+)").WillReturnError(errors.New("not found"))
+		saveMonitorSession(MonitorSession{PolicyID: 404, Key: "resume_key"})
+		ResumeMonitors()
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Len(getMonitorSessions(), 0)
+	}
+
+	// 会话已过期，按到期流程清理
+	{
+		cache.Set("setting_onedrive_monitor_timeout", "600", 0)
+		cache.Set("setting_onedrive_chunk_retries", "0", 0)
+		cache.Set("policy_405", model.Policy{Model: gorm.Model{ID: 405}, Type: "onedrive"}, 0)
+		saveMonitorSession(MonitorSession{
+			PolicyID:  405,
+			UploadURL: "url",
+			Key:       "resume_key",
+			SavePath:  "/1.txt",
+			Expires:   time.Now().Add(-time.Duration(1) * time.Hour).Unix(),
+		})
+		ResumeMonitors()
+		asserts.Eventually(func() bool {
+			return len(getMonitorSessions()) == 0
+		}, time.Duration(5)*time.Second, time.Duration(50)*time.Millisecond)
+	}
+}
+
+func TestUploadStatus(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Deletes([]string{monitorSessionsKey}, "")
+
+	// 监控会话不存在
+	{
+		_, _, err := UploadStatus(context.Background(), "status_key")
+		asserts.Equal(ErrMonitorNotFound, err)
+	}
+
+	// 存储策略不存在
+	{
+		mock.ExpectQuery("SELECT(.+)").WillReturnError(errors.New("not found"))
+		saveMonitorSession(MonitorSession{PolicyID: 404, Key: "status_key"})
+		_, _, err := UploadStatus(context.Background(), "status_key")
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+		deleteMonitorSession("status_key")
+	}
+}
+
+func TestCancelMonitor(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Deletes([]string{monitorSessionsKey}, "")
+	cache.Set("setting_onedrive_monitor_timeout", "600", 0)
+	cache.Set("setting_onedrive_chunk_retries", "0", 0)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+
+	// 监控不存在
+	{
+		asserts.False(CancelMonitor("not_exist"))
+	}
+
+	// 取消后删除上传会话、创建占位文件并清除回调会话
+	{
+		client, _ := NewClient(&model.Policy{})
+		client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		client.Credential.AccessToken = "1"
+		clientMock := ClientMock{}
+		for _, method := range []string{"DELETE", "PUT"} {
+			clientMock.On(
+				"Request",
+				method,
+				testMock.Anything,
+				testMock.Anything,
+				testMock.Anything,
+			).Return(&request.Response{
+				Err: nil,
+				Response: &http.Response{
+					StatusCode: 204,
+					Body:       ioutil.NopCloser(strings.NewReader(`{}`)),
+				},
+			})
+		}
+		client.Request = clientMock
+		cache.Set("callback_cancel_key", "ok", 0)
+
+		client.startMonitor(context.Background(), "url", "cancel_key", "path", 10, 100)
+		asserts.Eventually(func() bool {
+			_, ok := callbackSignal.Load("cancel_key")
+			return ok
+		}, time.Duration(5)*time.Second, time.Duration(10)*time.Millisecond)
+		asserts.True(CancelMonitor("cancel_key"))
+
+		asserts.Eventually(func() bool {
+			_, ok := monitorCancels.Load("cancel_key")
+			return !ok
+		}, time.Duration(5)*time.Second, time.Duration(10)*time.Millisecond)
+		clientMock.AssertExpectations(t)
+		_, ok := cache.Get("callback_cancel_key")
+		asserts.False(ok)
+		_, ok = callbackSignal.Load("cancel_key")
+		asserts.False(ok)
+		asserts.NotContains(getMonitorSessions(), "cancel_key")
+		asserts.False(CancelMonitor("cancel_key"))
+	}
+
+	// 监控正常结束后无法再取消
+	{
+		client, _ := NewClient(&model.Policy{})
+		client.startMonitor(context.Background(), "url", "finished_key", "path", 10, 100)
+		asserts.Eventually(func() bool {
+			_, ok := callbackSignal.Load("finished_key")
+			return ok
+		}, time.Duration(5)*time.Second, time.Duration(10)*time.Millisecond)
+		FinishCallback("finished_key")
+		asserts.Eventually(func() bool {
+			return !CancelMonitor("finished_key")
+		}, time.Duration(5)*time.Second, time.Duration(10)*time.Millisecond)
+	}
+}
+
+func TestClient_MonitorUpload_Context(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Deletes([]string{monitorSessionsKey}, "")
+	cache.Set("setting_onedrive_chunk_retries", "0", 0)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	client.Credential.AccessToken = "1"
+	mockRequests := func(methods ...string) ClientMock {
+		clientMock := ClientMock{}
+		for _, method := range methods {
+			status, body := 204, `{}`
+			if method == "GET" {
+				status, body = 404, `{"error":{"code":"itemNotFound"}}`
+			}
+			clientMock.On(
+				"Request",
+				method,
+				testMock.Anything,
+				testMock.Anything,
+				testMock.Anything,
+			).Return(&request.Response{
+				Err: nil,
+				Response: &http.Response{
+					StatusCode: status,
+					Body:       ioutil.NopCloser(strings.NewReader(body)),
+				},
+			})
+		}
+		return clientMock
+	}
+	monitor := func(ctx context.Context, key string) {
+		done := make(chan struct{})
+		go func() {
+			client.MonitorUpload(ctx, "url", key, "path", 10, 600)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Duration(5) * time.Second):
+			t.Fatal("上传监控未及时结束")
+		}
+	}
+
+	// 等待检查回调时被取消，及时结束并清除回调会话
+	{
+		cache.Set("setting_onedrive_monitor_timeout", "0", 0)
+		cache.Set("setting_onedrive_callback_check", "600", 0)
+		cache.Set("callback_ctx_cancel", "ok", 0)
+		clientMock := mockRequests("GET", "DELETE", "PUT")
+		client.Request = clientMock
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(time.Duration(100)*time.Millisecond, cancel)
+		monitor(ctx, "ctx_cancel")
+		clientMock.AssertExpectations(t)
+		_, ok := cache.Get("callback_ctx_cancel")
+		asserts.False(ok)
+		asserts.NotContains(getMonitorSessions(), "ctx_cancel")
+	}
+
+	// 上级 ctx 超过截止时间，及时结束并取消上传会话
+	{
+		cache.Set("setting_onedrive_monitor_timeout", "600", 0)
+		cache.Set("setting_onedrive_callback_check", "600", 0)
+		cache.Set("callback_ctx_deadline", "ok", 0)
+		clientMock := mockRequests("DELETE", "PUT")
+		client.Request = clientMock
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(100)*time.Millisecond)
+		defer cancel()
+		monitor(ctx, "ctx_deadline")
+		clientMock.AssertExpectations(t)
+		asserts.NotContains(getMonitorSessions(), "ctx_deadline")
+	}
+}
+
+func TestDriver_Close(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Deletes([]string{monitorSessionsKey}, "")
+	cache.Set("setting_onedrive_monitor_timeout", "600", 0)
+	cache.Set("setting_onedrive_chunk_retries", "0", 0)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	newClient := func(policyID uint) *Client {
+		policy := &model.Policy{BucketName: "close_client"}
+		policy.ID = policyID
+		client, _ := NewClient(policy)
+		client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		client.Credential.AccessToken = "1"
+		clientMock := ClientMock{}
+		for _, method := range []string{"DELETE", "PUT"} {
+			clientMock.On(
+				"Request",
+				method,
+				testMock.Anything,
+				testMock.Anything,
+				testMock.Anything,
+			).Return(&request.Response{
+				Err: nil,
+				Response: &http.Response{
+					StatusCode: 204,
+					Body:       ioutil.NopCloser(strings.NewReader(`{}`)),
+				},
+			})
+		}
+		client.Request = clientMock
+		return client
+	}
+
+	// 停止该存储策略的上传监控并以最新配置恢复，不中止上传会话，清除缓存的凭证
+	{
+		closing, other := newClient(80), newClient(81)
+		cache.Set("policy_80", *closing.Policy, 0)
+		closing.startMonitor(context.Background(), "url", "close_key", "path", 10, 100)
+		other.startMonitor(context.Background(), "url", "close_other_key", "path", 10, 100)
+		cache.Set(credentialCachePrefix+"80_close_client", Credential{AccessToken: "cached"}, 0)
+		getRefreshLock("80_close_client")
+		previous, _ := monitorCancels.Load("close_key")
+
+		handler := Driver{Policy: closing.Policy, Client: closing, HTTPClient: request.HTTPClient{}}
+		asserts.NoError(handler.Close())
+
+		select {
+		case <-previous.(*monitorHandle).done:
+		default:
+			asserts.Fail("原有上传监控未结束")
+		}
+		resumed, ok := monitorCancels.Load("close_key")
+		asserts.True(ok)
+		asserts.NotEqual(previous, resumed)
+		asserts.Contains(getMonitorSessions(), "close_key")
+		_, ok = cache.Get(credentialCachePrefix + "80_close_client")
+		asserts.False(ok)
+		_, ok = refreshLocks.Load("80_close_client")
+		asserts.False(ok)
+
+		// 其他存储策略的监控不受影响
+		_, ok = monitorCancels.Load("close_other_key")
+		asserts.True(ok)
+		asserts.True(CancelMonitor("close_other_key"))
+		asserts.Eventually(func() bool {
+			_, ok := monitorCancels.Load("close_other_key")
+			return !ok
+		}, time.Duration(5)*time.Second, time.Duration(10)*time.Millisecond)
+
+		// 停止恢复的监控
+		handle := resumed.(*monitorHandle)
+		handle.stopOnce.Do(func() { close(handle.stop) })
+		<-handle.done
+		deleteMonitorSession("close_key")
+		cache.Deletes([]string{"policy_80"}, "")
+	}
+
+	// 存储策略已被删除，恢复时清除监控会话
+	{
+		closing := newClient(82)
+		closing.startMonitor(context.Background(), "url", "close_deleted_key", "path", 10, 100)
+		mock.ExpectQuery("SELECT(.+)").WillReturnError(errors.New("not found"))
+
+		handler := Driver{Policy: closing.Policy, Client: closing, HTTPClient: request.HTTPClient{}}
+		asserts.NoError(handler.Close())
+		asserts.NoError(mock.ExpectationsWereMet())
+
+		_, ok := monitorCancels.Load("close_deleted_key")
+		asserts.False(ok)
+		asserts.NotContains(getMonitorSessions(), "close_deleted_key")
+	}
+
+	// 无运行中的监控
+	{
+		handler := Driver{Policy: &model.Policy{}}
+		asserts.NoError(handler.Close())
+	}
+}
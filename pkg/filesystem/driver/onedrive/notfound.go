@@ -0,0 +1,65 @@
+package onedrive
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+)
+
+// notFoundCachePrefix 已确认不存在的路径在缓存中的键前缀
+const notFoundCachePrefix = "onedrive_notfound_"
+
+// getNotFoundCacheKey 获取路径不存在记录的缓存键（不含前缀）
+func getNotFoundCacheKey(policyID uint, p string) string {
+	return policyPathCacheKey(policyID, p)
+}
+
+// isKnownNotFound 返回 p 是否在设置项 onedrive_notfound_cache_ttl 指定的秒数内已确认不存在，
+// 避免反复查询同一个不存在的路径（如被大量访问的失效外链）。尚未保存的存储策略不记录
+func (client *Client) isKnownNotFound(p string) bool {
+	policyID := client.policyID()
+	if policyID == 0 {
+		return false
+	}
+	_, ok := cache.Get(notFoundCachePrefix + getNotFoundCacheKey(policyID, p))
+	return ok
+}
+
+// setNotFound 记录 p 处的路径不存在
+func (client *Client) setNotFound(p string) {
+	policyID := client.policyID()
+	ttl := model.GetIntSetting("onedrive_notfound_cache_ttl", 10)
+	if policyID == 0 || ttl <= 0 {
+		return
+	}
+	_ = cache.Set(notFoundCachePrefix+getNotFoundCacheKey(policyID, p), true, ttl)
+}
+
+// errKnownNotFound 命中路径不存在记录时返回的错误，与 OneDrive 返回的错误一样可由 IsNotFound 判断
+func errKnownNotFound(p string) *RespError {
+	return &RespError{
+		Status: http.StatusNotFound,
+		APIError: APIError{
+			Code:    "itemNotFound",
+			Message: fmt.Sprintf("路径[%s]不存在", p),
+		},
+	}
+}
+
+// invalidateNotFoundCache 清除给定路径及其各级上级目录的不存在记录，
+// 上传、复制、移动、创建目录等会在给定路径处创建项目的操作后应调用此方法
+func invalidateNotFoundCache(policyID uint, paths ...string) {
+	var keys []string
+	for _, p := range paths {
+		for p = path.Clean("/" + p); ; p = path.Dir(p) {
+			keys = append(keys, getNotFoundCacheKey(policyID, p))
+			if p == "/" {
+				break
+			}
+		}
+	}
+	cache.Deletes(keys, notFoundCachePrefix)
+}
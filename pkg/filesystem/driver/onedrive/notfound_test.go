@@ -0,0 +1,126 @@
+package onedrive
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+// notFoundDriveMock 上传前所有查询均返回 404 的驱动器
+type notFoundDriveMock struct {
+	gets     *int
+	uploaded map[string]bool
+}
+
+func (m notFoundDriveMock) Request(method, target string, body io.Reader, opts ...request.Option) *request.Response {
+	respond := func(status int, resBody string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: status,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(strings.NewReader(resBody)),
+			},
+		}
+	}
+
+	if method == "PUT" {
+		m.uploaded[strings.TrimSuffix(strings.TrimPrefix(target, "drive/root:/"), ":/content")] = true
+		return respond(201, `{"name":"a.txt","size":7}`)
+	}
+
+	*m.gets++
+	if m.uploaded[strings.TrimSuffix(strings.TrimPrefix(target, "drive/root:/"), "?expand=thumbnails")] {
+		return respond(200, `{"name":"a.txt","@microsoft.graph.downloadUrl":"http://dev.com/a.txt"}`)
+	}
+	return respond(404, `{"error":{"code":"itemNotFound","message":"not found"}}`)
+}
+
+func TestClient_Meta_NotFoundCache(t *testing.T) {
+	asserts := assert.New(t)
+	policy := &model.Policy{}
+	policy.ID = 96
+	handler := Driver{Policy: policy}
+	handler.Client, _ = NewClient(policy)
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_etag_cache_ttl", "0", 0)
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+	cache.Set("setting_onedrive_source_timeout", "0", 0)
+	cache.Set("setting_onedrive_notfound_cache_ttl", "10", 0)
+	drive := notFoundDriveMock{gets: new(int), uploaded: make(map[string]bool)}
+	handler.Client.Request = drive
+
+	// 首次查询不存在的路径，请求 OneDrive
+	{
+		_, err := handler.Source(context.Background(), "/dir/a.txt", url.URL{}, 0, false, 0)
+		asserts.True(IsNotFound(err))
+		asserts.NotZero(*drive.gets)
+	}
+
+	// 有效期内再次查询，不再发送请求
+	{
+		gets := *drive.gets
+		_, err := handler.Source(context.Background(), "/dir/a.txt", url.URL{}, 0, false, 0)
+		asserts.True(IsNotFound(err))
+		_, err = handler.Client.Meta(context.Background(), "", "dir/a.txt")
+		asserts.True(IsNotFound(err))
+		asserts.Equal(gets, *drive.gets)
+	}
+
+	// 上传后清除不存在记录
+	{
+		gets := *drive.gets
+		asserts.NoError(handler.Put(context.Background(), ioutil.NopCloser(strings.NewReader("content")), "dir/a.txt", 7))
+		res, err := handler.Source(context.Background(), "/dir/a.txt", url.URL{}, 0, false, 0)
+		asserts.NoError(err)
+		asserts.Equal("http://dev.com/a.txt", res)
+		asserts.Equal(gets+1, *drive.gets)
+	}
+
+	// 未设定有效期时不记录
+	{
+		cache.Set("setting_onedrive_notfound_cache_ttl", "0", 0)
+		gets := *drive.gets
+		handler.Client.Meta(context.Background(), "", "b.txt")
+		handler.Client.Meta(context.Background(), "", "b.txt")
+		asserts.Equal(gets+2, *drive.gets)
+	}
+}
+
+func TestInvalidateNotFoundCache(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	client.Policy.ID = 96
+	cache.Set("setting_onedrive_notfound_cache_ttl", "10", 0)
+
+	// 清除路径本身及各级上级目录的记录
+	{
+		client.setNotFound("a")
+		client.setNotFound("a/b")
+		client.setNotFound("a/b/c.txt")
+		client.setNotFound("other")
+		invalidateNotFoundCache(96, "/a/b/c.txt")
+		asserts.False(client.isKnownNotFound("a"))
+		asserts.False(client.isKnownNotFound("a/b"))
+		asserts.False(client.isKnownNotFound("/a/b/c.txt"))
+		asserts.True(client.isKnownNotFound("other"))
+	}
+
+	// 尚未保存的存储策略不记录
+	{
+		client.Policy.ID = 0
+		client.setNotFound("a")
+		asserts.False(client.isKnownNotFound("a"))
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
@@ -14,6 +15,9 @@ import (
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 )
 
+// refreshLocks 各存储策略的凭证刷新锁，避免并发请求重复刷新导致 RefreshToken 失效
+var refreshLocks sync.Map
+
 // Error 实现error接口
 func (err OAuthError) Error() string {
 	return err.ErrorDescription
@@ -31,28 +35,105 @@ func (client *Client) OAuthURL(ctx context.Context, scope []string) string {
 	return client.Endpoints.OAuthEndpoints.authorize.String()
 }
 
+// oauthCloud 各国家云的 OAuth 认证主机及对应的 Graph 接口地址
+type oauthCloud struct {
+	host      string
+	token     string
+	authorize string
+	graph     string
+	isInChina bool
+}
+
+// oauthClouds 已知的 OAuth 认证主机，按主机名后缀匹配
+var oauthClouds = []oauthCloud{
+	{
+		host:      "login.live.com",
+		token:     "https://login.live.com/oauth20_token.srf",
+		authorize: "https://login.live.com/oauth20_authorize.srf",
+		graph:     "https://graph.microsoft.com/v1.0",
+	},
+	{
+		host:      "login.chinacloudapi.cn",
+		token:     "https://login.chinacloudapi.cn/common/oauth2/v2.0/token",
+		authorize: "https://login.chinacloudapi.cn/common/oauth2/v2.0/authorize",
+		graph:     "https://microsoftgraph.chinacloudapi.cn/v1.0",
+		isInChina: true,
+	},
+	{
+		host:      "login.microsoftonline.us",
+		token:     "https://login.microsoftonline.us/common/oauth2/v2.0/token",
+		authorize: "https://login.microsoftonline.us/common/oauth2/v2.0/authorize",
+		graph:     "https://graph.microsoft.us/v1.0",
+	},
+	{
+		host:      "login.microsoftonline.de",
+		token:     "https://login.microsoftonline.de/common/oauth2/v2.0/token",
+		authorize: "https://login.microsoftonline.de/common/oauth2/v2.0/authorize",
+		graph:     "https://graph.microsoft.de/v1.0",
+	},
+	{
+		host:      "login.microsoftonline.com",
+		token:     "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+		authorize: "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+		graph:     "https://graph.microsoft.com/v1.0",
+	},
+}
+
+// matchHost 返回 host 是否为 pattern 本身或其子域名，不区分大小写
+func matchHost(host, pattern string) bool {
+	host = strings.ToLower(host)
+	pattern = strings.ToLower(strings.TrimPrefix(pattern, "."))
+	return pattern != "" && (host == pattern || strings.HasSuffix(host, "."+pattern))
+}
+
+// matchOAuthCloud 根据主机名后缀查找 OAuth 认证主机
+func matchOAuthCloud(host string) (oauthCloud, bool) {
+	for _, cloud := range oauthClouds {
+		if matchHost(host, cloud.host) {
+			return cloud, true
+		}
+	}
+	return oauthClouds[len(oauthClouds)-1], false
+}
+
+// isOAuthEndpoint 返回给定地址是否为 OAuth 认证端点，而非 CDN
+func isOAuthEndpoint(rawURL string) bool {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	_, ok := matchOAuthCloud(target.Hostname())
+	return ok
+}
+
+// isCDNEndpoint 返回给定地址是否可作为 CDN 替换下载地址。cdnHosts 为运营者额外配置的
+// CDN 主机，优先于内置的 OAuth 认证主机表
+func isCDNEndpoint(rawURL string, cdnHosts []string) bool {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return true
+	}
+	for _, host := range cdnHosts {
+		if matchHost(target.Hostname(), host) {
+			return true
+		}
+	}
+	return !isOAuthEndpoint(rawURL)
+}
+
 // getOAuthEndpoint 根据指定的AuthURL获取详细的认证接口地址
 func (client *Client) getOAuthEndpoint() *oauthEndpoint {
 	base, err := url.Parse(client.Endpoints.OAuthURL)
 	if err != nil {
 		return nil
 	}
-	var (
-		token     *url.URL
-		authorize *url.URL
-	)
-	switch base.Host {
-	case "login.live.com":
-		token, _ = url.Parse("https://login.live.com/oauth20_token.srf")
-		authorize, _ = url.Parse("https://login.live.com/oauth20_authorize.srf")
-	case "login.chinacloudapi.cn":
-		client.Endpoints.isInChina = true
-		token, _ = url.Parse("https://login.chinacloudapi.cn/common/oauth2/v2.0/token")
-		authorize, _ = url.Parse("https://login.chinacloudapi.cn/common/oauth2/v2.0/authorize")
-	default:
-		token, _ = url.Parse("https://login.microsoftonline.com/common/oauth2/v2.0/token")
-		authorize, _ = url.Parse("https://login.microsoftonline.com/common/oauth2/v2.0/authorize")
-	}
+
+	// 未知主机使用国际版认证地址
+	cloud, _ := matchOAuthCloud(base.Hostname())
+	client.Endpoints.isInChina = cloud.isInChina
+	client.Endpoints.graphURL = cloud.graph
+	token, _ := url.Parse(cloud.token)
+	authorize, _ := url.Parse(cloud.authorize)
 
 	return &oauthEndpoint{
 		token:     *token,
@@ -89,6 +170,7 @@ func (client *Client) ObtainToken(ctx context.Context, opts ...Option) (*Credent
 			"Content-Type": {"application/x-www-form-urlencoded"}},
 		),
 		request.WithContentLength(int64(len(strBody))),
+		withUserAgent(),
 	)
 	if res.Err != nil {
 		return nil, res.Err
@@ -122,6 +204,45 @@ func (client *Client) ObtainToken(ctx context.Context, opts ...Option) (*Credent
 
 }
 
+// credentialCachePrefix 访问凭证缓存的键前缀
+const credentialCachePrefix = "onedrive_credential_"
+
+// credentialKey 获取访问凭证缓存及刷新锁的键（不含前缀）。使用同一应用的存储策略
+// 可能授权了不同账号，凭证按存储策略区分
+func (client *Client) credentialKey() string {
+	return policyCacheKey(client.policyID(), client.ClientID)
+}
+
+// ClearCredentialCache 清除该存储策略缓存的访问凭证，下次请求时重新获取
+func (client *Client) ClearCredentialCache() {
+	cache.Deletes([]string{client.credentialKey()}, credentialCachePrefix)
+}
+
+// getRefreshLock 获取给定凭证的刷新锁
+func getRefreshLock(key string) *sync.Mutex {
+	lock, _ := refreshLocks.LoadOrStore(key, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// invalidateCredential 使当前访问令牌失效，下次请求前强制刷新。缓存中的凭证
+// 与被拒绝的令牌相同时一并清除，已由其他请求刷新的凭证则保留
+func (client *Client) invalidateCredential() {
+	if client.Credential == nil {
+		return
+	}
+
+	if cacheCredential, ok := cache.Get(credentialCachePrefix + client.credentialKey()); ok {
+		if credential, ok := cacheCredential.(Credential); ok &&
+			credential.AccessToken == client.Credential.AccessToken {
+			cache.Deletes([]string{client.credentialKey()}, credentialCachePrefix)
+		}
+	}
+
+	credential := *client.Credential
+	credential.ExpiresIn = 0
+	client.Credential = &credential
+}
+
 // UpdateCredential 更新凭证，并检查有效期
 func (client *Client) UpdateCredential(ctx context.Context) error {
 	// 如果已存在凭证
@@ -134,7 +255,21 @@ func (client *Client) UpdateCredential(ctx context.Context) error {
 	}
 
 	// 尝试从缓存中获取凭证
-	if cacheCredential, ok := cache.Get("onedrive_" + client.ClientID); ok {
+	if cacheCredential, ok := cache.Get(credentialCachePrefix + client.credentialKey()); ok {
+		credential := cacheCredential.(Credential)
+		if credential.ExpiresIn > time.Now().Unix() {
+			client.Credential = &credential
+			return nil
+		}
+	}
+
+	// 同一凭证同时只允许一个刷新请求，其余请求等待其结果
+	lock := getRefreshLock(client.credentialKey())
+	lock.Lock()
+	defer lock.Unlock()
+
+	// 等待期间其他请求可能已完成刷新
+	if cacheCredential, ok := cache.Get(credentialCachePrefix + client.credentialKey()); ok {
 		credential := cacheCredential.(Credential)
 		if credential.ExpiresIn > time.Now().Unix() {
 			client.Credential = &credential
@@ -163,7 +298,7 @@ func (client *Client) UpdateCredential(ctx context.Context) error {
 	client.Policy.UpdateAccessKey(credential.RefreshToken)
 
 	// 更新缓存
-	cache.Set("onedrive_"+client.ClientID, *credential, int(expires))
+	cache.Set(credentialCachePrefix+client.credentialKey(), *credential, int(expires))
 
 	return nil
 }
@@ -7,8 +7,11 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -69,6 +72,30 @@ func TestGetOAuthEndpoint(t *testing.T) {
 				auth:     "https://login.chinacloudapi.cn/common/oauth2/v2.0/authorize",
 				isChina:  true,
 			},
+			{
+				OAuthURL: "https://login.microsoftonline.us",
+				token:    "https://login.microsoftonline.us/common/oauth2/v2.0/token",
+				auth:     "https://login.microsoftonline.us/common/oauth2/v2.0/authorize",
+				isChina:  false,
+			},
+			{
+				OAuthURL: "https://login.microsoftonline.de/common/oauth2/v2.0",
+				token:    "https://login.microsoftonline.de/common/oauth2/v2.0/token",
+				auth:     "https://login.microsoftonline.de/common/oauth2/v2.0/authorize",
+				isChina:  false,
+			},
+			{
+				OAuthURL: "https://LOGIN.chinacloudapi.cn/common/oauth2/v2.0",
+				token:    "https://login.chinacloudapi.cn/common/oauth2/v2.0/token",
+				auth:     "https://login.chinacloudapi.cn/common/oauth2/v2.0/authorize",
+				isChina:  true,
+			},
+			{
+				OAuthURL: "https://login.microsoftonline.com",
+				token:    "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+				auth:     "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+				isChina:  false,
+			},
 			{
 				OAuthURL: "other",
 				token:    "https://login.microsoftonline.com/common/oauth2/v2.0/token",
@@ -91,6 +118,50 @@ func TestGetOAuthEndpoint(t *testing.T) {
 	}
 }
 
+func TestIsOAuthEndpoint(t *testing.T) {
+	asserts := assert.New(t)
+	testCase := []struct {
+		URL    string
+		expect bool
+	}{
+		{"https://login.live.com", true},
+		{"https://login.microsoftonline.com/common/oauth2/v2.0", true},
+		{"https://login.chinacloudapi.cn", true},
+		{"https://login.microsoftonline.us", true},
+		{"https://login.microsoftonline.de:443", true},
+		{"https://cdn.login.microsoftonline.com", true},
+		{"https://notlogin.microsoftonline.com", false},
+		{"https://cdn.cloudreve.org", false},
+		{"https://login.microsoftonline.com.cdn.org", false},
+		{string([]byte{0x7f}), false},
+	}
+	for i, testCase := range testCase {
+		asserts.Equal(testCase.expect, isOAuthEndpoint(testCase.URL), "Test Case #%d", i)
+	}
+}
+
+func TestIsCDNEndpoint(t *testing.T) {
+	asserts := assert.New(t)
+	testCase := []struct {
+		URL    string
+		hosts  []string
+		expect bool
+	}{
+		{"https://cdn.cloudreve.org", nil, true},
+		{"https://login.microsoftonline.com", nil, false},
+		{"https://cdn.login.microsoftonline.us", nil, false},
+		// 运营者配置的 CDN 主机优先于内置的认证主机表
+		{"https://cdn.login.microsoftonline.us", []string{"cdn.login.microsoftonline.us"}, true},
+		{"https://a.cdn.login.live.com", []string{".CDN.login.live.com"}, true},
+		{"https://login.live.com", []string{"cdn.login.live.com"}, false},
+		{"https://login.chinacloudapi.cn", []string{""}, false},
+		{string([]byte{0x7f}), nil, true},
+	}
+	for i, testCase := range testCase {
+		asserts.Equal(testCase.expect, isCDNEndpoint(testCase.URL, testCase.hosts), "Test Case #%d", i)
+	}
+}
+
 func TestClient_OAuthURL(t *testing.T) {
 	asserts := assert.New(t)
 
@@ -303,7 +374,7 @@ func TestClient_UpdateCredential(t *testing.T) {
 		clientMock.AssertExpectations(t)
 		asserts.NoError(mock.ExpectationsWereMet())
 		asserts.NoError(err)
-		cacheRes, ok := cache.Get("onedrive_TestClient_UpdateCredential")
+		cacheRes, ok := cache.Get(credentialCachePrefix + client.credentialKey())
 		asserts.True(ok)
 		cacheCredential := cacheRes.(Credential)
 		asserts.Equal("new_refresh_token", cacheCredential.RefreshToken)
@@ -312,7 +383,7 @@ func TestClient_UpdateCredential(t *testing.T) {
 
 	// OneDrive返回错误
 	{
-		cache.Deletes([]string{"TestClient_UpdateCredential"}, "onedrive_")
+		cache.Deletes([]string{client.credentialKey()}, credentialCachePrefix)
 		clientMock := ClientMock{}
 		clientMock.On(
 			"Request",
@@ -338,7 +409,7 @@ func TestClient_UpdateCredential(t *testing.T) {
 
 	// 从缓存中获取
 	{
-		cache.Set("onedrive_TestClient_UpdateCredential", Credential{
+		cache.Set(credentialCachePrefix+client.credentialKey(), Credential{
 			ExpiresIn:    time.Now().Add(time.Duration(10) * time.Second).Unix(),
 			AccessToken:  "AccessToken",
 			RefreshToken: "RefreshToken",
@@ -364,3 +435,185 @@ func TestClient_UpdateCredential(t *testing.T) {
 		asserts.Equal("AccessToken2", client.Credential.AccessToken)
 	}
 }
+
+// tokenRefreshCounter 记录令牌端点调用次数，并延迟返回以放大并发窗口
+type tokenRefreshCounter struct {
+	calls *int32
+}
+
+func (m tokenRefreshCounter) Request(method, target string, body io.Reader, opts ...request.Option) *request.Response {
+	atomic.AddInt32(m.calls, 1)
+	time.Sleep(50 * time.Millisecond)
+	return &request.Response{
+		Response: &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"expires_in":3600,"refresh_token":"rotated_refresh_token","access_token":"new token"}`)),
+		},
+	}
+}
+
+func TestClient_UpdateCredential_Concurrent(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Deletes([]string{policyCacheKey(258, "TestClient_UpdateCredential_Concurrent")}, credentialCachePrefix)
+
+	var (
+		calls int32
+		wg    sync.WaitGroup
+	)
+	const n = 10
+	clients := make([]*Client, n)
+	for i := 0; i < n; i++ {
+		clients[i] = &Client{
+			Policy:    &model.Policy{Model: gorm.Model{ID: 258}},
+			Endpoints: &Endpoints{},
+			ClientID:  "TestClient_UpdateCredential_Concurrent",
+			Credential: &Credential{
+				RefreshToken: "old_refresh_token",
+				AccessToken:  "expired token",
+			},
+			Request: tokenRefreshCounter{calls: &calls},
+		}
+		clients[i].Endpoints.OAuthEndpoints = clients[i].getOAuthEndpoint()
+	}
+
+	// 仅刷新一次并写入一次新的 RefreshToken
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = clients[i].UpdateCredential(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	asserts.EqualValues(1, atomic.LoadInt32(&calls))
+	asserts.NoError(mock.ExpectationsWereMet())
+	for i := 0; i < n; i++ {
+		asserts.NoError(errs[i])
+		asserts.Equal("new token", clients[i].Credential.AccessToken)
+		asserts.Equal("rotated_refresh_token", clients[i].Credential.RefreshToken)
+	}
+}
+
+// tokenServer 模拟 OneDrive 接口，仅接受 validToken，rejectFirst 为 true 时即使令牌有效也拒绝首个请求，
+// rejectAll 为 true 时拒绝所有请求
+type tokenServer struct {
+	validToken  string
+	rejectFirst bool
+	rejectAll   bool
+	refreshes   int32
+	bodies      []string
+	mu          sync.Mutex
+}
+
+func (server *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		atomic.AddInt32(&server.refreshes, 1)
+		w.Write([]byte(`{"expires_in":3600,"refresh_token":"new_refresh_token","access_token":"` + server.validToken + `"}`))
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	server.bodies = append(server.bodies, string(body))
+	if r.Header.Get("Authorization") != "Bearer "+server.validToken || server.rejectFirst || server.rejectAll {
+		server.rejectFirst = false
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"code":"InvalidAuthenticationToken","message":"Access token has expired."}}`))
+		return
+	}
+	w.Write([]byte(`{"id":"1","name":"a.txt","size":4}`))
+}
+
+func TestClient_Request_RefreshOnUnauthorized(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+
+	newClient := func(server *httptest.Server, clientID string) *Client {
+		cache.Deletes([]string{policyCacheKey(259, clientID)}, credentialCachePrefix)
+		client := &Client{
+			Policy:   &model.Policy{Model: gorm.Model{ID: 259}},
+			ClientID: clientID,
+			Endpoints: &Endpoints{
+				EndpointURL: server.URL,
+			},
+			Credential: &Credential{
+				AccessToken:  "expired token",
+				RefreshToken: "old_refresh_token",
+				ExpiresIn:    time.Now().Add(time.Duration(1) * time.Hour).Unix(),
+			},
+			Request: request.HTTPClient{},
+		}
+		token, _ := url.Parse(server.URL + "/token")
+		client.Endpoints.OAuthEndpoints = &oauthEndpoint{token: *token}
+		return client
+	}
+
+	// 令牌被拒绝后刷新并重试，重试时重新发送请求正文
+	{
+		handler := &tokenServer{validToken: "new token"}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		client := newClient(server, "TestClient_Request_RefreshOnUnauthorized")
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		err := client.Upload(context.Background(), "/a.txt", 4, strings.NewReader("1234"))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.EqualValues(1, handler.refreshes)
+		asserts.Equal([]string{"1234", "1234"}, handler.bodies)
+		asserts.Equal("new token", client.Credential.AccessToken)
+	}
+
+	// 刷新后仍被拒绝，只重试一次
+	{
+		handler := &tokenServer{validToken: "new token 2", rejectFirst: true}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		client := newClient(server, "TestClient_Request_RefreshOnUnauthorized_2")
+		client.Credential.AccessToken = "new token 2"
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		_, err := client.request(context.Background(), "GET", client.getRequestURL("me"), nil)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Nil(err)
+		asserts.EqualValues(1, handler.refreshes)
+		asserts.Len(handler.bodies, 2)
+
+		handler.rejectAll = true
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		_, err = client.request(context.Background(), "GET", client.getRequestURL("me"), nil)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+		asserts.True(IsUnauthorized(err))
+		asserts.EqualValues(2, handler.refreshes)
+		asserts.Len(handler.bodies, 4)
+	}
+
+	// 不可重置的请求正文不重试
+	{
+		handler := &tokenServer{validToken: "new token"}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		client := newClient(server, "TestClient_Request_RefreshOnUnauthorized_3")
+
+		_, err := client.request(context.Background(), "PUT", client.getRequestURL("me"), ioutil.NopCloser(strings.NewReader("1234")))
+		asserts.Error(err)
+		asserts.EqualValues(0, handler.refreshes)
+		asserts.Len(handler.bodies, 1)
+	}
+}
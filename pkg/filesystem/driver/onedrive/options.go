@@ -12,6 +12,8 @@ type options struct {
 	code             string
 	refreshToken     string
 	conflictBehavior string
+	description      string
+	modTime          time.Time
 	expires          time.Time
 }
 
@@ -38,6 +40,20 @@ func WithConflictBehavior(t string) Option {
 	})
 }
 
+// WithDescription 设置上传后项目的 description 字段
+func WithDescription(t string) Option {
+	return optionFunc(func(o *options) {
+		o.description = t
+	})
+}
+
+// WithModTime 设置上传后项目的修改时间，零值表示使用 OneDrive 接收文件的时间
+func WithModTime(t time.Time) Option {
+	return optionFunc(func(o *options) {
+		o.modTime = t
+	})
+}
+
 func (f optionFunc) apply(o *options) {
 	f(o)
 }
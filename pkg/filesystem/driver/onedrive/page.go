@@ -0,0 +1,98 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+)
+
+// ListChildrenPage 列取 path 下的一页子对象，pageToken 为空时列取第一页，每页最多 pageSize 个。
+// 返回下一页的分页标记，已是最后一页时为空。分页标记由 OneDrive 返回的 nextLink 生成，
+// 后续分页沿用第一页的每页数量
+func (client *Client) ListChildrenPage(ctx context.Context, path, pageToken string, pageSize int) ([]FileInfo, string, error) {
+	dst := strings.Trim(path, "/")
+	var requestURL string
+	if pageToken == "" {
+		if pageSize <= 0 {
+			pageSize = DefaultListPageSize
+		}
+		if pageSize > MaxListPageSize {
+			pageSize = MaxListPageSize
+		}
+		requestURL = fmt.Sprintf("%s?$top=%d", client.getItemRequestURL(dst, "children"), pageSize)
+	} else {
+		nextLink, err := client.decodePageToken(dst, pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		requestURL = nextLink
+	}
+
+	page, err := client.listChildrenPage(ctx, path, requestURL)
+	// 路径可能经过尚未记录的快捷方式
+	if pageToken == "" && IsNotFound(err) && client.discoverShortcuts(ctx, dst) {
+		requestURL = fmt.Sprintf("%s?$top=%d", client.getItemRequestURL(dst, "children"), pageSize)
+		page, err = client.listChildrenPage(ctx, path, requestURL)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextToken string
+	if page.NextLink != "" {
+		nextToken = encodePageToken(dst, page.NextLink)
+	}
+	return client.resolveShortcuts(ctx, dst, page.Value), nextToken, nil
+}
+
+// encodePageToken 将所属目录与 nextLink 编码为分页标记，相同的分页总是得到相同的标记
+func encodePageToken(dir, nextLink string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(dir + "\x00" + nextLink))
+}
+
+// decodePageToken 解析分页标记，返回其中的 nextLink。分页标记不属于 dir，或 nextLink
+// 不指向当前接口地址所在主机时返回 ErrInvalidPageToken，避免访问令牌被发往其他主机
+func (client *Client) decodePageToken(dir, pageToken string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(pageToken)
+	if err != nil {
+		return "", ErrInvalidPageToken
+	}
+	parts := strings.SplitN(string(raw), "\x00", 2)
+	if len(parts) != 2 || parts[0] != dir {
+		return "", ErrInvalidPageToken
+	}
+
+	nextLink, err := url.Parse(parts[1])
+	if err != nil {
+		return "", ErrInvalidPageToken
+	}
+	endpoint, err := url.Parse(client.Endpoints.EndpointURL)
+	if err != nil || nextLink.Scheme != endpoint.Scheme || nextLink.Host != endpoint.Host {
+		return "", ErrInvalidPageToken
+	}
+	return parts[1], nil
+}
+
+// ListPage 分页列取 base 下的直接子项目，pageToken 为空时列取第一页。返回下一页的分页标记，
+// 已是最后一页时为空。适用于按需逐页加载的界面，不必一次列取整个目录
+func (handler Driver) ListPage(ctx context.Context, base, pageToken string, pageSize int) ([]response.Object, string, error) {
+	base = strings.TrimPrefix(base, "/")
+	objects, nextToken, err := handler.Client.ListChildrenPage(ctx, base, pageToken, pageSize)
+	if err != nil {
+		return nil, "", err
+	}
+
+	filter := fsctx.ListFilter(ctx)
+	res := make([]response.Object, 0, len(objects))
+	for _, object := range objects {
+		if obj, ok := toObject(base, base, object); ok && filter.Match(obj.IsDir) {
+			res = append(res, obj)
+		}
+	}
+	return res, nextToken, nil
+}
@@ -0,0 +1,101 @@
+package onedrive
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestDriver_ListPage(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{Policy: &model.Policy{}}
+	handler.Client, _ = NewClient(handler.Policy)
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_etag_cache_ttl", "0", 0)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	page := func(body string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			},
+		}
+	}
+	clientMock := ClientMock{}
+	clientMock.On("Request", "GET", "drive/root:/dir:/children?$top=2", testMock.Anything, testMock.Anything).
+		Return(page(`{"value":[{"name":"a.txt","file":{}},{"name":"sub","folder":{}}],"@odata.nextLink":"drive/items/1/children?$top=2&$skiptoken=p2"}`)).Once()
+	clientMock.On("Request", "GET", "drive/root:/dir:/children?$top=2", testMock.Anything, testMock.Anything).
+		Return(page(`{"value":[{"name":"a.txt","file":{}},{"name":"sub","folder":{}}],"@odata.nextLink":"drive/items/1/children?$top=2&$skiptoken=p2"}`)).Once()
+	clientMock.On("Request", "GET", "drive/items/1/children?$top=2&$skiptoken=p2", testMock.Anything, testMock.Anything).
+		Return(page(`{"value":[{"name":"b.txt","file":{}}]}`)).Once()
+	handler.Client.Request = clientMock
+
+	// 第一页，返回下一页的分页标记
+	res, token, err := handler.ListPage(context.Background(), "/dir", "", 2)
+	asserts.NoError(err)
+	asserts.Len(res, 2)
+	asserts.Equal("a.txt", res[0].Name)
+	asserts.Equal("dir/a.txt", res[0].Source)
+	asserts.True(res[1].IsDir)
+	asserts.NotEmpty(token)
+
+	// 相同分页得到相同的分页标记
+	_, sameToken, err := handler.ListPage(context.Background(), "dir", "", 2)
+	asserts.NoError(err)
+	asserts.Equal(token, sameToken)
+
+	// 根据分页标记列取下一页，最后一页不返回分页标记
+	res, token2, err := handler.ListPage(context.Background(), "/dir", token, 2)
+	asserts.NoError(err)
+	asserts.Len(res, 1)
+	asserts.Equal("dir/b.txt", res[0].Source)
+	asserts.Empty(token2)
+	clientMock.AssertExpectations(t)
+
+	// 分页标记不属于当前目录
+	_, _, err = handler.ListPage(context.Background(), "/other", token, 2)
+	asserts.Equal(ErrInvalidPageToken, err)
+
+	// 分页标记无法解析
+	_, _, err = handler.ListPage(context.Background(), "/dir", "!!", 2)
+	asserts.Equal(ErrInvalidPageToken, err)
+
+	// 分页标记指向其他主机
+	_, _, err = handler.ListPage(context.Background(), "/dir", encodePageToken("dir", "https://evil.invalid/children"), 2)
+	asserts.Equal(ErrInvalidPageToken, err)
+}
+
+func TestClient_ListChildrenPage_PageSize(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_etag_cache_ttl", "0", 0)
+
+	clientMock := ClientMock{}
+	clientMock.On("Request", "GET", "drive/root/children?$top=200", testMock.Anything, testMock.Anything).
+		Return(&request.Response{Response: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(`{"value":[]}`))}})
+	clientMock.On("Request", "GET", "drive/root/children?$top=999", testMock.Anything, testMock.Anything).
+		Return(&request.Response{Response: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(`{"value":[]}`))}})
+	client.Request = clientMock
+
+	// 未指定每页数量时使用默认值
+	_, token, err := client.ListChildrenPage(context.Background(), "/", "", 0)
+	asserts.NoError(err)
+	asserts.Empty(token)
+
+	// 每页数量超出上限
+	_, _, err = client.ListChildrenPage(context.Background(), "/", "", 100000)
+	asserts.NoError(err)
+	clientMock.AssertExpectations(t)
+}
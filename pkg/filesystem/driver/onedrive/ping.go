@@ -0,0 +1,110 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+var (
+	// ErrPingUnauthorized 连通性检查失败：授权无效或已过期
+	ErrPingUnauthorized = errors.New("OneDrive 授权无效或已过期，请重新授权")
+	// ErrPingNetwork 连通性检查失败：无法连接到 OneDrive 或服务暂时不可用
+	ErrPingNetwork = errors.New("无法连接到 OneDrive")
+	// ErrPingEndpoint 连通性检查失败：接口地址或驱动器配置有误
+	ErrPingEndpoint = errors.New("OneDrive 接口地址或驱动器配置有误")
+)
+
+// PingError 连通性检查失败的原因，Kind 为 ErrPingUnauthorized、ErrPingNetwork、
+// ErrPingEndpoint 之一，可使用 errors.Is 判断
+type PingError struct {
+	Kind error
+	Err  error
+}
+
+// Error 实现error接口
+func (err *PingError) Error() string {
+	return fmt.Sprintf("%s，%s", err.Kind, err.Err)
+}
+
+// Unwrap 返回原始错误
+func (err *PingError) Unwrap() error {
+	return err.Err
+}
+
+// Is 判断失败原因是否为 target
+func (err *PingError) Is(target error) bool {
+	return err.Kind == target
+}
+
+// Ping 使用当前凭证获取驱动器根目录的元信息，检查存储策略能否正常访问 OneDrive
+func (client *Client) Ping(ctx context.Context) error {
+	endpoint, err := url.Parse(client.Endpoints.EndpointURL)
+	if err != nil {
+		return &PingError{Kind: ErrPingEndpoint, Err: err}
+	}
+	if (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return &PingError{Kind: ErrPingEndpoint, Err: fmt.Errorf("无效的接口地址[%s]", client.Endpoints.EndpointURL)}
+	}
+
+	// 单独刷新凭证，以区分授权失败与请求失败
+	if err := client.UpdateCredential(ctx); err != nil {
+		return classifyCredentialError(err)
+	}
+
+	res, respErr := client.request(ctx, "GET", client.getDriveRequestURL("root"), nil)
+	if respErr != nil {
+		return classifyPingError(respErr)
+	}
+
+	var root FileInfo
+	if err := json.Unmarshal([]byte(res), &root); err != nil || root.Folder == nil {
+		if err == nil {
+			err = ErrNotFolder
+		}
+		return &PingError{Kind: ErrPingEndpoint, Err: err}
+	}
+
+	return nil
+}
+
+// classifyCredentialError 归类刷新凭证时遇到的错误
+func classifyCredentialError(err error) error {
+	var (
+		oauthErr  OAuthError
+		syntaxErr *json.SyntaxError
+	)
+	switch {
+	case errors.Is(err, ErrInvalidRefreshToken), errors.As(err, &oauthErr):
+		return &PingError{Kind: ErrPingUnauthorized, Err: err}
+	case errors.As(err, &syntaxErr):
+		// 授权端点返回了非 JSON 响应
+		return &PingError{Kind: ErrPingEndpoint, Err: err}
+	default:
+		return &PingError{Kind: ErrPingNetwork, Err: err}
+	}
+}
+
+// classifyPingError 归类请求驱动器根目录时遇到的错误
+func classifyPingError(err *RespError) error {
+	switch {
+	case err.APIError.Message == ErrClientCanceled.Error():
+		return ErrClientCanceled
+	case IsUnauthorized(err) || err.Status == http.StatusForbidden:
+		return &PingError{Kind: ErrPingUnauthorized, Err: err}
+	case err.Status == 0 || err.Status >= 500 || err.Status == http.StatusTooManyRequests:
+		// 未收到响应，或服务暂时不可用
+		return &PingError{Kind: ErrPingNetwork, Err: err}
+	default:
+		// 接口地址或驱动器ID有误时通常返回 400、404 或非 JSON 响应
+		return &PingError{Kind: ErrPingEndpoint, Err: err}
+	}
+}
+
+// Ping 检查存储策略能否正常访问 OneDrive，失败时返回 *PingError
+func (handler Driver) Ping(ctx context.Context) error {
+	return handler.Client.Ping(ctx)
+}
@@ -0,0 +1,155 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestDriver_Ping(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	pingResponse := func(status int, body string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: status,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			},
+		}
+	}
+	newHandler := func() Driver {
+		handler := Driver{
+			Policy: &model.Policy{Server: "https://graph.microsoft.com/v1.0/me", BucketName: "ping"},
+		}
+		handler.Client, _ = NewClient(handler.Policy)
+		handler.Client.Credential.AccessToken = "AccessToken"
+		handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		return handler
+	}
+	rootURL := "https://graph.microsoft.com/v1.0/me/drive/root"
+
+	// 成功
+	{
+		handler := newHandler()
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", rootURL, testMock.Anything, testMock.Anything).
+			Return(pingResponse(200, `{"name":"root","folder":{"childCount":1}}`))
+		handler.Client.Request = clientMock
+		asserts.NoError(handler.Ping(context.Background()))
+		clientMock.AssertExpectations(t)
+	}
+
+	// 接口地址无效
+	{
+		for _, server := range []string{"", "graph.microsoft.com", "ftp://graph.microsoft.com", "https://"} {
+			handler := newHandler()
+			handler.Client.Endpoints.EndpointURL = server
+			err := handler.Ping(context.Background())
+			asserts.True(errors.Is(err, ErrPingEndpoint), server)
+		}
+	}
+
+	// 无有效的 RefreshToken
+	{
+		handler := newHandler()
+		handler.Client.Credential = &Credential{}
+		err := handler.Ping(context.Background())
+		asserts.True(errors.Is(err, ErrPingUnauthorized))
+		asserts.True(errors.Is(err, ErrInvalidRefreshToken))
+	}
+
+	// 刷新凭证被拒绝
+	{
+		handler := newHandler()
+		handler.Client.Credential = &Credential{RefreshToken: "expired"}
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", testMock.Anything, testMock.Anything, testMock.Anything).
+			Return(pingResponse(400, `{"error":"invalid_grant","error_description":"expired"}`))
+		handler.Client.Request = clientMock
+		err := handler.Ping(context.Background())
+		clientMock.AssertExpectations(t)
+		asserts.True(errors.Is(err, ErrPingUnauthorized))
+	}
+
+	// 无法连接授权端点
+	{
+		handler := newHandler()
+		handler.Client.Credential = &Credential{RefreshToken: "token"}
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", testMock.Anything, testMock.Anything, testMock.Anything).
+			Return(&request.Response{Err: errors.New("connection refused")})
+		handler.Client.Request = clientMock
+		err := handler.Ping(context.Background())
+		clientMock.AssertExpectations(t)
+		asserts.True(errors.Is(err, ErrPingNetwork))
+	}
+
+	// 访问令牌被拒绝
+	{
+		handler := newHandler()
+		handler.Client.Credential.RefreshToken = ""
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", rootURL, testMock.Anything, testMock.Anything).
+			Return(pingResponse(401, `{"error":{"code":"InvalidAuthenticationToken"}}`))
+		handler.Client.Request = clientMock
+		err := handler.Ping(context.Background())
+		clientMock.AssertExpectations(t)
+		asserts.True(errors.Is(err, ErrPingUnauthorized))
+	}
+
+	// 网络错误及服务不可用
+	{
+		for _, res := range []*request.Response{
+			{Err: errors.New("timeout")},
+			pingResponse(503, `{"error":{"code":"serviceNotAvailable"}}`),
+		} {
+			handler := newHandler()
+			clientMock := ClientMock{}
+			clientMock.On("Request", "GET", rootURL, testMock.Anything, testMock.Anything).Return(res)
+			handler.Client.Request = clientMock
+			err := handler.Ping(context.Background())
+			clientMock.AssertExpectations(t)
+			asserts.True(errors.Is(err, ErrPingNetwork))
+		}
+	}
+
+	// 接口地址或驱动器有误
+	{
+		for _, res := range []*request.Response{
+			pingResponse(404, `{"error":{"code":"itemNotFound"}}`),
+			pingResponse(404, `<html>Not Found</html>`),
+			pingResponse(200, `<html>OK</html>`),
+			pingResponse(200, `{"name":"a.txt","file":{}}`),
+		} {
+			handler := newHandler()
+			clientMock := ClientMock{}
+			clientMock.On("Request", "GET", rootURL, testMock.Anything, testMock.Anything).Return(res)
+			handler.Client.Request = clientMock
+			err := handler.Ping(context.Background())
+			clientMock.AssertExpectations(t)
+			asserts.True(errors.Is(err, ErrPingEndpoint))
+			asserts.Error(errors.Unwrap(err))
+		}
+	}
+
+	// 客户端取消
+	{
+		handler := newHandler()
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", rootURL, testMock.Anything, testMock.Anything).
+			Return(&request.Response{Err: ErrClientCanceled})
+		handler.Client.Request = clientMock
+		asserts.Equal(ErrClientCanceled, handler.Ping(context.Background()))
+	}
+}
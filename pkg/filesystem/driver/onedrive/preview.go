@@ -0,0 +1,106 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+)
+
+// previewCachePrefix 在线预览地址缓存的键前缀
+const previewCachePrefix = "onedrive_preview_"
+
+// ErrPreviewNotAvailable 文件不支持在线预览
+var ErrPreviewNotAvailable = errors.New("文件不支持在线预览")
+
+// previewExtensions 支持通过 OneDrive 在线预览的文件扩展名
+var previewExtensions = map[string]bool{
+	"doc": true, "docx": true, "docm": true, "dot": true, "dotx": true, "odt": true, "rtf": true,
+	"xls": true, "xlsx": true, "xlsm": true, "xlsb": true, "ods": true,
+	"ppt": true, "pptx": true, "pptm": true, "pps": true, "ppsx": true, "odp": true,
+	"pdf": true,
+}
+
+// previewResponse 创建在线预览的响应
+type previewResponse struct {
+	GetURL string `json:"getUrl"`
+}
+
+// Preview 获取 src 的可嵌入在线预览地址，地址的有效期较短
+func (client *Client) Preview(ctx context.Context, src string) (string, error) {
+	requestURL := client.getItemRequestURL(strings.TrimPrefix(src, "/"), "preview")
+	res, err := client.requestWithStr(ctx, "POST", requestURL, "{}", 200)
+	if err != nil {
+		return "", err
+	}
+
+	var preview previewResponse
+	if err := json.Unmarshal([]byte(res), &preview); err != nil {
+		return "", err
+	}
+	if preview.GetURL == "" {
+		return "", ErrPreviewNotAvailable
+	}
+	return preview.GetURL, nil
+}
+
+// supportsPreview 返回 path 处的文件能否在线预览
+func supportsPreview(path string) bool {
+	return previewExtensions[strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))]
+}
+
+// isPreviewUnavailable 返回错误是否表示 OneDrive 无法为此文件生成在线预览
+func isPreviewUnavailable(err error) bool {
+	if errors.Is(err, ErrPreviewNotAvailable) {
+		return true
+	}
+	respErr, ok := asRespError(err)
+	if !ok {
+		return false
+	}
+	return respErr.APIError.Code == "notSupported" ||
+		respErr.Status == http.StatusBadRequest ||
+		respErr.Status == http.StatusNotImplemented
+}
+
+// getPreviewCacheKey 获取在线预览地址缓存的键
+func getPreviewCacheKey(policyID uint, path string) string {
+	return policyCacheKey(policyID, path)
+}
+
+// PreviewURL 获取 path 处文件的可嵌入在线预览地址，在缓存中保留 PreviewCacheTTL 秒。
+// Office 文档、PDF 以外的文件，以及 OneDrive 无法预览的文件，返回普通的预览外链地址；
+// 存储策略启用加密时返回 ErrEncryptedDirectLink
+func (handler Driver) PreviewURL(ctx context.Context, path string) (string, error) {
+	// 启用加密时 OneDrive 只能预览密文，也没有可用的直链
+	if aead, err := handler.encryptionAEAD(); err != nil {
+		return "", err
+	} else if aead != nil {
+		return "", ErrEncryptedDirectLink
+	}
+
+	if !supportsPreview(path) {
+		return handler.Source(ctx, path, url.URL{}, 0, false, 0)
+	}
+
+	cacheKey := previewCachePrefix + getPreviewCacheKey(handler.Policy.ID, path)
+	if cachedURL, ok := cache.Get(cacheKey); ok {
+		return cachedURL.(string), nil
+	}
+
+	previewURL, err := handler.Client.Preview(ctx, path)
+	if err != nil {
+		if isPreviewUnavailable(err) {
+			return handler.Source(ctx, path, url.URL{}, 0, false, 0)
+		}
+		return "", err
+	}
+
+	cache.Set(cacheKey, previewURL, PreviewCacheTTL)
+	return previewURL, nil
+}
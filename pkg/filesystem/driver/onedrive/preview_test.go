@@ -0,0 +1,117 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestDriver_PreviewURL(t *testing.T) {
+	asserts := assert.New(t)
+	policy := &model.Policy{}
+	policy.ID = 85
+	handler := Driver{Policy: policy}
+	handler.Client, _ = NewClient(policy)
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_source_timeout", "1800", 0)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	response := func(status int, body string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: status,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			},
+		}
+	}
+
+	// Office 文档返回在线预览地址，并写入缓存
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", "drive/root:/dir/a.docx:/preview", testMock.Anything, testMock.Anything).
+			Return(response(200, `{"getUrl":"https://onedrive.live.com/embed?resid=1"}`)).Once()
+		handler.Client.Request = clientMock
+		res, err := handler.PreviewURL(context.Background(), "/dir/a.docx")
+		asserts.NoError(err)
+		asserts.Equal("https://onedrive.live.com/embed?resid=1", res)
+
+		// 命中缓存
+		res, err = handler.PreviewURL(context.Background(), "/dir/a.docx")
+		asserts.NoError(err)
+		asserts.Equal("https://onedrive.live.com/embed?resid=1", res)
+		clientMock.AssertExpectations(t)
+
+		// 文件变化后缓存失效
+		invalidateSourceCache(policy.ID, "/dir/a.docx")
+		_, ok := cache.Get(previewCachePrefix + getPreviewCacheKey(policy.ID, "/dir/a.docx"))
+		asserts.False(ok)
+	}
+
+	// 不支持在线预览的类型，返回预览外链地址
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/dir/a.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(response(200, `{"name":"a.txt","@microsoft.graph.downloadUrl":"https://download/a.txt"}`))
+		handler.Client.Request = clientMock
+		res, err := handler.PreviewURL(context.Background(), "/dir/a.txt")
+		asserts.NoError(err)
+		asserts.Equal("https://download/a.txt", res)
+		clientMock.AssertExpectations(t)
+		clientMock.AssertNotCalled(t, "Request", "POST", testMock.Anything, testMock.Anything, testMock.Anything)
+	}
+
+	// OneDrive 无法预览，返回预览外链地址
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", "drive/root:/dir/b.pdf:/preview", testMock.Anything, testMock.Anything).
+			Return(response(400, `{"error":{"code":"invalidRequest","message":"not supported"}}`))
+		clientMock.On("Request", "GET", "drive/root:/dir/b.pdf?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(response(200, `{"name":"b.pdf","@microsoft.graph.downloadUrl":"https://download/b.pdf"}`))
+		handler.Client.Request = clientMock
+		res, err := handler.PreviewURL(context.Background(), "/dir/b.pdf")
+		asserts.NoError(err)
+		asserts.Equal("https://download/b.pdf", res)
+		clientMock.AssertExpectations(t)
+	}
+
+	// 其他错误
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", "drive/root:/dir/c.xlsx:/preview", testMock.Anything, testMock.Anything).
+			Return(&request.Response{Err: errors.New("error")})
+		handler.Client.Request = clientMock
+		res, err := handler.PreviewURL(context.Background(), "/dir/c.xlsx")
+		asserts.Error(err)
+		asserts.Empty(res)
+		clientMock.AssertExpectations(t)
+	}
+
+	// 未返回预览地址
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", "drive/root:/dir/d.pptx:/preview", testMock.Anything, testMock.Anything).
+			Return(response(200, `{}`))
+		handler.Client.Request = clientMock
+		res, err := handler.Client.Preview(context.Background(), "/dir/d.pptx")
+		asserts.Equal(ErrPreviewNotAvailable, err)
+		asserts.Empty(res)
+	}
+}
+
+func TestSupportsPreview(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.True(supportsPreview("a.docx"))
+	asserts.True(supportsPreview("dir/A.PDF"))
+	asserts.False(supportsPreview("a.txt"))
+	asserts.False(supportsPreview("docx"))
+}
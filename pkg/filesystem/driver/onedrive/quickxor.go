@@ -0,0 +1,114 @@
+package onedrive
+
+import (
+	"encoding/binary"
+	"hash"
+)
+
+const (
+	// quickXorWidth quickXorHash 的位宽
+	quickXorWidth = 160
+	// quickXorShift 每个字节循环左移的位数
+	quickXorShift = 11
+	// QuickXorSize quickXorHash 摘要的字节数
+	QuickXorSize = quickXorWidth / 8
+)
+
+// quickXorHash OneDrive 使用的 quickXorHash 摘要算法，参见
+// https://docs.microsoft.com/onedrive/developer/code-snippets/quickxorhash
+type quickXorHash struct {
+	data        [(quickXorWidth-1)/64 + 1]uint64
+	lengthSoFar uint64
+	shiftSoFar  int
+}
+
+// NewQuickXorHash 返回计算 quickXorHash 的 hash.Hash
+func NewQuickXorHash() hash.Hash {
+	return &quickXorHash{}
+}
+
+// Write 写入数据
+func (q *quickXorHash) Write(p []byte) (int, error) {
+	currentShift := q.shiftSoFar
+	vectorArrayIndex := currentShift / 64
+	vectorOffset := currentShift % 64
+	iterations := len(p)
+	if iterations > quickXorWidth {
+		iterations = quickXorWidth
+	}
+
+	for i := 0; i < iterations; i++ {
+		isLastCell := vectorArrayIndex == len(q.data)-1
+		bitsInVectorCell := 64
+		if isLastCell {
+			bitsInVectorCell = quickXorWidth % 64
+		}
+
+		if vectorOffset <= bitsInVectorCell-8 {
+			for j := i; j < len(p); j += quickXorWidth {
+				q.data[vectorArrayIndex] ^= uint64(p[j]) << uint(vectorOffset)
+			}
+		} else {
+			index1 := vectorArrayIndex
+			index2 := vectorArrayIndex + 1
+			if isLastCell {
+				index2 = 0
+			}
+			low := uint(bitsInVectorCell - vectorOffset)
+
+			var xoredByte byte
+			for j := i; j < len(p); j += quickXorWidth {
+				xoredByte ^= p[j]
+			}
+			q.data[index1] ^= uint64(xoredByte) << uint(vectorOffset)
+			q.data[index2] ^= uint64(xoredByte) >> low
+		}
+
+		vectorOffset += quickXorShift
+		for vectorOffset >= bitsInVectorCell {
+			if isLastCell {
+				vectorArrayIndex = 0
+			} else {
+				vectorArrayIndex++
+			}
+			vectorOffset -= bitsInVectorCell
+		}
+	}
+
+	q.shiftSoFar = (q.shiftSoFar + quickXorShift*(len(p)%quickXorWidth)) % quickXorWidth
+	q.lengthSoFar += uint64(len(p))
+	return len(p), nil
+}
+
+// Sum 将摘要追加到 b 后返回，不改变当前状态
+func (q *quickXorHash) Sum(b []byte) []byte {
+	rgb := make([]byte, 8*len(q.data))
+	for i, cell := range q.data {
+		binary.LittleEndian.PutUint64(rgb[i*8:], cell)
+	}
+	rgb = rgb[:QuickXorSize]
+
+	// 将数据长度异或到摘要的最后8个字节
+	length := make([]byte, 8)
+	binary.LittleEndian.PutUint64(length, q.lengthSoFar)
+	for i := 0; i < 8; i++ {
+		rgb[QuickXorSize-8+i] ^= length[i]
+	}
+
+	return append(b, rgb...)
+}
+
+// Reset 重置状态
+func (q *quickXorHash) Reset() {
+	*q = quickXorHash{}
+}
+
+// Size 返回摘要的字节数
+func (q *quickXorHash) Size() int {
+	return QuickXorSize
+}
+
+// BlockSize 返回块大小
+func (q *quickXorHash) BlockSize() int {
+	return 64
+}
@@ -0,0 +1,56 @@
+package onedrive
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuickXorHash(t *testing.T) {
+	asserts := assert.New(t)
+	pattern := make([]byte, 1000)
+	for i := range pattern {
+		pattern[i] = byte((i*31 + 7) % 256)
+	}
+
+	testCases := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte{}, "AAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+		{[]byte("J"), "SgAAAAAAAAAAAAAAAQAAAAAAAAA="},
+		{[]byte("hello world"), "aCgDG9jwBhDc4Q1yawMZAAAAAAA="},
+		{pattern, "X4X7cC7/cVgPZMrjju+fOUsa7aY="},
+	}
+
+	// 一次性写入
+	for _, testCase := range testCases {
+		hasher := NewQuickXorHash()
+		hasher.Write(testCase.data)
+		asserts.Equal(testCase.expected, base64.StdEncoding.EncodeToString(hasher.Sum(nil)))
+		asserts.Equal(QuickXorSize, hasher.Size())
+	}
+
+	// 分多次写入，结果与一次性写入一致
+	for _, step := range []int{1, 7, 159, 160, 161, 333} {
+		hasher := NewQuickXorHash()
+		for start := 0; start < len(pattern); start += step {
+			end := start + step
+			if end > len(pattern) {
+				end = len(pattern)
+			}
+			hasher.Write(pattern[start:end])
+		}
+		asserts.Equal("X4X7cC7/cVgPZMrjju+fOUsa7aY=", base64.StdEncoding.EncodeToString(hasher.Sum(nil)), "step %d", step)
+	}
+
+	// 重置
+	{
+		hasher := NewQuickXorHash()
+		hasher.Write(pattern)
+		hasher.Reset()
+		hasher.Write([]byte("J"))
+		asserts.Equal("SgAAAAAAAAAAAAAAAQAAAAAAAAA=", base64.StdEncoding.EncodeToString(hasher.Sum(nil)))
+	}
+}
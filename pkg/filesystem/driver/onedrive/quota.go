@@ -0,0 +1,51 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+)
+
+// quotaCachePrefix 驱动器容量信息缓存的键前缀
+const quotaCachePrefix = "onedrive_quota_"
+
+// getQuotaCacheKey 获取驱动器容量信息的缓存键（不含前缀）
+func getQuotaCacheKey(policyID uint) string {
+	return policyCacheKey(policyID)
+}
+
+// GetQuota 获取当前驱动器的容量使用情况
+func (client *Client) GetQuota(ctx context.Context) (*Quota, error) {
+	res, err := client.request(ctx, "GET", client.getDriveRequestURL(""), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var drive DriveResponse
+	if decodeErr := json.Unmarshal([]byte(res), &drive); decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	return &drive.Quota, nil
+}
+
+// Quota 获取存储策略所绑定驱动器的总容量、已用容量及剩余容量，
+// 结果会在短时间内缓存，避免管理面板频繁请求
+func (handler Driver) Quota(ctx context.Context) (total, used, remaining int64, err error) {
+	cacheKey := quotaCachePrefix + getQuotaCacheKey(handler.Policy.ID)
+	if cached, ok := cache.Get(cacheKey); ok {
+		if quota, ok := cached.(Quota); ok {
+			return quota.Total, quota.Used, quota.Remaining, nil
+		}
+	}
+
+	quota, err := handler.Client.GetQuota(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	_ = cache.Set(cacheKey, *quota, model.GetIntSetting("onedrive_quota_cache_ttl", 60))
+	return quota.Total, quota.Used, quota.Remaining, nil
+}
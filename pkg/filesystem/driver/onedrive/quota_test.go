@@ -0,0 +1,78 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestDriver_Quota(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Policy.ID = 62
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_quota_cache_ttl", "60", 0)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+
+	// 请求失败
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive", testMock.Anything, testMock.Anything).
+			Return(&request.Response{Err: errors.New("error")})
+		handler.Client.Request = clientMock
+		_, _, _, err := handler.Quota(context.Background())
+		clientMock.AssertExpectations(t)
+		asserts.Error(err)
+	}
+
+	// 解析容量信息
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive", testMock.Anything, testMock.Anything).
+			Return(&request.Response{
+				Response: &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(strings.NewReader(`{"id":"123","driveType":"business","quota":{"total":1099511627776,"used":107374182400,"remaining":992137445376,"deleted":1024,"state":"normal"}}`)),
+				},
+			})
+		handler.Client.Request = clientMock
+		total, used, remaining, err := handler.Quota(context.Background())
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.EqualValues(1099511627776, total)
+		asserts.EqualValues(107374182400, used)
+		asserts.EqualValues(992137445376, remaining)
+	}
+
+	// 再次查询时使用缓存
+	{
+		clientMock := ClientMock{}
+		handler.Client.Request = clientMock
+		total, _, remaining, err := handler.Quota(context.Background())
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.EqualValues(1099511627776, total)
+		asserts.EqualValues(992137445376, remaining)
+	}
+
+	// 释放存储策略后清除缓存
+	{
+		asserts.NoError(handler.Close())
+		_, ok := cache.Get(quotaCachePrefix + getQuotaCacheKey(62))
+		asserts.False(ok)
+	}
+}
@@ -0,0 +1,41 @@
+package onedrive
+
+import (
+	"context"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+)
+
+// readOnlyCachePrefix 已确认驱动器只读的存储策略在缓存中的键前缀
+const readOnlyCachePrefix = "onedrive_readonly_"
+
+// checkWritable 存储策略的驱动器近期已确认只读时返回 ErrReadOnly，写入操作直接失败，
+// 不再发送注定被拒绝的请求
+func (handler Driver) checkWritable() error {
+	if handler.Policy.ID == 0 {
+		return nil
+	}
+	if _, ok := cache.Get(readOnlyCachePrefix + policyCacheKey(handler.Policy.ID)); ok {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// writeError 将写入操作遇到的只读及保管库锁定错误转换为 ErrReadOnly、ErrVaultLocked。
+// 驱动器只读时记录只读状态，设置项 onedrive_readonly_cache_ttl 指定的秒数内的写入直接失败
+func (handler Driver) writeError(ctx context.Context, err error) error {
+	switch {
+	case err == nil, err == ErrReadOnly, err == ErrVaultLocked:
+		return err
+	case IsReadOnly(err):
+		handler.Client.log(ctx).Warning("存储策略[%d]的驱动器为只读，%s", handler.Policy.ID, err)
+		if ttl := model.GetIntSetting("onedrive_readonly_cache_ttl", 300); ttl > 0 && handler.Policy.ID != 0 {
+			_ = cache.Set(readOnlyCachePrefix+policyCacheKey(handler.Policy.ID), true, ttl)
+		}
+		return ErrReadOnly
+	case IsVaultLocked(err):
+		return ErrVaultLocked
+	}
+	return err
+}
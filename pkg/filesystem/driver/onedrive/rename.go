@@ -0,0 +1,105 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidName 名称不符合 OneDrive 的命名规则
+var ErrInvalidName = errors.New("名称不符合 OneDrive 命名规则")
+
+const (
+	// invalidNameChars OneDrive 名称中不允许出现的字符
+	invalidNameChars = `"*:<>?/\|`
+	// maxNameLength OneDrive 名称的最大长度
+	maxNameLength = 255
+)
+
+// reservedNamePattern OneDrive 保留的名称，设备名附带扩展名时同样不允许使用
+var reservedNamePattern = regexp.MustCompile(`(?i)^((con|prn|aux|nul|com[0-9]|lpt[0-9])(\..*)?|\.lock|desktop\.ini)$`)
+
+// ValidateName 检查 name 能否作为 OneDrive 中文件或目录的名称，不符合时返回可由
+// errors.Is(err, ErrInvalidName) 识别的错误
+func ValidateName(name string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w：%s", ErrInvalidName, reason)
+	}
+
+	switch {
+	case name == "" || name == "." || name == "..":
+		return invalid("名称不能为空")
+	case utf8.RuneCountInString(name) > maxNameLength:
+		return invalid(fmt.Sprintf("名称长度不能超过 %d 个字符", maxNameLength))
+	case strings.ContainsAny(name, invalidNameChars):
+		return invalid("名称不能包含以下字符：" + invalidNameChars)
+	case strings.IndexFunc(name, func(r rune) bool { return r < 0x20 || r == 0x7f }) >= 0:
+		return invalid("名称不能包含控制字符")
+	case strings.TrimSpace(name) != name:
+		return invalid("名称不能以空格开头或结尾")
+	case strings.HasSuffix(name, "."):
+		return invalid("名称不能以 . 结尾")
+	case strings.HasPrefix(name, "~$"):
+		return invalid("名称不能以 ~$ 开头")
+	case strings.Contains(strings.ToLower(name), "_vti_"):
+		return invalid("名称不能包含 _vti_")
+	case reservedNamePattern.MatchString(name):
+		return invalid(fmt.Sprintf("%s 为保留名称", name))
+	}
+	return nil
+}
+
+// Rename 将 src 在所在目录内重命名为 newName，仅修改项目的名称属性，
+// 项目ID、版本历史及共享链接保持不变
+func (client *Client) Rename(ctx context.Context, src, newName string) (*FileInfo, error) {
+	requestURL := client.getItemRequestURL(src, "")
+	bodyBytes, _ := json.Marshal(map[string]string{"name": newName})
+
+	res, err := client.requestWithStr(ctx, "PATCH", requestURL, string(bodyBytes), 200)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileInfo FileInfo
+	if err := json.Unmarshal([]byte(res), &fileInfo); err != nil {
+		return nil, err
+	}
+	return &fileInfo, nil
+}
+
+// Rename 将 path 处的文件在原目录内重命名为 newName。与 Move 不同，不会改变所在目录，
+// newName 不符合 OneDrive 命名规则时不发起请求，直接返回错误
+func (handler Driver) Rename(ctx context.Context, path, newName string) error {
+	if err := ValidateName(newName); err != nil {
+		return err
+	}
+	if err := handler.checkWritable(); err != nil {
+		return err
+	}
+
+	if _, err := handler.Client.Rename(ctx, path, newName); err != nil {
+		return handler.writeError(ctx, err)
+	}
+
+	dst := renamedPath(path, newName)
+	invalidateSourceCache(handler.Policy.ID, path)
+	invalidateListCache(handler.Policy.ID, path, dst)
+	invalidateThumbCache(handler.Policy.ID, path, dst)
+	invalidateShortcutCache(handler.Policy.ID, path)
+	invalidateNotFoundCache(handler.Policy.ID, dst)
+	return nil
+}
+
+// renamedPath 获取 src 重命名为 newName 后的路径
+func renamedPath(src, newName string) string {
+	dir := path.Dir(strings.TrimPrefix(src, "/"))
+	if dir == "." {
+		return newName
+	}
+	return path.Join(dir, newName)
+}
@@ -0,0 +1,115 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestValidateName(t *testing.T) {
+	asserts := assert.New(t)
+	testCases := []struct {
+		name  string
+		valid bool
+	}{
+		{"report.docx", true},
+		{"中文 名称.txt", true},
+		{"console.txt", true},
+		{".hidden", true},
+		{"", false},
+		{"..", false},
+		{"a:b.txt", false},
+		{"a/b.txt", false},
+		{`a\b.txt`, false},
+		{"what?.txt", false},
+		{"a\x01b", false},
+		{" leading.txt", false},
+		{"trailing.txt ", false},
+		{"trailing.", false},
+		{"~$lock.docx", false},
+		{"a_vti_b", false},
+		{"CON", false},
+		{"nul.txt", false},
+		{"COM1", false},
+		{"desktop.ini", false},
+		{".lock", false},
+		{strings.Repeat("a", 256), false},
+		{strings.Repeat("中", 255), true},
+	}
+
+	for i, testCase := range testCases {
+		err := ValidateName(testCase.name)
+		if testCase.valid {
+			asserts.NoError(err, "Test Case #%d", i)
+		} else {
+			asserts.True(errors.Is(err, ErrInvalidName), "Test Case #%d", i)
+		}
+	}
+}
+
+func TestDriver_Rename(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Policy.ID = 72
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+
+	// 成功，仅修改名称，清除原文件的缓存
+	{
+		cache.Set(sourceCachePrefix+getSourceCacheKey(72, "dir/old.txt", false), "https://cqu.edu.cn/old", 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "PATCH", "drive/root:/dir/old.txt", testMock.Anything, testMock.Anything).
+			Run(func(args testMock.Arguments) {
+				body := args.Get(2).(*strings.Reader)
+				content := make([]byte, body.Len())
+				body.Read(content)
+				asserts.JSONEq(`{"name":"new.txt"}`, string(content))
+			}).
+			Return(shortcutResponse(200, `{"id":"item-id","name":"new.txt","file":{}}`))
+		handler.Client.Request = clientMock
+		err := handler.Rename(context.Background(), "/dir/old.txt", "new.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		_, ok := cache.Get(sourceCachePrefix + getSourceCacheKey(72, "dir/old.txt", false))
+		asserts.False(ok)
+	}
+
+	// 名称非法，不发起请求
+	{
+		clientMock := ClientMock{}
+		handler.Client.Request = clientMock
+		err := handler.Rename(context.Background(), "dir/old.txt", "new:name.txt")
+		clientMock.AssertExpectations(t)
+		asserts.True(errors.Is(err, ErrInvalidName))
+		asserts.Contains(err.Error(), "名称不能包含以下字符")
+	}
+
+	// 目标名称已存在
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "PATCH", "drive/root:/old.txt", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(409, `{"error":{"code":"nameAlreadyExists","message":"Name already exists"}}`))
+		handler.Client.Request = clientMock
+		err := handler.Rename(context.Background(), "old.txt", "new.txt")
+		clientMock.AssertExpectations(t)
+		asserts.Error(err)
+	}
+}
+
+func TestRenamedPath(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.Equal("new.txt", renamedPath("old.txt", "new.txt"))
+	asserts.Equal("new.txt", renamedPath("/old.txt", "new.txt"))
+	asserts.Equal("a/b/new.txt", renamedPath("/a/b/old.txt", "new.txt"))
+}
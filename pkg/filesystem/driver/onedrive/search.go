@@ -0,0 +1,68 @@
+package onedrive
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// Search 在整个驱动器中搜索名称或内容匹配 keyword 的项目，自动跟随 nextLink 获取所有分页
+func (client *Client) Search(ctx context.Context, keyword string) ([]FileInfo, error) {
+	// OData 字符串字面量中的单引号需转义为两个单引号
+	query := strings.ReplaceAll(keyword, "'", "''")
+	requestURL := client.getDriveRequestURL("root/search(q='"+query+"')") + "?$top=999999999"
+
+	res := make([]FileInfo, 0)
+	for requestURL != "" {
+		select {
+		case <-ctx.Done():
+			util.Log().Debug("OneDrive 客户端取消")
+			return nil, ErrClientCanceled
+		default:
+		}
+
+		page, err := client.listChildrenPage(ctx, "search:"+keyword, requestURL)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, page.Value...)
+		requestURL = page.NextLink
+	}
+
+	return res, nil
+}
+
+// Search 使用 OneDrive 服务端搜索查找 keyword，返回的对象路径以存储策略根目录
+// 作为起始根目录。未返回所在目录路径的项目无法定位，将被忽略
+func (handler Driver) Search(ctx context.Context, keyword string) ([]response.Object, error) {
+	items, err := handler.Client.Search(ctx, keyword)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := fsctx.ListFilter(ctx)
+	res := make([]response.Object, 0, len(items))
+	for _, item := range items {
+		if item.ParentReference.Path == "" || !filter.Match(item.Folder != nil) {
+			continue
+		}
+
+		source := item.GetSourcePath()
+		if source == "" {
+			continue
+		}
+		base := path.Dir(source)
+		if base == "." {
+			base = ""
+		}
+		if obj, ok := toObject(base, "", item); ok {
+			res = append(res, obj)
+		}
+	}
+
+	return res, nil
+}
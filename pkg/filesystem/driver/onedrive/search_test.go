@@ -0,0 +1,84 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestDriver_Search(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	searchResponse := func(body string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			},
+		}
+	}
+
+	// 成功，跟随分页，并以根目录计算相对路径
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root/search%28q=%27report%27%29?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(searchResponse(`{"value":[{"name":"report.doc","size":10,"parentReference":{"path":"/drive/root:"}},{"name":"report","folder":{},"parentReference":{"path":"/drive/root:/my%20dir"}}],"@odata.nextLink":"next"}`))
+		clientMock.On("Request", "GET", "next", testMock.Anything, testMock.Anything).
+			Return(searchResponse(`{"value":[{"name":"old report.txt","parentReference":{"path":"/drives/123/root:/my%20dir/sub"}},{"name":"unknown.txt","parentReference":{}}]}`))
+		handler.Client.Request = clientMock
+		res, err := handler.Search(context.Background(), "report")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Len(res, 3)
+		asserts.Equal("report.doc", res[0].RelativePath)
+		asserts.Equal("report.doc", res[0].Source)
+		asserts.EqualValues(10, res[0].Size)
+		asserts.Equal("my dir/report", res[1].RelativePath)
+		asserts.True(res[1].IsDir)
+		asserts.Equal("my dir/sub/old report.txt", res[2].RelativePath)
+		asserts.Equal("my dir/sub/old report.txt", res[2].Source)
+	}
+
+	// 按类型过滤，关键字中的单引号被转义
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root/search%28q=%27it%27%27s%27%29?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(searchResponse(`{"value":[{"name":"it's.txt","parentReference":{"path":"/drive/root:"}},{"name":"it's","folder":{},"parentReference":{"path":"/drive/root:"}}]}`))
+		handler.Client.Request = clientMock
+		ctx := context.WithValue(context.Background(), fsctx.ListFilterCtx, fsctx.ListFilesOnly)
+		res, err := handler.Search(ctx, "it's")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Len(res, 1)
+		asserts.Equal("it's.txt", res[0].Name)
+	}
+
+	// 请求失败
+	{
+		cache.Set("setting_onedrive_throttle_retries", "0", 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", testMock.Anything, testMock.Anything, testMock.Anything).
+			Return(&request.Response{Err: errors.New("error")})
+		handler.Client.Request = clientMock
+		ctx := context.WithValue(context.Background(), fsctx.RetryCtx, ListRetry)
+		res, err := handler.Search(ctx, "report")
+		asserts.Error(err)
+		asserts.Nil(res)
+	}
+}
@@ -0,0 +1,169 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+// sharedBackend 模拟多个节点共用的分布式缓存，值经过序列化存储
+type sharedBackend struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+// sharedNode 某一节点上连接到 sharedBackend 的缓存存储器
+type sharedNode struct {
+	backend *sharedBackend
+}
+
+type sharedItem struct {
+	Value interface{}
+}
+
+func (node sharedNode) Set(key string, value interface{}, ttl int) error {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(sharedItem{Value: value}); err != nil {
+		return err
+	}
+	node.backend.mu.Lock()
+	defer node.backend.mu.Unlock()
+	node.backend.values[key] = buffer.Bytes()
+	return nil
+}
+
+func (node sharedNode) Get(key string) (interface{}, bool) {
+	node.backend.mu.Lock()
+	raw, ok := node.backend.values[key]
+	node.backend.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	var res sharedItem
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&res); err != nil {
+		return nil, false
+	}
+	return res.Value, true
+}
+
+func (node sharedNode) Gets(keys []string, prefix string) (map[string]interface{}, []string) {
+	res := make(map[string]interface{})
+	var miss []string
+	for _, key := range keys {
+		if value, ok := node.Get(prefix + key); ok {
+			res[key] = value
+		} else {
+			miss = append(miss, key)
+		}
+	}
+	return res, miss
+}
+
+func (node sharedNode) Sets(values map[string]interface{}, prefix string) error {
+	for key, value := range values {
+		if err := node.Set(prefix+key, value, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (node sharedNode) Delete(keys []string, prefix string) error {
+	node.backend.mu.Lock()
+	defer node.backend.mu.Unlock()
+	for _, key := range keys {
+		delete(node.backend.values, prefix+key)
+	}
+	return nil
+}
+
+func TestDriver_SharedCache(t *testing.T) {
+	asserts := assert.New(t)
+	backend := &sharedBackend{values: make(map[string][]byte)}
+	origin := cache.Store
+	defer func() { cache.Store = origin }()
+
+	newNode := func(policyID uint) Driver {
+		handler := Driver{Policy: &model.Policy{}}
+		handler.Policy.ID = policyID
+		handler.Client, _ = NewClient(&model.Policy{})
+		handler.Client.Policy.ID = policyID
+		handler.Client.Credential.AccessToken = "AccessToken"
+		handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+		return handler
+	}
+	nodeA, nodeB := newNode(67), newNode(67)
+
+	// 节点 A 获取外链地址及缩略图后写入共享缓存
+	{
+		cache.Store = sharedNode{backend: backend}
+		cache.Set("setting_onedrive_source_timeout", "1800", 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/a.jpg?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"name":"a.jpg","file":{},"@microsoft.graph.downloadUrl":"https://cqu.edu.cn/a"}`)).Once()
+		clientMock.On("Request", "GET", "drive/root:/a.jpg:/thumbnails?select=c400x300_Crop", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"value":[{"c400x300_Crop":{"url":"https://cqu.edu.cn/thumb"}}]}`)).Once()
+		nodeA.Client.Request = clientMock
+
+		res, err := nodeA.Source(context.Background(), "a.jpg", url.URL{}, 60, false, 0)
+		asserts.NoError(err)
+		asserts.Equal("https://cqu.edu.cn/a", res)
+		thumb, err := nodeA.Thumb(context.Background(), "a.jpg")
+		asserts.NoError(err)
+		asserts.Equal("https://cqu.edu.cn/thumb", thumb.URL)
+		clientMock.AssertExpectations(t)
+	}
+
+	// 节点 B 直接命中共享缓存，不再请求 Graph
+	{
+		cache.Store = sharedNode{backend: backend}
+		clientMock := ClientMock{}
+		nodeB.Client.Request = clientMock
+
+		res, err := nodeB.Source(context.Background(), "a.jpg", url.URL{}, 60, false, 0)
+		asserts.NoError(err)
+		asserts.Equal("https://cqu.edu.cn/a", res)
+		thumb, err := nodeB.Thumb(context.Background(), "a.jpg")
+		asserts.NoError(err)
+		asserts.Equal("https://cqu.edu.cn/thumb", thumb.URL)
+		clientMock.AssertExpectations(t)
+	}
+
+	// 其他存储策略下的同名文件不会命中
+	{
+		other := newNode(68)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/a.jpg?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"name":"a.jpg","file":{},"@microsoft.graph.downloadUrl":"https://cqu.edu.cn/other"}`)).Once()
+		other.Client.Request = clientMock
+		res, err := other.Source(context.Background(), "a.jpg", url.URL{}, 60, false, 0)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("https://cqu.edu.cn/other", res)
+	}
+
+	// 节点 B 删除文件后，节点 A 的缓存一并失效
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", testMock.Anything, testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"responses":[{"id":"1","status":204}]}`))
+		nodeB.Client.Request = clientMock
+		_, err := nodeB.Delete(context.Background(), []string{"a.jpg"})
+		asserts.NoError(err)
+
+		_, ok := cache.Get(sourceCachePrefix + getSourceCacheKey(67, "a.jpg", false))
+		asserts.False(ok)
+		_, ok = getCachedThumb(67, "a.jpg", 400, 300)
+		asserts.False(ok)
+	}
+}
@@ -0,0 +1,233 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+const (
+	// shortcutCachePrefix 快捷方式指向项目缓存的键前缀
+	shortcutCachePrefix = "onedrive_shortcut_"
+	// maxShortcutDepth 单个路径中最多可经过的快捷方式数量，超出时视为循环引用
+	maxShortcutDepth = 8
+)
+
+const (
+	// MetadataShortcutKey 对象元数据中标记快捷方式解析状态的键
+	MetadataShortcutKey = "onedrive_shortcut"
+	// ShortcutResolved 快捷方式已解析为其指向的项目
+	ShortcutResolved = "resolved"
+	// ShortcutBroken 快捷方式指向的项目不可用或存在循环引用
+	ShortcutBroken = "broken"
+)
+
+var (
+	// ErrBrokenShortcut 快捷方式指向的项目不可用
+	ErrBrokenShortcut = errors.New("快捷方式指向的项目不可用")
+	// ErrShortcutCycle 快捷方式存在循环引用
+	ErrShortcutCycle = errors.New("快捷方式存在循环引用")
+)
+
+// getShortcutCacheKey 获取快捷方式指向项目的缓存键（不含前缀）
+func getShortcutCacheKey(policyID uint, p string) string {
+	return policyPathCacheKey(policyID, p)
+}
+
+// policyID 获取客户端所属存储策略的ID
+func (client *Client) policyID() uint {
+	if client.Policy == nil {
+		return 0
+	}
+	return client.Policy.ID
+}
+
+// getShortcutTarget 获取 p 处快捷方式所指向的项目
+func (client *Client) getShortcutTarget(p string) (ShortcutTarget, bool) {
+	raw, ok := cache.Get(shortcutCachePrefix + getShortcutCacheKey(client.policyID(), p))
+	if !ok {
+		return ShortcutTarget{}, false
+	}
+	target, ok := raw.(ShortcutTarget)
+	return target, ok
+}
+
+// setShortcutTarget 记录 p 处快捷方式所指向的项目
+func (client *Client) setShortcutTarget(p string, target ShortcutTarget) {
+	_ = cache.Set(
+		shortcutCachePrefix+getShortcutCacheKey(client.policyID(), p),
+		target,
+		model.GetIntSetting("onedrive_shortcut_cache_ttl", 3600),
+	)
+}
+
+// invalidateShortcutCache 清除给定路径处记录的快捷方式，删除、移动文件后应调用此方法
+func invalidateShortcutCache(policyID uint, paths ...string) {
+	keys := make([]string, 0, len(paths))
+	for _, p := range paths {
+		keys = append(keys, getShortcutCacheKey(policyID, p))
+	}
+	cache.Deletes(keys, shortcutCachePrefix)
+}
+
+// shortcutChain 获取 dst 及其各级上级目录中已记录的快捷方式，按路径由浅至深排列，
+// 同时返回最深一层快捷方式之下的相对路径
+func (client *Client) shortcutChain(dst string) ([]ShortcutTarget, string) {
+	dst = strings.Trim(dst, "/")
+	if dst == "" {
+		return nil, ""
+	}
+
+	var (
+		chain []ShortcutTarget
+		rest  = dst
+	)
+	segments := strings.Split(dst, "/")
+	for i := range segments {
+		if target, ok := client.getShortcutTarget(strings.Join(segments[:i+1], "/")); ok {
+			chain = append(chain, target)
+			rest = strings.Join(segments[i+1:], "/")
+		}
+	}
+	return chain, rest
+}
+
+// getItemRequestURL 获取 dst 处项目的请求URL，api 非空时为该项目下的接口。
+// dst 位于已记录的快捷方式之下时，改为请求快捷方式所指向的驱动器及项目
+func (client *Client) getItemRequestURL(dst, api string) string {
+	dst = strings.Trim(dst, "/")
+	chain, rest := client.shortcutChain(dst)
+	if len(chain) == 0 {
+		if dst == "" {
+			return client.getDriveRequestURL(path.Join("root", api))
+		}
+		if api == "" {
+			return client.getDriveRequestURL("root:/" + dst)
+		}
+		return client.getDriveRequestURL("root:/" + dst + ":/" + api)
+	}
+
+	target := chain[len(chain)-1]
+	item := "items/" + target.ID
+	switch {
+	case rest == "":
+		return client.getDrivesRequestURL(target.DriveID, path.Join(item, api))
+	case api == "":
+		return client.getDrivesRequestURL(target.DriveID, item+":/"+rest)
+	default:
+		return client.getDrivesRequestURL(target.DriveID, item+":/"+rest+":/"+api)
+	}
+}
+
+// checkShortcut 检查位于 dir 下、指向 target 的快捷方式能否被跟随。
+// 指向路径中已经过的快捷方式，或经过的快捷方式过多时视为循环引用
+func (client *Client) checkShortcut(dir string, target ShortcutTarget) error {
+	if target.ID == "" || target.DriveID == "" {
+		return ErrBrokenShortcut
+	}
+
+	chain, _ := client.shortcutChain(dir)
+	if len(chain) >= maxShortcutDepth {
+		return ErrShortcutCycle
+	}
+	for _, passed := range chain {
+		if passed == target {
+			return ErrShortcutCycle
+		}
+	}
+	return nil
+}
+
+// resolveShortcut 获取 dir 下快捷方式 shortcut 所指向的项目，并记录该快捷方式
+func (client *Client) resolveShortcut(ctx context.Context, dir string, shortcut *FileInfo) (*FileInfo, error) {
+	target := shortcut.RemoteItem.target()
+	if err := client.checkShortcut(dir, target); err != nil {
+		return nil, err
+	}
+
+	info, err := client.getItem(ctx, client.getDrivesRequestURL(target.DriveID, "items/"+target.ID))
+	if err != nil {
+		return nil, err
+	}
+	if info.Deleted != nil || (info.Folder == nil && info.File == nil) {
+		return nil, ErrBrokenShortcut
+	}
+
+	client.setShortcutTarget(path.Join(dir, shortcut.Name), target)
+	return info, nil
+}
+
+// followShortcut 获取 dst 处快捷方式所指向的项目，名称沿用快捷方式的名称
+func (client *Client) followShortcut(ctx context.Context, dst string, shortcut *FileInfo) (*FileInfo, error) {
+	dir := path.Dir(dst)
+	if dir == "." {
+		dir = ""
+	}
+
+	info, err := client.resolveShortcut(ctx, dir, shortcut)
+	if err != nil {
+		return nil, err
+	}
+	info.Name = shortcut.Name
+	info.Shortcut = ShortcutResolved
+	return info, nil
+}
+
+// resolveShortcuts 将 dir 下列取结果中的快捷方式替换为其指向项目的信息，
+// 无法解析的快捷方式保留原样并标记为不可用，不影响其他项目
+func (client *Client) resolveShortcuts(ctx context.Context, dir string, items []FileInfo) []FileInfo {
+	for i := range items {
+		item := &items[i]
+		if item.RemoteItem == nil {
+			continue
+		}
+
+		resolved, err := client.resolveShortcut(ctx, dir, item)
+		if err != nil {
+			util.Log().Debug("无法解析快捷方式[%s]，%s", path.Join(dir, item.Name), err)
+			item.Shortcut = ShortcutBroken
+			continue
+		}
+
+		item.Shortcut = ShortcutResolved
+		item.Size = resolved.Size
+		item.File = resolved.File
+		item.Folder = resolved.Folder
+		item.DownloadURL = resolved.DownloadURL
+	}
+	return items
+}
+
+// discoverShortcuts 路径请求返回不存在时调用，检查 dst 的各级上级目录中是否有尚未记录的快捷方式，
+// 记录到新的快捷方式时返回 true，调用方应重新发起请求
+func (client *Client) discoverShortcuts(ctx context.Context, dst string) bool {
+	segments := strings.Split(strings.Trim(dst, "/"), "/")
+	found := false
+	for i := 1; i < len(segments); i++ {
+		dir := strings.Join(segments[:i-1], "/")
+		current := strings.Join(segments[:i], "/")
+		if _, ok := client.getShortcutTarget(current); ok {
+			continue
+		}
+
+		info, err := client.getItem(ctx, client.getItemRequestURL(current, ""))
+		if err != nil {
+			// 上级目录不存在，无需继续检查
+			return found
+		}
+		if info.RemoteItem == nil {
+			continue
+		}
+		if _, err := client.resolveShortcut(ctx, dir, info); err != nil {
+			util.Log().Debug("无法解析快捷方式[%s]，%s", current, err)
+			return found
+		}
+		found = true
+	}
+	return found
+}
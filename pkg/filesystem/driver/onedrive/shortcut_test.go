@@ -0,0 +1,206 @@
+package onedrive
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func shortcutResponse(status int, body string) *request.Response {
+	return &request.Response{
+		Response: &http.Response{
+			StatusCode: status,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		},
+	}
+}
+
+func TestClient_GetItemRequestURL(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	client.Policy.ID = 63
+
+	// 不经过快捷方式
+	{
+		asserts.Equal("drive/root", client.getItemRequestURL("", ""))
+		asserts.Equal("drive/root/children", client.getItemRequestURL("/", "children"))
+		asserts.Equal("drive/root:/dir/a.txt", client.getItemRequestURL("dir/a.txt", ""))
+		asserts.Equal("drive/root:/dir:/children", client.getItemRequestURL("dir", "children"))
+	}
+
+	// 经过快捷方式时改为请求其指向的项目，多层快捷方式以最深一层为准
+	{
+		client.setShortcutTarget("dir/shared", ShortcutTarget{DriveID: "d1", ID: "i1"})
+		client.setShortcutTarget("dir/shared/inner", ShortcutTarget{DriveID: "d2", ID: "i2"})
+		asserts.Equal("drives/d1/items/i1", client.getItemRequestURL("dir/shared", ""))
+		asserts.Equal("drives/d1/items/i1/children", client.getItemRequestURL("/dir/shared/", "children"))
+		asserts.Equal("drives/d1/items/i1:/sub/a.txt", client.getItemRequestURL("dir/shared/sub/a.txt", ""))
+		asserts.Equal("drives/d1/items/i1:/sub:/children", client.getItemRequestURL("dir/shared/sub", "children"))
+		asserts.Equal("drives/d2/items/i2:/b.txt", client.getItemRequestURL("dir/shared/inner/b.txt", ""))
+	}
+
+	// 循环引用检测
+	{
+		asserts.Equal(ErrBrokenShortcut, client.checkShortcut("dir", ShortcutTarget{ID: "i1"}))
+		asserts.NoError(client.checkShortcut("dir", ShortcutTarget{DriveID: "d1", ID: "i1"}))
+		asserts.Equal(ErrShortcutCycle, client.checkShortcut("dir/shared/sub", ShortcutTarget{DriveID: "d1", ID: "i1"}))
+		asserts.NoError(client.checkShortcut("dir/shared/sub", ShortcutTarget{DriveID: "d3", ID: "i3"}))
+	}
+
+	// 删除后清除记录
+	{
+		invalidateShortcutCache(63, "/dir/shared")
+		asserts.Equal("drive/root:/dir/shared/sub/a.txt", client.getItemRequestURL("dir/shared/sub/a.txt", ""))
+	}
+}
+
+func TestDriver_List_Shortcut(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Policy.ID = 64
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Policy.ID = 64
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	ctx := context.WithValue(context.Background(), fsctx.RetryCtx, ListRetry)
+
+	// 递归列取时跟随快捷方式，不可用及循环引用的快捷方式被标记
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/dir:/children?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"value":[
+				{"name":"a.txt","size":1,"file":{}},
+				{"name":"shared","remoteItem":{"id":"i1","folder":{},"parentReference":{"driveId":"d1"}}},
+				{"name":"gone","remoteItem":{"id":"i2","file":{},"parentReference":{"driveId":"d2"}}},
+				{"name":"invalid","remoteItem":{"id":"i3"}}
+			]}`))
+		clientMock.On("Request", "GET", "drives/d1/items/i1?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"id":"i1","name":"Team","size":30,"folder":{"childCount":2}}`))
+		clientMock.On("Request", "GET", "drives/d2/items/i2?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(404, `{"error":{"code":"itemNotFound"}}`))
+		clientMock.On("Request", "GET", "drives/d1/items/i1/children?$top=999999999", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"value":[
+				{"name":"doc.txt","size":30,"file":{}},
+				{"name":"loop","remoteItem":{"id":"i1","folder":{},"parentReference":{"driveId":"d1"}}}
+			]}`))
+		handler.Client.Request = clientMock
+		res, err := handler.List(ctx, "dir", true)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Len(res, 6)
+
+		objects := make(map[string]int)
+		for i, obj := range res {
+			objects[obj.RelativePath] = i
+		}
+		shared := res[objects["shared"]]
+		asserts.True(shared.IsDir)
+		asserts.EqualValues(30, shared.Size)
+		asserts.Equal(ShortcutResolved, shared.Metadata[MetadataShortcutKey])
+		asserts.Equal("dir/shared/doc.txt", res[objects["shared/doc.txt"]].Source)
+		asserts.Equal(ShortcutBroken, res[objects["gone"]].Metadata[MetadataShortcutKey])
+		asserts.Equal(ShortcutBroken, res[objects["invalid"]].Metadata[MetadataShortcutKey])
+		asserts.False(res[objects["shared/loop"]].IsDir)
+		asserts.Equal(ShortcutBroken, res[objects["shared/loop"]].Metadata[MetadataShortcutKey])
+		asserts.Nil(res[objects["a.txt"]].Metadata)
+	}
+
+	// 已记录的快捷方式下的文件直接请求其指向的项目
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drives/d1/items/i1:/doc.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"name":"doc.txt","size":30,"file":{},"@microsoft.graph.downloadUrl":"https://cqu.edu.cn/doc"}`))
+		handler.Client.Request = clientMock
+		cache.Set("setting_onedrive_source_timeout", "1800", 0)
+		res, err := handler.Source(context.Background(), "/dir/shared/doc.txt", url.URL{}, 60, false, 0)
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("https://cqu.edu.cn/doc", res)
+	}
+}
+
+func TestClient_Meta_Shortcut(t *testing.T) {
+	asserts := assert.New(t)
+	client, _ := NewClient(&model.Policy{})
+	client.Policy.ID = 65
+	client.Credential.AccessToken = "AccessToken"
+	client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+
+	// 获取快捷方式本身时返回其指向的文件
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/link.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"name":"link.txt","remoteItem":{"id":"i1","file":{},"parentReference":{"driveId":"d1"}}}`))
+		clientMock.On("Request", "GET", "drives/d1/items/i1?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"name":"real.txt","size":10,"file":{},"@microsoft.graph.downloadUrl":"download"}`))
+		client.Request = clientMock
+		res, err := client.Meta(context.Background(), "", "/link.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("link.txt", res.Name)
+		asserts.Equal("download", res.DownloadURL)
+		asserts.EqualValues(10, res.Size)
+	}
+
+	// 路径经过尚未记录的快捷方式时，查找上级目录中的快捷方式后重试
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/dir/cold/doc.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(404, `{"error":{"code":"itemNotFound"}}`))
+		clientMock.On("Request", "GET", "drive/root:/dir?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"name":"dir","folder":{}}`))
+		clientMock.On("Request", "GET", "drive/root:/dir/cold?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"name":"cold","remoteItem":{"id":"i2","folder":{},"parentReference":{"driveId":"d2"}}}`))
+		clientMock.On("Request", "GET", "drives/d2/items/i2?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"name":"Shared","folder":{}}`))
+		clientMock.On("Request", "GET", "drives/d2/items/i2:/doc.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"name":"doc.txt","file":{}}`))
+		client.Request = clientMock
+		res, err := client.Meta(context.Background(), "", "dir/cold/doc.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("doc.txt", res.Name)
+	}
+
+	// 文件确实不存在
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/none/doc.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(404, `{"error":{"code":"itemNotFound"}}`))
+		clientMock.On("Request", "GET", "drive/root:/none?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(404, `{"error":{"code":"itemNotFound"}}`))
+		client.Request = clientMock
+		_, err := client.Meta(context.Background(), "", "none/doc.txt")
+		clientMock.AssertExpectations(t)
+		asserts.True(IsNotFound(err))
+	}
+
+	// 快捷方式指向的项目不可用
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/broken.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"name":"broken.txt","remoteItem":{"id":"i3","parentReference":{"driveId":"d3"}}}`))
+		clientMock.On("Request", "GET", "drives/d3/items/i3?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"name":"deleted","deleted":{"state":"deleted"}}`))
+		client.Request = clientMock
+		_, err := client.Meta(context.Background(), "", "broken.txt")
+		clientMock.AssertExpectations(t)
+		asserts.Equal(ErrBrokenShortcut, err)
+	}
+}
@@ -0,0 +1,219 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+)
+
+// SourceBatchError 批量获取外链地址时部分文件失败，Errors 为各失败文件遇到的错误
+type SourceBatchError struct {
+	Errors map[string]error
+}
+
+// Error 实现error接口
+func (err *SourceBatchError) Error() string {
+	paths := make([]string, 0, len(err.Errors))
+	for path := range err.Errors {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return fmt.Sprintf("%d 个文件无法获取外链地址：%s", len(paths), strings.Join(paths, ", "))
+}
+
+// MetaBatch 通过 $batch 接口一次获取 paths 的元信息，返回各文件的元信息及失败文件遇到的错误。
+// 由于API限制，最多获取 MaxBatchRequests 个
+func (client *Client) MetaBatch(ctx context.Context, paths []string) (map[string]*FileInfo, map[string]error) {
+	infos := make(map[string]*FileInfo, len(paths))
+	requestURLs := make([]string, len(paths))
+	for i, path := range paths {
+		requestURLs[i] = client.getItemRequestURL(strings.TrimPrefix(path, "/"), "")
+	}
+
+	failed := client.batchGet(ctx, paths, requestURLs, func(path string, body json.RawMessage) error {
+		var info FileInfo
+		if err := json.Unmarshal(body, &info); err != nil {
+			return err
+		}
+		infos[path] = &info
+		return nil
+	})
+	return infos, failed
+}
+
+// batchGet 通过 $batch 接口一次发送 requestURLs 的 GET 请求，requestURLs 与 paths 一一对应。
+// 各成功的响应交由 handle 处理，返回各失败文件遇到的错误，未出现在响应中的请求视为失败
+func (client *Client) batchGet(ctx context.Context, paths, requestURLs []string, handle func(path string, body json.RawMessage) error) map[string]error {
+	failed := make(map[string]error)
+
+	req := BatchRequests{Requests: make([]BatchRequest, len(requestURLs))}
+	for i, requestURL := range requestURLs {
+		req.Requests[i] = BatchRequest{
+			ID:     strconv.Itoa(i),
+			Method: "GET",
+			URL:    batchRequestPath(requestURL),
+		}
+	}
+	body, _ := json.Marshal(req)
+
+	res, respErr := client.requestWithStr(ctx, "POST", client.getBatchRequestURL(), string(body), 200)
+	if respErr != nil {
+		for _, path := range paths {
+			failed[path] = respErr
+		}
+		return failed
+	}
+
+	var batchRes BatchResponses
+	if err := json.Unmarshal([]byte(res), &batchRes); err != nil {
+		for _, path := range paths {
+			failed[path] = err
+		}
+		return failed
+	}
+
+	handled := make(map[string]bool, len(paths))
+	for _, v := range batchRes.Responses {
+		i, err := strconv.Atoi(v.ID)
+		if err != nil || i < 0 || i >= len(paths) {
+			continue
+		}
+		handled[paths[i]] = true
+
+		if v.Status != 200 {
+			itemErr := &RespError{}
+			json.Unmarshal(v.Body, itemErr)
+			itemErr.Status = v.Status
+			itemErr.RequestID = itemErr.APIError.InnerError.RequestID
+			failed[paths[i]] = itemErr
+			continue
+		}
+
+		if err := handle(paths[i], v.Body); err != nil {
+			failed[paths[i]] = err
+		}
+	}
+
+	for _, path := range paths {
+		if !handled[path] {
+			failed[path] = &RespError{APIError: APIError{Code: "batch", Message: "批量请求未返回此文件的响应"}}
+		}
+	}
+
+	return failed
+}
+
+// batchRequestPath 将接口请求URL转换为 $batch 中单个请求使用的相对地址
+func batchRequestPath(requestURL string) string {
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return requestURL
+	}
+	u.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(u.Path, "/v1.0"), "/")
+	res := u.EscapedPath()
+	if u.RawQuery != "" {
+		res += "?" + u.RawQuery
+	}
+	return res
+}
+
+// SourceBatch 批量获取 paths 的预览外链地址，用于预热外链地址缓存。已缓存的地址直接返回，其余文件按
+// MaxBatchRequests 个一组通过 $batch 接口获取元信息，并写入与 Source 相同的缓存。快捷方式等未直接
+// 返回下载地址的文件，以及路径可能经过尚未记录的快捷方式时，改用 Source 单独获取。
+// 部分文件失败时仍返回其余文件的地址，并返回 *SourceBatchError。
+// 存储策略启用加密时没有可用的直链，所有文件均以 ErrEncryptedDirectLink 失败
+func (handler Driver) SourceBatch(ctx context.Context, paths []string, ttl int64) (map[string]string, error) {
+	urls := make(map[string]string, len(paths))
+	failed := make(map[string]error)
+	if aead, err := handler.encryptionAEAD(); err != nil || aead != nil {
+		if err == nil {
+			err = ErrEncryptedDirectLink
+		}
+		for _, path := range paths {
+			failed[path] = err
+		}
+		return urls, &SourceBatchError{Errors: failed}
+	}
+	setURL := func(path, origin string) {
+		urls[path] = handler.replaceSourceHost(origin)
+	}
+
+	// 先从缓存中查找，并去除重复的路径
+	pending := make([]string, 0, len(paths))
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		if cachedURL, ok := cache.Get(sourceCachePrefix + getSourceCacheKey(handler.Policy.ID, path, false)); ok {
+			setURL(path, cachedURL.(string))
+			continue
+		}
+		pending = append(pending, path)
+	}
+
+	var fallback []string
+	for start := 0; start < len(pending); start += MaxBatchRequests {
+		end := start + MaxBatchRequests
+		if end > len(pending) {
+			end = len(pending)
+		}
+		group := pending[start:end]
+
+		if err := ctx.Err(); err != nil {
+			for _, path := range pending[start:] {
+				failed[path] = err
+			}
+			break
+		}
+
+		infos, errs := handler.Client.MetaBatch(ctx, group)
+		for _, path := range group {
+			if err, ok := errs[path]; ok {
+				if IsNotFound(err) {
+					// 路径可能经过尚未记录的快捷方式
+					fallback = append(fallback, path)
+				} else {
+					failed[path] = err
+				}
+				continue
+			}
+
+			info := infos[path]
+			if info.DownloadURL == "" || info.RemoteItem != nil {
+				fallback = append(fallback, path)
+				continue
+			}
+
+			cache.Set(
+				sourceCachePrefix+getSourceCacheKey(handler.Policy.ID, path, false),
+				info.DownloadURL,
+				model.GetIntSetting("onedrive_source_timeout", 1800),
+			)
+			setURL(path, info.DownloadURL)
+		}
+	}
+
+	for _, path := range fallback {
+		res, err := handler.Source(ctx, path, url.URL{}, ttl, false, 0)
+		if err != nil {
+			failed[path] = err
+			continue
+		}
+		urls[path] = res
+	}
+
+	if len(failed) > 0 {
+		return urls, &SourceBatchError{Errors: failed}
+	}
+	return urls, nil
+}
@@ -0,0 +1,152 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+// batchMetaRecorder 记录每个 $batch 请求中包含的请求数，路径含 missing 的文件不存在，含 denied 的文件无权访问
+type batchMetaRecorder struct {
+	batches *[]int
+	single  *[]string
+}
+
+func (m batchMetaRecorder) Request(method, target string, body io.Reader, opts ...request.Option) *request.Response {
+	if !strings.HasSuffix(target, "$batch") {
+		*m.single = append(*m.single, target)
+		return shortcutResponse(404, `{"error":{"code":"itemNotFound"}}`)
+	}
+
+	var req BatchRequests
+	data, _ := ioutil.ReadAll(body)
+	json.Unmarshal(data, &req)
+	*m.batches = append(*m.batches, len(req.Requests))
+
+	responses := make([]string, 0, len(req.Requests))
+	for _, r := range req.Requests {
+		switch {
+		case strings.Contains(r.URL, "missing"):
+			responses = append(responses, fmt.Sprintf(`{"id":"%s","status":404,"body":{"error":{"code":"itemNotFound"}}}`, r.ID))
+		case strings.Contains(r.URL, "denied"):
+			responses = append(responses, fmt.Sprintf(`{"id":"%s","status":403,"body":{"error":{"code":"accessDenied"}}}`, r.ID))
+		default:
+			responses = append(responses, fmt.Sprintf(`{"id":"%s","status":200,"body":{"name":"a","file":{},"@microsoft.graph.downloadUrl":"https://cqu.edu.cn%s"}}`, r.ID, r.URL))
+		}
+	}
+	return shortcutResponse(200, `{"responses":[`+strings.Join(responses, ",")+`]}`)
+}
+
+func TestBatchRequestPath(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.Equal("/drive/root:/dir/a.txt", batchRequestPath("drive/root:/dir/a.txt"))
+	asserts.Equal("/me/drive/root:/a%20b.txt", batchRequestPath("https://graph.microsoft.com/v1.0/me/drive/root:/a b.txt"))
+	asserts.Equal("/drives/d1/items/i1?expand=thumbnails", batchRequestPath("https://graph.microsoft.com/v1.0/drives/d1/items/i1?expand=thumbnails"))
+}
+
+func TestDriver_SourceBatch(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Policy.ID = 75
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Policy.ID = 75
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_source_timeout", "1800", 0)
+
+	// 25 个文件分两组批量获取，部分文件失败不影响其余文件
+	{
+		var (
+			batches []int
+			single  []string
+		)
+		handler.Client.Request = batchMetaRecorder{batches: &batches, single: &single}
+		paths := make([]string, 0, 25)
+		for i := 0; i < 23; i++ {
+			paths = append(paths, fmt.Sprintf("dir/%d.txt", i))
+		}
+		paths = append(paths, "dir/missing.txt", "/dir/denied.txt")
+
+		res, err := handler.SourceBatch(context.Background(), paths, 60)
+		asserts.Equal([]int{20, 5}, batches)
+		asserts.Len(res, 23)
+		asserts.Equal("https://cqu.edu.cn/drive/root:/dir/0.txt", res["dir/0.txt"])
+		asserts.Equal("https://cqu.edu.cn/drive/root:/dir/22.txt", res["dir/22.txt"])
+
+		var batchErr *SourceBatchError
+		asserts.True(errors.As(err, &batchErr))
+		asserts.Len(batchErr.Errors, 2)
+		asserts.True(IsNotFound(batchErr.Errors["dir/missing.txt"]))
+		respErr, ok := asRespError(batchErr.Errors["/dir/denied.txt"])
+		asserts.True(ok)
+		asserts.Equal(403, respErr.Status)
+		asserts.Equal("accessDenied", respErr.APIError.Code)
+
+		// 不存在的文件改用 Source 单独获取，以防路径经过快捷方式
+		asserts.Contains(single, "drive/root:/dir/missing.txt?expand=thumbnails")
+
+		// 写入与 Source 相同的缓存
+		cached, ok := cache.Get(sourceCachePrefix + getSourceCacheKey(75, "dir/5.txt", false))
+		asserts.True(ok)
+		asserts.Equal("https://cqu.edu.cn/drive/root:/dir/5.txt", cached)
+	}
+
+	// 已缓存的文件不再请求
+	{
+		var (
+			batches []int
+			single  []string
+		)
+		handler.Client.Request = batchMetaRecorder{batches: &batches, single: &single}
+		res, err := handler.SourceBatch(context.Background(), []string{"dir/1.txt", "dir/1.txt", "dir/2.txt"}, 60)
+		asserts.NoError(err)
+		asserts.Empty(batches)
+		asserts.Empty(single)
+		asserts.Len(res, 2)
+
+		source, err := handler.Source(context.Background(), "dir/2.txt", url.URL{}, 60, false, 0)
+		asserts.NoError(err)
+		asserts.Equal(res["dir/2.txt"], source)
+	}
+
+	// 整个批量请求失败
+	{
+		handler.Client.Credential.ExpiresIn = 0
+		res, err := handler.SourceBatch(context.Background(), []string{"dir/new.txt"}, 60)
+		asserts.Empty(res)
+		var batchErr *SourceBatchError
+		asserts.True(errors.As(err, &batchErr))
+		asserts.Error(batchErr.Errors["dir/new.txt"])
+	}
+
+	// ctx 已结束时不再发送请求
+	{
+		var (
+			batches []int
+			single  []string
+		)
+		handler.Client.Request = batchMetaRecorder{batches: &batches, single: &single}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := handler.SourceBatch(ctx, []string{"dir/other.txt"}, 60)
+		asserts.Empty(batches)
+		var batchErr *SourceBatchError
+		asserts.True(errors.As(err, &batchErr))
+		asserts.Equal(context.Canceled, batchErr.Errors["dir/other.txt"])
+	}
+}
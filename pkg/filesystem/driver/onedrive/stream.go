@@ -0,0 +1,137 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// ErrResumeOffsetMismatch 续传响应的起始位置与已读取的位置不一致
+var ErrResumeOffsetMismatch = errors.New("续传响应的起始位置与请求不一致")
+
+// resumableBody 中转下载的文件数据流。大文件的下载地址可能在慢速客户端读完前过期，
+// 此时重新获取下载地址，并从已读取的位置按范围续传
+type resumableBody struct {
+	ctx     context.Context
+	handler Driver
+	path    string
+	body    io.ReadCloser
+	// offset 下一个待读取字节在文件中的位置
+	offset int64
+	// end 本次请求范围的结束位置（不含），长度未知时为 -1
+	end int64
+	// retries 剩余可续传次数
+	retries int
+}
+
+// newResumableBody 包装下载响应的正文，无法确定响应对应的字节范围时原样返回
+func newResumableBody(ctx context.Context, handler Driver, path string, resp *http.Response) io.ReadCloser {
+	start, end, ok := responseRange(resp)
+	if !ok {
+		return resp.Body
+	}
+
+	return &resumableBody{
+		ctx:     ctx,
+		handler: handler,
+		path:    path,
+		body:    resp.Body,
+		offset:  start,
+		end:     end,
+		retries: model.GetIntSetting("onedrive_download_retries", 3),
+	}
+}
+
+// responseRange 解析响应正文对应的文件字节范围 [start, end)，长度未知时 end 为 -1
+func responseRange(resp *http.Response) (start, end int64, ok bool) {
+	if resp.StatusCode != http.StatusPartialContent {
+		if resp.ContentLength < 0 {
+			return 0, -1, true
+		}
+		return 0, resp.ContentLength, true
+	}
+
+	var last int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d", &start, &last); err != nil {
+		return 0, 0, false
+	}
+	return start, last + 1, true
+}
+
+// Read 读取数据，数据流中断时尝试续传
+func (r *resumableBody) Read(p []byte) (int, error) {
+	for {
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if err == nil || (err == io.EOF && (r.end < 0 || r.offset >= r.end)) {
+			return n, err
+		}
+
+		// 先交付已读取的数据，下一次读取时再处理中断
+		if n > 0 {
+			return n, nil
+		}
+
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if r.retries <= 0 || r.ctx.Err() != nil {
+			return 0, err
+		}
+		r.retries--
+
+		util.Log().Debug("文件[%s]的数据流在 %d 处中断，%s，尝试续传", r.path, r.offset, err)
+		if resumeErr := r.resume(); resumeErr != nil {
+			util.Log().Warning("无法续传文件[%s]，%s", r.path, resumeErr)
+			return 0, err
+		}
+	}
+}
+
+// resume 重新获取下载地址，从已读取的位置请求剩余数据
+func (r *resumableBody) resume() error {
+	r.body.Close()
+
+	// 原有下载地址可能已过期，清除缓存以获取新的地址
+	invalidateSourceCache(r.handler.Policy.ID, r.path)
+	downloadURL, err := r.handler.directURL(r.ctx, r.path, false)
+	if err != nil {
+		return err
+	}
+
+	rangeHeader := fmt.Sprintf("bytes=%d-", r.offset)
+	if r.end >= 0 {
+		rangeHeader += strconv.FormatInt(r.end-1, 10)
+	}
+
+	res, err := r.handler.getFollowingRedirects(r.ctx, downloadURL, rangeHeader)
+	if err != nil {
+		return err
+	}
+	res = res.CheckHTTPResponse(http.StatusPartialContent)
+	if res.Err != nil {
+		if res.Response != nil {
+			res.Response.Body.Close()
+		}
+		return res.Err
+	}
+
+	if start, _, ok := responseRange(res.Response); !ok || start != r.offset {
+		res.Response.Body.Close()
+		return ErrResumeOffsetMismatch
+	}
+
+	r.body = res.Response.Body
+	return nil
+}
+
+// Close 关闭当前的数据流
+func (r *resumableBody) Close() error {
+	return r.body.Close()
+}
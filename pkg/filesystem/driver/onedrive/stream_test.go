@@ -0,0 +1,318 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+// expiringServer 首次请求只返回一半数据后断开连接，此后的请求均返回 403，
+// 模拟下载地址在传输中途过期
+func expiringServer(content string) *httptest.Server {
+	requested := false
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requested {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		requested = true
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(content[:len(content)/2]))
+		w.(http.Flusher).Flush()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+}
+
+func TestDriver_Get_Resume(t *testing.T) {
+	asserts := assert.New(t)
+	content := strings.Repeat("0123456789", 1000)
+	var freshRange []string
+	fresh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		freshRange = append(freshRange, r.Header.Get("Range"))
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer fresh.Close()
+
+	handler := Driver{
+		Policy:     &model.Policy{},
+		HTTPClient: request.HTTPClient{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	handler.Client.Credential.AccessToken = "1"
+	cache.Set("setting_onedrive_download_retries", "1", 0)
+	cache.Set("setting_onedrive_source_timeout", "1800", 0)
+	ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, model.File{Size: uint64(len(content))})
+	metaResponse := func() *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"@microsoft.graph.downloadUrl":"` + fresh.URL + `"}`)),
+			},
+		}
+	}
+
+	// 中途过期后重新获取地址并续传
+	{
+		expired := expiringServer(content)
+		cache.Set("onedrive_source_0_preview_big.txt", expired.URL, 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/big.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(metaResponse())
+		handler.Client.Request = clientMock
+
+		res, err := handler.Get(ctx, "big.txt")
+		asserts.NoError(err)
+		_, err = res.Seek(0, io.SeekEnd)
+		asserts.NoError(err)
+		body, err := ioutil.ReadAll(res)
+		res.Close()
+		expired.Close()
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal(content, string(body))
+		asserts.Equal([]string{"bytes=5000-9999"}, freshRange)
+
+		// 新的下载地址写入缓存
+		cached, ok := cache.Get("onedrive_source_0_preview_big.txt")
+		asserts.True(ok)
+		asserts.Equal(fresh.URL, cached)
+	}
+
+	// 按范围获取时，续传不超出原有范围
+	{
+		freshRange = nil
+		expired := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", "bytes 1000-1999/10000")
+			w.Header().Set("Content-Length", "1000")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte(content[1000:1500]))
+			w.(http.Flusher).Flush()
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}))
+		cache.Set("onedrive_source_0_preview_big.txt", expired.URL, 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/big.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(metaResponse())
+		handler.Client.Request = clientMock
+
+		res, err := handler.Get(context.WithValue(ctx, fsctx.RangeCtx, "bytes=1000-1999"), "big.txt")
+		asserts.NoError(err)
+		_, err = res.Seek(0, io.SeekEnd)
+		asserts.NoError(err)
+		body, err := ioutil.ReadAll(res)
+		res.Close()
+		expired.Close()
+		asserts.NoError(err)
+		asserts.Equal(content[1000:2000], string(body))
+		asserts.Equal([]string{"bytes=1500-1999"}, freshRange)
+	}
+
+	// 无法获取新的下载地址
+	{
+		expired := expiringServer(content)
+		cache.Set("onedrive_source_0_preview_big.txt", expired.URL, 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/big.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(&request.Response{Err: errors.New("error")})
+		handler.Client.Request = clientMock
+
+		res, err := handler.Get(ctx, "big.txt")
+		asserts.NoError(err)
+		_, err = res.Seek(0, io.SeekEnd)
+		asserts.NoError(err)
+		body, err := ioutil.ReadAll(res)
+		res.Close()
+		expired.Close()
+		asserts.Error(err)
+		asserts.Equal(content[:len(content)/2], string(body))
+	}
+
+	// 续传次数用尽
+	{
+		freshRange = nil
+		cache.Set("setting_onedrive_download_retries", "0", 0)
+		expired := expiringServer(content)
+		cache.Set("onedrive_source_0_preview_big.txt", expired.URL, 0)
+
+		res, err := handler.Get(ctx, "big.txt")
+		asserts.NoError(err)
+		_, err = res.Seek(0, io.SeekEnd)
+		asserts.NoError(err)
+		_, err = ioutil.ReadAll(res)
+		res.Close()
+		expired.Close()
+		asserts.Error(err)
+		asserts.Empty(freshRange)
+	}
+}
+
+func TestDriver_Get_ResumeRange(t *testing.T) {
+	asserts := assert.New(t)
+	content := strings.Repeat("0123456789", 1000)
+	var ranges []string
+	// interrupted 按范围返回数据，但只传输 1000 字节后断开连接
+	interrupted := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, "interrupted:"+r.Header.Get("Range"))
+		w.Header().Set("Content-Range", "bytes 5000-9999/10000")
+		w.Header().Set("Content-Length", "5000")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(content[5000:6000]))
+		w.(http.Flusher).Flush()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer interrupted.Close()
+	fresh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, "fresh:"+r.Header.Get("Range"))
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer fresh.Close()
+	expired := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, "expired:"+r.Header.Get("Range"))
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer expired.Close()
+
+	handler := Driver{
+		Policy:     &model.Policy{},
+		HTTPClient: request.HTTPClient{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	handler.Client.Credential.AccessToken = "1"
+	cache.Set("setting_onedrive_download_retries", "1", 0)
+	cache.Set("setting_onedrive_source_timeout", "1800", 0)
+	metaResponse := func(downloadURL string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"@microsoft.graph.downloadUrl":"` + downloadURL + `"}`)),
+			},
+		}
+	}
+	serve := func(ctx context.Context) *httptest.ResponseRecorder {
+		res, err := handler.Get(ctx, "big.txt")
+		asserts.NoError(err)
+		defer res.Close()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Range", "bytes=5000-")
+		http.ServeContent(w, r, "", time.Time{}, res)
+		return w
+	}
+	ctx := context.WithValue(context.Background(), fsctx.RangeCtx, "bytes=5000-")
+
+	// 缓存的地址已过期，重新获取后按原范围返回；分段响应不使用过期的文件记录大小
+	{
+		ranges = nil
+		cache.Set("onedrive_source_0_preview_big.txt", expired.URL, 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/big.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(metaResponse(fresh.URL)).Once()
+		handler.Client.Request = clientMock
+		w := serve(context.WithValue(ctx, fsctx.FileModelCtx, model.File{Size: 123}))
+		clientMock.AssertExpectations(t)
+		asserts.Equal(http.StatusPartialContent, w.Code)
+		asserts.Equal("bytes 5000-9999/10000", w.Header().Get("Content-Range"))
+		asserts.Equal(content[5000:], w.Body.String())
+		asserts.Equal([]string{"expired:bytes=5000-", "fresh:bytes=5000-"}, ranges)
+	}
+
+	// 续传的范围跨越下载地址的再次刷新
+	{
+		ranges = nil
+		cache.Set("onedrive_source_0_preview_big.txt", expired.URL, 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/big.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(metaResponse(interrupted.URL)).Once()
+		clientMock.On("Request", "GET", "drive/root:/big.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(metaResponse(fresh.URL)).Once()
+		handler.Client.Request = clientMock
+		w := serve(ctx)
+		clientMock.AssertExpectations(t)
+		asserts.Equal(http.StatusPartialContent, w.Code)
+		asserts.Equal("bytes 5000-9999/10000", w.Header().Get("Content-Range"))
+		asserts.Equal(content[5000:], w.Body.String())
+		asserts.Equal([]string{"expired:bytes=5000-", "interrupted:bytes=5000-", "fresh:bytes=6000-9999"}, ranges)
+	}
+
+	// 重新获取的地址仍不可用
+	{
+		cache.Set("onedrive_source_0_preview_big.txt", expired.URL, 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/big.txt?expand=thumbnails", testMock.Anything, testMock.Anything).
+			Return(metaResponse(expired.URL)).Once()
+		handler.Client.Request = clientMock
+		_, err := handler.Get(ctx, "big.txt")
+		clientMock.AssertExpectations(t)
+		respErr, ok := asRespError(err)
+		asserts.True(ok)
+		asserts.Equal(http.StatusForbidden, respErr.Status)
+	}
+}
+
+func TestIsSourceExpired(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.True(isSourceExpired(&RespError{APIError: APIError{Code: "download"}, Status: http.StatusForbidden}))
+	asserts.True(isSourceExpired(&RespError{APIError: APIError{Code: "download"}, Status: http.StatusUnauthorized}))
+	asserts.False(isSourceExpired(&RespError{APIError: APIError{Code: "download"}, Status: http.StatusNotFound}))
+	asserts.False(isSourceExpired(&RespError{APIError: APIError{Code: "download"}, Status: http.StatusInternalServerError}))
+	asserts.False(isSourceExpired(&RespError{APIError: APIError{Code: "itemNotFound"}, Status: http.StatusNotFound}))
+	asserts.False(isSourceExpired(errors.New("error")))
+	asserts.False(isSourceExpired(nil))
+}
+
+func TestResponseRange(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 完整响应
+	{
+		start, end, ok := responseRange(&http.Response{StatusCode: 200, ContentLength: 10})
+		asserts.True(ok)
+		asserts.EqualValues(0, start)
+		asserts.EqualValues(10, end)
+	}
+
+	// 长度未知
+	{
+		start, end, ok := responseRange(&http.Response{StatusCode: 200, ContentLength: -1})
+		asserts.True(ok)
+		asserts.EqualValues(0, start)
+		asserts.EqualValues(-1, end)
+	}
+
+	// 分段响应
+	{
+		start, end, ok := responseRange(&http.Response{
+			StatusCode: 206,
+			Header:     http.Header{"Content-Range": {"bytes 5-9/20"}},
+		})
+		asserts.True(ok)
+		asserts.EqualValues(5, start)
+		asserts.EqualValues(10, end)
+	}
+
+	// 分段响应缺少范围
+	{
+		_, _, ok := responseRange(&http.Response{StatusCode: 206})
+		asserts.False(ok)
+	}
+}
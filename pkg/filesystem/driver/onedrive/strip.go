@@ -0,0 +1,208 @@
+package onedrive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// 去除图片元数据时，以等长的填充代替元数据的内容而非删除，文件大小保持不变，
+// 与上传前记录的文件大小及已扣除的用户容量一致；图像数据原样保留，不重新编码。
+// 图片的旋转方向记录在 Exif 中，去除后部分图片可能不再按拍摄方向显示
+
+var (
+	jpegSignature = []byte{0xFF, 0xD8}
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+)
+
+const (
+	jpegMarkerSOS = 0xDA
+	jpegMarkerEOI = 0xD9
+	jpegMarkerCOM = 0xFE
+	// jpegMarkerAPP1 Exif 及 XMP
+	jpegMarkerAPP1 = 0xE1
+	// jpegMarkerAPP13 Photoshop IPTC
+	jpegMarkerAPP13 = 0xED
+)
+
+// pngMetadataChunks 含有元数据的 PNG 数据块
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true}
+
+// pngPaddingChunk 代替元数据块的填充块类型，为辅助、私有、可安全复制的数据块，解码时被忽略
+const pngPaddingChunk = "crPd"
+
+// supportsMetadataStrip 返回能否去除 path 处文件的元数据
+func supportsMetadataStrip(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".jpe", ".png":
+		return true
+	}
+	return false
+}
+
+// metadataStripper 逐段读取 JPEG 或 PNG 文件，将元数据替换为等长的填充。
+// 文件头与扩展名不符或结构无法解析时，自该处起原样输出
+type metadataStripper struct {
+	r *bufio.Reader
+	// parse 解析下一段内容，为空时原样输出剩余内容
+	parse   func() error
+	pending []byte
+	// copyLeft 原样输出的字节数
+	copyLeft int64
+	// zeroLeft 以零填充代替的字节数，同时丢弃等量的原始内容
+	zeroLeft int64
+	// crc 正在填充的 PNG 数据块的校验值，填充完成后代替原有的校验值输出
+	crc hash.Hash32
+}
+
+// newMetadataStripper 按 name 的扩展名去除 src 中的图片元数据
+func newMetadataStripper(src io.Reader, name string) *metadataStripper {
+	s := &metadataStripper{r: bufio.NewReader(src)}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".jpe":
+		s.parse = func() error { return s.parseSignature(jpegSignature, s.parseJPEGSegment) }
+	case ".png":
+		s.parse = func() error { return s.parseSignature(pngSignature, s.parsePNGChunk) }
+	}
+	return s
+}
+
+// Read 读取去除元数据后的内容
+func (s *metadataStripper) Read(p []byte) (int, error) {
+	for {
+		switch {
+		case len(s.pending) > 0:
+			n := copy(p, s.pending)
+			s.pending = s.pending[n:]
+			return n, nil
+		case s.copyLeft > 0:
+			if int64(len(p)) > s.copyLeft {
+				p = p[:s.copyLeft]
+			}
+			n, err := s.r.Read(p)
+			s.copyLeft -= int64(n)
+			return n, unexpectedEOF(err)
+		case s.zeroLeft > 0:
+			if int64(len(p)) > s.zeroLeft {
+				p = p[:s.zeroLeft]
+			}
+			n, err := s.r.Discard(len(p))
+			for i := range p[:n] {
+				p[i] = 0
+			}
+			if s.crc != nil {
+				s.crc.Write(p[:n])
+			}
+			s.zeroLeft -= int64(n)
+			return n, unexpectedEOF(err)
+		case s.crc != nil:
+			if _, err := s.r.Discard(crc32.Size); err != nil {
+				return 0, unexpectedEOF(err)
+			}
+			s.pending = s.crc.Sum(nil)
+			s.crc = nil
+		case s.parse == nil:
+			return s.r.Read(p)
+		default:
+			if err := s.parse(); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+// parseSignature 检查文件头，与 signature 一致时以 next 解析之后的内容
+func (s *metadataStripper) parseSignature(signature []byte, next func() error) error {
+	s.parse = nil
+	if head, err := s.r.Peek(len(signature)); err != nil || !bytes.Equal(head, signature) {
+		return nil
+	}
+	s.r.Discard(len(signature))
+	s.pending = signature
+	s.parse = next
+	return nil
+}
+
+// parseJPEGSegment 解析一个 JPEG 段，APP1、APP13 段替换为同样长度、内容为零的注释段。
+// 图像数据位于 SOS 段之后，自 SOS 起原样输出
+func (s *metadataStripper) parseJPEGSegment() error {
+	head, err := s.r.Peek(2)
+	if err != nil || head[0] != 0xFF {
+		s.parse = nil
+		return nil
+	}
+
+	marker := head[1]
+	switch {
+	case marker == 0xFF:
+		// 段之间的填充字节
+		s.copyLeft = 1
+		return nil
+	case marker == jpegMarkerSOS || marker == jpegMarkerEOI:
+		s.parse = nil
+		return nil
+	case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+		// 无长度字段的独立标记
+		s.copyLeft = 2
+		return nil
+	}
+
+	head, err = s.r.Peek(4)
+	if err != nil {
+		s.parse = nil
+		return nil
+	}
+	length := int64(binary.BigEndian.Uint16(head[2:]))
+	if length < 2 {
+		s.parse = nil
+		return nil
+	}
+
+	if marker == jpegMarkerAPP1 || marker == jpegMarkerAPP13 {
+		s.pending = []byte{0xFF, jpegMarkerCOM, head[2], head[3]}
+		s.r.Discard(4)
+		s.zeroLeft = length - 2
+		return nil
+	}
+	s.copyLeft = 2 + length
+	return nil
+}
+
+// parsePNGChunk 解析一个 PNG 数据块，元数据块替换为同样长度、内容为零的填充块。
+// IEND 之后的内容原样输出
+func (s *metadataStripper) parsePNGChunk() error {
+	head, err := s.r.Peek(8)
+	if err != nil {
+		s.parse = nil
+		return nil
+	}
+	length := int64(binary.BigEndian.Uint32(head[:4]))
+	chunkType := string(head[4:8])
+
+	if pngMetadataChunks[chunkType] {
+		s.pending = append(append([]byte{}, head[:4]...), pngPaddingChunk...)
+		s.r.Discard(8)
+		s.crc = crc32.NewIEEE()
+		s.crc.Write([]byte(pngPaddingChunk))
+		s.zeroLeft = length
+		return nil
+	}
+	if chunkType == "IEND" {
+		s.parse = nil
+	}
+	s.copyLeft = 8 + length + crc32.Size
+	return nil
+}
+
+// unexpectedEOF 段内容尚未读完时遇到 EOF，说明文件不完整
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,186 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// exifPayload 含有 GPS 信息的 Exif 内容
+var exifPayload = []byte("Exif\x00\x00GPSLatitude=31.2304N;GPSLongitude=121.4737E")
+
+func sampleImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 16; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), G: uint8(y * 16), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+// sampleJPEG 生成在 SOI 之后带有 Exif 段的 JPEG 图片
+func sampleJPEG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, sampleImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	segment := []byte{0xFF, jpegMarkerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(exifPayload)+2))
+	segment = append(segment, exifPayload...)
+
+	res := append([]byte{}, encoded[:2]...)
+	res = append(res, segment...)
+	return append(res, encoded[2:]...)
+}
+
+// samplePNG 生成在 IHDR 之后带有 tEXt 块的 PNG 图片
+func samplePNG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, sampleImage()); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	data := []byte("Comment\x00GPSLatitude=31.2304N")
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, "tEXt"...)
+	chunk = append(chunk, data...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	chunk = append(chunk, crc...)
+
+	// 文件头 8 字节，IHDR 块 25 字节
+	res := append([]byte{}, encoded[:33]...)
+	res = append(res, chunk...)
+	return append(res, encoded[33:]...)
+}
+
+func stripAll(t *testing.T, content []byte, name string) []byte {
+	res, err := ioutil.ReadAll(iotest.OneByteReader(newMetadataStripper(bytes.NewReader(content), name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestMetadataStripper_JPEG(t *testing.T) {
+	asserts := assert.New(t)
+	original := sampleJPEG(t)
+	asserts.True(bytes.Contains(original, []byte("GPSLatitude")))
+
+	stripped := stripAll(t, original, "photo.JPG")
+	asserts.Len(stripped, len(original))
+	asserts.False(bytes.Contains(stripped, []byte("Exif")))
+	asserts.False(bytes.Contains(stripped, []byte("GPSLatitude")))
+
+	// 图像数据不变
+	want, err := jpeg.Decode(bytes.NewReader(original))
+	asserts.NoError(err)
+	got, err := jpeg.Decode(bytes.NewReader(stripped))
+	asserts.NoError(err)
+	asserts.Equal(want, got)
+}
+
+func TestMetadataStripper_PNG(t *testing.T) {
+	asserts := assert.New(t)
+	original := samplePNG(t)
+
+	stripped := stripAll(t, original, "photo.png")
+	asserts.Len(stripped, len(original))
+	asserts.False(bytes.Contains(stripped, []byte("tEXt")))
+	asserts.False(bytes.Contains(stripped, []byte("GPSLatitude")))
+
+	// 填充块的校验值正确，图像数据不变
+	want, err := png.Decode(bytes.NewReader(original))
+	asserts.NoError(err)
+	got, err := png.Decode(bytes.NewReader(stripped))
+	asserts.NoError(err)
+	asserts.Equal(want, got)
+}
+
+func TestMetadataStripper_Passthrough(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 扩展名与内容不符
+	{
+		content := []byte("not an image, GPSLatitude")
+		asserts.Equal(content, stripAll(t, content, "fake.jpg"))
+	}
+
+	// 不支持的类型
+	{
+		content := sampleJPEG(t)
+		asserts.Equal(content, stripAll(t, content, "photo.gif"))
+	}
+
+	// 文件不完整
+	{
+		content := sampleJPEG(t)[:10]
+		_, err := ioutil.ReadAll(newMetadataStripper(bytes.NewReader(content), "photo.jpg"))
+		asserts.Equal(io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestSupportsMetadataStrip(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.True(supportsMetadataStrip("/a/photo.jpeg"))
+	asserts.True(supportsMetadataStrip("photo.PNG"))
+	asserts.False(supportsMetadataStrip("photo.heic"))
+	asserts.False(supportsMetadataStrip("photo"))
+}
+
+func TestDriver_Put_StripMetadata(t *testing.T) {
+	asserts := assert.New(t)
+	policy := &model.Policy{}
+	policy.OptionsSerialized.OdStripMetadata = true
+	handler := Driver{Policy: policy}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_etag_cache_ttl", "0", 0)
+	drive := newDedupDriveMock()
+	handler.Client.Request = drive
+	content := sampleJPEG(t)
+
+	// 图片去除元数据后上传
+	{
+		asserts.NoError(handler.Put(context.Background(), ioutil.NopCloser(bytes.NewReader(content)), "photo.jpg", uint64(len(content))))
+		asserts.Len(drive.files["photo.jpg"], len(content))
+		asserts.False(bytes.Contains(drive.files["photo.jpg"], []byte("GPSLatitude")))
+		_, err := jpeg.Decode(bytes.NewReader(drive.files["photo.jpg"]))
+		asserts.NoError(err)
+	}
+
+	// 其他文件原样上传
+	{
+		asserts.NoError(handler.Put(context.Background(), ioutil.NopCloser(bytes.NewReader(content)), "photo.bin", uint64(len(content))))
+		asserts.Equal(content, drive.files["photo.bin"])
+	}
+
+	// 未启用时原样上传
+	{
+		policy.OptionsSerialized.OdStripMetadata = false
+		asserts.NoError(handler.Put(context.Background(), ioutil.NopCloser(bytes.NewReader(content)), "raw.jpg", uint64(len(content))))
+		asserts.Equal(content, drive.files["raw.jpg"])
+	}
+}
@@ -0,0 +1,209 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// thumbCachePrefix 缩略图地址缓存的键前缀
+const thumbCachePrefix = "onedrive_thumb_"
+
+// getThumbCacheKey 获取缩略图地址的缓存键（不含前缀），同一文件的各尺寸缩略图共用一个键，
+// 以便文件变更时一并清除
+func getThumbCacheKey(policyID uint, p string) string {
+	return policyPathCacheKey(policyID, p)
+}
+
+// getThumbSize 获取缩略图尺寸在缓存中的标识
+func getThumbSize(w, h uint) string {
+	return fmt.Sprintf("%dx%d", w, h)
+}
+
+// getCachedThumb 获取缓存的给定尺寸缩略图地址
+func getCachedThumb(policyID uint, p string, w, h uint) (string, bool) {
+	raw, ok := cache.Get(thumbCachePrefix + getThumbCacheKey(policyID, p))
+	if !ok {
+		return "", false
+	}
+
+	thumbs, ok := raw.(map[string]ThumbCache)
+	if !ok {
+		return "", false
+	}
+
+	thumb, ok := thumbs[getThumbSize(w, h)]
+	if !ok || thumb.Expires <= time.Now().Unix() {
+		return "", false
+	}
+	return thumb.URL, true
+}
+
+// setCachedThumb 缓存给定尺寸的缩略图地址，各尺寸分别记录过期时间
+func setCachedThumb(policyID uint, p string, w, h uint, thumbURL string, ttl int) {
+	if ttl <= 0 {
+		return
+	}
+
+	key := thumbCachePrefix + getThumbCacheKey(policyID, p)
+	now := time.Now().Unix()
+	thumbs := make(map[string]ThumbCache)
+	if raw, ok := cache.Get(key); ok {
+		if cached, ok := raw.(map[string]ThumbCache); ok {
+			for size, thumb := range cached {
+				if thumb.Expires > now {
+					thumbs[size] = thumb
+				}
+			}
+		}
+	}
+
+	thumbs[getThumbSize(w, h)] = ThumbCache{URL: thumbURL, Expires: now + int64(ttl)}
+	cache.Set(key, thumbs, ttl)
+}
+
+// invalidateThumbCache 清除给定文件的缩略图地址缓存，
+// 上传、删除、移动等会改变文件内容的操作后应调用此方法
+func invalidateThumbCache(policyID uint, paths ...string) {
+	keys := make([]string, 0, len(paths))
+	for _, p := range paths {
+		keys = append(keys, getThumbCacheKey(policyID, p))
+	}
+	cache.Deletes(keys, thumbCachePrefix)
+}
+
+// isThumbUnavailable 返回错误是否表示文件确实没有可用的缩略图，
+// 限流、授权失效、网络异常等暂时性错误返回 false
+func isThumbUnavailable(err error) bool {
+	if errors.Is(err, ErrThumbNotAvailable) {
+		return true
+	}
+
+	respErr, ok := asRespError(err)
+	if !ok || IsThrottled(err) || IsUnauthorized(err) {
+		return false
+	}
+
+	switch respErr.Status {
+	case http.StatusForbidden, http.StatusRequestTimeout:
+		return false
+	}
+	return respErr.Status >= 400 && respErr.Status < 500
+}
+
+// ThumbBatchError 批量获取缩略图时部分文件失败，Errors 为各失败文件遇到的错误
+type ThumbBatchError struct {
+	Errors map[string]error
+}
+
+// Error 实现error接口
+func (err *ThumbBatchError) Error() string {
+	paths := make([]string, 0, len(err.Errors))
+	for path := range err.Errors {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return fmt.Sprintf("%d 个文件无法获取缩略图：%s", len(paths), strings.Join(paths, ", "))
+}
+
+// GetThumbURLBatch 通过 $batch 接口一次获取 paths 给定尺寸的缩略图URL，返回各文件的缩略图URL
+// 及失败文件遇到的错误。由于API限制，最多获取 MaxBatchRequests 个
+func (client *Client) GetThumbURLBatch(ctx context.Context, paths []string, w, h uint) (map[string]string, map[string]error) {
+	urls := make(map[string]string, len(paths))
+	requestURLs := make([]string, len(paths))
+	var cropOption string
+	for i, path := range paths {
+		requestURLs[i], cropOption = client.getThumbRequestURL(path, w, h)
+	}
+
+	failed := client.batchGet(ctx, paths, requestURLs, func(path string, body json.RawMessage) error {
+		thumbURL, err := parseThumbURL(body, cropOption)
+		if err != nil {
+			return err
+		}
+		urls[path] = thumbURL
+		return nil
+	})
+	return urls, failed
+}
+
+// ThumbBatch 批量获取 paths 给定尺寸的缩略图地址，尺寸为零时使用默认尺寸，用于一次渲染多个缩略图。
+// 已缓存的地址直接返回，其余文件按 MaxBatchRequests 个一组通过 $batch 接口获取，并写入与 Thumb
+// 相同的缓存。文件确实没有缩略图时，清空对应文件记录的 pic_info；暂时性错误不在后台重试，
+// 可改用 Thumb 单独获取。部分文件失败时仍返回其余文件的地址，并返回 *ThumbBatchError
+func (handler Driver) ThumbBatch(ctx context.Context, paths []string, size [2]uint) (map[string]string, error) {
+	width, height := size[0], size[1]
+	if width == 0 || height == 0 {
+		width, height = 400, 300
+	}
+	urls := make(map[string]string, len(paths))
+	failed := make(map[string]error)
+
+	// 先从缓存中查找，并去除重复的路径
+	pending := make([]string, 0, len(paths))
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		if cachedURL, ok := getCachedThumb(handler.Policy.ID, path, width, height); ok {
+			urls[path] = cachedURL
+			continue
+		}
+		pending = append(pending, path)
+	}
+
+	var unavailable []string
+	ttl := model.GetIntSetting("onedrive_source_timeout", 1800)
+	for start := 0; start < len(pending); start += MaxBatchRequests {
+		end := start + MaxBatchRequests
+		if end > len(pending) {
+			end = len(pending)
+		}
+		group := pending[start:end]
+
+		if err := ctx.Err(); err != nil {
+			for _, path := range pending[start:] {
+				failed[path] = err
+			}
+			break
+		}
+
+		thumbs, errs := handler.Client.GetThumbURLBatch(ctx, group, width, height)
+		for _, path := range group {
+			if err, ok := errs[path]; ok {
+				failed[path] = err
+				if isThumbUnavailable(err) {
+					unavailable = append(unavailable, path)
+				}
+				continue
+			}
+
+			setCachedThumb(handler.Policy.ID, path, width, height, thumbs[path], ttl)
+			cancelThumbRetry(getThumbRetryKey(handler.Policy.ID, path, width, height))
+			urls[path] = thumbs[path]
+		}
+	}
+
+	if len(unavailable) > 0 {
+		if err := model.ClearPicInfoBySourceNames(handler.Policy.ID, unavailable); err != nil {
+			util.Log().Warning("无法清空没有缩略图的文件的图像信息，%s", err)
+		}
+	}
+
+	if len(failed) > 0 {
+		return urls, &ThumbBatchError{Errors: failed}
+	}
+	return urls, nil
+}
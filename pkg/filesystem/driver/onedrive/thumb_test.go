@@ -0,0 +1,282 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestIsThumbUnavailable(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 确实没有缩略图
+	asserts.True(isThumbUnavailable(ErrThumbNotAvailable))
+	asserts.True(isThumbUnavailable(&RespError{Status: http.StatusNotFound}))
+	asserts.True(isThumbUnavailable(&RespError{Status: http.StatusBadRequest}))
+
+	// 暂时性错误
+	asserts.False(isThumbUnavailable(&RespError{Status: http.StatusTooManyRequests}))
+	asserts.False(isThumbUnavailable(&RespError{Status: http.StatusServiceUnavailable}))
+	asserts.False(isThumbUnavailable(&RespError{Status: http.StatusUnauthorized}))
+	asserts.False(isThumbUnavailable(&RespError{APIError: APIError{Code: "activityLimitReached"}}))
+	asserts.False(isThumbUnavailable(&RespError{}))
+	asserts.False(isThumbUnavailable(errors.New("error")))
+}
+
+func TestDriver_Thumb_Cache(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Policy.ID = 60
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_source_timeout", "1800", 0)
+	thumbResponse := func(body string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			},
+		}
+	}
+	ctx := context.WithValue(context.Background(), fsctx.ThumbSizeCtx, [2]uint{10, 20})
+
+	// 首次获取时发出请求
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/thumb.jpg:/thumbnails?select=c10x20_Crop", testMock.Anything, testMock.Anything).
+			Return(thumbResponse(`{"value":[{"c10x20_Crop":{"url":"thumb1"}}]}`))
+		handler.Client.Request = clientMock
+		res, err := handler.Thumb(ctx, "thumb.jpg")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("thumb1", res.URL)
+	}
+
+	// 再次获取相同尺寸时使用缓存
+	{
+		clientMock := ClientMock{}
+		handler.Client.Request = clientMock
+		res, err := handler.Thumb(ctx, "/thumb.jpg")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.True(res.Redirect)
+		asserts.Equal("thumb1", res.URL)
+	}
+
+	// 不同尺寸分别缓存
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/thumb.jpg:/thumbnails/0/large", testMock.Anything, testMock.Anything).
+			Return(thumbResponse(`{"url":"large"}`))
+		handler.Client.Request = clientMock
+		ctx := context.WithValue(context.Background(), fsctx.ThumbSizeCtx, [2]uint{800, 800})
+		res, err := handler.Thumb(ctx, "thumb.jpg")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("large", res.URL)
+
+		cachedURL, ok := getCachedThumb(60, "thumb.jpg", 10, 20)
+		asserts.True(ok)
+		asserts.Equal("thumb1", cachedURL)
+	}
+
+	// 已过期的缓存不使用
+	{
+		cache.Set(thumbCachePrefix+getThumbCacheKey(60, "expired.jpg"), map[string]ThumbCache{
+			"10x20": {URL: "expired", Expires: time.Now().Unix() - 1},
+		}, 0)
+		_, ok := getCachedThumb(60, "expired.jpg", 10, 20)
+		asserts.False(ok)
+	}
+
+	// 文件变更后缓存失效
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "PATCH", "drive/root:/thumb.jpg", testMock.Anything, testMock.Anything).
+			Return(thumbResponse(`{"name":"new.jpg"}`))
+		handler.Client.Request = clientMock
+		asserts.NoError(handler.Move(context.Background(), "thumb.jpg", "new.jpg"))
+		clientMock.AssertExpectations(t)
+		_, ok := getCachedThumb(60, "thumb.jpg", 10, 20)
+		asserts.False(ok)
+		_, ok = getCachedThumb(60, "thumb.jpg", 800, 800)
+		asserts.False(ok)
+	}
+}
+
+func TestDriver_Thumb_PicInfo(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	ctx := context.WithValue(context.Background(), fsctx.ThumbSizeCtx, [2]uint{10, 20})
+	ctx = context.WithValue(ctx, fsctx.FileModelCtx, model.File{})
+	errResponse := func(status int, code string) *request.Response {
+		return &request.Response{
+			Response: &http.Response{
+				StatusCode: status,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error":{"code":"` + code + `"}}`)),
+			},
+		}
+	}
+
+	// 没有可用的缩略图，清空pic_info
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/none.txt:/thumbnails?select=c10x20_Crop", testMock.Anything, testMock.Anything).
+			Return(errResponse(http.StatusNotFound, "itemNotFound"))
+		handler.Client.Request = clientMock
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		res, err := handler.Thumb(ctx, "none.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+		asserts.Empty(res.URL)
+	}
+
+	// 请求被限流，保留pic_info
+	{
+		for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+			clientMock := ClientMock{}
+			clientMock.On("Request", "GET", "drive/root:/busy.jpg:/thumbnails?select=c10x20_Crop", testMock.Anything, testMock.Anything).
+				Return(errResponse(status, "activityLimitReached"))
+			handler.Client.Request = clientMock
+			res, err := handler.Thumb(ctx, "busy.jpg")
+			clientMock.AssertExpectations(t)
+			asserts.NoError(mock.ExpectationsWereMet())
+			asserts.True(IsThrottled(err))
+			asserts.Empty(res.URL)
+		}
+
+		_, ok := getCachedThumb(0, "busy.jpg", 10, 20)
+		asserts.False(ok)
+
+		// 安排后台重试
+		key := getThumbRetryKey(0, "busy.jpg", 10, 20)
+		asserts.Contains(getThumbRetries(), key)
+		cancelThumbRetry(key)
+	}
+}
+
+// thumbBatchDriveMock 以 $batch 接口返回缩略图的驱动器，路径含 nothumb 的文件没有缩略图，
+// 路径含 error 的文件返回服务端错误
+type thumbBatchDriveMock struct {
+	batches *int
+}
+
+func (m thumbBatchDriveMock) Request(method, target string, body io.Reader, opts ...request.Option) *request.Response {
+	*m.batches++
+	var req BatchRequests
+	json.NewDecoder(body).Decode(&req)
+
+	res := BatchResponses{Responses: make([]BatchResponse, len(req.Requests))}
+	for i, r := range req.Requests {
+		res.Responses[i].ID = r.ID
+		switch {
+		case strings.Contains(r.URL, "nothumb"):
+			res.Responses[i].Status = 200
+			res.Responses[i].Body = json.RawMessage(`{"value":[]}`)
+		case strings.Contains(r.URL, "error"):
+			res.Responses[i].Status = 500
+			res.Responses[i].Body = json.RawMessage(`{"error":{"code":"generalException","message":"error"}}`)
+		default:
+			res.Responses[i].Status = 200
+			res.Responses[i].Body = json.RawMessage(fmt.Sprintf(`{"value":[{"c100x100_Crop":{"url":"http://thumb/%s"}}]}`, r.ID))
+		}
+	}
+	resBody, _ := json.Marshal(res)
+	return &request.Response{
+		Response: &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader(string(resBody))),
+		},
+	}
+}
+
+func TestDriver_ThumbBatch(t *testing.T) {
+	asserts := assert.New(t)
+	policy := &model.Policy{}
+	policy.ID = 98
+	handler := Driver{Policy: policy}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_source_timeout", "1800", 0)
+	drive := thumbBatchDriveMock{batches: new(int)}
+	handler.Client.Request = drive
+
+	paths := make([]string, 0, 31)
+	for i := 0; i < 28; i++ {
+		paths = append(paths, fmt.Sprintf("/gallery/%d.jpg", i))
+	}
+	paths = append(paths, "/gallery/nothumb.jpg", "/gallery/error.jpg", "/gallery/0.jpg")
+
+	// 30 个文件分两次批量请求，没有缩略图的文件清空 pic_info，其他错误不影响其余文件
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)pic_info(.+)").WithArgs("", sqlmock.AnyArg(), 98, "/gallery/nothumb.jpg").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		res, err := handler.ThumbBatch(context.Background(), paths, [2]uint{100, 100})
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(2, *drive.batches)
+		asserts.Len(res, 28)
+		asserts.Equal("http://thumb/0", res["/gallery/0.jpg"])
+		asserts.Equal("http://thumb/7", res["/gallery/27.jpg"])
+
+		batchErr, ok := err.(*ThumbBatchError)
+		asserts.True(ok)
+		asserts.Len(batchErr.Errors, 2)
+		asserts.Equal(ErrThumbNotAvailable, batchErr.Errors["/gallery/nothumb.jpg"])
+		asserts.False(isThumbUnavailable(batchErr.Errors["/gallery/error.jpg"]))
+	}
+
+	// 已获取的缩略图地址写入与 Thumb 相同的缓存
+	{
+		cachedURL, ok := getCachedThumb(98, "/gallery/3.jpg", 100, 100)
+		asserts.True(ok)
+		asserts.Equal("http://thumb/3", cachedURL)
+
+		res, err := handler.ThumbBatch(context.Background(), paths[:28], [2]uint{100, 100})
+		asserts.NoError(err)
+		asserts.Len(res, 28)
+		asserts.Equal(2, *drive.batches)
+	}
+
+	// ctx 已取消
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		res, err := handler.ThumbBatch(ctx, []string{"/gallery/new.jpg"}, [2]uint{100, 100})
+		asserts.Empty(res)
+		asserts.Equal(context.Canceled, err.(*ThumbBatchError).Errors["/gallery/new.jpg"])
+		asserts.Equal(2, *drive.batches)
+	}
+}
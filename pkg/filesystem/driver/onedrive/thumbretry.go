@@ -0,0 +1,184 @@
+package onedrive
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// thumbRetriesKey 持久化的缩略图重试在缓存中的键
+const thumbRetriesKey = "onedrive_thumb_retries"
+
+// thumbRetriesLock 读写持久化缩略图重试时使用的锁
+var thumbRetriesLock sync.Mutex
+
+// thumbRetryTimers 已安排的缩略图重试，键为重试键，值为 *time.Timer
+var thumbRetryTimers sync.Map
+
+// getThumbRetryKey 获取给定尺寸缩略图重试的键
+func getThumbRetryKey(policyID uint, p string, w, h uint) string {
+	return getThumbCacheKey(policyID, p) + "_" + getThumbSize(w, h)
+}
+
+// scheduleThumbRetry 获取缩略图遇到暂时性错误时调用，在后台稍后重试。同一缩略图已安排重试时不重复安排
+func scheduleThumbRetry(retry ThumbRetry) {
+	if _, ok := getThumbRetries()[retry.Key]; ok {
+		return
+	}
+	requeueThumbRetry(retry)
+}
+
+// requeueThumbRetry 按退避间隔安排下一次重试，重试次数达到设置项 onedrive_thumb_retries
+// 后不再重试，视为文件没有可用的缩略图
+func requeueThumbRetry(retry ThumbRetry) {
+	if retry.Attempts >= model.GetIntSetting("onedrive_thumb_retries", 5) {
+		util.Log().Warning("多次重试后仍无法获取文件[%s]的缩略图，不再重试", retry.Path)
+		deleteThumbRetry(retry.Key)
+		clearPicInfo(retry.FileID)
+		return
+	}
+
+	retry.Attempts++
+	delay := thumbRetryBackoff(retry.Attempts)
+	retry.NextAttempt = time.Now().Add(delay).Unix()
+	saveThumbRetry(retry)
+	startThumbRetryTimer(retry.Key, delay)
+}
+
+// thumbRetryBackoff 获取第 attempts 次重试前等待的时间，自设置项 onedrive_thumb_retry_interval
+// 起逐次翻倍，不超过 MaxThumbRetryBackoff
+func thumbRetryBackoff(attempts int) time.Duration {
+	delay := time.Duration(model.GetIntSetting("onedrive_thumb_retry_interval", 60)) * time.Second
+	for i := 1; i < attempts && delay < MaxThumbRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > MaxThumbRetryBackoff {
+		delay = MaxThumbRetryBackoff
+	}
+	return delay
+}
+
+// startThumbRetryTimer 在 delay 后执行重试，替换已安排的同一重试
+func startThumbRetryTimer(key string, delay time.Duration) {
+	timer := time.AfterFunc(delay, func() {
+		runThumbRetry(key)
+	})
+	if previous, ok := thumbRetryTimers.Load(key); ok {
+		previous.(*time.Timer).Stop()
+	}
+	thumbRetryTimers.Store(key, timer)
+}
+
+// cancelThumbRetry 缩略图已成功获取时调用，取消尚未执行的重试
+func cancelThumbRetry(key string) {
+	if timer, ok := thumbRetryTimers.Load(key); ok {
+		timer.(*time.Timer).Stop()
+		thumbRetryTimers.Delete(key)
+	}
+	deleteThumbRetry(key)
+}
+
+// runThumbRetry 重新获取缩略图地址，成功时写入缓存；文件确实没有缩略图时清空其 pic_info；
+// 仍遇到暂时性错误时按退避间隔再次安排重试
+func runThumbRetry(key string) {
+	thumbRetryTimers.Delete(key)
+	retry, ok := getThumbRetries()[key]
+	if !ok {
+		return
+	}
+
+	policy, err := model.GetPolicyByID(retry.PolicyID)
+	if err != nil {
+		util.Log().Warning("无法重试获取缩略图[%s]，存储策略不存在，%s", retry.Path, err)
+		deleteThumbRetry(key)
+		return
+	}
+
+	client, err := NewClient(&policy)
+	if err != nil {
+		util.Log().Warning("无法重试获取缩略图[%s]，%s", retry.Path, err)
+		deleteThumbRetry(key)
+		return
+	}
+
+	thumbURL, err := client.GetThumbURL(context.Background(), retry.Path, retry.Width, retry.Height)
+	switch {
+	case err == nil:
+		setCachedThumb(retry.PolicyID, retry.Path, retry.Width, retry.Height, thumbURL, model.GetIntSetting("onedrive_source_timeout", 1800))
+		deleteThumbRetry(key)
+	case isThumbUnavailable(err):
+		deleteThumbRetry(key)
+		clearPicInfo(retry.FileID)
+	default:
+		util.Log().Debug("重试获取缩略图[%s]失败，%s", retry.Path, err)
+		requeueThumbRetry(retry)
+	}
+}
+
+// clearPicInfo 清空文件的 pic_info，标记文件没有可用的缩略图
+func clearPicInfo(fileID uint) {
+	if fileID == 0 {
+		return
+	}
+	file := model.File{}
+	file.ID = fileID
+	if err := file.UpdatePicInfo(""); err != nil {
+		util.Log().Warning("无法清空文件[%d]的图像信息，%s", fileID, err)
+	}
+}
+
+// saveThumbRetry 持久化缩略图重试
+func saveThumbRetry(retry ThumbRetry) {
+	thumbRetriesLock.Lock()
+	defer thumbRetriesLock.Unlock()
+
+	retries := getThumbRetries()
+	retries[retry.Key] = retry
+	if err := cache.Set(thumbRetriesKey, retries, 0); err != nil {
+		util.Log().Warning("无法保存缩略图重试，%s", err)
+	}
+}
+
+// deleteThumbRetry 删除持久化的缩略图重试
+func deleteThumbRetry(key string) {
+	thumbRetriesLock.Lock()
+	defer thumbRetriesLock.Unlock()
+
+	retries := getThumbRetries()
+	if _, ok := retries[key]; !ok {
+		return
+	}
+	delete(retries, key)
+	if err := cache.Set(thumbRetriesKey, retries, 0); err != nil {
+		util.Log().Warning("无法删除缩略图重试，%s", err)
+	}
+}
+
+// getThumbRetries 获取所有持久化的缩略图重试
+func getThumbRetries() map[string]ThumbRetry {
+	res := make(map[string]ThumbRetry)
+	if raw, ok := cache.Get(thumbRetriesKey); ok {
+		if retries, ok := raw.(map[string]ThumbRetry); ok {
+			for k, v := range retries {
+				res[k] = v
+			}
+		}
+	}
+	return res
+}
+
+// ResumeThumbRetries 恢复重启前安排的缩略图重试，已到期的重试立即执行。
+// 缓存不能跨重启保留时（如使用内存缓存），不会恢复任何重试
+func ResumeThumbRetries() {
+	for key, retry := range getThumbRetries() {
+		delay := time.Until(time.Unix(retry.NextAttempt, 0))
+		if delay < 0 {
+			delay = 0
+		}
+		startThumbRetryTimer(key, delay)
+	}
+}
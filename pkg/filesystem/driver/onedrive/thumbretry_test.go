@@ -0,0 +1,209 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestThumbRetryBackoff(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_thumb_retry_interval", "60", 0)
+	asserts.Equal(time.Duration(60)*time.Second, thumbRetryBackoff(1))
+	asserts.Equal(time.Duration(120)*time.Second, thumbRetryBackoff(2))
+	asserts.Equal(time.Duration(480)*time.Second, thumbRetryBackoff(4))
+	asserts.Equal(MaxThumbRetryBackoff, thumbRetryBackoff(100))
+}
+
+func TestDriver_Thumb_Requeue(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{Model: gorm.Model{ID: 77}},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_thumb_retry_interval", "3600", 0)
+	cache.Set("setting_onedrive_source_timeout", "1800", 0)
+	ctx := context.WithValue(context.Background(), fsctx.ThumbSizeCtx, [2]uint{10, 20})
+	ctx = context.WithValue(ctx, fsctx.FileModelCtx, model.File{Model: gorm.Model{ID: 7}})
+	key := getThumbRetryKey(77, "busy.jpg", 10, 20)
+	defer cancelThumbRetry(key)
+
+	// 暂时性错误，安排后台重试，不清空pic_info
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/busy.jpg:/thumbnails?select=c10x20_Crop", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(http.StatusServiceUnavailable, `{"error":{"code":"serviceNotAvailable"}}`))
+		handler.Client.Request = clientMock
+		_, err := handler.Thumb(ctx, "busy.jpg")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+
+		retry, ok := getThumbRetries()[key]
+		asserts.True(ok)
+		asserts.Equal(1, retry.Attempts)
+		asserts.EqualValues(7, retry.FileID)
+		asserts.InDelta(time.Now().Add(time.Hour).Unix(), retry.NextAttempt, 5)
+		_, ok = thumbRetryTimers.Load(key)
+		asserts.True(ok)
+	}
+
+	// 已安排重试时不重复安排
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/busy.jpg:/thumbnails?select=c10x20_Crop", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(http.StatusServiceUnavailable, `{"error":{"code":"serviceNotAvailable"}}`))
+		handler.Client.Request = clientMock
+		_, err := handler.Thumb(ctx, "busy.jpg")
+		asserts.Error(err)
+		asserts.Equal(1, getThumbRetries()[key].Attempts)
+	}
+
+	// 获取成功后取消重试
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/busy.jpg:/thumbnails?select=c10x20_Crop", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"value":[{"c10x20_Crop":{"url":"thumb"}}]}`))
+		handler.Client.Request = clientMock
+		res, err := handler.Thumb(ctx, "busy.jpg")
+		asserts.NoError(err)
+		asserts.Equal("thumb", res.URL)
+		asserts.NotContains(getThumbRetries(), key)
+		_, ok := thumbRetryTimers.Load(key)
+		asserts.False(ok)
+	}
+
+	// 文件确实没有缩略图，立即清空pic_info，不安排重试
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/none.txt:/thumbnails?select=c10x20_Crop", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(http.StatusNotFound, `{"error":{"code":"itemNotFound"}}`))
+		handler.Client.Request = clientMock
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		_, err := handler.Thumb(ctx, "none.txt")
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+		asserts.NotContains(getThumbRetries(), getThumbRetryKey(77, "none.txt", 10, 20))
+	}
+}
+
+func TestRunThumbRetry(t *testing.T) {
+	asserts := assert.New(t)
+	var status int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := int(atomic.LoadInt32(&status))
+		w.WriteHeader(code)
+		if code == 200 {
+			w.Write([]byte(`{"value":[{"c10x20_Crop":{"url":"thumb"}}]}`))
+			return
+		}
+		w.Write([]byte(`{"error":{"code":"error"}}`))
+	}))
+	defer server.Close()
+
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_thumb_retries", "2", 0)
+	cache.Set("setting_onedrive_thumb_retry_interval", "3600", 0)
+	cache.Set("setting_onedrive_source_timeout", "1800", 0)
+	cache.Set("policy_477", model.Policy{
+		Model:      gorm.Model{ID: 477},
+		Type:       "onedrive",
+		Server:     server.URL + "/v1.0/me",
+		BucketName: "thumb_retry",
+	}, 0)
+	cache.Set(credentialCachePrefix+"477_thumb_retry", Credential{
+		AccessToken: "AccessToken",
+		ExpiresIn:   time.Now().Add(time.Duration(100) * time.Hour).Unix(),
+	}, 0)
+	key := getThumbRetryKey(477, "a.jpg", 10, 20)
+	defer cancelThumbRetry(key)
+	newRetry := func(attempts int) ThumbRetry {
+		return ThumbRetry{Key: key, PolicyID: 477, FileID: 8, Path: "a.jpg", Width: 10, Height: 20, Attempts: attempts}
+	}
+
+	// 仍遇到暂时性错误，按退避间隔再次安排
+	{
+		atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+		saveThumbRetry(newRetry(1))
+		runThumbRetry(key)
+		retry, ok := getThumbRetries()[key]
+		asserts.True(ok)
+		asserts.Equal(2, retry.Attempts)
+		asserts.InDelta(time.Now().Add(2*time.Hour).Unix(), retry.NextAttempt, 5)
+	}
+
+	// 重试成功，写入缓存
+	{
+		atomic.StoreInt32(&status, http.StatusOK)
+		runThumbRetry(key)
+		asserts.NotContains(getThumbRetries(), key)
+		res, ok := getCachedThumb(477, "a.jpg", 10, 20)
+		asserts.True(ok)
+		asserts.Equal("thumb", res)
+		invalidateThumbCache(477, "a.jpg")
+	}
+
+	// 重试次数用尽，不再重试并清空pic_info
+	{
+		atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+		saveThumbRetry(newRetry(2))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WithArgs("", sqlmock.AnyArg(), 8).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		runThumbRetry(key)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NotContains(getThumbRetries(), key)
+	}
+
+	// 文件确实没有缩略图，不再重试并清空pic_info
+	{
+		atomic.StoreInt32(&status, http.StatusNotFound)
+		saveThumbRetry(newRetry(1))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		runThumbRetry(key)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NotContains(getThumbRetries(), key)
+	}
+
+	// 重试已被取消
+	{
+		runThumbRetry(key)
+		asserts.NotContains(getThumbRetries(), key)
+	}
+}
+
+func TestResumeThumbRetries(t *testing.T) {
+	asserts := assert.New(t)
+	key := getThumbRetryKey(478, "a.jpg", 10, 20)
+
+	// 已到期的重试立即执行，存储策略不存在时删除
+	{
+		mock.ExpectQuery("SELECT(.+)").WillReturnError(errors.New("not found"))
+		saveThumbRetry(ThumbRetry{Key: key, PolicyID: 478, Path: "a.jpg", NextAttempt: time.Now().Add(-time.Hour).Unix()})
+		ResumeThumbRetries()
+		asserts.Eventually(func() bool {
+			_, ok := getThumbRetries()[key]
+			return !ok
+		}, time.Duration(5)*time.Second, time.Duration(50)*time.Millisecond)
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
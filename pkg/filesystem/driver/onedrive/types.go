@@ -2,21 +2,44 @@ package onedrive
 
 import (
 	"encoding/gob"
+	"encoding/json"
 	"net/url"
 	"sync"
+	"time"
 )
 
 // RespError 接口返回错误
 type RespError struct {
 	APIError APIError `json:"error"`
+	// Status 响应的 HTTP 状态码，非请求 Graph API 产生的错误为 0
+	Status int `json:"-"`
+	// RequestID Graph API 分配的请求ID，便于向微软反馈问题
+	RequestID string `json:"-"`
 }
 
 // APIError 接口返回的错误内容
 type APIError struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Code       string     `json:"code"`
+	Message    string     `json:"message"`
+	InnerError InnerError `json:"innerError"`
 }
 
+// InnerError 接口返回错误的附加信息
+type InnerError struct {
+	// Code 更具体的错误码，如 serviceReadOnly
+	Code      string `json:"code"`
+	RequestID string `json:"request-id"`
+}
+
+// ListError 递归列取时单个子目录遇到的错误
+type ListError struct {
+	Path string
+	Err  error
+}
+
+// ListErrors 递归列取时各子目录遇到的错误
+type ListErrors []ListError
+
 // UploadSessionResponse 分片上传会话
 type UploadSessionResponse struct {
 	DataContext        string   `json:"@odata.context"`
@@ -27,6 +50,7 @@ type UploadSessionResponse struct {
 
 // FileInfo 文件元信息
 type FileInfo struct {
+	ID              string          `json:"id"`
 	Name            string          `json:"name"`
 	Size            uint64          `json:"size"`
 	Image           imageInfo       `json:"image"`
@@ -34,25 +58,65 @@ type FileInfo struct {
 	DownloadURL     string          `json:"@microsoft.graph.downloadUrl"`
 	File            *file           `json:"file"`
 	Folder          *folder         `json:"folder"`
+	LastModify      time.Time       `json:"lastModifiedDateTime"`
+	ETag            string          `json:"eTag"`
+	Description     string          `json:"description"`
+	Deleted         *deleted        `json:"deleted"`
+	RemoteItem      *remoteItem     `json:"remoteItem"`
+	// Shortcut 项目为快捷方式时的解析状态，不是快捷方式时为空
+	Shortcut string `json:"-"`
+}
+
+// remoteItem 快捷方式所指向的其他驱动器中的项目
+type remoteItem struct {
+	ID              string          `json:"id"`
+	Name            string          `json:"name"`
+	Size            uint64          `json:"size"`
+	ParentReference parentReference `json:"parentReference"`
+	File            *file           `json:"file"`
+	Folder          *folder         `json:"folder"`
+}
+
+// target 获取快捷方式指向的项目
+func (item *remoteItem) target() ShortcutTarget {
+	return ShortcutTarget{DriveID: item.ParentReference.DriveID, ID: item.ID}
+}
+
+// ShortcutTarget 快捷方式指向的驱动器及项目
+type ShortcutTarget struct {
+	DriveID string
+	ID      string
 }
 
 type file struct {
 	MimeType string `json:"mimeType"`
+	Hashes   hashes `json:"hashes"`
+}
+
+type hashes struct {
+	QuickXorHash string `json:"quickXorHash"`
+	SHA1Hash     string `json:"sha1Hash"`
+	SHA256Hash   string `json:"sha256Hash"`
 }
 
 type folder struct {
 	ChildCount int `json:"childCount"`
 }
 
+type deleted struct {
+	State string `json:"state"`
+}
+
 type imageInfo struct {
 	Height int `json:"height"`
 	Width  int `json:"width"`
 }
 
 type parentReference struct {
-	Path string `json:"path"`
-	Name string `json:"name"`
-	ID   string `json:"id"`
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	ID      string `json:"id"`
+	DriveID string `json:"driveId"`
 }
 
 // UploadResult 上传结果
@@ -60,6 +124,7 @@ type UploadResult struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
 	Size uint64 `json:"size"`
+	File *file  `json:"file"`
 }
 
 // BatchRequests 批量操作请求
@@ -83,8 +148,9 @@ type BatchResponses struct {
 
 // BatchResponse 批量操作单个响应
 type BatchResponse struct {
-	ID     string `json:"id"`
-	Status int    `json:"status"`
+	ID     string          `json:"id"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
 }
 
 // ThumbResponse 获取缩略图的响应
@@ -93,10 +159,26 @@ type ThumbResponse struct {
 	URL   string                   `json:"url"`
 }
 
+// CopyStatus 异步复制任务的状态
+type CopyStatus struct {
+	Status             string    `json:"status"`
+	PercentageComplete float64   `json:"percentageComplete"`
+	ResourceID         string    `json:"resourceId"`
+	Error              *APIError `json:"error,omitempty"`
+}
+
 // ListResponse 列取子项目响应
 type ListResponse struct {
-	Value   []FileInfo `json:"value"`
-	Context string     `json:"@odata.context"`
+	Value    []FileInfo `json:"value"`
+	Context  string     `json:"@odata.context"`
+	NextLink string     `json:"@odata.nextLink"`
+}
+
+// DeltaResponse 增量同步查询的单页响应，最后一页携带 DeltaLink
+type DeltaResponse struct {
+	Value     []FileInfo `json:"value"`
+	NextLink  string     `json:"@odata.nextLink"`
+	DeltaLink string     `json:"@odata.deltaLink"`
 }
 
 // Chunk 文件分片
@@ -108,6 +190,60 @@ type Chunk struct {
 	Data      []byte
 }
 
+// MonitorSession 持久化的上传监控会话，用于重启后恢复监控
+type MonitorSession struct {
+	PolicyID  uint
+	UploadURL string
+	Key       string
+	SavePath  string
+	Size      uint64
+	Expires   int64
+	// OperationID 创建上传会话时的操作ID，恢复后的监控沿用此ID
+	OperationID string
+}
+
+// ThumbRetry 持久化的缩略图重试，获取缩略图遇到暂时性错误时在后台稍后重试
+type ThumbRetry struct {
+	Key      string
+	PolicyID uint
+	FileID   uint
+	Path     string
+	Width    uint
+	Height   uint
+	// Attempts 已安排的重试次数
+	Attempts int
+	// NextAttempt 下次重试的时间戳
+	NextAttempt int64
+}
+
+// ThumbCache 缓存的缩略图地址
+type ThumbCache struct {
+	URL     string
+	Expires int64
+}
+
+// Quota 驱动器容量使用情况
+type Quota struct {
+	Total     int64  `json:"total"`
+	Used      int64  `json:"used"`
+	Remaining int64  `json:"remaining"`
+	Deleted   int64  `json:"deleted"`
+	State     string `json:"state"`
+}
+
+// DriveResponse 获取驱动器信息响应
+type DriveResponse struct {
+	ID        string `json:"id"`
+	DriveType string `json:"driveType"`
+	Quota     Quota  `json:"quota"`
+}
+
+// ConditionalCache 带 ETag 的响应缓存，用于发送条件请求
+type ConditionalCache struct {
+	ETag string
+	Body string
+}
+
 // oauthEndpoint OAuth接口地址
 type oauthEndpoint struct {
 	token     url.URL
@@ -133,6 +269,12 @@ type OAuthError struct {
 
 func init() {
 	gob.Register(Credential{})
+	gob.Register(map[string]MonitorSession{})
+	gob.Register(ConditionalCache{})
+	gob.Register(map[string]ThumbCache{})
+	gob.Register(map[string]ThumbRetry{})
+	gob.Register(Quota{})
+	gob.Register(ShortcutTarget{})
 }
 
 // IsLast 返回是否为最后一个分片
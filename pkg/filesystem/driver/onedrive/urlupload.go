@@ -0,0 +1,130 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+)
+
+var (
+	// ErrInvalidSourceURL 远程文件地址无效
+	ErrInvalidSourceURL = errors.New("远程文件地址无效，仅支持 http 及 https 地址")
+	// ErrSourceSizeUnknown 远程文件未返回大小
+	ErrSourceSizeUnknown = errors.New("无法获取远程文件大小")
+	// ErrSourceTooLarge 远程文件超过允许的大小
+	ErrSourceTooLarge = errors.New("远程文件超过允许的大小")
+	// ErrSourceTooManyRedirects 远程文件重定向次数过多
+	ErrSourceTooManyRedirects = errors.New("远程文件重定向次数过多")
+)
+
+// maxSourceRedirects 获取远程文件时最多跟随的重定向次数
+const maxSourceRedirects = 10
+
+// PutFromURL 由服务端获取 srcURL 处的远程文件，边下载边上传至 dst，不在本地缓存完整文件。
+// 大文件经由上传会话分片上传；远程文件大小受存储策略及设置项 onedrive_url_upload_max_size
+// 限制，整个过程超过设置项 onedrive_url_upload_timeout 指定的秒数时取消。除非开启设置项
+// onedrive_url_upload_allow_private，否则拒绝获取环回、内网及链路本地地址的文件，
+// 重定向后的每个地址均会检查
+func (handler Driver) PutFromURL(ctx context.Context, srcURL, dst string) error {
+	src, err := url.Parse(srcURL)
+	if err != nil || !isHTTPURL(src) {
+		return ErrInvalidSourceURL
+	}
+
+	timeout := model.GetIntSetting("onedrive_url_upload_timeout", 3600)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+
+	res, err := handler.fetchSource(ctx, src)
+	if err != nil {
+		return fmt.Errorf("无法获取远程文件，%w", err)
+	}
+
+	// 上传会话需要预先确定文件大小
+	size := res.ContentLength
+	if size < 0 {
+		res.Body.Close()
+		return ErrSourceSizeUnknown
+	}
+	if maxSize := handler.maxURLUploadSize(); maxSize > 0 && uint64(size) > maxSize {
+		res.Body.Close()
+		return ErrSourceTooLarge
+	}
+
+	return handler.Put(ctx, res.Body, dst, uint64(size))
+}
+
+// isHTTPURL 返回 u 是否为带有主机的 http 或 https 地址
+func isHTTPURL(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// fetchSource 获取远程文件。重定向由此处逐个跟随，每次请求前检查目标地址，
+// 并在连接时再次检查实际连接的地址，防止域名在检查后被解析至内网地址
+func (handler Driver) fetchSource(ctx context.Context, src *url.URL) (*http.Response, error) {
+	allowPrivate := model.IsTrueVal(model.GetSettingByName("onedrive_url_upload_allow_private"))
+	client := handler.HTTPClient
+	if httpClient, ok := client.(request.HTTPClient); ok && !allowPrivate {
+		httpClient.PublicOnly = true
+		client = httpClient
+	}
+
+	for redirects := 0; ; redirects++ {
+		if !allowPrivate {
+			if err := request.CheckPublicHost(ctx, src.Hostname()); err != nil {
+				return nil, err
+			}
+		}
+
+		res := client.Request(
+			"GET",
+			src.String(),
+			nil,
+			request.WithContext(ctx),
+			request.WithTimeout(time.Duration(0)),
+			request.WithoutRedirect(),
+		)
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		switch res.Response.StatusCode {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+			http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			res.Response.Body.Close()
+			if redirects >= maxSourceRedirects {
+				return nil, ErrSourceTooManyRedirects
+			}
+			next, err := src.Parse(res.Response.Header.Get("Location"))
+			if err != nil || !isHTTPURL(next) {
+				return nil, ErrInvalidSourceURL
+			}
+			src = next
+			continue
+		}
+
+		if res = res.CheckHTTPResponse(200); res.Err != nil {
+			res.Response.Body.Close()
+			return nil, res.Err
+		}
+		return res.Response, nil
+	}
+}
+
+// maxURLUploadSize 获取远程文件的最大允许大小，取存储策略与设置项中较小的非零值，0 表示不限制
+func (handler Driver) maxURLUploadSize() uint64 {
+	maxSize := uint64(model.GetIntSetting("onedrive_url_upload_max_size", 0))
+	if policyMax := handler.Policy.MaxSize; policyMax > 0 && (maxSize == 0 || policyMax < maxSize) {
+		maxSize = policyMax
+	}
+	return maxSize
+}
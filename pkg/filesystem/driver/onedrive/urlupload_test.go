@@ -0,0 +1,274 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+// uploadSessionClientMock 模拟上传会话，记录收到的文件内容
+type uploadSessionClientMock struct {
+	mu       *sync.Mutex
+	received *bytes.Buffer
+	chunks   *int
+}
+
+func (m uploadSessionClientMock) Request(method, target string, body io.Reader, opts ...request.Option) *request.Response {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case method == "POST" && strings.HasSuffix(target, ":/createUploadSession"):
+		return shortcutResponse(200, `{"uploadUrl":"upload"}`)
+	case method == "PUT" && target == "upload":
+		*m.chunks++
+		io.Copy(m.received, body)
+		return shortcutResponse(202, `{"nextExpectedRanges":[]}`)
+	case method == "PUT" && strings.HasSuffix(target, ":/content"):
+		io.Copy(m.received, body)
+		return shortcutResponse(201, `{"name":"file","file":{}}`)
+	}
+	return &request.Response{Err: errors.New("unexpected request " + method + " " + target)}
+}
+
+func TestDriver_PutFromURL(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+	cache.Set("setting_onedrive_url_upload_timeout", "60", 0)
+	cache.Set("setting_onedrive_url_upload_max_size", "0", 0)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_chunk_retries", "0", 0)
+	cache.Set("setting_onedrive_url_upload_allow_private", "1", 0)
+	defer cache.Set("setting_onedrive_url_upload_allow_private", "0", 0)
+
+	small := "hello, Cloudreve"
+	large := strings.Repeat("0123456789", 500*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small":
+			w.Write([]byte(small))
+		case "/redirect":
+			http.Redirect(w, r, "/small", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/large":
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(large))
+		case "/chunked":
+			w.(http.Flusher).Flush()
+			w.Write([]byte(small))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	policy := &model.Policy{}
+	policy.OptionsSerialized.OdChunkSize = 2 * 1024 * 1024
+	handler := Driver{
+		Policy:     &model.Policy{},
+		HTTPClient: request.HTTPClient{},
+	}
+	handler.Client, _ = NewClient(policy)
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	newMock := func() uploadSessionClientMock {
+		return uploadSessionClientMock{mu: &sync.Mutex{}, received: &bytes.Buffer{}, chunks: new(int)}
+	}
+
+	// 小文件使用简单上传
+	{
+		clientMock := newMock()
+		handler.Client.Request = clientMock
+		err := handler.PutFromURL(context.Background(), server.URL+"/small", "dir/small.txt")
+		asserts.NoError(err)
+		asserts.Equal(small, clientMock.received.String())
+		asserts.Equal(0, *clientMock.chunks)
+	}
+
+	// 跟随重定向
+	{
+		clientMock := newMock()
+		handler.Client.Request = clientMock
+		err := handler.PutFromURL(context.Background(), server.URL+"/redirect", "dir/small.txt")
+		asserts.NoError(err)
+		asserts.Equal(small, clientMock.received.String())
+	}
+
+	// 重定向次数过多
+	{
+		err := handler.PutFromURL(context.Background(), server.URL+"/loop", "dir/loop.txt")
+		asserts.True(errors.Is(err, ErrSourceTooManyRedirects), "%v", err)
+	}
+
+	// 大文件分片上传
+	{
+		clientMock := newMock()
+		handler.Client.Request = clientMock
+		err := handler.PutFromURL(context.Background(), server.URL+"/large", "dir/large.txt")
+		asserts.NoError(err)
+		asserts.Equal(3, *clientMock.chunks)
+		asserts.True(clientMock.received.String() == large)
+	}
+
+	// 超过大小限制
+	{
+		clientMock := newMock()
+		handler.Client.Request = clientMock
+		cache.Set("setting_onedrive_url_upload_max_size", "1024", 0)
+		err := handler.PutFromURL(context.Background(), server.URL+"/large", "dir/large.txt")
+		cache.Set("setting_onedrive_url_upload_max_size", "0", 0)
+		asserts.Equal(ErrSourceTooLarge, err)
+		asserts.Zero(clientMock.received.Len())
+
+		handler.Policy.MaxSize = 1024
+		err = handler.PutFromURL(context.Background(), server.URL+"/large", "dir/large.txt")
+		handler.Policy.MaxSize = 0
+		asserts.Equal(ErrSourceTooLarge, err)
+	}
+
+	// 远程文件未返回大小
+	{
+		err := handler.PutFromURL(context.Background(), server.URL+"/chunked", "dir/chunked.txt")
+		asserts.Equal(ErrSourceSizeUnknown, err)
+	}
+
+	// 远程文件不存在
+	{
+		err := handler.PutFromURL(context.Background(), server.URL+"/missing", "dir/missing.txt")
+		asserts.Error(err)
+	}
+
+	// 地址无效
+	{
+		for _, srcURL := range []string{"ftp://example.com/a.txt", "file:///etc/passwd", "/relative", "http://", "://bad"} {
+			asserts.Equal(ErrInvalidSourceURL, handler.PutFromURL(context.Background(), srcURL, "dst"), srcURL)
+		}
+	}
+
+	// 超时
+	{
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		defer slow.Close()
+		cache.Set("setting_onedrive_url_upload_timeout", "1", 0)
+		start := time.Now()
+		err := handler.PutFromURL(context.Background(), slow.URL, "dir/slow.txt")
+		cache.Set("setting_onedrive_url_upload_timeout", "60", 0)
+		asserts.Error(err)
+		asserts.True(time.Since(start) < 4*time.Second)
+	}
+}
+
+// sourceClientMock 模拟远程文件服务器，按地址返回预设的响应并记录请求的地址
+type sourceClientMock struct {
+	responses map[string]*http.Response
+	requested *[]string
+}
+
+func (m sourceClientMock) Request(method, target string, body io.Reader, opts ...request.Option) *request.Response {
+	*m.requested = append(*m.requested, target)
+	if res, ok := m.responses[target]; ok {
+		return &request.Response{Response: res}
+	}
+	return &request.Response{Err: errors.New("unexpected request " + method + " " + target)}
+}
+
+func TestDriver_PutFromURL_PrivateAddress(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_url_upload_timeout", "60", 0)
+	cache.Set("setting_onedrive_url_upload_allow_private", "0", 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer server.Close()
+
+	// 拒绝环回、内网及链路本地地址
+	{
+		handler := Driver{Policy: &model.Policy{}, HTTPClient: request.HTTPClient{}}
+		for _, srcURL := range []string{
+			server.URL,
+			"http://localhost/a.txt",
+			"http://127.0.0.1/a.txt",
+			"http://[::1]/a.txt",
+			"http://10.0.0.1/a.txt",
+			"http://172.16.0.1/a.txt",
+			"http://192.168.1.1/a.txt",
+			"http://169.254.169.254/latest/meta-data/",
+			"http://[fe80::1]/a.txt",
+			"http://0.0.0.0/a.txt",
+		} {
+			err := handler.PutFromURL(context.Background(), srcURL, "dst")
+			asserts.True(errors.Is(err, request.ErrPrivateAddress), "%s: %v", srcURL, err)
+		}
+	}
+
+	// 重定向至内网地址时拒绝，且不请求重定向后的地址
+	{
+		redirect := func(location string) *http.Response {
+			return &http.Response{
+				StatusCode: http.StatusFound,
+				Header:     http.Header{"Location": []string{location}},
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+			}
+		}
+		var requested []string
+		handler := Driver{Policy: &model.Policy{}, HTTPClient: sourceClientMock{
+			responses: map[string]*http.Response{
+				"http://93.184.216.34/metadata": redirect("http://169.254.169.254/latest/meta-data/"),
+				"http://93.184.216.34/ipv6":     redirect("http://[::1]/a.txt"),
+				"http://93.184.216.34/file":     redirect("file:///etc/passwd"),
+			},
+			requested: &requested,
+		}}
+
+		err := handler.PutFromURL(context.Background(), "http://93.184.216.34/metadata", "dst")
+		asserts.True(errors.Is(err, request.ErrPrivateAddress), "%v", err)
+		err = handler.PutFromURL(context.Background(), "http://93.184.216.34/ipv6", "dst")
+		asserts.True(errors.Is(err, request.ErrPrivateAddress), "%v", err)
+		err = handler.PutFromURL(context.Background(), "http://93.184.216.34/file", "dst")
+		asserts.True(errors.Is(err, ErrInvalidSourceURL), "%v", err)
+		asserts.Equal([]string{
+			"http://93.184.216.34/metadata",
+			"http://93.184.216.34/ipv6",
+			"http://93.184.216.34/file",
+		}, requested)
+	}
+}
+
+func TestDriver_MaxURLUploadSize(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{Policy: &model.Policy{}}
+	testCases := []struct {
+		setting  string
+		policy   uint64
+		expected uint64
+	}{
+		{"0", 0, 0},
+		{"100", 0, 100},
+		{"0", 50, 50},
+		{"100", 50, 50},
+		{"50", 100, 50},
+	}
+	for i, testCase := range testCases {
+		cache.Set("setting_onedrive_url_upload_max_size", testCase.setting, 0)
+		handler.Policy.MaxSize = testCase.policy
+		asserts.Equal(testCase.expected, handler.maxURLUploadSize(), "Test Case #%d", i)
+	}
+	cache.Set("setting_onedrive_url_upload_max_size", "0", 0)
+}
@@ -0,0 +1,23 @@
+package onedrive
+
+import (
+	"net/http"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+)
+
+// userAgent 获取 OneDrive 请求使用的 User-Agent，可通过设置项 onedrive_user_agent 覆盖。
+// 使用可识别的 User-Agent 便于管理员在微软的日志中区分 Cloudreve 的请求
+func userAgent() string {
+	if ua := model.GetSettingByName("onedrive_user_agent"); ua != "" {
+		return ua
+	}
+	return "Cloudreve/" + conf.BackendVersion + " (+https://cloudreve.org)"
+}
+
+// withUserAgent 为请求设置 User-Agent
+func withUserAgent() request.Option {
+	return request.WithHeader(http.Header{"User-Agent": {userAgent()}})
+}
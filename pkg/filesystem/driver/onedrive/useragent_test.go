@@ -0,0 +1,87 @@
+package onedrive
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserAgent(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 未设置时使用默认值
+	{
+		cache.Set("setting_onedrive_user_agent", "", 0)
+		asserts.Equal("Cloudreve/"+conf.BackendVersion+" (+https://cloudreve.org)", userAgent())
+	}
+
+	// 设置项覆盖
+	{
+		cache.Set("setting_onedrive_user_agent", "ISV|Cloudreve|Custom/1.0", 0)
+		asserts.Equal("ISV|Cloudreve|Custom/1.0", userAgent())
+		cache.Set("setting_onedrive_user_agent", "", 0)
+	}
+}
+
+func TestClient_Request_UserAgent(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_onedrive_user_agent", "Cloudreve-Test/1.0", 0)
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_chunk_retries", "0", 0)
+	defer cache.Set("setting_onedrive_user_agent", "", 0)
+
+	var (
+		mu     sync.Mutex
+		agents = make(map[string]string)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents[r.Method+" "+r.URL.Path] = r.Header.Get("User-Agent")
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/token":
+			w.Write([]byte(`{"access_token":"AccessToken","refresh_token":"RefreshToken","expires_in":3600}`))
+		case r.URL.Path == "/upload":
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"nextExpectedRanges":["3-"]}`))
+		default:
+			w.Write([]byte(`{"name":"a.txt"}`))
+		}
+	}))
+	defer server.Close()
+
+	policy := &model.Policy{Server: server.URL + "/v1.0/me", AccessKey: "RefreshToken", BucketName: "user_agent_client"}
+	client, err := NewClient(policy)
+	asserts.NoError(err)
+	tokenURL, _ := url.Parse(server.URL + "/token")
+	client.Endpoints.OAuthEndpoints.token = *tokenURL
+
+	// 刷新凭证、接口请求、上传分片均携带 User-Agent
+	_, err = client.Meta(context.Background(), "", "a.txt")
+	asserts.NoError(err)
+	_, err = client.UploadChunk(context.Background(), server.URL+"/upload", &Chunk{
+		Offset:    0,
+		ChunkSize: 3,
+		Total:     6,
+		Data:      []byte("123"),
+	})
+	asserts.NoError(err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	asserts.Equal("Cloudreve-Test/1.0", agents["POST /token"])
+	asserts.Equal("Cloudreve-Test/1.0", agents["GET /v1.0/me/drive/root:/a.txt"])
+	asserts.Equal("Cloudreve-Test/1.0", agents["PUT /upload"])
+	for request, agent := range agents {
+		asserts.False(strings.HasPrefix(agent, "Go-http-client"), request)
+	}
+}
@@ -0,0 +1,153 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// ErrInvalidVersion 未指定要恢复的历史版本，或版本ID无效
+var ErrInvalidVersion = errors.New("无效的版本ID")
+
+// FileVersion 文件的历史版本
+type FileVersion struct {
+	ID         string    `json:"id"`
+	Size       uint64    `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	// Author 最后修改此版本的用户或应用名称
+	Author string `json:"author"`
+}
+
+// versionsResponse 列取历史版本的单页响应
+type versionsResponse struct {
+	Value    []driveItemVersion `json:"value"`
+	NextLink string             `json:"@odata.nextLink"`
+}
+
+// driveItemVersion 接口返回的历史版本
+type driveItemVersion struct {
+	ID                   string      `json:"id"`
+	Size                 uint64      `json:"size"`
+	LastModifiedDateTime time.Time   `json:"lastModifiedDateTime"`
+	LastModifiedBy       identitySet `json:"lastModifiedBy"`
+}
+
+// identitySet 执行操作的用户或应用
+type identitySet struct {
+	User        *identity `json:"user"`
+	Application *identity `json:"application"`
+}
+
+type identity struct {
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email"`
+}
+
+// name 获取用于展示的名称，优先使用用户名称
+func (set identitySet) name() string {
+	if set.User != nil {
+		if set.User.DisplayName != "" {
+			return set.User.DisplayName
+		}
+		if set.User.Email != "" {
+			return set.User.Email
+		}
+	}
+	if set.Application != nil {
+		return set.Application.DisplayName
+	}
+	return ""
+}
+
+// ListVersions 列取 src 的历史版本，自动跟随 nextLink 获取所有分页，最新的版本在前
+func (client *Client) ListVersions(ctx context.Context, src string) ([]FileVersion, error) {
+	requestURL := client.getItemRequestURL(strings.TrimPrefix(src, "/"), "versions")
+
+	res := make([]FileVersion, 0)
+	for requestURL != "" {
+		select {
+		case <-ctx.Done():
+			util.Log().Debug("OneDrive 客户端取消")
+			return nil, ErrClientCanceled
+		default:
+		}
+
+		body, respErr := client.requestWithStr(ctx, "GET", requestURL, "", 200)
+		if respErr != nil {
+			return nil, respErr
+		}
+
+		var page versionsResponse
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			return nil, err
+		}
+		for _, v := range page.Value {
+			res = append(res, FileVersion{
+				ID:         v.ID,
+				Size:       v.Size,
+				ModifiedAt: v.LastModifiedDateTime,
+				Author:     v.LastModifiedBy.name(),
+			})
+		}
+		requestURL = page.NextLink
+	}
+
+	return res, nil
+}
+
+// RestoreVersion 将 src 恢复为 versionID 指定的历史版本，恢复后的内容成为新的当前版本
+func (client *Client) RestoreVersion(ctx context.Context, src, versionID string) error {
+	if versionID == "" || strings.Contains(versionID, "/") {
+		return ErrInvalidVersion
+	}
+
+	requestURL := client.getItemRequestURL(
+		strings.TrimPrefix(src, "/"),
+		"versions/"+versionID+"/restoreVersion",
+	)
+	if _, err := client.requestWithStr(ctx, "POST", requestURL, "", 204); err != nil {
+		return err
+	}
+	return nil
+}
+
+// isVersioningUnavailable 返回错误是否表示文件所在的驱动器未启用版本历史
+func isVersioningUnavailable(err error) bool {
+	respErr, ok := asRespError(err)
+	if !ok {
+		return false
+	}
+	return respErr.APIError.Code == "notSupported" ||
+		respErr.Status == http.StatusMethodNotAllowed ||
+		respErr.Status == http.StatusNotImplemented
+}
+
+// ListVersions 列取 path 处文件的历史版本。驱动器未启用版本历史时返回空列表
+func (handler Driver) ListVersions(ctx context.Context, path string) ([]FileVersion, error) {
+	versions, err := handler.Client.ListVersions(ctx, path)
+	if err != nil {
+		if isVersioningUnavailable(err) {
+			return []FileVersion{}, nil
+		}
+		return nil, err
+	}
+	return versions, nil
+}
+
+// RestoreVersion 将 path 处的文件恢复为 versionID 指定的历史版本，并清除文件内容相关的缓存
+func (handler Driver) RestoreVersion(ctx context.Context, path, versionID string) error {
+	if err := handler.Client.RestoreVersion(ctx, path, versionID); err != nil {
+		return err
+	}
+
+	// 外链地址缓存键未统一去除开头的 /，两种形式一并清除
+	invalidateSourceCache(handler.Policy.ID, path, strings.TrimPrefix(path, "/"))
+	invalidateListCache(handler.Policy.ID, path)
+	invalidateThumbCache(handler.Policy.ID, path)
+	return nil
+}
@@ -0,0 +1,135 @@
+package onedrive
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestDriver_ListVersions(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+
+	// 成功，跟随分页
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/dir/a.docx:/versions", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"value":[
+				{"id":"3.0","size":300,"lastModifiedDateTime":"2020-01-03T00:00:00Z","lastModifiedBy":{"user":{"displayName":"Alice"}}},
+				{"id":"2.0","size":200,"lastModifiedDateTime":"2020-01-02T00:00:00Z","lastModifiedBy":{"user":{"email":"bob@cqu.edu.cn"}}}
+			],"@odata.nextLink":"next"}`))
+		clientMock.On("Request", "GET", "next", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{"value":[
+				{"id":"1.0","size":100,"lastModifiedDateTime":"2020-01-01T00:00:00Z","lastModifiedBy":{"application":{"displayName":"Cloudreve"}}}
+			]}`))
+		handler.Client.Request = clientMock
+		res, err := handler.ListVersions(context.Background(), "/dir/a.docx")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Len(res, 3)
+		asserts.Equal(FileVersion{
+			ID:         "3.0",
+			Size:       300,
+			ModifiedAt: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+			Author:     "Alice",
+		}, res[0])
+		asserts.Equal("bob@cqu.edu.cn", res[1].Author)
+		asserts.Equal("Cloudreve", res[2].Author)
+		asserts.EqualValues(100, res[2].Size)
+	}
+
+	// 未启用版本历史，返回空列表
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/b.txt:/versions", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(400, `{"error":{"code":"notSupported","message":"Versioning is not enabled"}}`))
+		handler.Client.Request = clientMock
+		res, err := handler.ListVersions(context.Background(), "b.txt")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.NotNil(res)
+		asserts.Len(res, 0)
+	}
+
+	// 文件不存在
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/none.txt:/versions", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(404, `{"error":{"code":"itemNotFound"}}`))
+		handler.Client.Request = clientMock
+		res, err := handler.ListVersions(context.Background(), "none.txt")
+		clientMock.AssertExpectations(t)
+		asserts.True(IsNotFound(err))
+		asserts.Nil(res)
+	}
+
+	// 无法解析响应
+	{
+		clientMock := ClientMock{}
+		clientMock.On("Request", "GET", "drive/root:/bad.txt:/versions", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(200, `{`))
+		handler.Client.Request = clientMock
+		_, err := handler.ListVersions(context.Background(), "bad.txt")
+		asserts.Error(err)
+	}
+}
+
+func TestDriver_RestoreVersion(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{},
+	}
+	handler.Policy.ID = 78
+	handler.Client, _ = NewClient(&model.Policy{})
+	handler.Client.Credential.AccessToken = "AccessToken"
+	handler.Client.Credential.ExpiresIn = time.Now().Add(time.Duration(100) * time.Hour).Unix()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+
+	// 成功，清除文件缓存
+	{
+		cache.Set(sourceCachePrefix+getSourceCacheKey(78, "dir/a.docx", false), "https://cqu.edu.cn/a", 0)
+		setCachedThumb(78, "dir/a.docx", 10, 20, "thumb", 60)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", "drive/root:/dir/a.docx:/versions/2.0/restoreVersion", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(204, ``))
+		handler.Client.Request = clientMock
+		err := handler.RestoreVersion(context.Background(), "/dir/a.docx", "2.0")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		_, ok := cache.Get(sourceCachePrefix + getSourceCacheKey(78, "dir/a.docx", false))
+		asserts.False(ok)
+		_, ok = getCachedThumb(78, "dir/a.docx", 10, 20)
+		asserts.False(ok)
+	}
+
+	// 未指定版本或版本ID无效
+	{
+		asserts.Equal(ErrInvalidVersion, handler.RestoreVersion(context.Background(), "a.docx", ""))
+		asserts.Equal(ErrInvalidVersion, handler.RestoreVersion(context.Background(), "a.docx", "../1.0"))
+	}
+
+	// 版本不存在
+	{
+		cache.Set(sourceCachePrefix+getSourceCacheKey(78, "a.docx", false), "https://cqu.edu.cn/a", 0)
+		clientMock := ClientMock{}
+		clientMock.On("Request", "POST", "drive/root:/a.docx:/versions/9.0/restoreVersion", testMock.Anything, testMock.Anything).
+			Return(shortcutResponse(404, `{"error":{"code":"itemNotFound"}}`))
+		handler.Client.Request = clientMock
+		err := handler.RestoreVersion(context.Background(), "a.docx", "9.0")
+		clientMock.AssertExpectations(t)
+		asserts.True(IsNotFound(err))
+		_, ok := cache.Get(sourceCachePrefix + getSourceCacheKey(78, "a.docx", false))
+		asserts.True(ok)
+	}
+}
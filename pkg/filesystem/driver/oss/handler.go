@@ -9,9 +9,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -177,7 +179,7 @@ func (handler Driver) List(ctx context.Context, base string, recursive bool) ([]
 		})
 	}
 
-	return res, nil
+	return fsctx.ListFilter(ctx).Filter(res), nil
 }
 
 // Get 获取文件
@@ -272,6 +274,30 @@ func (handler Driver) Delete(ctx context.Context, files []string) ([]string, err
 	return []string{}, nil
 }
 
+// Head 获取文件元信息
+func (handler Driver) Head(ctx context.Context, path string) (response.Object, error) {
+	// 初始化客户端
+	if err := handler.InitOSSClient(false); err != nil {
+		return response.Object{}, err
+	}
+
+	header, err := handler.bucket.GetObjectDetailedMeta(path)
+	if err != nil {
+		return response.Object{}, err
+	}
+
+	size, _ := strconv.ParseUint(header.Get("Content-Length"), 10, 64)
+	lastModify, _ := http.ParseTime(header.Get("Last-Modified"))
+	return response.Object{
+		Name:         filepath.Base(path),
+		RelativePath: filepath.Base(path),
+		Source:       path,
+		Size:         size,
+		LastModify:   lastModify,
+		ETag:         strings.Trim(header.Get("ETag"), `"`),
+	}, nil
+}
+
 // Thumb 获取文件缩略图
 func (handler Driver) Thumb(ctx context.Context, path string) (*response.ContentResponse, error) {
 	// 初始化客户端
@@ -382,8 +408,7 @@ func (handler Driver) signSourceURL(ctx context.Context, path string, ttl int64,
 		if err != nil {
 			return "", err
 		}
-		finalURL.Host = cdnURL.Host
-		finalURL.Scheme = cdnURL.Scheme
+		util.ReplaceURLBase(finalURL, cdnURL)
 	}
 
 	return finalURL.String(), nil
@@ -466,3 +491,8 @@ func (handler Driver) getUploadCredential(ctx context.Context, policy UploadPoli
 		Token:     signature,
 	}, nil
 }
+
+// Close 释放资源，此存储策略无需清理
+func (handler Driver) Close() error {
+	return nil
+}
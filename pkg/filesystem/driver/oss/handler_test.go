@@ -189,6 +189,20 @@ func TestDriver_Source(t *testing.T) {
 		asserts.Contains(resURL.String(), handler.Policy.BaseURL)
 	}
 
+	// 正常 CDN 地址带路径前缀，私有空间保留签名参数
+	{
+		handler.Policy.IsPrivate = true
+		handler.Policy.BaseURL = "https://cqu.edu.cn/oss"
+		res, err := handler.Source(context.Background(), "dir/123", url.URL{}, 10, false, 0)
+		asserts.NoError(err)
+		resURL, err := url.Parse(res)
+		asserts.NoError(err)
+		asserts.Equal("cqu.edu.cn", resURL.Host)
+		asserts.Equal("/oss/dir/123", resURL.Path)
+		asserts.NotEmpty(resURL.Query().Get("Signature"))
+		handler.Policy.IsPrivate = false
+	}
+
 	// 强制使用公网 Endpoint
 	{
 		handler.Policy.BaseURL = ""
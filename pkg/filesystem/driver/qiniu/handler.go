@@ -96,7 +96,7 @@ func (handler Driver) List(ctx context.Context, base string, recursive bool) ([]
 		})
 	}
 
-	return res, nil
+	return fsctx.ListFilter(ctx).Filter(res), nil
 }
 
 // Get 获取文件
@@ -216,6 +216,29 @@ func (handler Driver) Delete(ctx context.Context, files []string) ([]string, err
 	return []string{}, nil
 }
 
+// Head 获取文件元信息
+func (handler Driver) Head(ctx context.Context, path string) (response.Object, error) {
+	mac := qbox.NewMac(handler.Policy.AccessKey, handler.Policy.SecretKey)
+	cfg := storage.Config{
+		UseHTTPS: true,
+	}
+	bucketManager := storage.NewBucketManager(mac, &cfg)
+	info, err := bucketManager.Stat(handler.Policy.BucketName, path)
+	if err != nil {
+		return response.Object{}, err
+	}
+
+	// PutTime 以 100 纳秒为单位
+	return response.Object{
+		Name:         filepath.Base(path),
+		RelativePath: filepath.Base(path),
+		Source:       path,
+		Size:         uint64(info.Fsize),
+		LastModify:   time.Unix(0, info.PutTime*100),
+		ETag:         info.Hash,
+	}, nil
+}
+
 // Thumb 获取文件缩略图
 func (handler Driver) Thumb(ctx context.Context, path string) (*response.ContentResponse, error) {
 	var (
@@ -314,3 +337,8 @@ func (handler Driver) getUploadCredential(ctx context.Context, policy storage.Pu
 		Token: upToken,
 	}, nil
 }
+
+// Close 释放资源，此存储策略无需清理
+func (handler Driver) Close() error {
+	return nil
+}
@@ -1,6 +1,7 @@
 package remote
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -10,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,8 +21,15 @@ import (
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 )
 
+// DefaultChunkSize 未设置时上传至从机的分片大小
+const DefaultChunkSize = 10 * 1024 * 1024
+
+// ErrChunkSessionLost 从机已接收的数据与本地不一致，无法续传
+var ErrChunkSessionLost = errors.New("从机分片上传会话已失效，无法续传")
+
 // Driver 远程存储策略适配器
 type Driver struct {
 	Client       request.Client
@@ -66,7 +75,7 @@ func (handler Driver) List(ctx context.Context, path string, recursive bool) ([]
 		}
 	}
 
-	return res, nil
+	return fsctx.ListFilter(ctx).Filter(res), nil
 }
 
 // getAPIUrl 获取接口请求地址
@@ -84,6 +93,8 @@ func (handler Driver) getAPIUrl(scope string, routes ...string) string {
 		controller, _ = url.Parse("/api/v3/slave/thumb")
 	case "list":
 		controller, _ = url.Parse("/api/v3/slave/list")
+	case "chunk":
+		controller, _ = url.Parse("/api/v3/slave/upload/chunk")
 	default:
 		controller = serverURL
 	}
@@ -155,6 +166,13 @@ func (handler Driver) Put(ctx context.Context, file io.ReadCloser, dst string, s
 	if err != nil {
 		return err
 	}
+
+	// 大文件分片上传，以便网络中断后续传
+	chunkSize := handler.chunkSize()
+	if size > chunkSize {
+		return handler.putChunks(ctx, file, size, chunkSize, credential, fileName)
+	}
+
 	// 上传文件
 	resp, err := handler.Client.Request(
 		"POST",
@@ -178,6 +196,130 @@ func (handler Driver) Put(ctx context.Context, file io.ReadCloser, dst string, s
 	return nil
 }
 
+// chunkSize 获取分片上传时的分片大小
+func (handler Driver) chunkSize() uint64 {
+	chunkSize := model.GetIntSetting("slave_chunk_size", DefaultChunkSize)
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	return uint64(chunkSize)
+}
+
+// putChunks 将文件流按固定大小分片上传至从机。分片上传失败时查询从机已确认接收的偏移，
+// 并从该偏移处续传当前分片。从机保存文件成功后才视为上传完成
+func (handler Driver) putChunks(ctx context.Context, file io.Reader, size, chunkSize uint64, credential serializer.UploadCredential, fileName string) error {
+	sessionID := util.RandStringRunes(32)
+	maxRetry := model.GetIntSetting("slave_chunk_retries", 3)
+	buf := make([]byte, chunkSize)
+
+	for offset := uint64(0); offset < size; {
+		// 读取当前分片，失败重传时需要再次发送
+		end := offset + chunkSize
+		if end > size {
+			end = size
+		}
+		chunk := buf[:end-offset]
+		if _, err := io.ReadFull(file, chunk); err != nil {
+			return err
+		}
+
+		confirmed := offset
+		for retried := 0; ; retried++ {
+			err := handler.uploadChunk(ctx, sessionID, confirmed, size, chunk[confirmed-offset:], credential, fileName)
+			if err == nil {
+				break
+			}
+
+			// 从机返回的业务错误不再重试
+			if _, ok := err.(serializer.AppError); ok || retried >= maxRetry {
+				return err
+			}
+
+			util.Log().Debug("分片[%d]上传失败[%s]，将查询从机已接收的偏移并续传", offset/chunkSize, err)
+			status, queryErr := handler.getChunkStatus(ctx, sessionID, credential)
+			if queryErr != nil {
+				// 无法查询时从上次确认的位置重传，从机会丢弃其后的数据
+				continue
+			}
+			if status.Completed {
+				return nil
+			}
+			if status.Received < offset || status.Received > end {
+				return ErrChunkSessionLost
+			}
+			// 最后一个分片须由从机确认文件已保存，数据已全部接收时重新提交以取得保存结果
+			if status.Received == end && end < size {
+				break
+			}
+			confirmed = status.Received
+		}
+
+		offset = end
+	}
+
+	return nil
+}
+
+// uploadChunk 从 offset 处上传一个分片
+func (handler Driver) uploadChunk(ctx context.Context, sessionID string, offset, size uint64, chunk []byte, credential serializer.UploadCredential, fileName string) error {
+	signTTL := model.GetIntSetting("slave_api_timeout", 60)
+	resp, err := handler.Client.Request(
+		"POST",
+		handler.getAPIUrl("chunk", sessionID),
+		bytes.NewReader(chunk),
+		request.WithHeader(map[string][]string{
+			"X-Policy":       {credential.Policy},
+			"X-FileName":     {fileName},
+			"X-Chunk-Offset": {strconv.FormatUint(offset, 10)},
+			"X-Total-Size":   {strconv.FormatUint(size, 10)},
+		}),
+		request.WithCredential(handler.AuthInstance, int64(signTTL)),
+		request.WithContentLength(int64(len(chunk))),
+		request.WithContext(ctx),
+		request.WithTimeout(time.Duration(0)),
+	).CheckHTTPResponse(200).DecodeResponse()
+	if err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return serializer.NewError(resp.Code, resp.Msg, errors.New(resp.Error))
+	}
+
+	return nil
+}
+
+// getChunkStatus 查询从机分片上传会话已确认接收的字节数及文件是否已保存
+func (handler Driver) getChunkStatus(ctx context.Context, sessionID string, credential serializer.UploadCredential) (serializer.SlaveChunkStatus, error) {
+	var status serializer.SlaveChunkStatus
+	signTTL := model.GetIntSetting("slave_api_timeout", 60)
+	resp, err := handler.Client.Request(
+		"POST",
+		handler.getAPIUrl("chunk", sessionID, "status"),
+		nil,
+		request.WithHeader(map[string][]string{
+			"X-Policy": {credential.Policy},
+		}),
+		request.WithCredential(handler.AuthInstance, int64(signTTL)),
+		request.WithContext(ctx),
+	).CheckHTTPResponse(200).DecodeResponse()
+	if err != nil {
+		return status, err
+	}
+	if resp.Code != 0 {
+		return status, errors.New(resp.Msg)
+	}
+
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		return status, err
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return status, errors.New("未知的返回结果格式")
+	}
+
+	return status, nil
+}
+
 // Delete 删除一个或多个文件，
 // 返回未删除的文件，及遇到的最后一个错误
 func (handler Driver) Delete(ctx context.Context, files []string) ([]string, error) {
@@ -223,6 +365,11 @@ func (handler Driver) Delete(ctx context.Context, files []string) ([]string, err
 	return []string{}, nil
 }
 
+// Head 获取文件元信息，从机暂未提供此接口
+func (handler Driver) Head(ctx context.Context, path string) (response.Object, error) {
+	return response.Object{}, serializer.NewError(serializer.CodePolicyNotAllowed, "当前存储策略不支持获取文件信息", nil)
+}
+
 // Thumb 获取文件缩略图
 func (handler Driver) Thumb(ctx context.Context, path string) (*response.ContentResponse, error) {
 	sourcePath := base64.RawURLEncoding.EncodeToString([]byte(path))
@@ -333,3 +480,8 @@ func (handler Driver) getUploadCredential(ctx context.Context, policy serializer
 	}
 	return serializer.UploadCredential{}, errors.New("无法签名上传策略")
 }
+
+// Close 释放资源，此存储策略无需清理
+func (handler Driver) Close() error {
+	return nil
+}
@@ -2,11 +2,15 @@ package remote
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
@@ -379,6 +383,7 @@ func TestHandler_Put(t *testing.T) {
 	}
 	ctx := context.Background()
 	asserts.NoError(cache.Set("setting_upload_credential_timeout", "3600", 0))
+	asserts.NoError(cache.Set("setting_slave_chunk_size", "1048576", 0))
 
 	// 成功
 	{
@@ -451,6 +456,184 @@ func TestHandler_Put(t *testing.T) {
 
 }
 
+// chunkSlave 模拟从机的分片上传接口，可在指定请求的处理中途断开连接
+type chunkSlave struct {
+	mu       sync.Mutex
+	received []byte
+	saved    []byte
+	offsets  []uint64
+	requests int
+	// disconnect 接收一半数据后断开
+	disconnect int
+	// dropBeforeSave 接收全部数据、保存文件前断开
+	dropBeforeSave int
+	// dropAfterSave 保存文件后断开，主机收不到保存结果
+	dropAfterSave int
+}
+
+func (slave *chunkSlave) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	slave.mu.Lock()
+	defer slave.mu.Unlock()
+	drop := func() {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}
+
+	// 查询已接收的偏移
+	if strings.HasSuffix(r.URL.Path, "/status") {
+		fmt.Fprintf(w, `{"code":0,"data":{"received":%d,"completed":%t}}`, len(slave.received), slave.saved != nil)
+		return
+	}
+
+	offset, _ := strconv.ParseUint(r.Header.Get("X-Chunk-Offset"), 10, 64)
+	size, _ := strconv.ParseUint(r.Header.Get("X-Total-Size"), 10, 64)
+	slave.offsets = append(slave.offsets, offset)
+	slave.requests++
+	if slave.saved != nil && offset+uint64(r.ContentLength) == size {
+		fmt.Fprintf(w, `{"code":0,"data":%d}`, size)
+		return
+	}
+	if offset > uint64(len(slave.received)) {
+		fmt.Fprint(w, `{"code":40002,"msg":"分片起始偏移超出已接收的数据"}`)
+		return
+	}
+	slave.received = slave.received[:offset]
+
+	if slave.requests == slave.disconnect {
+		half := make([]byte, r.ContentLength/2)
+		n, _ := io.ReadFull(r.Body, half)
+		slave.received = append(slave.received, half[:n]...)
+		drop()
+		return
+	}
+
+	content, _ := ioutil.ReadAll(r.Body)
+	slave.received = append(slave.received, content...)
+	if uint64(len(slave.received)) < size {
+		fmt.Fprintf(w, `{"code":0,"data":%d}`, len(slave.received))
+		return
+	}
+	if slave.requests == slave.dropBeforeSave {
+		drop()
+		return
+	}
+
+	// 保存文件，删除已接收的数据
+	slave.saved, slave.received = slave.received, nil
+	if slave.requests == slave.dropAfterSave {
+		drop()
+		return
+	}
+	fmt.Fprint(w, `{"code":0}`)
+}
+
+func TestHandler_PutChunks(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.NoError(cache.Set("setting_upload_credential_timeout", "3600", 0))
+	asserts.NoError(cache.Set("setting_slave_api_timeout", "60", 0))
+	asserts.NoError(cache.Set("setting_slave_chunk_size", "10", 0))
+	asserts.NoError(cache.Set("setting_slave_chunk_retries", "3", 0))
+	content := "0123456789abcdefghijklmnopqrstuvwxyz"
+
+	// 传输中断后从已确认的偏移处续传
+	{
+		slave := &chunkSlave{disconnect: 2}
+		server := httptest.NewServer(slave)
+		defer server.Close()
+		handler := Driver{
+			Client:       request.HTTPClient{},
+			Policy:       &model.Policy{Type: "remote", SecretKey: "test", Server: server.URL},
+			AuthInstance: auth.HMACAuth{SecretKey: []byte("test")},
+		}
+
+		err := handler.Put(context.Background(), ioutil.NopCloser(strings.NewReader(content)), "/dir/a.txt", uint64(len(content)))
+		asserts.NoError(err)
+		asserts.Equal(content, string(slave.saved))
+		// 第二个分片中途断开，续传从已接收的15字节处开始
+		asserts.Equal([]uint64{0, 10, 15, 20, 30}, slave.offsets)
+	}
+
+	// 最后一个分片的保存结果丢失，以从机的完成状态为准
+	{
+		slave := &chunkSlave{dropAfterSave: 4}
+		server := httptest.NewServer(slave)
+		defer server.Close()
+		handler := Driver{
+			Client:       request.HTTPClient{},
+			Policy:       &model.Policy{Type: "remote", SecretKey: "test", Server: server.URL},
+			AuthInstance: auth.HMACAuth{SecretKey: []byte("test")},
+		}
+
+		err := handler.Put(context.Background(), ioutil.NopCloser(strings.NewReader(content)), "/dir/a.txt", uint64(len(content)))
+		asserts.NoError(err)
+		asserts.Equal(content, string(slave.saved))
+		asserts.Equal([]uint64{0, 10, 20, 30}, slave.offsets)
+	}
+
+	// 最后一个分片已全部接收但尚未保存，重新提交以取得保存结果
+	{
+		slave := &chunkSlave{dropBeforeSave: 4}
+		server := httptest.NewServer(slave)
+		defer server.Close()
+		handler := Driver{
+			Client:       request.HTTPClient{},
+			Policy:       &model.Policy{Type: "remote", SecretKey: "test", Server: server.URL},
+			AuthInstance: auth.HMACAuth{SecretKey: []byte("test")},
+		}
+
+		err := handler.Put(context.Background(), ioutil.NopCloser(strings.NewReader(content)), "/dir/a.txt", uint64(len(content)))
+		asserts.NoError(err)
+		asserts.Equal(content, string(slave.saved))
+		asserts.Equal([]uint64{0, 10, 20, 30, 36}, slave.offsets)
+	}
+
+	// 重试次数用尽
+	{
+		asserts.NoError(cache.Set("setting_slave_chunk_retries", "0", 0))
+		slave := &chunkSlave{disconnect: 1}
+		server := httptest.NewServer(slave)
+		defer server.Close()
+		handler := Driver{
+			Client:       request.HTTPClient{},
+			Policy:       &model.Policy{Type: "remote", SecretKey: "test", Server: server.URL},
+			AuthInstance: auth.HMACAuth{SecretKey: []byte("test")},
+		}
+
+		err := handler.Put(context.Background(), ioutil.NopCloser(strings.NewReader(content)), "/dir/a.txt", uint64(len(content)))
+		asserts.Error(err)
+		asserts.NoError(cache.Set("setting_slave_chunk_retries", "3", 0))
+	}
+
+	// 从机返回业务错误时不重试
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			testMock.MatchedBy(func(target string) bool {
+				return strings.HasPrefix(target, "http://test.com/api/v3/slave/upload/chunk/")
+			}),
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"code":40002,"msg":"文件太大"}`)),
+			},
+		}).Once()
+		handler := Driver{
+			Client:       clientMock,
+			Policy:       &model.Policy{Type: "remote", SecretKey: "test", Server: "http://test.com"},
+			AuthInstance: auth.HMACAuth{SecretKey: []byte("test")},
+		}
+
+		err := handler.Put(context.Background(), ioutil.NopCloser(strings.NewReader(content)), "/dir/a.txt", uint64(len(content)))
+		clientMock.AssertExpectations(t)
+		asserts.Error(err)
+	}
+}
+
 func TestHandler_Thumb(t *testing.T) {
 	asserts := assert.New(t)
 	handler := Driver{
@@ -27,6 +27,7 @@ import (
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 )
 
 // Driver 适配器模板
@@ -42,6 +43,13 @@ type UploadPolicy struct {
 	Conditions []interface{} `json:"conditions"`
 }
 
+const (
+	// MinPartSize 分片上传的最小分片大小
+	MinPartSize = s3manager.MinUploadPartSize
+	// DefaultRegion 未指定区域时使用的默认区域，大部分兼容服务均接受此值
+	DefaultRegion = "us-east-1"
+)
+
 //MetaData 文件信息
 type MetaData struct {
 	Size uint64
@@ -59,8 +67,8 @@ func (handler *Driver) InitS3Client() error {
 		sess, err := session.NewSession(&aws.Config{
 			Credentials:      credentials.NewStaticCredentials(handler.Policy.AccessKey, handler.Policy.SecretKey, ""),
 			Endpoint:         &handler.Policy.Server,
-			Region:           &handler.Policy.OptionsSerialized.Region,
-			S3ForcePathStyle: aws.Bool(false),
+			Region:           aws.String(handler.region()),
+			S3ForcePathStyle: aws.Bool(handler.Policy.OptionsSerialized.S3ForcePathStyle),
 		})
 
 		if err != nil {
@@ -72,6 +80,23 @@ func (handler *Driver) InitS3Client() error {
 	return nil
 }
 
+// region 获取存储策略的区域代码，未指定时使用默认区域
+func (handler Driver) region() string {
+	if handler.Policy.OptionsSerialized.Region == "" {
+		return DefaultRegion
+	}
+	return handler.Policy.OptionsSerialized.Region
+}
+
+// getPartSize 根据文件大小计算分片上传的分片大小，保证分片数不超过上限
+func getPartSize(size uint64) int64 {
+	partSize := int64(MinPartSize)
+	if size/uint64(partSize) >= s3manager.MaxUploadParts {
+		partSize = int64(size/s3manager.MaxUploadParts) + 1
+	}
+	return partSize
+}
+
 // List 列出给定路径下的文件
 func (handler Driver) List(ctx context.Context, base string, recursive bool) ([]response.Object, error) {
 
@@ -151,7 +176,7 @@ func (handler Driver) List(ctx context.Context, base string, recursive bool) ([]
 		})
 	}
 
-	return res, nil
+	return fsctx.ListFilter(ctx).Filter(res), nil
 
 }
 
@@ -205,9 +230,12 @@ func (handler Driver) Put(ctx context.Context, file io.ReadCloser, dst string, s
 		return err
 	}
 
-	uploader := s3manager.NewUploader(handler.sess)
+	// 超过分片大小的文件将自动使用分片上传
+	uploader := s3manager.NewUploader(handler.sess, func(u *s3manager.Uploader) {
+		u.PartSize = getPartSize(size)
+	})
 
-	_, err := uploader.Upload(&s3manager.UploadInput{
+	_, err := uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 		Bucket: &handler.Policy.BucketName,
 		Key:    &dst,
 		Body:   file,
@@ -279,6 +307,31 @@ func (handler Driver) Delete(ctx context.Context, files []string) ([]string, err
 
 }
 
+// Head 获取文件元信息
+func (handler Driver) Head(ctx context.Context, path string) (response.Object, error) {
+	// 初始化客户端
+	if err := handler.InitS3Client(); err != nil {
+		return response.Object{}, err
+	}
+
+	res, err := handler.svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: &handler.Policy.BucketName,
+		Key:    &path,
+	})
+	if err != nil {
+		return response.Object{}, err
+	}
+
+	return response.Object{
+		Name:         filepath.Base(path),
+		RelativePath: filepath.Base(path),
+		Source:       path,
+		Size:         uint64(aws.Int64Value(res.ContentLength)),
+		LastModify:   aws.TimeValue(res.LastModified),
+		ETag:         strings.Trim(aws.StringValue(res.ETag), `"`),
+	}, nil
+}
+
 // Thumb 获取文件缩略图
 func (handler Driver) Thumb(ctx context.Context, path string) (*response.ContentResponse, error) {
 	return nil, errors.New("未实现")
@@ -334,8 +387,7 @@ func (handler Driver) Source(
 		if err != nil {
 			return "", err
 		}
-		finalURL.Host = cdnURL.Host
-		finalURL.Scheme = cdnURL.Scheme
+		util.ReplaceURLBase(finalURL, cdnURL)
 	}
 
 	return finalURL.String(), nil
@@ -377,6 +429,57 @@ func (handler Driver) Token(ctx context.Context, TTL int64, key string) (seriali
 	return handler.getUploadCredential(ctx, putPolicy, apiURL)
 }
 
+// GetUploadCredential 按统一直传约定获取上传凭证，客户端将 Fields 及文件以表单
+// POST 至存储桶地址，上传成功后由存储端重定向至回调地址。上传策略还要求表单附带
+// name 及 Content-Type 字段，由客户端根据所选文件填写
+func (handler Driver) GetUploadCredential(ctx context.Context, TTL int64, key string) (serializer.UploadCredential, error) {
+	credential, err := handler.Token(ctx, TTL, key)
+	if err != nil {
+		return credential, err
+	}
+
+	uploadURL, err := handler.bucketURL()
+	if err != nil {
+		return serializer.UploadCredential{}, err
+	}
+
+	credential.Mode = serializer.UploadModeForm
+	credential.UploadURL = uploadURL
+	credential.Fields = map[string]string{
+		"key":                     credential.Path,
+		"policy":                  credential.Policy,
+		"success_action_redirect": credential.Callback,
+		"x-amz-algorithm":         "AWS4-HMAC-SHA256",
+		"x-amz-credential":        credential.AccessKey,
+		"x-amz-date":              credential.KeyTime,
+		"x-amz-signature":         credential.Token,
+	}
+	credential.Expires = time.Now().Unix() + TTL
+	// 上传完成后由存储端重定向回调，客户端无需另行请求
+	credential.Callback = ""
+	return credential, nil
+}
+
+// bucketURL 获取存储桶的访问地址，未指定 Endpoint 时使用 AWS 默认地址
+func (handler Driver) bucketURL() (string, error) {
+	server := handler.Policy.Server
+	if server == "" {
+		server = "https://s3." + handler.region() + ".amazonaws.com"
+	}
+
+	bucketURL, err := url.Parse(server)
+	if err != nil {
+		return "", err
+	}
+
+	if handler.Policy.OptionsSerialized.S3ForcePathStyle {
+		bucketURL.Path = strings.TrimSuffix(bucketURL.Path, "/") + "/" + handler.Policy.BucketName
+	} else {
+		bucketURL.Host = handler.Policy.BucketName + "." + bucketURL.Host
+	}
+	return bucketURL.String(), nil
+}
+
 // Meta 获取文件信息
 func (handler Driver) Meta(ctx context.Context, path string) (*MetaData, error) {
 	// 初始化客户端
@@ -412,7 +515,7 @@ func (handler Driver) getUploadCredential(ctx context.Context, policy UploadPoli
 	longDate := time.Now().UTC().Format("20060102T150405Z")
 	shortDate := time.Now().UTC().Format("20060102")
 
-	credential := handler.Policy.AccessKey + "/" + shortDate + "/" + handler.Policy.OptionsSerialized.Region + "/s3/aws4_request"
+	credential := handler.Policy.AccessKey + "/" + shortDate + "/" + handler.region() + "/s3/aws4_request"
 	policy.Conditions = append(policy.Conditions, map[string]string{"x-amz-credential": credential})
 	policy.Conditions = append(policy.Conditions, map[string]string{"x-amz-date": longDate})
 
@@ -425,7 +528,7 @@ func (handler Driver) getUploadCredential(ctx context.Context, policy UploadPoli
 
 	//签名
 	signature := getHMAC([]byte("AWS4"+handler.Policy.SecretKey), []byte(shortDate))
-	signature = getHMAC(signature, []byte(handler.Policy.OptionsSerialized.Region))
+	signature = getHMAC(signature, []byte(handler.region()))
 	signature = getHMAC(signature, []byte("s3"))
 	signature = getHMAC(signature, []byte("aws4_request"))
 	signature = getHMAC(signature, []byte(policyEncoded))
@@ -475,3 +578,8 @@ func (handler Driver) CORS() error {
 
 	return err
 }
+
+// Close 释放资源，此存储策略无需清理
+func (handler Driver) Close() error {
+	return nil
+}
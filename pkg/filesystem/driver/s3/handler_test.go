@@ -0,0 +1,215 @@
+package s3
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDriver_InitS3Client(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 成功
+	{
+		handler := Driver{
+			Policy: &model.Policy{
+				AccessKey:  "ak",
+				SecretKey:  "sk",
+				BucketName: "bucket",
+				Server:     "https://minio.cloudreve.org",
+			},
+		}
+		asserts.NoError(handler.InitS3Client())
+		asserts.NotNil(handler.svc)
+		asserts.Equal(DefaultRegion, *handler.sess.Config.Region)
+		asserts.False(*handler.sess.Config.S3ForcePathStyle)
+	}
+
+	// 使用路径形式
+	{
+		handler := Driver{
+			Policy: &model.Policy{
+				AccessKey:  "ak",
+				SecretKey:  "sk",
+				BucketName: "bucket",
+				Server:     "https://minio.cloudreve.org",
+				OptionsSerialized: model.PolicyOption{
+					Region:           "cn-east",
+					S3ForcePathStyle: true,
+				},
+			},
+		}
+		asserts.NoError(handler.InitS3Client())
+		asserts.Equal("cn-east", *handler.sess.Config.Region)
+		asserts.True(*handler.sess.Config.S3ForcePathStyle)
+	}
+
+	// 未指定存储策略
+	{
+		handler := Driver{}
+		asserts.Error(handler.InitS3Client())
+	}
+}
+
+func TestGetPartSize(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 小文件使用最小分片
+	{
+		asserts.EqualValues(MinPartSize, getPartSize(0))
+		asserts.EqualValues(MinPartSize, getPartSize(100*1024*1024))
+	}
+
+	// 大文件分片数不超过上限
+	{
+		size := uint64(MinPartSize) * s3manager.MaxUploadParts * 3
+		partSize := getPartSize(size)
+		asserts.True(partSize > MinPartSize)
+		asserts.True(size/uint64(partSize) < s3manager.MaxUploadParts)
+	}
+}
+
+func TestDriver_Source(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 虚拟主机形式
+	{
+		handler := Driver{
+			Policy: &model.Policy{
+				AccessKey:  "ak",
+				SecretKey:  "sk",
+				BucketName: "bucket",
+				Server:     "https://s3.cloudreve.org",
+				IsPrivate:  true,
+			},
+		}
+		res, err := handler.Source(context.Background(), "dir/a.txt", url.URL{}, 10, false, 0)
+		asserts.NoError(err)
+		resURL, err := url.Parse(res)
+		asserts.NoError(err)
+		asserts.Equal("bucket.s3.cloudreve.org", resURL.Host)
+		asserts.Equal("/dir/a.txt", resURL.Path)
+		asserts.NotEmpty(resURL.Query().Get("X-Amz-Signature"))
+	}
+
+	// 路径形式，公有空间并使用CDN
+	{
+		handler := Driver{
+			Policy: &model.Policy{
+				AccessKey:         "ak",
+				SecretKey:         "sk",
+				BucketName:        "bucket",
+				Server:            "https://s3.cloudreve.org",
+				BaseURL:           "https://cdn.cloudreve.org",
+				OptionsSerialized: model.PolicyOption{S3ForcePathStyle: true},
+			},
+		}
+		res, err := handler.Source(context.Background(), "dir/a.txt", url.URL{}, 10, false, 0)
+		asserts.NoError(err)
+		asserts.Equal("https://cdn.cloudreve.org/bucket/dir/a.txt", res)
+	}
+
+	// 私有空间，CDN 地址带路径前缀，保留签名参数
+	{
+		handler := Driver{
+			Policy: &model.Policy{
+				AccessKey:  "ak",
+				SecretKey:  "sk",
+				BucketName: "bucket",
+				Server:     "https://s3.cloudreve.org",
+				BaseURL:    "https://cdn.cloudreve.org/s3/",
+				IsPrivate:  true,
+			},
+		}
+		res, err := handler.Source(context.Background(), "dir/a.txt", url.URL{}, 10, false, 0)
+		asserts.NoError(err)
+		resURL, err := url.Parse(res)
+		asserts.NoError(err)
+		asserts.Equal("cdn.cloudreve.org", resURL.Host)
+		asserts.Equal("/s3/dir/a.txt", resURL.Path)
+		asserts.NotEmpty(resURL.Query().Get("X-Amz-Signature"))
+	}
+}
+
+func TestDriver_Token(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{
+			AccessKey:  "ak",
+			SecretKey:  "sk",
+			BucketName: "bucket",
+			Server:     "https://s3.cloudreve.org",
+		},
+	}
+
+	// 成功
+	{
+		ctx := context.WithValue(context.Background(), fsctx.SavePathCtx, "/123")
+		cache.Set("setting_siteURL", "http://test.cloudreve.org", 0)
+		res, err := handler.Token(ctx, 10, "key")
+		asserts.NoError(err)
+		asserts.NotEmpty(res.Policy)
+		asserts.NotEmpty(res.Token)
+		asserts.True(strings.HasPrefix(res.AccessKey, "ak/"))
+		asserts.True(strings.HasSuffix(res.AccessKey, "/"+DefaultRegion+"/s3/aws4_request"))
+		asserts.Equal("/123", res.Path)
+		asserts.Equal("http://test.cloudreve.org/api/v3/callback/s3/key", res.Callback)
+	}
+
+	// 上下文错误
+	{
+		_, err := handler.Token(context.Background(), 10, "key")
+		asserts.Error(err)
+	}
+}
+
+func TestDriver_GetUploadCredential(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_siteURL", "http://test.cloudreve.org", 0)
+	handler := Driver{
+		Policy: &model.Policy{
+			AccessKey:  "ak",
+			SecretKey:  "sk",
+			BucketName: "bucket",
+			Server:     "https://s3.cloudreve.org",
+		},
+	}
+	ctx := context.WithValue(context.Background(), fsctx.SavePathCtx, "/123")
+
+	// 以表单上传至存储桶
+	{
+		res, err := handler.GetUploadCredential(ctx, 10, "key")
+		asserts.NoError(err)
+		asserts.Equal(serializer.UploadModeForm, res.Mode)
+		asserts.Equal("https://bucket.s3.cloudreve.org", res.UploadURL)
+		asserts.Equal("/123", res.Fields["key"])
+		asserts.Equal(res.Policy, res.Fields["policy"])
+		asserts.Equal(res.Token, res.Fields["x-amz-signature"])
+		asserts.Equal("http://test.cloudreve.org/api/v3/callback/s3/key", res.Fields["success_action_redirect"])
+		asserts.Empty(res.Callback)
+		asserts.True(res.Expires > time.Now().Unix())
+	}
+
+	// 路径形式的存储桶地址
+	{
+		handler.Policy.OptionsSerialized.S3ForcePathStyle = true
+		res, err := handler.GetUploadCredential(ctx, 10, "key")
+		asserts.NoError(err)
+		asserts.Equal("https://s3.cloudreve.org/bucket", res.UploadURL)
+	}
+
+	// 上下文错误
+	{
+		_, err := handler.GetUploadCredential(context.Background(), 10, "key")
+		asserts.Error(err)
+	}
+}
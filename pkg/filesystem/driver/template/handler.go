@@ -32,6 +32,11 @@ func (handler Driver) Delete(ctx context.Context, files []string) ([]string, err
 	return []string{}, errors.New("未实现")
 }
 
+// Head 获取文件元信息
+func (handler Driver) Head(ctx context.Context, path string) (response.Object, error) {
+	return response.Object{}, errors.New("未实现")
+}
+
 // Thumb 获取文件缩略图
 func (handler Driver) Thumb(ctx context.Context, path string) (*response.ContentResponse, error) {
 	return nil, errors.New("未实现")
@@ -53,3 +58,8 @@ func (handler Driver) Source(
 func (handler Driver) Token(ctx context.Context, TTL int64, key string) (serializer.UploadCredential, error) {
 	return serializer.UploadCredential{}, errors.New("未实现")
 }
+
+// Close 释放资源，此存储策略无需清理
+func (handler Driver) Close() error {
+	return nil
+}
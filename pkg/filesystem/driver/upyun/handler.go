@@ -100,7 +100,7 @@ func (handler Driver) List(ctx context.Context, base string, recursive bool) ([]
 		})
 	}
 
-	return res, nil
+	return fsctx.ListFilter(ctx).Filter(res), nil
 }
 
 // Get 获取文件
@@ -223,6 +223,30 @@ func (handler Driver) Delete(ctx context.Context, files []string) ([]string, err
 	return failed, lastErr
 }
 
+// Head 获取文件元信息
+func (handler Driver) Head(ctx context.Context, path string) (response.Object, error) {
+	up := upyun.NewUpYun(&upyun.UpYunConfig{
+		Bucket:   handler.Policy.BucketName,
+		Operator: handler.Policy.AccessKey,
+		Password: handler.Policy.SecretKey,
+	})
+
+	info, err := up.GetInfo(path)
+	if err != nil {
+		return response.Object{}, err
+	}
+
+	return response.Object{
+		Name:         info.Name,
+		RelativePath: info.Name,
+		Source:       path,
+		Size:         uint64(info.Size),
+		IsDir:        info.IsDir,
+		LastModify:   info.Time,
+		ETag:         strings.Trim(info.ETag, `"`),
+	}, nil
+}
+
 // Thumb 获取文件缩略图
 func (handler Driver) Thumb(ctx context.Context, path string) (*response.ContentResponse, error) {
 	var (
@@ -375,3 +399,8 @@ func (handler Driver) Sign(ctx context.Context, elements []string) string {
 	signStr := base64.StdEncoding.EncodeToString((mac.Sum(nil)))
 	return fmt.Sprintf("UPYUN %s:%s", handler.Policy.AccessKey, signStr)
 }
+
+// Close 释放资源，此存储策略无需清理
+func (handler Driver) Close() error {
+	return nil
+}
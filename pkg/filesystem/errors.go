@@ -3,6 +3,7 @@ package filesystem
 import (
 	"errors"
 
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/onedrive"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 )
 
@@ -14,6 +15,8 @@ var (
 	ErrIllegalObjectName       = errors.New("目标名称非法")
 	ErrClientCanceled          = errors.New("客户端取消操作")
 	ErrRootProtected           = errors.New("无法对根目录进行操作")
+	ErrQuotaUnsupported        = errors.New("存储策略不支持查询容量")
+	ErrPingUnsupported         = errors.New("存储策略不支持连通性检查")
 	ErrInsertFileRecord        = serializer.NewError(serializer.CodeDBError, "无法插入文件记录", nil)
 	ErrFileExisted             = serializer.NewError(serializer.CodeObjectExist, "同名文件或目录已存在", nil)
 	ErrFolderExisted           = serializer.NewError(serializer.CodeObjectExist, "同名目录已存在", nil)
@@ -23,3 +26,23 @@ var (
 	ErrDBListObjects           = serializer.NewError(serializer.CodeDBError, "无法列取对象记录", nil)
 	ErrDBDeleteObjects         = serializer.NewError(serializer.CodeDBError, "无法删除对象记录", nil)
 )
+
+// translateDriverError 将存储策略适配器返回的可识别错误转换为带有对应错误码和
+// 提示信息的 AppError，无法识别时返回 false
+func translateDriverError(err error) (serializer.AppError, bool) {
+	switch {
+	case onedrive.IsNotFound(err):
+		return serializer.NewError(serializer.CodeNotFound, "存储端文件不存在", err), true
+	case onedrive.IsQuotaExceeded(err):
+		return serializer.NewError(serializer.CodeIOFailed, "存储端空间不足", err), true
+	case onedrive.IsThrottled(err):
+		return serializer.NewError(serializer.CodeIOFailed, "存储端请求过于频繁，请稍后重试", err), true
+	case onedrive.IsVaultLocked(err):
+		return serializer.NewError(serializer.CodeNoPermissionErr, "文件位于已锁定的 OneDrive 个人保管库中，请解锁后重试", err), true
+	case onedrive.IsReadOnly(err):
+		return serializer.NewError(serializer.CodePolicyNotAllowed, "存储端为只读，无法写入", err), true
+	case onedrive.IsUnauthorized(err):
+		return serializer.NewError(serializer.CodeInternalSetting, "存储策略授权已失效，请联系管理员重新授权", err), true
+	}
+	return serializer.AppError{}, false
+}
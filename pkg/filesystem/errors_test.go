@@ -0,0 +1,43 @@
+package filesystem
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/onedrive"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslateDriverError(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 可识别的存储端错误
+	{
+		testCases := []struct {
+			err  error
+			code int
+		}{
+			{&onedrive.RespError{Status: 404}, serializer.CodeNotFound},
+			{&onedrive.RespError{Status: 507}, serializer.CodeIOFailed},
+			{&onedrive.RespError{Status: 429}, serializer.CodeIOFailed},
+			{&onedrive.RespError{Status: 401}, serializer.CodeInternalSetting},
+			{&onedrive.RespError{Status: 403, APIError: onedrive.APIError{Code: "accessDenied", InnerError: onedrive.InnerError{Code: "vaultLocked"}}}, serializer.CodeNoPermissionErr},
+			{&onedrive.RespError{Status: 403, APIError: onedrive.APIError{Code: "serviceReadOnly"}}, serializer.CodePolicyNotAllowed},
+		}
+		for i, testCase := range testCases {
+			appErr, ok := translateDriverError(testCase.err)
+			asserts.True(ok, "Test Case #%d", i)
+			asserts.Equal(testCase.code, appErr.Code, "Test Case #%d", i)
+			asserts.Equal(testCase.err, appErr.RawError, "Test Case #%d", i)
+		}
+	}
+
+	// 无法识别的错误
+	{
+		_, ok := translateDriverError(errors.New("error"))
+		asserts.False(ok)
+		_, ok = translateDriverError(&onedrive.RespError{Status: 403})
+		asserts.False(ok)
+	}
+}
@@ -2,7 +2,8 @@ package filesystem
 
 import (
 	"context"
-	"io"
+	"path"
+	"strings"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
@@ -10,7 +11,7 @@ import (
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
-	"github.com/juju/ratelimit"
+	"github.com/gin-gonic/gin"
 )
 
 /* ============
@@ -18,28 +19,10 @@ import (
    ============
 */
 
-// 限速后的ReaderSeeker
-type lrs struct {
-	response.RSCloser
-	r io.Reader
-}
-
-func (r lrs) Read(p []byte) (int, error) {
-	return r.r.Read(p)
-}
-
 // withSpeedLimit 给原有的ReadSeeker加上限速
 func (fs *FileSystem) withSpeedLimit(rs response.RSCloser) response.RSCloser {
-	// 如果用户组有速度限制，就返回限制流速的ReaderSeeker
-	if fs.User.Group.SpeedLimit != 0 {
-		speed := fs.User.Group.SpeedLimit
-		bucket := ratelimit.NewBucketWithRate(float64(speed), int64(speed))
-		lrs := lrs{rs, ratelimit.Reader(rs, bucket)}
-		return lrs
-	}
-	// 否则返回原始流
-	return rs
-
+	// 如果用户组有速度限制，就返回限制流速的ReaderSeeker，否则返回原始流
+	return response.LimitSpeed(rs, fs.User.Group.SpeedLimit)
 }
 
 // AddFile 新增文件记录
@@ -165,16 +148,53 @@ func (fs *FileSystem) GetContent(ctx context.Context, id uint) (response.RSClose
 		return nil, err
 	}
 	ctx = context.WithValue(ctx, fsctx.FileModelCtx, fs.FileTarget[0])
+	ctx = withRequestRange(ctx)
+	ctx = fs.withUser(ctx)
 
 	// 获取文件流
 	rs, err := fs.Handler.Get(ctx, fs.FileTarget[0].SourceName)
 	if err != nil {
+		if appErr, ok := translateDriverError(err); ok {
+			return nil, appErr
+		}
 		return nil, ErrIO.WithError(err)
 	}
 
 	return rs, nil
 }
 
+// withUser 将文件系统所属用户写入上下文，供存储策略适配器计量用户流量。
+// 上下文中已指定用户，或为匿名用户时不作修改
+func (fs *FileSystem) withUser(ctx context.Context) context.Context {
+	if fs.User == nil || fs.User.ID == 0 {
+		return ctx
+	}
+	if _, ok := fsctx.User(ctx); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, fsctx.UserCtx, *fs.User)
+}
+
+// withRequestRange 将客户端请求的单个字节范围写入上下文，供存储策略按范围获取
+// 文件。带有 If-Range 的请求可能会被回退为完整响应，此时不转发范围
+func withRequestRange(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(fsctx.RangeCtx).(string); ok {
+		return ctx
+	}
+
+	ginCtx, ok := ctx.Value(fsctx.GinCtx).(*gin.Context)
+	if !ok || ginCtx.Request == nil || ginCtx.GetHeader("If-Range") != "" {
+		return ctx
+	}
+
+	rangeHeader := ginCtx.GetHeader("Range")
+	if !strings.HasPrefix(rangeHeader, "bytes=") || strings.Contains(rangeHeader, ",") {
+		return ctx
+	}
+
+	return context.WithValue(ctx, fsctx.RangeCtx, rangeHeader)
+}
+
 // deleteGroupedFile 对分组好的文件执行删除操作，
 // 返回每个分组失败的文件列表
 func (fs *FileSystem) deleteGroupedFile(ctx context.Context, files map[uint][]*model.File) map[uint][]string {
@@ -200,12 +220,123 @@ func (fs *FileSystem) deleteGroupedFile(ctx context.Context, files map[uint][]*m
 		// 执行删除
 		failedFile, _ := fs.Handler.Delete(ctx, sourceNames)
 		failed[policyID] = failedFile
+		fs.clearDirSizeCache(sourceNames...)
 
 	}
 
 	return failed
 }
 
+// DeletePhysicalPrefix 删除存储策略中 prefix 目录及其下的全部内容，返回删除失败的路径。
+// 适配器支持时以单个请求删除整个目录，否则列取全部文件后按文件列表删除。
+// 上下文中指定 DryRunCtx 时不发出任何删除请求，返回列取到的将被删除的文件路径
+func (fs *FileSystem) DeletePhysicalPrefix(ctx context.Context, prefix string) ([]string, error) {
+	if err := fs.DispatchHandler(); fs.Policy == nil || err != nil {
+		return []string{prefix}, ErrUnknownPolicyType
+	}
+
+	// 禁止清空存储策略的根目录
+	if path.Clean("/"+prefix) == "/" {
+		return []string{prefix}, ErrRootProtected
+	}
+
+	var (
+		res []string
+		err error
+	)
+	if fsctx.DryRun(ctx) {
+		res, err = fs.listPrefixFiles(ctx, prefix)
+		if err != nil {
+			res = []string{prefix}
+		}
+	} else {
+		defer fs.clearDirSizeCache(prefix)
+		if deleter, ok := fs.Handler.(PrefixDeleter); ok {
+			res, err = deleter.DeletePrefix(ctx, prefix)
+		} else {
+			res, err = fs.deleteListedFiles(ctx, prefix)
+		}
+	}
+
+	if appErr, ok := translateDriverError(err); ok {
+		return res, appErr
+	}
+	return res, err
+}
+
+// MovePhysical 将存储策略中 src 路径的文件移动至 dst，不修改数据库中的文件记录。
+// 适配器支持时使用存储端的原生移动，否则读取文件内容写入 dst 后删除 src
+func (fs *FileSystem) MovePhysical(ctx context.Context, src, dst string) error {
+	if err := fs.DispatchHandler(); fs.Policy == nil || err != nil {
+		return ErrUnknownPolicyType
+	}
+
+	// 禁止移动存储策略的根目录
+	if path.Clean("/"+src) == "/" || path.Clean("/"+dst) == "/" {
+		return ErrRootProtected
+	}
+
+	defer fs.clearDirSizeCache(src, dst)
+	var err error
+	if mover, ok := fs.Handler.(Mover); ok {
+		err = mover.Move(ctx, src, dst)
+	} else {
+		err = fs.copyAndDelete(ctx, src, dst)
+	}
+
+	if appErr, ok := translateDriverError(err); ok {
+		return appErr
+	}
+	return err
+}
+
+// copyAndDelete 将 src 的文件内容写入 dst 后删除 src
+func (fs *FileSystem) copyAndDelete(ctx context.Context, src, dst string) error {
+	object, err := fs.Handler.Head(ctx, src)
+	if err != nil {
+		return err
+	}
+
+	rs, err := fs.Handler.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+
+	if err := fs.Handler.Put(ctx, rs, dst, object.Size); err != nil {
+		return err
+	}
+
+	_, err = fs.Handler.Delete(ctx, []string{src})
+	return err
+}
+
+// deleteListedFiles 递归列取 prefix 下的全部文件后删除
+func (fs *FileSystem) deleteListedFiles(ctx context.Context, prefix string) ([]string, error) {
+	files, err := fs.listPrefixFiles(ctx, prefix)
+	if err != nil {
+		return []string{prefix}, err
+	}
+
+	if len(files) == 0 {
+		return []string{}, nil
+	}
+	return fs.Handler.Delete(ctx, files)
+}
+
+// listPrefixFiles 递归列取 prefix 下全部文件的存储路径
+func (fs *FileSystem) listPrefixFiles(ctx context.Context, prefix string) ([]string, error) {
+	objects, err := fs.Handler.List(context.WithValue(ctx, fsctx.ListFilterCtx, fsctx.ListFilesOnly), prefix, true)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(objects))
+	for _, object := range objects {
+		files = append(files, object.Source)
+	}
+	return files, nil
+}
+
 // GroupFileByPolicy 将目标文件按照存储策略分组
 func (fs *FileSystem) GroupFileByPolicy(ctx context.Context, files []model.File) map[uint][]*model.File {
 	var policyGroup = make(map[uint][]*model.File)
@@ -233,6 +364,7 @@ func (fs *FileSystem) GetDownloadURL(ctx context.Context, id uint, timeout strin
 	fileTarget := &fs.FileTarget[0]
 
 	// 生成下載地址
+	ctx = context.WithValue(ctx, fsctx.DownloadFileNameCtx, fileTarget.Name)
 	ttl := model.GetIntSetting(timeout, 60)
 	source, err := fs.signURL(
 		ctx,
@@ -2,19 +2,30 @@ package filesystem
 
 import (
 	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/onedrive"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
 )
 
 func TestFileSystem_AddFile(t *testing.T) {
@@ -157,6 +168,34 @@ func TestFileSystem_GetDownloadContent(t *testing.T) {
 	asserts.NoError(mock.ExpectationsWereMet())
 }
 
+func TestFileSystem_GetDownloadContent_SpeedLimit(t *testing.T) {
+	asserts := assert.New(t)
+	speed := 10 * 1024
+	testHandler := new(FileHeaderMock)
+	testHandler.On("Get", testMock.Anything, "speed.txt").
+		Return(MockRSC{rs: strings.NewReader(strings.Repeat("1", 2*speed))}, nil)
+	fs := &FileSystem{
+		User:    &model.User{Model: gorm.Model{ID: 1}, Group: model.Group{SpeedLimit: speed}},
+		Handler: testHandler,
+		FileTarget: []model.File{{
+			Model:      gorm.Model{ID: 1},
+			SourceName: "speed.txt",
+			Policy:     model.Policy{Model: gorm.Model{ID: 1}, Type: "mock"},
+		}},
+	}
+
+	// 经由文件系统中转的下载按用户组限速
+	rs, err := fs.GetDownloadContent(context.Background(), 1)
+	asserts.NoError(err)
+	start := time.Now()
+	content, err := ioutil.ReadAll(rs)
+	elapsed := time.Since(start)
+	asserts.NoError(err)
+	asserts.Len(content, 2*speed)
+	asserts.True(elapsed > 800*time.Millisecond, "elapsed %s", elapsed)
+	asserts.True(elapsed < 2*time.Second, "elapsed %s", elapsed)
+}
+
 func TestFileSystem_GroupFileByPolicy(t *testing.T) {
 	asserts := assert.New(t)
 	ctx := context.Background()
@@ -609,3 +648,258 @@ func TestFileSystem_Search(t *testing.T) {
 	asserts.NoError(err)
 	asserts.Len(res, 1)
 }
+
+func TestWithRequestRange(t *testing.T) {
+	asserts := assert.New(t)
+	newGinCtx := func(header http.Header) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header = header
+		return c
+	}
+
+	// 无 Gin 上下文
+	{
+		ctx := withRequestRange(context.Background())
+		_, ok := ctx.Value(fsctx.RangeCtx).(string)
+		asserts.False(ok)
+	}
+
+	// 单个范围
+	{
+		c := newGinCtx(http.Header{"Range": {"bytes=1000-"}})
+		ctx := withRequestRange(context.WithValue(context.Background(), fsctx.GinCtx, c))
+		asserts.Equal("bytes=1000-", ctx.Value(fsctx.RangeCtx))
+	}
+
+	// 已指定范围时不覆盖
+	{
+		c := newGinCtx(http.Header{"Range": {"bytes=1000-"}})
+		ctx := context.WithValue(context.Background(), fsctx.GinCtx, c)
+		ctx = withRequestRange(context.WithValue(ctx, fsctx.RangeCtx, "bytes=0-1"))
+		asserts.Equal("bytes=0-1", ctx.Value(fsctx.RangeCtx))
+	}
+
+	// 多个范围、带有 If-Range 或无范围时不转发
+	{
+		headers := []http.Header{
+			{"Range": {"bytes=0-1,5-6"}},
+			{"Range": {"bytes=0-1"}, "If-Range": {"etag"}},
+			{},
+		}
+		for _, header := range headers {
+			c := newGinCtx(header)
+			ctx := withRequestRange(context.WithValue(context.Background(), fsctx.GinCtx, c))
+			_, ok := ctx.Value(fsctx.RangeCtx).(string)
+			asserts.False(ok)
+		}
+	}
+}
+
+type PrefixDeleterMock struct {
+	FileHeaderMock
+}
+
+func (m PrefixDeleterMock) DeletePrefix(ctx context.Context, prefix string) ([]string, error) {
+	args := m.Called(ctx, prefix)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func TestFileSystem_DeletePhysicalPrefix(t *testing.T) {
+	asserts := assert.New(t)
+	newFS := func(handler Handler) *FileSystem {
+		return &FileSystem{
+			Handler: handler,
+			Policy:  &model.Policy{Model: gorm.Model{ID: 1}, Type: "mock"},
+		}
+	}
+
+	// 适配器支持时，以单个请求删除整个目录
+	{
+		testHandler := new(PrefixDeleterMock)
+		testHandler.On("DeletePrefix", testMock.Anything, "/dir").Return([]string{}, nil)
+		failed, err := newFS(testHandler).DeletePhysicalPrefix(context.Background(), "/dir")
+		testHandler.AssertExpectations(t)
+		testHandler.AssertNotCalled(t, "List", testMock.Anything, testMock.Anything, testMock.Anything)
+		asserts.NoError(err)
+		asserts.Empty(failed)
+	}
+
+	// 目录删除失败
+	{
+		testHandler := new(PrefixDeleterMock)
+		testHandler.On("DeletePrefix", testMock.Anything, "/dir").Return([]string{"/dir"}, errors.New("error"))
+		failed, err := newFS(testHandler).DeletePhysicalPrefix(context.Background(), "/dir")
+		testHandler.AssertExpectations(t)
+		asserts.Error(err)
+		asserts.Equal([]string{"/dir"}, failed)
+	}
+
+	// 适配器不支持时，列取全部文件后按文件列表删除
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("List", testMock.MatchedBy(func(ctx context.Context) bool {
+			return fsctx.ListFilter(ctx) == fsctx.ListFilesOnly
+		}), "/dir", true).Return([]response.Object{
+			{Name: "a.txt", Source: "dir/a.txt"},
+			{Name: "b.txt", Source: "dir/sub/b.txt"},
+		}, nil)
+		testHandler.On("Delete", testMock.Anything, []string{"dir/a.txt", "dir/sub/b.txt"}).
+			Return([]string{"dir/sub/b.txt"}, errors.New("error"))
+		failed, err := newFS(testHandler).DeletePhysicalPrefix(context.Background(), "/dir")
+		testHandler.AssertExpectations(t)
+		asserts.Error(err)
+		asserts.Equal([]string{"dir/sub/b.txt"}, failed)
+	}
+
+	// 仅解析时返回的路径与实际删除的文件一致，且不发出删除请求
+	{
+		listed := []response.Object{
+			{Name: "a.txt", Source: "dir/a.txt"},
+			{Name: "b.txt", Source: "dir/sub/b.txt"},
+		}
+		dryRunCtx := context.WithValue(context.Background(), fsctx.DryRunCtx, true)
+
+		testHandler := new(PrefixDeleterMock)
+		testHandler.On("List", testMock.Anything, "/dir", true).Return(listed, nil)
+		planned, err := newFS(testHandler).DeletePhysicalPrefix(dryRunCtx, "/dir")
+		testHandler.AssertExpectations(t)
+		testHandler.AssertNotCalled(t, "DeletePrefix", testMock.Anything, testMock.Anything)
+		testHandler.AssertNotCalled(t, "Delete", testMock.Anything, testMock.Anything)
+		asserts.NoError(err)
+
+		var deleted []string
+		deleteHandler := new(FileHeaderMock)
+		deleteHandler.On("List", testMock.Anything, "/dir", true).Return(listed, nil)
+		deleteHandler.On("Delete", testMock.Anything, testMock.MatchedBy(func(files []string) bool {
+			deleted = files
+			return true
+		})).Return([]string{}, nil)
+		failed, err := newFS(deleteHandler).DeletePhysicalPrefix(context.Background(), "/dir")
+		deleteHandler.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Empty(failed)
+		asserts.Equal(deleted, planned)
+	}
+
+	// 仅解析时列取失败
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("List", testMock.Anything, "/dir", true).Return([]response.Object{}, errors.New("error"))
+		res, err := newFS(testHandler).DeletePhysicalPrefix(context.WithValue(context.Background(), fsctx.DryRunCtx, true), "/dir")
+		asserts.Error(err)
+		asserts.Equal([]string{"/dir"}, res)
+	}
+
+	// 空目录无需删除
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("List", testMock.Anything, "/empty", true).Return([]response.Object{}, nil)
+		failed, err := newFS(testHandler).DeletePhysicalPrefix(context.Background(), "/empty")
+		testHandler.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Empty(failed)
+	}
+
+	// 列取失败
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("List", testMock.Anything, "/dir", true).Return([]response.Object{}, errors.New("error"))
+		failed, err := newFS(testHandler).DeletePhysicalPrefix(context.Background(), "/dir")
+		testHandler.AssertExpectations(t)
+		asserts.Error(err)
+		asserts.Equal([]string{"/dir"}, failed)
+	}
+
+	// 禁止清空根目录
+	{
+		testHandler := new(PrefixDeleterMock)
+		failed, err := newFS(testHandler).DeletePhysicalPrefix(context.Background(), "/")
+		asserts.Equal(ErrRootProtected, err)
+		asserts.Equal([]string{"/"}, failed)
+	}
+}
+
+type MoverMock struct {
+	FileHeaderMock
+}
+
+func (m MoverMock) Move(ctx context.Context, src, dst string) error {
+	args := m.Called(ctx, src, dst)
+	return args.Error(0)
+}
+
+func TestFileSystem_MovePhysical(t *testing.T) {
+	asserts := assert.New(t)
+	newFS := func(handler Handler) *FileSystem {
+		return &FileSystem{
+			Handler: handler,
+			Policy:  &model.Policy{Model: gorm.Model{ID: 1}, Type: "mock"},
+		}
+	}
+
+	// 适配器支持时使用原生移动
+	{
+		testHandler := new(MoverMock)
+		testHandler.On("Move", testMock.Anything, "/dir/a.txt", "/new/a.txt").Return(nil)
+		err := newFS(testHandler).MovePhysical(context.Background(), "/dir/a.txt", "/new/a.txt")
+		testHandler.AssertExpectations(t)
+		asserts.NoError(err)
+	}
+
+	// 原生移动失败
+	{
+		testHandler := new(MoverMock)
+		testHandler.On("Move", testMock.Anything, "/dir/a.txt", "/new/a.txt").Return(errors.New("error"))
+		err := newFS(testHandler).MovePhysical(context.Background(), "/dir/a.txt", "/new/a.txt")
+		testHandler.AssertExpectations(t)
+		asserts.Error(err)
+	}
+
+	// 适配器不支持时，复制后删除
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Head", testMock.Anything, "/dir/a.txt").Return(response.Object{Size: 5}, nil)
+		testHandler.On("Get", testMock.Anything, "/dir/a.txt").Return(request.NopRSCloser{}, nil)
+		testHandler.On("Put", testMock.Anything, testMock.Anything, "/new/a.txt").Return(nil)
+		testHandler.On("Delete", testMock.Anything, []string{"/dir/a.txt"}).Return([]string{}, nil)
+		err := newFS(testHandler).MovePhysical(context.Background(), "/dir/a.txt", "/new/a.txt")
+		testHandler.AssertExpectations(t)
+		asserts.NoError(err)
+	}
+
+	// 复制失败时不删除源文件
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Head", testMock.Anything, "/dir/a.txt").Return(response.Object{Size: 5}, nil)
+		testHandler.On("Get", testMock.Anything, "/dir/a.txt").Return(request.NopRSCloser{}, nil)
+		testHandler.On("Put", testMock.Anything, testMock.Anything, "/new/a.txt").Return(errors.New("error"))
+		err := newFS(testHandler).MovePhysical(context.Background(), "/dir/a.txt", "/new/a.txt")
+		testHandler.AssertExpectations(t)
+		testHandler.AssertNotCalled(t, "Delete", testMock.Anything, testMock.Anything)
+		asserts.Error(err)
+	}
+
+	// 源文件不存在
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Head", testMock.Anything, "/dir/a.txt").Return(response.Object{}, errors.New("error"))
+		err := newFS(testHandler).MovePhysical(context.Background(), "/dir/a.txt", "/new/a.txt")
+		testHandler.AssertExpectations(t)
+		testHandler.AssertNotCalled(t, "Get", testMock.Anything, testMock.Anything)
+		asserts.Error(err)
+	}
+
+	// 禁止移动根目录
+	{
+		testHandler := new(MoverMock)
+		asserts.Equal(ErrRootProtected, newFS(testHandler).MovePhysical(context.Background(), "/", "/new"))
+		asserts.Equal(ErrRootProtected, newFS(testHandler).MovePhysical(context.Background(), "/dir", "/"))
+	}
+
+	// OneDrive 使用原生移动
+	{
+		_, ok := interface{}(onedrive.Driver{}).(Mover)
+		asserts.True(ok)
+	}
+}
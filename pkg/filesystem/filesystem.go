@@ -55,6 +55,9 @@ type Handler interface {
 	// 获取文件内容
 	Get(ctx context.Context, path string) (response.RSCloser, error)
 
+	// 获取文件大小、修改时间、ETag 等元信息，不读取文件内容
+	Head(ctx context.Context, path string) (response.Object, error)
+
 	// 获取缩略图，可直接在ContentResponse中返回文件数据流，也可指
 	// 定为重定向
 	Thumb(ctx context.Context, path string) (*response.ContentResponse, error)
@@ -71,6 +74,74 @@ type Handler interface {
 	// 返回的对象路径以path作为起始根目录.
 	// recursive - 是否递归列出
 	List(ctx context.Context, path string, recursive bool) ([]response.Object, error)
+
+	// Close 释放适配器为存储策略持有的资源，存储策略被删除或修改后调用。
+	// 目前仅 OneDrive 需要清理（缓存的凭证、上传监控、空闲连接），其余适配器
+	// 不持有额外资源，直接返回 nil
+	Close() error
+}
+
+// Existence 可选实现，能够直接判断存储端路径是否已存在的存储策略适配器，
+// 文件系统在安全上传模式下据此避免覆盖已有文件
+type Existence interface {
+	// Exists 判断 path 处是否已存在文件或目录，仅在确认不存在时返回 false，
+	// 鉴权失败等无法确认的情况应返回错误
+	Exists(ctx context.Context, path string) (bool, error)
+}
+
+// DirSizer 可选实现，能够比逐个列取文件更高效地统计目录大小的存储策略适配器
+type DirSizer interface {
+	// DirSize 统计 base 下所有文件的总大小及文件数量，不包含目录本身
+	DirSize(ctx context.Context, base string) (int64, int64, error)
+}
+
+// UploadCredentialProvider 可选实现，按统一约定签发客户端直传凭证的存储策略适配器，
+// 前端据此上传文件，无需区分存储策略类型。返回的凭证必须填写 Mode，为
+// serializer.UploadModeRelay 时由服务端中转，其余统一字段留空；否则 UploadURL 为文件数据的
+// 上传地址，Fields 为表单直传时需附带的字段（文件本身以 file 字段附在最后），Callback 为
+// 上传完成后客户端需请求的回调地址（由存储端回调时留空），Expires 为凭证过期的 Unix 时间戳。
+// Token、Policy 等原有字段照旧填写，以兼容按存储策略类型处理的前端
+type UploadCredentialProvider interface {
+	// GetUploadCredential 获取有效期为 ttl 的直传凭证，key 为回调会话标识
+	GetUploadCredential(ctx context.Context, ttl int64, key string) (serializer.UploadCredential, error)
+}
+
+// PrefixDeleter 可选实现，能够以单个请求删除目录及其全部内容的存储策略适配器
+type PrefixDeleter interface {
+	// DeletePrefix 删除 prefix 目录及其下的全部内容，返回删除失败的路径列表及错误
+	DeletePrefix(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Mover 可选实现，能够在存储端原生移动或重命名文件的存储策略适配器，
+// 未实现时文件系统回退为复制后删除
+type Mover interface {
+	// Move 移动或重命名 src 路径的文件至 dst
+	Move(ctx context.Context, src, dst string) error
+}
+
+// Searcher 可选实现，能够由存储端直接搜索文件的存储策略适配器
+type Searcher interface {
+	// Search 在整个存储策略中搜索 keyword，返回的对象路径以存储策略根目录作为起始根目录
+	Search(ctx context.Context, keyword string) ([]response.Object, error)
+}
+
+// QuotaReporter 可选实现，能够查询存储端容量使用情况的存储策略适配器
+type QuotaReporter interface {
+	// Quota 返回存储端的总容量、已用容量及剩余容量，单位为字节
+	Quota(ctx context.Context) (total, used, remaining int64, err error)
+}
+
+// Pinger 可选实现，能够检查存储端连通性的存储策略适配器
+type Pinger interface {
+	// Ping 以最少的请求检查存储策略的配置及授权是否可用，失败时返回的错误应能区分
+	// 授权失效、网络不通及接口地址配置有误
+	Ping(ctx context.Context) error
+}
+
+// CapabilityReporter 可选实现，能够报告自身支持功能的存储策略适配器
+type CapabilityReporter interface {
+	// Capabilities 返回适配器支持的功能，与存储策略的具体配置无关
+	Capabilities() response.Capabilities
 }
 
 // FileSystem 管理文件的文件系统
@@ -206,10 +277,12 @@ func (fs *FileSystem) DispatchHandler() error {
 		return nil
 	case "onedrive":
 		client, err := onedrive.NewClient(currentPolicy)
+		// 代理地址无效时 NewClient 已返回错误
+		httpClient, _ := onedrive.NewHTTPClient(currentPolicy)
 		fs.Handler = onedrive.Driver{
 			Policy:     currentPolicy,
 			Client:     client,
-			HTTPClient: request.HTTPClient{},
+			HTTPClient: httpClient,
 		}
 		return err
 	case "cos":
@@ -236,6 +309,18 @@ func (fs *FileSystem) DispatchHandler() error {
 	}
 }
 
+// ClosePolicy 释放存储策略适配器为 policy 持有的资源，存储策略被删除或修改后调用
+func ClosePolicy(policy *model.Policy) error {
+	fs := &FileSystem{Policy: policy}
+	if err := fs.DispatchHandler(); err != nil {
+		return err
+	}
+	if fs.Handler == nil {
+		return nil
+	}
+	return fs.Handler.Close()
+}
+
 // NewFileSystemFromContext 从gin.Context创建文件系统
 func NewFileSystemFromContext(c *gin.Context) (*FileSystem, error) {
 	user, exist := c.Get("user")
@@ -109,6 +109,18 @@ func TestDispatchHandler(t *testing.T) {
 	asserts.NoError(err)
 }
 
+func TestClosePolicy(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 未知存储策略
+	asserts.Equal(ErrUnknownPolicyType, ClosePolicy(&model.Policy{Type: "unknown"}))
+
+	// 无需清理的存储策略
+	asserts.NoError(ClosePolicy(&model.Policy{Type: "mock"}))
+	asserts.NoError(ClosePolicy(&model.Policy{Type: "local"}))
+	asserts.NoError(ClosePolicy(&model.Policy{Type: "onedrive"}))
+}
+
 func TestNewFileSystemFromCallback(t *testing.T) {
 	asserts := assert.New(t)
 
@@ -39,4 +39,40 @@ const (
 	CancelFuncCtx
 	// ValidateCapacityOnceCtx 限定归还容量的操作只執行一次
 	ValidateCapacityOnceCtx
+	// RangeCtx 客户端请求的字节范围，值为 HTTP Range 头
+	RangeCtx
+	// DownloadFileNameCtx 下载时使用的文件名
+	DownloadFileNameCtx
+	// ProgressCallbackCtx 上传进度回调，值为 ProgressCallback
+	ProgressCallbackCtx
+	// ConflictBehaviorCtx 目标已存在时的处理方式，覆盖存储策略中的设置
+	ConflictBehaviorCtx
+	// ListFilterCtx 列取时返回的对象类型，值为 ListFilterType
+	ListFilterCtx
+	// MetadataCtx 随文件保存到存储端的自定义元数据，值为 map[string]string
+	MetadataCtx
+	// DryRunCtx 仅解析将被删除的对象，不实际删除，值为 bool
+	DryRunCtx
+	// ListDepthCtx 递归列取时最多进入的目录层数，值为 int，不大于 0 时不限制
+	ListDepthCtx
+	// ModTimeCtx 上传文件的原始修改时间，值为 time.Time，支持的存储策略会将其保留在存储端
+	ModTimeCtx
 )
+
+// ListFilterType 列取时返回的对象类型。递归列取时仍会进入所有子目录，
+// 仅在结果中排除不符合的对象
+type ListFilterType int
+
+const (
+	// ListAll 返回文件及目录
+	ListAll ListFilterType = iota
+	// ListFilesOnly 仅返回文件
+	ListFilesOnly
+	// ListFoldersOnly 仅返回目录
+	ListFoldersOnly
+)
+
+// ProgressCallback 上传进度回调，transferred 为已传输的字节数，total 为文件总大小。
+// 支持进度报告的存储策略适配器在 Put 过程中每完成一部分数据的传输便调用一次，
+// transferred 单调递增，传输完成时等于 total；回调在上传所在的协程中同步调用，不应阻塞
+type ProgressCallback func(transferred, total uint64)
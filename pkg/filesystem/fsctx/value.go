@@ -0,0 +1,126 @@
+package fsctx
+
+import (
+	"context"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+)
+
+// 以下方法集中约定各上下文键对应值的类型，值不存在或类型不符时返回 false
+
+// SavePath 获取文件物理路径
+func SavePath(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(SavePathCtx).(string)
+	return v, ok
+}
+
+// FileSize 获取文件大小
+func FileSize(ctx context.Context) (uint64, bool) {
+	v, ok := ctx.Value(FileSizeCtx).(uint64)
+	return v, ok
+}
+
+// ThumbSize 获取缩略图尺寸，依次为宽、高
+func ThumbSize(ctx context.Context) (uint, uint, bool) {
+	v, ok := ctx.Value(ThumbSizeCtx).([2]uint)
+	return v[0], v[1], ok
+}
+
+// FileModel 获取文件数据库模型
+func FileModel(ctx context.Context) (model.File, bool) {
+	v, ok := ctx.Value(FileModelCtx).(model.File)
+	return v, ok
+}
+
+// User 获取用户
+func User(ctx context.Context) (model.User, bool) {
+	v, ok := ctx.Value(UserCtx).(model.User)
+	return v, ok
+}
+
+// Retry 获取失败重试次数，未设置时为 0
+func Retry(ctx context.Context) int {
+	v, _ := ctx.Value(RetryCtx).(int)
+	return v
+}
+
+// Range 获取客户端请求的 HTTP Range 头
+func Range(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(RangeCtx).(string)
+	return v, ok
+}
+
+// DownloadFileName 获取下载时使用的文件名
+func DownloadFileName(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(DownloadFileNameCtx).(string)
+	return v, ok
+}
+
+// Progress 获取上传进度回调
+func Progress(ctx context.Context) (ProgressCallback, bool) {
+	v, ok := ctx.Value(ProgressCallbackCtx).(ProgressCallback)
+	return v, ok
+}
+
+// ConflictBehavior 获取目标已存在时的处理方式
+func ConflictBehavior(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(ConflictBehaviorCtx).(string)
+	return v, ok
+}
+
+// Metadata 获取随文件保存的自定义元数据
+func Metadata(ctx context.Context) (map[string]string, bool) {
+	v, ok := ctx.Value(MetadataCtx).(map[string]string)
+	return v, ok
+}
+
+// DryRun 获取是否仅解析将被删除的对象，未指定时为 false
+func DryRun(ctx context.Context) bool {
+	v, _ := ctx.Value(DryRunCtx).(bool)
+	return v
+}
+
+// ListFilter 获取列取时返回的对象类型，未指定时为 ListAll
+func ListFilter(ctx context.Context) ListFilterType {
+	v, _ := ctx.Value(ListFilterCtx).(ListFilterType)
+	return v
+}
+
+// ListDepth 获取递归列取时最多进入的目录层数
+func ListDepth(ctx context.Context) (int, bool) {
+	v, ok := ctx.Value(ListDepthCtx).(int)
+	return v, ok
+}
+
+// ModTime 获取上传文件的原始修改时间，未指定或为零值时返回 false
+func ModTime(ctx context.Context) (time.Time, bool) {
+	v, ok := ctx.Value(ModTimeCtx).(time.Time)
+	return v, ok && !v.IsZero()
+}
+
+// Match 返回对象是否符合过滤条件
+func (filter ListFilterType) Match(isDir bool) bool {
+	switch filter {
+	case ListFilesOnly:
+		return !isDir
+	case ListFoldersOnly:
+		return isDir
+	}
+	return true
+}
+
+// Filter 原地过滤列取结果，返回符合条件的对象
+func (filter ListFilterType) Filter(objects []response.Object) []response.Object {
+	if filter == ListAll {
+		return objects
+	}
+	res := objects[:0]
+	for _, object := range objects {
+		if filter.Match(object.IsDir) {
+			res = append(res, object)
+		}
+	}
+	return res
+}
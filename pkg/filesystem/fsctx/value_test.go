@@ -0,0 +1,132 @@
+package fsctx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueGetters(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 值不存在
+	{
+		ctx := context.Background()
+		_, ok := SavePath(ctx)
+		asserts.False(ok)
+		_, ok = FileSize(ctx)
+		asserts.False(ok)
+		_, _, ok = ThumbSize(ctx)
+		asserts.False(ok)
+		_, ok = FileModel(ctx)
+		asserts.False(ok)
+		asserts.Equal(0, Retry(ctx))
+	}
+
+	// 值类型不符
+	{
+		ctx := context.WithValue(context.Background(), SavePathCtx, []byte("/a.txt"))
+		ctx = context.WithValue(ctx, FileSizeCtx, 10)
+		ctx = context.WithValue(ctx, ThumbSizeCtx, []uint{1, 2})
+		ctx = context.WithValue(ctx, FileModelCtx, &model.File{})
+		_, ok := SavePath(ctx)
+		asserts.False(ok)
+		_, ok = FileSize(ctx)
+		asserts.False(ok)
+		_, _, ok = ThumbSize(ctx)
+		asserts.False(ok)
+		_, ok = FileModel(ctx)
+		asserts.False(ok)
+	}
+
+	// 成功
+	{
+		ctx := context.WithValue(context.Background(), SavePathCtx, "/a.txt")
+		ctx = context.WithValue(ctx, FileSizeCtx, uint64(10))
+		ctx = context.WithValue(ctx, ThumbSizeCtx, [2]uint{400, 300})
+		ctx = context.WithValue(ctx, FileModelCtx, model.File{Name: "a.txt"})
+		ctx = context.WithValue(ctx, RetryCtx, 2)
+		savePath, ok := SavePath(ctx)
+		asserts.True(ok)
+		asserts.Equal("/a.txt", savePath)
+		size, ok := FileSize(ctx)
+		asserts.True(ok)
+		asserts.EqualValues(10, size)
+		w, h, ok := ThumbSize(ctx)
+		asserts.True(ok)
+		asserts.EqualValues(400, w)
+		asserts.EqualValues(300, h)
+		file, ok := FileModel(ctx)
+		asserts.True(ok)
+		asserts.Equal("a.txt", file.Name)
+		asserts.Equal(2, Retry(ctx))
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.False(DryRun(context.Background()))
+	asserts.False(DryRun(context.WithValue(context.Background(), DryRunCtx, false)))
+	asserts.True(DryRun(context.WithValue(context.Background(), DryRunCtx, true)))
+}
+
+func TestModTime(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 未指定或为零值
+	{
+		_, ok := ModTime(context.Background())
+		asserts.False(ok)
+		_, ok = ModTime(context.WithValue(context.Background(), ModTimeCtx, time.Time{}))
+		asserts.False(ok)
+		_, ok = ModTime(context.WithValue(context.Background(), ModTimeCtx, "2020-01-01"))
+		asserts.False(ok)
+	}
+
+	// 成功
+	{
+		expected := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		res, ok := ModTime(context.WithValue(context.Background(), ModTimeCtx, expected))
+		asserts.True(ok)
+		asserts.True(expected.Equal(res))
+	}
+}
+
+func TestListFilter(t *testing.T) {
+	asserts := assert.New(t)
+	objects := func() []response.Object {
+		return []response.Object{{Name: "dir", IsDir: true}, {Name: "a.txt"}, {Name: "b.txt"}}
+	}
+
+	// 未指定时返回全部
+	{
+		asserts.Equal(ListAll, ListFilter(context.Background()))
+		asserts.Len(ListFilter(context.Background()).Filter(objects()), 3)
+	}
+
+	// 仅文件
+	{
+		ctx := context.WithValue(context.Background(), ListFilterCtx, ListFilesOnly)
+		res := ListFilter(ctx).Filter(objects())
+		asserts.Len(res, 2)
+		asserts.Equal("a.txt", res[0].Name)
+		asserts.Equal("b.txt", res[1].Name)
+	}
+
+	// 仅目录
+	{
+		ctx := context.WithValue(context.Background(), ListFilterCtx, ListFoldersOnly)
+		res := ListFilter(ctx).Filter(objects())
+		asserts.Len(res, 1)
+		asserts.Equal("dir", res[0].Name)
+	}
+
+	// 空结果
+	{
+		asserts.Nil(ListFilesOnly.Filter(nil))
+	}
+}
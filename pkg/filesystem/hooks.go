@@ -167,6 +167,7 @@ func HookDeleteTempFile(ctx context.Context, fs *FileSystem) error {
 	if err != nil {
 		util.Log().Warning("无法清理上传临时文件，%s", err)
 	}
+	fs.clearDirSizeCache(filePath)
 
 	return nil
 }
@@ -19,7 +19,7 @@ import (
 */
 
 // HandledExtension 可以生成缩略图的文件扩展名
-var HandledExtension = []string{"jpg", "jpeg", "png", "gif"}
+var HandledExtension = []string{"jpg", "jpeg", "png", "gif", "webp"}
 
 // GetThumb 获取文件的缩略图
 func (fs *FileSystem) GetThumb(ctx context.Context, id uint) (*response.ContentResponse, error) {
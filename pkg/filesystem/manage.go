@@ -8,6 +8,7 @@ import (
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/hashid"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
@@ -301,6 +302,9 @@ func (fs *FileSystem) ListPhysical(ctx context.Context, dirPath string) ([]Objec
 	// 列取路径
 	objects, err := fs.Handler.List(ctx, dirPath, false)
 	if err != nil {
+		if appErr, ok := translateDriverError(err); ok {
+			return nil, appErr
+		}
 		return nil, err
 	}
 
@@ -318,6 +322,49 @@ func (fs *FileSystem) ListPhysical(ctx context.Context, dirPath string) ([]Objec
 	return fs.listObjects(ctx, dirPath, nil, folders, nil), nil
 }
 
+// SearchPhysical 在存储策略中搜索名称包含 keyword 的文件、目录。适配器支持
+// 时交由存储端搜索，否则递归列取存储策略根目录后按名称过滤（不区分大小写）
+func (fs *FileSystem) SearchPhysical(ctx context.Context, keyword string) ([]response.Object, error) {
+	if err := fs.DispatchHandler(); fs.Policy == nil || err != nil {
+		return nil, ErrUnknownPolicyType
+	}
+
+	var (
+		objects []response.Object
+		err     error
+	)
+	if searcher, ok := fs.Handler.(Searcher); ok {
+		objects, err = searcher.Search(ctx, keyword)
+	} else {
+		objects, err = fs.searchListedObjects(ctx, keyword)
+	}
+
+	if err != nil {
+		if appErr, ok := translateDriverError(err); ok {
+			return nil, appErr
+		}
+		return nil, err
+	}
+	return objects, nil
+}
+
+// searchListedObjects 递归列取存储策略根目录，返回名称包含 keyword 的对象
+func (fs *FileSystem) searchListedObjects(ctx context.Context, keyword string) ([]response.Object, error) {
+	objects, err := fs.Handler.List(ctx, "/", true)
+	if err != nil {
+		return nil, err
+	}
+
+	keyword = strings.ToLower(keyword)
+	res := make([]response.Object, 0)
+	for _, object := range objects {
+		if strings.Contains(strings.ToLower(object.Name), keyword) {
+			res = append(res, object)
+		}
+	}
+	return res, nil
+}
+
 func (fs *FileSystem) listObjects(ctx context.Context, parent string, files []model.File, folders []model.Folder, pathProcessor func(string) string) []Object {
 	// 分享文件的ID
 	shareKey := ""
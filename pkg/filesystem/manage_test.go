@@ -65,6 +65,82 @@ func TestFileSystem_ListPhysical(t *testing.T) {
 	}
 }
 
+type SearcherMock struct {
+	FileHeaderMock
+}
+
+func (m SearcherMock) Search(ctx context.Context, keyword string) ([]response.Object, error) {
+	args := m.Called(ctx, keyword)
+	return args.Get(0).([]response.Object), args.Error(1)
+}
+
+func TestFileSystem_SearchPhysical(t *testing.T) {
+	asserts := assert.New(t)
+	newFS := func(handler Handler) *FileSystem {
+		return &FileSystem{
+			Handler: handler,
+			Policy:  &model.Policy{Type: "mock"},
+		}
+	}
+	ctx := context.Background()
+
+	// 未知存储策略
+	{
+		fs := newFS(new(FileHeaderMock))
+		fs.Policy.Type = "unknown"
+		res, err := fs.SearchPhysical(ctx, "a")
+		asserts.Equal(ErrUnknownPolicyType, err)
+		asserts.Empty(res)
+	}
+
+	// 适配器支持时交由存储端搜索
+	{
+		testHandler := new(SearcherMock)
+		testHandler.On("Search", testMock.Anything, "a").Return([]response.Object{{Name: "a.txt", RelativePath: "dir/a.txt"}}, nil)
+		res, err := newFS(testHandler).SearchPhysical(ctx, "a")
+		testHandler.AssertExpectations(t)
+		testHandler.AssertNotCalled(t, "List", testMock.Anything, testMock.Anything, testMock.Anything)
+		asserts.NoError(err)
+		asserts.Len(res, 1)
+		asserts.Equal("dir/a.txt", res[0].RelativePath)
+	}
+
+	// 存储端搜索失败
+	{
+		testHandler := new(SearcherMock)
+		testHandler.On("Search", testMock.Anything, "a").Return([]response.Object{}, errors.New("error"))
+		res, err := newFS(testHandler).SearchPhysical(ctx, "a")
+		asserts.EqualError(err, "error")
+		asserts.Empty(res)
+	}
+
+	// 适配器不支持时，递归列取后按名称过滤
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("List", testMock.Anything, "/", true).Return([]response.Object{
+			{Name: "Abc.txt", RelativePath: "Abc.txt"},
+			{Name: "dir", RelativePath: "dir", IsDir: true},
+			{Name: "xabc", RelativePath: "dir/xabc", IsDir: true},
+			{Name: "b.txt", RelativePath: "dir/b.txt"},
+		}, nil)
+		res, err := newFS(testHandler).SearchPhysical(ctx, "aBC")
+		testHandler.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Len(res, 2)
+		asserts.Equal("Abc.txt", res[0].RelativePath)
+		asserts.Equal("dir/xabc", res[1].RelativePath)
+	}
+
+	// 列取失败
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("List", testMock.Anything, "/", true).Return([]response.Object{}, errors.New("error"))
+		res, err := newFS(testHandler).SearchPhysical(ctx, "a")
+		asserts.EqualError(err, "error")
+		asserts.Empty(res)
+	}
+}
+
 func TestFileSystem_List(t *testing.T) {
 	asserts := assert.New(t)
 	fs := &FileSystem{User: &model.User{
@@ -0,0 +1,19 @@
+package filesystem
+
+import (
+	"context"
+)
+
+// PingPolicy 检查当前存储策略能否正常访问存储端，
+// 存储策略适配器无法检查时返回 ErrPingUnsupported
+func (fs *FileSystem) PingPolicy(ctx context.Context) error {
+	if err := fs.DispatchHandler(); fs.Policy == nil || err != nil {
+		return ErrUnknownPolicyType
+	}
+
+	pinger, ok := fs.Handler.(Pinger)
+	if !ok {
+		return ErrPingUnsupported
+	}
+	return pinger.Ping(ctx)
+}
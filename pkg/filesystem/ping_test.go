@@ -0,0 +1,53 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+type PingerMock struct {
+	FileHeaderMock
+}
+
+func (m PingerMock) Ping(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func TestFileSystem_PingPolicy(t *testing.T) {
+	asserts := assert.New(t)
+	newFS := func(handler Handler) *FileSystem {
+		return &FileSystem{
+			Handler: handler,
+			Policy:  &model.Policy{Type: "mock"},
+		}
+	}
+	ctx := context.Background()
+
+	// 未知存储策略
+	{
+		fs := newFS(new(FileHeaderMock))
+		fs.Policy.Type = "unknown"
+		asserts.Equal(ErrUnknownPolicyType, fs.PingPolicy(ctx))
+	}
+
+	// 适配器不支持
+	{
+		asserts.Equal(ErrPingUnsupported, newFS(new(FileHeaderMock)).PingPolicy(ctx))
+	}
+
+	// 交由适配器检查
+	{
+		testHandler := new(PingerMock)
+		testHandler.On("Ping", testMock.Anything).Return(nil).Once()
+		testHandler.On("Ping", testMock.Anything).Return(errors.New("error")).Once()
+		asserts.NoError(newFS(testHandler).PingPolicy(ctx))
+		asserts.EqualError(newFS(testHandler).PingPolicy(ctx), "error")
+		testHandler.AssertExpectations(t)
+	}
+}
@@ -0,0 +1,38 @@
+package filesystem
+
+import (
+	"context"
+)
+
+// PolicyQuota 存储端的容量使用情况
+type PolicyQuota struct {
+	// Total 总容量
+	Total int64 `json:"total"`
+	// Used 已用容量
+	Used int64 `json:"used"`
+	// Remaining 剩余容量
+	Remaining int64 `json:"remaining"`
+}
+
+// GetPolicyQuota 查询当前存储策略在存储端的容量使用情况，
+// 存储策略适配器无法查询时返回 ErrQuotaUnsupported
+func (fs *FileSystem) GetPolicyQuota(ctx context.Context) (PolicyQuota, error) {
+	if err := fs.DispatchHandler(); fs.Policy == nil || err != nil {
+		return PolicyQuota{}, ErrUnknownPolicyType
+	}
+
+	reporter, ok := fs.Handler.(QuotaReporter)
+	if !ok {
+		return PolicyQuota{}, ErrQuotaUnsupported
+	}
+
+	total, used, remaining, err := reporter.Quota(ctx)
+	if err != nil {
+		if appErr, ok := translateDriverError(err); ok {
+			return PolicyQuota{}, appErr
+		}
+		return PolicyQuota{}, err
+	}
+
+	return PolicyQuota{Total: total, Used: used, Remaining: remaining}, nil
+}
@@ -0,0 +1,73 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/onedrive"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+type QuotaReporterMock struct {
+	FileHeaderMock
+}
+
+func (m QuotaReporterMock) Quota(ctx context.Context) (int64, int64, int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Get(1).(int64), args.Get(2).(int64), args.Error(3)
+}
+
+func TestFileSystem_GetPolicyQuota(t *testing.T) {
+	asserts := assert.New(t)
+	newFS := func(handler Handler) *FileSystem {
+		return &FileSystem{
+			Handler: handler,
+			Policy:  &model.Policy{Type: "mock"},
+		}
+	}
+	ctx := context.Background()
+
+	// 未知存储策略
+	{
+		fs := newFS(new(FileHeaderMock))
+		fs.Policy.Type = "unknown"
+		_, err := fs.GetPolicyQuota(ctx)
+		asserts.Equal(ErrUnknownPolicyType, err)
+	}
+
+	// 适配器不支持
+	{
+		_, err := newFS(new(FileHeaderMock)).GetPolicyQuota(ctx)
+		asserts.Equal(ErrQuotaUnsupported, err)
+	}
+
+	// 成功
+	{
+		testHandler := new(QuotaReporterMock)
+		testHandler.On("Quota", testMock.Anything).Return(int64(100), int64(40), int64(60), nil)
+		res, err := newFS(testHandler).GetPolicyQuota(ctx)
+		testHandler.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal(PolicyQuota{Total: 100, Used: 40, Remaining: 60}, res)
+	}
+
+	// 查询失败
+	{
+		testHandler := new(QuotaReporterMock)
+		testHandler.On("Quota", testMock.Anything).Return(int64(0), int64(0), int64(0), errors.New("error"))
+		_, err := newFS(testHandler).GetPolicyQuota(ctx)
+		asserts.EqualError(err, "error")
+	}
+
+	// 可识别的错误转换为 AppError
+	{
+		testHandler := new(QuotaReporterMock)
+		testHandler.On("Quota", testMock.Anything).Return(int64(0), int64(0), int64(0), &onedrive.RespError{Status: 401})
+		_, err := newFS(testHandler).GetPolicyQuota(ctx)
+		asserts.Equal(serializer.CodeInternalSetting, err.(serializer.AppError).Code)
+	}
+}
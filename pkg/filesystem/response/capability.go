@@ -0,0 +1,42 @@
+package response
+
+// UploadMethod 存储策略适配器支持的客户端上传方式
+type UploadMethod int
+
+const (
+	// UploadRelay 仅支持经由服务端中转上传
+	UploadRelay UploadMethod = iota
+	// UploadDirect 支持客户端使用签名地址或凭证直传，单次请求上传整个文件
+	UploadDirect
+	// UploadDirectChunked 支持客户端通过上传会话分片直传
+	UploadDirectChunked
+)
+
+// Capabilities 存储策略适配器支持的功能，上层据此选择原生实现或自行模拟。
+// 零值表示均不支持，上传仅能经由服务端中转
+type Capabilities struct {
+	// NativeMove 能够在存储端直接移动文件，无需复制后删除
+	NativeMove bool `json:"native_move"`
+	// NativeCopy 能够在存储端直接复制文件，无需下载后重新上传
+	NativeCopy bool `json:"native_copy"`
+	// Rename 能够在原目录内直接重命名文件
+	Rename bool `json:"rename"`
+	// Thumbnail 能够由存储端生成缩略图
+	Thumbnail bool `json:"thumbnail"`
+	// RangeRead 获取文件内容时支持按范围读取
+	RangeRead bool `json:"range_read"`
+	// Upload 客户端上传方式
+	Upload UploadMethod `json:"upload"`
+	// URLUpload 能够由服务端获取远程文件后直接上传
+	URLUpload bool `json:"url_upload"`
+	// Quota 能够查询存储端容量
+	Quota bool `json:"quota"`
+	// Search 能够由存储端搜索文件
+	Search bool `json:"search"`
+	// Versioning 能够列取及恢复文件的历史版本
+	Versioning bool `json:"versioning"`
+	// DirSize 能够高效统计目录大小
+	DirSize bool `json:"dir_size"`
+	// PrefixDelete 能够以单个请求删除目录及其全部内容
+	PrefixDelete bool `json:"prefix_delete"`
+}
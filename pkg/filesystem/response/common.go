@@ -21,12 +21,52 @@ type RSCloser interface {
 	io.Closer
 }
 
+// ContentTyper 可提供内容类型的文件流，例如存储策略适配器探测过内容类型的文件流
+type ContentTyper interface {
+	ContentType() string
+}
+
+// ContentType 返回文件流已知的内容类型，未知时为空
+func ContentType(rs RSCloser) string {
+	if limited, ok := rs.(speedLimitedRSCloser); ok {
+		rs = limited.RSCloser
+	}
+	if typer, ok := rs.(ContentTyper); ok {
+		return typer.ContentType()
+	}
+	return ""
+}
+
+// Sizer 可提供完整大小的文件流，大小未知时返回负数
+type Sizer interface {
+	ContentLength() int64
+}
+
+// SizeKnown 返回能否确定文件流的完整大小。未实现 Sizer 的文件流视为可通过 Seek 确定大小
+func SizeKnown(rs RSCloser) bool {
+	for {
+		switch wrapped := rs.(type) {
+		case speedLimitedRSCloser:
+			rs = wrapped.RSCloser
+		case meteredRSCloser:
+			rs = wrapped.RSCloser
+		case Sizer:
+			return wrapped.ContentLength() >= 0
+		default:
+			return true
+		}
+	}
+}
+
 // Object 列出文件、目录时返回的对象
 type Object struct {
-	Name         string    `json:"name"`
-	RelativePath string    `json:"relative_path"`
-	Source       string    `json:"source"`
-	Size         uint64    `json:"size"`
-	IsDir        bool      `json:"is_dir"`
-	LastModify   time.Time `json:"last_modify"`
+	Name         string            `json:"name"`
+	RelativePath string            `json:"relative_path"`
+	Source       string            `json:"source"`
+	Size         uint64            `json:"size"`
+	IsDir        bool              `json:"is_dir"`
+	LastModify   time.Time         `json:"last_modify"`
+	ETag         string            `json:"etag,omitempty"`
+	MimeType     string            `json:"mime_type,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
 }
@@ -0,0 +1,118 @@
+package response
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// TrafficDirection 流量方向
+type TrafficDirection int
+
+const (
+	// TrafficDownload 用户下载，由存储端经服务端中转至客户端
+	TrafficDownload TrafficDirection = iota
+	// TrafficUpload 用户上传，由客户端经服务端中转至存储端
+	TrafficUpload
+)
+
+// Meter 用户流量计量器，可用于按流量计费或限制用户流量
+type Meter interface {
+	// Report 报告用户 userID 在一次传输中实际传输的字节数，每次传输结束时调用一次
+	Report(userID uint, direction TrafficDirection, bytes int64)
+}
+
+// DefaultMeter 存储策略适配器报告用户流量时使用的计量器，为 nil 时不计量
+var DefaultMeter Meter
+
+// meterCounter 统计已传输的字节数，并在传输结束时报告一次
+type meterCounter struct {
+	// bytes 需位于首位以保证原子操作时 64 位对齐
+	bytes     int64
+	meter     Meter
+	userID    uint
+	direction TrafficDirection
+	once      sync.Once
+}
+
+func (c *meterCounter) add(n int) {
+	atomic.AddInt64(&c.bytes, int64(n))
+}
+
+func (c *meterCounter) report() {
+	c.once.Do(func() {
+		c.meter.Report(c.userID, c.direction, atomic.LoadInt64(&c.bytes))
+	})
+}
+
+// meteredRSCloser 计量下载流量的RSCloser
+type meteredRSCloser struct {
+	RSCloser
+	counter *meterCounter
+}
+
+func (r meteredRSCloser) Read(p []byte) (int, error) {
+	n, err := r.RSCloser.Read(p)
+	r.counter.add(n)
+	return n, err
+}
+
+// Close 关闭文件流，并报告实际读取的字节数
+func (r meteredRSCloser) Close() error {
+	defer r.counter.report()
+	return r.RSCloser.Close()
+}
+
+// ContentType 返回原始文件流的内容类型
+func (r meteredRSCloser) ContentType() string {
+	return ContentType(r.RSCloser)
+}
+
+// meteredReader 计量上传流量的文件流
+type meteredReader struct {
+	io.ReadCloser
+	counter *meterCounter
+}
+
+func (r meteredReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.counter.add(n)
+	return n, err
+}
+
+// Close 关闭文件流，并报告实际读取的字节数
+func (r meteredReader) Close() error {
+	defer r.counter.report()
+	return r.ReadCloser.Close()
+}
+
+// newMeterCounter 创建计量器，未设置 DefaultMeter 时返回 nil
+func newMeterCounter(userID uint, direction TrafficDirection) *meterCounter {
+	if DefaultMeter == nil {
+		return nil
+	}
+	return &meterCounter{
+		meter:     DefaultMeter,
+		userID:    userID,
+		direction: direction,
+	}
+}
+
+// MeterDownload 为下载文件流加上流量计量，关闭文件流时向 DefaultMeter 报告用户实际读取的字节数。
+// 客户端中途断开时，只计入已读取的部分
+func MeterDownload(rs RSCloser, userID uint) RSCloser {
+	counter := newMeterCounter(userID, TrafficDownload)
+	if counter == nil {
+		return rs
+	}
+	return meteredRSCloser{rs, counter}
+}
+
+// MeterUpload 为上传文件流加上流量计量，关闭文件流时向 DefaultMeter 报告用户实际上传的字节数
+func MeterUpload(r io.ReadCloser, userID uint) io.ReadCloser {
+	counter := newMeterCounter(userID, TrafficUpload)
+	if counter == nil {
+		return r
+	}
+	return meteredReader{r, counter}
+}
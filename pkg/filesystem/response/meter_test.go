@@ -0,0 +1,95 @@
+package response
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// MeterMock 记录报告的流量
+type MeterMock struct {
+	mu      sync.Mutex
+	Reports []MeterReport
+}
+
+// MeterReport 一次流量报告
+type MeterReport struct {
+	UserID    uint
+	Direction TrafficDirection
+	Bytes     int64
+}
+
+func (m *MeterMock) Report(userID uint, direction TrafficDirection, bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Reports = append(m.Reports, MeterReport{userID, direction, bytes})
+}
+
+func TestMeterDownload(t *testing.T) {
+	asserts := assert.New(t)
+	defer func() { DefaultMeter = nil }()
+
+	// 未设置计量器时不包装
+	{
+		rs := nopRSCloser{strings.NewReader("123")}
+		asserts.Equal(rs, MeterDownload(rs, 1))
+	}
+
+	// 完整读取
+	{
+		meter := &MeterMock{}
+		DefaultMeter = meter
+		rs := MeterDownload(nopRSCloser{strings.NewReader(strings.Repeat("1", 1000))}, 1)
+		content, err := ioutil.ReadAll(rs)
+		asserts.NoError(err)
+		asserts.Len(content, 1000)
+		asserts.Empty(meter.Reports)
+		asserts.NoError(rs.Close())
+		asserts.Equal([]MeterReport{{1, TrafficDownload, 1000}}, meter.Reports)
+
+		// 重复关闭不重复报告
+		asserts.NoError(rs.Close())
+		asserts.Len(meter.Reports, 1)
+	}
+
+	// 中途断开时只计入已读取的部分，Seek 跳过的部分不计入
+	{
+		meter := &MeterMock{}
+		DefaultMeter = meter
+		rs := LimitSpeed(MeterDownload(nopRSCloser{strings.NewReader(strings.Repeat("1", 1000))}, 2), 1024*1024)
+		_, err := rs.Seek(500, io.SeekStart)
+		asserts.NoError(err)
+		buf := make([]byte, 100)
+		_, err = io.ReadFull(rs, buf)
+		asserts.NoError(err)
+		asserts.NoError(rs.Close())
+		asserts.Equal([]MeterReport{{2, TrafficDownload, 100}}, meter.Reports)
+	}
+}
+
+func TestMeterUpload(t *testing.T) {
+	asserts := assert.New(t)
+	defer func() { DefaultMeter = nil }()
+
+	// 未设置计量器时不包装
+	{
+		r := ioutil.NopCloser(strings.NewReader("123"))
+		asserts.Equal(r, MeterUpload(r, 1))
+	}
+
+	// 部分读取
+	{
+		meter := &MeterMock{}
+		DefaultMeter = meter
+		r := MeterUpload(ioutil.NopCloser(strings.NewReader("1234567890")), 3)
+		buf := make([]byte, 4)
+		_, err := io.ReadFull(r, buf)
+		asserts.NoError(err)
+		asserts.NoError(r.Close())
+		asserts.Equal([]MeterReport{{3, TrafficUpload, 4}}, meter.Reports)
+	}
+}
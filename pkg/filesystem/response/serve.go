@@ -0,0 +1,51 @@
+package response
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// ServeContent 向客户端发送文件流。大小已知时交由 http.ServeContent 处理，支持范围请求；
+// 大小未知时 http.ServeContent 无法处理，改为不设置 Content-Length，以分块传输编码
+// 发送完整内容，忽略范围请求
+func ServeContent(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, rs RSCloser) {
+	if SizeKnown(rs) {
+		http.ServeContent(w, r, name, modtime, rs)
+		return
+	}
+
+	// 首次 Seek 后才会返回实际数据
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	header := w.Header()
+	if header.Get("Content-Type") == "" {
+		contentType := ContentType(rs)
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(name))
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header.Set("Content-Type", contentType)
+	}
+	if !modtime.IsZero() {
+		header.Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+	}
+	header.Set("Accept-Ranges", "none")
+	header.Del("Content-Length")
+	// HTTP/2 及以上版本自行分帧，不使用 Transfer-Encoding
+	if r.ProtoMajor == 1 && r.ProtoMinor >= 1 {
+		header.Set("Transfer-Encoding", "chunked")
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		io.Copy(w, rs)
+	}
+}
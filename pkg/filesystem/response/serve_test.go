@@ -0,0 +1,98 @@
+package response
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unknownSizeRSCloser 大小未知的文件流
+type unknownSizeRSCloser struct {
+	nopRSCloser
+	seeked bool
+}
+
+func (r *unknownSizeRSCloser) Seek(offset int64, whence int) (int64, error) {
+	r.seeked = true
+	return r.nopRSCloser.Seek(offset, whence)
+}
+
+func (r *unknownSizeRSCloser) ContentLength() int64 {
+	return -1
+}
+
+func TestSizeKnown(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.True(SizeKnown(nopRSCloser{strings.NewReader("123")}))
+	asserts.False(SizeKnown(&unknownSizeRSCloser{nopRSCloser: nopRSCloser{strings.NewReader("123")}}))
+	asserts.False(SizeKnown(LimitSpeed(&unknownSizeRSCloser{nopRSCloser: nopRSCloser{strings.NewReader("123")}}, 1024)))
+	DefaultMeter = &MeterMock{}
+	defer func() { DefaultMeter = nil }()
+	asserts.False(SizeKnown(MeterDownload(&unknownSizeRSCloser{nopRSCloser: nopRSCloser{strings.NewReader("123")}}, 1)))
+}
+
+func TestServeContent(t *testing.T) {
+	asserts := assert.New(t)
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var rs RSCloser
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeContent(w, r, "a.txt", modTime, rs)
+	}))
+	defer server.Close()
+
+	// 大小已知，设置 Content-Length 并支持范围请求
+	{
+		rs = nopRSCloser{strings.NewReader("0123456789")}
+		resp, err := http.Get(server.URL)
+		asserts.NoError(err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		asserts.Equal("0123456789", string(body))
+		asserts.EqualValues(10, resp.ContentLength)
+		asserts.Empty(resp.TransferEncoding)
+
+		rs = nopRSCloser{strings.NewReader("0123456789")}
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set("Range", "bytes=2-4")
+		resp, err = http.DefaultClient.Do(req)
+		asserts.NoError(err)
+		body, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		asserts.Equal(http.StatusPartialContent, resp.StatusCode)
+		asserts.Equal("234", string(body))
+	}
+
+	// 大小未知，使用分块传输编码发送完整内容
+	{
+		unknown := &unknownSizeRSCloser{nopRSCloser: nopRSCloser{strings.NewReader("0123456789")}}
+		rs = unknown
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set("Range", "bytes=2-4")
+		resp, err := http.DefaultClient.Do(req)
+		asserts.NoError(err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		asserts.Equal(http.StatusOK, resp.StatusCode)
+		asserts.Equal("0123456789", string(body))
+		asserts.EqualValues(-1, resp.ContentLength)
+		asserts.Equal([]string{"chunked"}, resp.TransferEncoding)
+		asserts.Equal("none", resp.Header.Get("Accept-Ranges"))
+		asserts.Equal("text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+		asserts.Equal(modTime.Format(http.TimeFormat), resp.Header.Get("Last-Modified"))
+		asserts.True(unknown.seeked)
+	}
+
+	// 大小未知的 HEAD 请求不发送正文
+	{
+		rs = &unknownSizeRSCloser{nopRSCloser: nopRSCloser{strings.NewReader("0123456789")}}
+		resp, err := http.Head(server.URL)
+		asserts.NoError(err)
+		asserts.Equal(http.StatusOK, resp.StatusCode)
+		asserts.Empty(resp.Header.Get("Content-Length"))
+	}
+}
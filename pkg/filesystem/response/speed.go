@@ -0,0 +1,31 @@
+package response
+
+import (
+	"io"
+
+	"github.com/juju/ratelimit"
+)
+
+// speedLimitedRSCloser 限速后的RSCloser
+type speedLimitedRSCloser struct {
+	RSCloser
+	r io.Reader
+}
+
+func (r speedLimitedRSCloser) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+// LimitSpeed 使用令牌桶为文件流加上限速，speed 为每秒字节数，不大于0时不限速。
+// 已限速的文件流不会重复限速
+func LimitSpeed(rs RSCloser, speed int) RSCloser {
+	if speed <= 0 {
+		return rs
+	}
+	if _, ok := rs.(speedLimitedRSCloser); ok {
+		return rs
+	}
+
+	bucket := ratelimit.NewBucketWithRate(float64(speed), int64(speed))
+	return speedLimitedRSCloser{rs, ratelimit.Reader(rs, bucket)}
+}
@@ -0,0 +1,60 @@
+package response
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// nopRSCloser 为 strings.Reader 加上空 Closer
+type nopRSCloser struct {
+	*strings.Reader
+}
+
+func (nopRSCloser) Close() error {
+	return nil
+}
+
+func TestLimitSpeed(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 不限速
+	{
+		rs := nopRSCloser{strings.NewReader("123")}
+		asserts.Equal(rs, LimitSpeed(rs, 0))
+	}
+
+	// 不重复限速
+	{
+		rs := LimitSpeed(nopRSCloser{strings.NewReader("123")}, 1024)
+		asserts.Equal(rs, LimitSpeed(rs, 2048))
+	}
+
+	// 限速在允许误差内
+	{
+		speed := 10 * 1024
+		rs := LimitSpeed(nopRSCloser{strings.NewReader(strings.Repeat("1", 2*speed))}, speed)
+		start := time.Now()
+		content, err := ioutil.ReadAll(rs)
+		elapsed := time.Since(start)
+		asserts.NoError(err)
+		asserts.Len(content, 2*speed)
+		// 令牌桶初始容量为一秒的流量，剩余部分需约一秒
+		asserts.True(elapsed > 800*time.Millisecond, "elapsed %s", elapsed)
+		asserts.True(elapsed < 2*time.Second, "elapsed %s", elapsed)
+	}
+
+	// Seek 仍作用于原始流
+	{
+		rs := LimitSpeed(nopRSCloser{strings.NewReader("123")}, 1024)
+		offset, err := rs.Seek(1, io.SeekStart)
+		asserts.NoError(err)
+		asserts.EqualValues(1, offset)
+		content, _ := ioutil.ReadAll(rs)
+		asserts.Equal("23", string(content))
+	}
+}
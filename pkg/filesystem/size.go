@@ -0,0 +1,102 @@
+package filesystem
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"path"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+)
+
+// dirSizeCachePrefix 目录大小统计结果缓存的键前缀
+const dirSizeCachePrefix = "dir_size_"
+
+// DirSize 存储端目录的统计结果
+type DirSize struct {
+	// Size 目录下所有文件的总大小
+	Size int64 `json:"size"`
+	// Count 目录下的文件数量
+	Count int64 `json:"count"`
+}
+
+func init() {
+	gob.Register(DirSize{})
+}
+
+// getDirSizeCacheKey 获取目录统计结果的缓存键
+func getDirSizeCacheKey(policyID uint, dirPath string) string {
+	return fmt.Sprintf("%d_%s", policyID, path.Clean("/"+dirPath))
+}
+
+// clearDirSizeCache 清除当前存储策略下给定路径所有上级目录的统计结果缓存，
+// 在存储端写入、删除文件后调用
+func (fs *FileSystem) clearDirSizeCache(paths ...string) {
+	if fs.Policy == nil {
+		return
+	}
+
+	keys := make([]string, 0, len(paths))
+	for _, p := range paths {
+		dir := path.Clean("/" + p)
+		for dir != "/" {
+			dir = path.Dir(dir)
+			keys = append(keys, getDirSizeCacheKey(fs.Policy.ID, dir))
+		}
+	}
+	_ = cache.Deletes(keys, dirSizeCachePrefix)
+}
+
+// GetPhysicalDirSize 统计存储策略中外部目录下文件的总大小及数量。
+// 统计需要遍历整个目录树，结果会在短时间内缓存
+func (fs *FileSystem) GetPhysicalDirSize(ctx context.Context, dirPath string) (DirSize, error) {
+	if err := fs.DispatchHandler(); fs.Policy == nil || err != nil {
+		return DirSize{}, ErrUnknownPolicyType
+	}
+
+	// 存储策略不支持列取时，返回空结果
+	if !fs.Policy.CanStructureBeListed() {
+		return DirSize{}, nil
+	}
+
+	cacheKey := dirSizeCachePrefix + getDirSizeCacheKey(fs.Policy.ID, dirPath)
+	if cached, ok := cache.Get(cacheKey); ok {
+		return cached.(DirSize), nil
+	}
+
+	res, err := fs.dirSize(ctx, dirPath)
+	if err != nil {
+		if appErr, ok := translateDriverError(err); ok {
+			return DirSize{}, appErr
+		}
+		return DirSize{}, err
+	}
+
+	_ = cache.Set(cacheKey, res, model.GetIntSetting("dir_size_cache_ttl", 60))
+	return res, nil
+}
+
+// dirSize 统计目录大小，适配器无专门实现时递归列取文件后汇总
+func (fs *FileSystem) dirSize(ctx context.Context, dirPath string) (DirSize, error) {
+	if sizer, ok := fs.Handler.(DirSizer); ok {
+		size, count, err := sizer.DirSize(ctx, dirPath)
+		return DirSize{Size: size, Count: count}, err
+	}
+
+	ctx = context.WithValue(ctx, fsctx.ListFilterCtx, fsctx.ListFilesOnly)
+	objects, err := fs.Handler.List(ctx, dirPath, true)
+	if err != nil {
+		return DirSize{}, err
+	}
+
+	var res DirSize
+	for _, object := range objects {
+		if !object.IsDir {
+			res.Size += int64(object.Size)
+			res.Count++
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,104 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+type DirSizerMock struct {
+	FileHeaderMock
+}
+
+func (m DirSizerMock) DirSize(ctx context.Context, base string) (int64, int64, error) {
+	args := m.Called(ctx, base)
+	return args.Get(0).(int64), args.Get(1).(int64), args.Error(2)
+}
+
+func TestFileSystem_GetPhysicalDirSize(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_dir_size_cache_ttl", "60", 0)
+	newFS := func(handler Handler) *FileSystem {
+		return &FileSystem{
+			Handler: handler,
+			Policy:  &model.Policy{Model: gorm.Model{ID: 1}, Type: "mock"},
+		}
+	}
+
+	// 适配器无专门实现时，只列取文件并汇总
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("List", testMock.MatchedBy(func(ctx context.Context) bool {
+			return fsctx.ListFilter(ctx) == fsctx.ListFilesOnly
+		}), "/list", true).Return([]response.Object{
+			{Name: "a.txt", Size: 10},
+			{Name: "b.txt", Size: 20},
+		}, nil)
+		res, err := newFS(testHandler).GetPhysicalDirSize(context.Background(), "/list")
+		testHandler.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal(DirSize{Size: 30, Count: 2}, res)
+	}
+
+	// 使用适配器的专门实现，结果被缓存
+	{
+		testHandler := new(DirSizerMock)
+		testHandler.On("DirSize", testMock.Anything, "/sized").Return(int64(100), int64(3), nil).Once()
+		fs := newFS(testHandler)
+		res, err := fs.GetPhysicalDirSize(context.Background(), "/sized")
+		asserts.NoError(err)
+		asserts.Equal(DirSize{Size: 100, Count: 3}, res)
+		res, err = fs.GetPhysicalDirSize(context.Background(), "sized/")
+		asserts.NoError(err)
+		asserts.Equal(DirSize{Size: 100, Count: 3}, res)
+		testHandler.AssertExpectations(t)
+	}
+
+	// 写入文件后，上级目录的缓存失效
+	{
+		testHandler := new(DirSizerMock)
+		testHandler.On("DirSize", testMock.Anything, "/dir").Return(int64(10), int64(1), nil).Twice()
+		testHandler.On("DirSize", testMock.Anything, "/other").Return(int64(5), int64(1), nil).Once()
+		fs := newFS(testHandler)
+		_, err := fs.GetPhysicalDirSize(context.Background(), "/dir")
+		asserts.NoError(err)
+		_, err = fs.GetPhysicalDirSize(context.Background(), "/other")
+		asserts.NoError(err)
+
+		fs.clearDirSizeCache("dir/sub/a.txt")
+		_, err = fs.GetPhysicalDirSize(context.Background(), "/dir")
+		asserts.NoError(err)
+		_, err = fs.GetPhysicalDirSize(context.Background(), "/other")
+		asserts.NoError(err)
+		testHandler.AssertExpectations(t)
+	}
+
+	// 统计失败
+	{
+		testHandler := new(DirSizerMock)
+		testHandler.On("DirSize", testMock.Anything, "/failed").Return(int64(0), int64(0), errors.New("error"))
+		_, err := newFS(testHandler).GetPhysicalDirSize(context.Background(), "/failed")
+		asserts.Error(err)
+		_, ok := cache.Get(dirSizeCachePrefix + getDirSizeCacheKey(1, "/failed"))
+		asserts.False(ok)
+	}
+
+	// 存储策略不支持列取
+	{
+		testHandler := new(FileHeaderMock)
+		fs := newFS(testHandler)
+		fs.Policy.Type = "local"
+		res, err := fs.GetPhysicalDirSize(context.Background(), "/")
+		asserts.NoError(err)
+		asserts.Equal(DirSize{}, res)
+		testHandler.AssertNotCalled(t, "List", testMock.Anything, testMock.Anything, testMock.Anything)
+	}
+}
@@ -0,0 +1,60 @@
+package filesystem
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+)
+
+// trafficCachePrefix 用户累计流量缓存的键前缀
+const trafficCachePrefix = "user_traffic_"
+
+// UserTraffic 用户经由服务端中转的累计流量，单位为字节
+type UserTraffic struct {
+	Download int64 `json:"download"`
+	Upload   int64 `json:"upload"`
+}
+
+// TrafficMeter 将用户流量累计至缓存的计量器，主机模式启动时设为 response.DefaultMeter
+type TrafficMeter struct {
+	mu sync.Mutex
+}
+
+// NewTrafficMeter 创建流量计量器
+func NewTrafficMeter() *TrafficMeter {
+	return &TrafficMeter{}
+}
+
+// getTrafficCacheKey 获取用户某一方向累计流量的缓存键
+func getTrafficCacheKey(userID uint, direction response.TrafficDirection) string {
+	return fmt.Sprintf("%d_%d", userID, direction)
+}
+
+// Report 累计用户 userID 的流量，匿名用户不计量
+func (meter *TrafficMeter) Report(userID uint, direction response.TrafficDirection, bytes int64) {
+	if userID == 0 || bytes <= 0 {
+		return
+	}
+
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+
+	key := trafficCachePrefix + getTrafficCacheKey(userID, direction)
+	total, _ := cache.Get(key)
+	current, _ := total.(int64)
+	_ = cache.Set(key, current+bytes, 0)
+}
+
+// GetUserTraffic 获取用户的累计流量
+func GetUserTraffic(userID uint) UserTraffic {
+	values, _ := cache.Store.Gets([]string{
+		getTrafficCacheKey(userID, response.TrafficDownload),
+		getTrafficCacheKey(userID, response.TrafficUpload),
+	}, trafficCachePrefix)
+
+	download, _ := values[getTrafficCacheKey(userID, response.TrafficDownload)].(int64)
+	upload, _ := values[getTrafficCacheKey(userID, response.TrafficUpload)].(int64)
+	return UserTraffic{Download: download, Upload: upload}
+}
@@ -0,0 +1,116 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/onedrive"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrafficMeter_Report(t *testing.T) {
+	asserts := assert.New(t)
+	meter := NewTrafficMeter()
+	cache.Deletes([]string{"5001_0", "5001_1"}, trafficCachePrefix)
+
+	// 未产生流量
+	{
+		asserts.Equal(UserTraffic{}, GetUserTraffic(5001))
+	}
+
+	// 按方向累计
+	{
+		meter.Report(5001, response.TrafficDownload, 10)
+		meter.Report(5001, response.TrafficDownload, 5)
+		meter.Report(5001, response.TrafficUpload, 3)
+		asserts.Equal(UserTraffic{Download: 15, Upload: 3}, GetUserTraffic(5001))
+	}
+
+	// 匿名用户及空传输不计量
+	{
+		meter.Report(0, response.TrafficDownload, 10)
+		meter.Report(5001, response.TrafficDownload, 0)
+		asserts.Equal(UserTraffic{}, GetUserTraffic(0))
+		asserts.Equal(UserTraffic{Download: 15, Upload: 3}, GetUserTraffic(5001))
+	}
+}
+
+func TestFileSystem_Metering(t *testing.T) {
+	asserts := assert.New(t)
+	response.DefaultMeter = NewTrafficMeter()
+	defer func() { response.DefaultMeter = nil }()
+	cache.Set("setting_onedrive_throttle_retries", "0", 0)
+	cache.Set("setting_onedrive_verify_upload", "0", 0)
+	cache.Deletes([]string{"5002_0", "5002_1"}, trafficCachePrefix)
+
+	content := strings.Repeat("0123456789", 100)
+	download := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer download.Close()
+	graph := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"name":"metering.txt","size":1000,"file":{}}`))
+			return
+		}
+		w.Write([]byte(`{"name":"metering.txt","size":1000,"file":{},"@microsoft.graph.downloadUrl":"` + download.URL + `"}`))
+	}))
+	defer graph.Close()
+
+	policy := model.Policy{Model: gorm.Model{ID: 5002}, Type: "onedrive", Server: graph.URL, BucketName: "metering"}
+	cache.Set("onedrive_credential_5002_metering", onedrive.Credential{
+		AccessToken: "AccessToken",
+		ExpiresIn:   time.Now().Add(time.Hour).Unix(),
+	}, 0)
+	defer cache.Deletes([]string{"5002_metering"}, "onedrive_credential_")
+	fs := &FileSystem{
+		User: &model.User{Model: gorm.Model{ID: 5002}},
+		FileTarget: []model.File{{
+			Model:      gorm.Model{ID: 1},
+			Size:       uint64(len(content)),
+			SourceName: "metering.txt",
+			Policy:     policy,
+		}},
+	}
+
+	// 经由文件系统中转下载时，按文件系统所属用户计量
+	{
+		rs, err := fs.GetDownloadContent(context.Background(), 1)
+		asserts.NoError(err)
+		_, err = rs.Seek(0, io.SeekStart)
+		asserts.NoError(err)
+		downloaded, err := ioutil.ReadAll(rs)
+		asserts.NoError(err)
+		asserts.Len(downloaded, len(content))
+		asserts.NoError(rs.Close())
+		asserts.Equal(UserTraffic{Download: int64(len(content))}, GetUserTraffic(5002))
+	}
+
+	// 经由文件系统上传时，按文件系统所属用户计量
+	{
+		fs.Policy = &policy
+		asserts.NoError(fs.DispatchHandler())
+		file := local.FileStream{
+			File: ioutil.NopCloser(strings.NewReader(content)),
+			Size: uint64(len(content)),
+			Name: "metering.txt",
+		}
+		ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, fs.FileTarget[0])
+		asserts.NoError(fs.Upload(ctx, file))
+		asserts.Equal(UserTraffic{Download: int64(len(content)), Upload: int64(len(content))}, GetUserTraffic(5002))
+	}
+}
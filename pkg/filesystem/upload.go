@@ -24,6 +24,7 @@ import (
 // Upload 上传文件
 func (fs *FileSystem) Upload(ctx context.Context, file FileHeader) (err error) {
 	ctx = context.WithValue(ctx, fsctx.FileHeaderCtx, file)
+	ctx = fs.withUser(ctx)
 
 	// 上传前的钩子
 	err = fs.Trigger(ctx, "BeforeUpload")
@@ -42,6 +43,13 @@ func (fs *FileSystem) Upload(ctx context.Context, file FileHeader) (err error) {
 	}
 	ctx = context.WithValue(ctx, fsctx.SavePathCtx, savePath)
 
+	// 安全上传模式下，存储端目标已存在时不进行覆盖
+	if err := fs.checkSavePathAvailable(ctx, savePath); err != nil {
+		request.BlackHole(file)
+		fs.Trigger(ctx, "AfterUploadFailed")
+		return err
+	}
+
 	// 处理客户端未完成上传时，关闭连接
 	go fs.CancelUpload(ctx, savePath, file)
 
@@ -49,8 +57,12 @@ func (fs *FileSystem) Upload(ctx context.Context, file FileHeader) (err error) {
 	err = fs.Handler.Put(ctx, file, savePath, file.GetSize())
 	if err != nil {
 		fs.Trigger(ctx, "AfterUploadFailed")
+		if appErr, ok := translateDriverError(err); ok {
+			return appErr
+		}
 		return err
 	}
+	fs.clearDirSizeCache(savePath)
 
 	// 上传完成后的钩子
 	err = fs.Trigger(ctx, "AfterUpload")
@@ -76,6 +88,51 @@ func (fs *FileSystem) Upload(ctx context.Context, file FileHeader) (err error) {
 	return nil
 }
 
+// conflictBehavior 获取存储端目标已存在时的处理方式，上下文中指定的值优先于存储策略设置，
+// 均未指定或无效时按 fail 处理
+func (fs *FileSystem) conflictBehavior(ctx context.Context) string {
+	policy := fs.Policy
+	if policy == nil {
+		policy = &fs.User.Policy
+	}
+
+	behavior := policy.OptionsSerialized.OdConflictBehavior
+	if override, ok := fsctx.ConflictBehavior(ctx); ok && override != "" {
+		behavior = override
+	}
+
+	switch behavior {
+	case "replace", "rename":
+		return behavior
+	default:
+		return "fail"
+	}
+}
+
+// checkSavePathAvailable 目标已存在时失败（默认），且存储策略适配器支持 Existence 时，
+// 检查存储端 savePath 处是否已存在文件。更新已有文件时不检查
+func (fs *FileSystem) checkSavePathAvailable(ctx context.Context, savePath string) error {
+	if fs.conflictBehavior(ctx) != "fail" {
+		return nil
+	}
+	if _, ok := fsctx.FileModel(ctx); ok {
+		return nil
+	}
+	handler, ok := fs.Handler.(Existence)
+	if !ok {
+		return nil
+	}
+
+	exist, err := handler.Exists(ctx, savePath)
+	if err != nil {
+		return serializer.NewError(serializer.CodeIOFailed, "无法检查目标文件是否已存在", err)
+	}
+	if exist {
+		return ErrFileExisted
+	}
+	return nil
+}
+
 // GenerateSavePath 生成要存放文件的路径
 // TODO 完善测试
 func (fs *FileSystem) GenerateSavePath(ctx context.Context, file FileHeader) string {
@@ -171,7 +228,12 @@ func (fs *FileSystem) GetUploadToken(ctx context.Context, path string, size uint
 
 	// 获取上传凭证
 	callbackKey := util.RandStringRunes(32)
-	credential, err := fs.Handler.Token(ctx, int64(credentialTTL), callbackKey)
+	var credential serializer.UploadCredential
+	if provider, ok := fs.Handler.(UploadCredentialProvider); ok {
+		credential, err = provider.GetUploadCredential(ctx, int64(credentialTTL), callbackKey)
+	} else {
+		credential, err = fs.Handler.Token(ctx, int64(credentialTTL), callbackKey)
+	}
 	if err != nil {
 		return nil, serializer.NewError(serializer.CodeEncryptError, "无法获取上传凭证", err)
 	}
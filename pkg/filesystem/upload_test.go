@@ -47,6 +47,16 @@ func (m FileHeaderMock) Delete(ctx context.Context, files []string) ([]string, e
 	return args.Get(0).([]string), args.Error(1)
 }
 
+func (m FileHeaderMock) Close() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m FileHeaderMock) Head(ctx context.Context, path string) (response.Object, error) {
+	args := m.Called(ctx, path)
+	return args.Get(0).(response.Object), args.Error(1)
+}
+
 func (m FileHeaderMock) Thumb(ctx context.Context, files string) (*response.ContentResponse, error) {
 	args := m.Called(ctx, files)
 	return args.Get(0).(*response.ContentResponse), args.Error(1)
@@ -62,6 +72,101 @@ func (m FileHeaderMock) Token(ctx context.Context, expires int64, key string) (s
 	return args.Get(0).(serializer.UploadCredential), args.Error(1)
 }
 
+type ExistenceMock struct {
+	FileHeaderMock
+}
+
+func (m ExistenceMock) Exists(ctx context.Context, path string) (bool, error) {
+	args := m.Called(ctx, path)
+	return args.Bool(0), args.Error(1)
+}
+
+func TestFileSystem_Upload_Existence(t *testing.T) {
+	asserts := assert.New(t)
+	newFS := func(handler Handler) *FileSystem {
+		return &FileSystem{
+			Handler: handler,
+			User: &model.User{
+				Model:  gorm.Model{ID: 1},
+				Policy: model.Policy{DirNameRule: "{path}"},
+			},
+		}
+	}
+	newCtx := func(behavior string) context.Context {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest("POST", "/", nil)
+		ctx = context.WithValue(ctx, fsctx.GinCtx, c)
+		return context.WithValue(ctx, fsctx.ConflictBehaviorCtx, behavior)
+	}
+	file := local.FileStream{
+		Size:        5,
+		VirtualPath: "/",
+		Name:        "1.txt",
+		File:        ioutil.NopCloser(strings.NewReader("")),
+	}
+
+	// 目标不存在，正常上传
+	{
+		testHandler := new(ExistenceMock)
+		testHandler.On("Exists", testMock.Anything, "/1.txt").Return(false, nil)
+		testHandler.On("Put", testMock.Anything, testMock.Anything, "/1.txt").Return(nil)
+		asserts.NoError(newFS(testHandler).Upload(newCtx("fail"), file))
+		testHandler.AssertExpectations(t)
+	}
+
+	// 目标已存在，不覆盖
+	{
+		testHandler := new(ExistenceMock)
+		testHandler.On("Exists", testMock.Anything, "/1.txt").Return(true, nil)
+		err := newFS(testHandler).Upload(newCtx("fail"), file)
+		asserts.Equal(ErrFileExisted, err)
+		testHandler.AssertNotCalled(t, "Put", testMock.Anything, testMock.Anything, testMock.Anything)
+	}
+
+	// 无法确认是否存在
+	{
+		testHandler := new(ExistenceMock)
+		testHandler.On("Exists", testMock.Anything, "/1.txt").Return(false, errors.New("error"))
+		err := newFS(testHandler).Upload(newCtx("fail"), file)
+		asserts.Error(err)
+		testHandler.AssertNotCalled(t, "Put", testMock.Anything, testMock.Anything, testMock.Anything)
+	}
+
+	// 未指定处理方式时，默认不覆盖
+	{
+		testHandler := new(ExistenceMock)
+		testHandler.On("Exists", testMock.Anything, "/1.txt").Return(true, nil)
+		err := newFS(testHandler).Upload(newCtx(""), file)
+		asserts.Equal(ErrFileExisted, err)
+		testHandler.AssertNotCalled(t, "Put", testMock.Anything, testMock.Anything, testMock.Anything)
+	}
+
+	// 非安全上传模式、更新已有文件时不检查
+	{
+		testHandler := new(ExistenceMock)
+		testHandler.On("Put", testMock.Anything, testMock.Anything, testMock.Anything).Return(nil)
+		asserts.NoError(newFS(testHandler).Upload(newCtx("replace"), file))
+		ctx := context.WithValue(newCtx("fail"), fsctx.FileModelCtx, model.File{SourceName: "123/123.txt"})
+		asserts.NoError(newFS(testHandler).Upload(ctx, file))
+		testHandler.AssertNotCalled(t, "Exists", testMock.Anything, testMock.Anything)
+	}
+
+	// 存储策略设定覆盖已有文件时不检查，上下文中指定的值优先
+	{
+		testHandler := new(ExistenceMock)
+		testHandler.On("Put", testMock.Anything, testMock.Anything, testMock.Anything).Return(nil)
+		fs := newFS(testHandler)
+		fs.User.Policy.OptionsSerialized.OdConflictBehavior = "replace"
+		asserts.NoError(fs.Upload(newCtx(""), file))
+		testHandler.AssertNotCalled(t, "Exists", testMock.Anything, testMock.Anything)
+
+		testHandler.On("Exists", testMock.Anything, "/1.txt").Return(true, nil)
+		asserts.Equal(ErrFileExisted, fs.Upload(newCtx("fail"), file))
+	}
+}
+
 func TestFileSystem_Upload(t *testing.T) {
 	asserts := assert.New(t)
 
@@ -175,6 +280,15 @@ func TestFileSystem_GenerateSavePath_Anonymous(t *testing.T) {
 	asserts.Contains(savePath, "test.test")
 }
 
+type UploadCredentialProviderMock struct {
+	FileHeaderMock
+}
+
+func (m UploadCredentialProviderMock) GetUploadCredential(ctx context.Context, ttl int64, key string) (serializer.UploadCredential, error) {
+	args := m.Called(ctx, ttl, key)
+	return args.Get(0).(serializer.UploadCredential), args.Error(1)
+}
+
 func TestFileSystem_GetUploadToken(t *testing.T) {
 	asserts := assert.New(t)
 	fs := FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
@@ -195,6 +309,20 @@ func TestFileSystem_GetUploadToken(t *testing.T) {
 		asserts.Equal("test", res.Token)
 	}
 
+	// 适配器实现统一直传约定
+	{
+		testHandler := new(UploadCredentialProviderMock)
+		testHandler.On("GetUploadCredential", testMock.Anything, int64(10), testMock.Anything).
+			Return(serializer.UploadCredential{Mode: serializer.UploadModeChunk, UploadURL: "url"}, nil)
+		fs.Handler = testHandler
+		res, err := fs.GetUploadToken(ctx, "/", 10, "123")
+		testHandler.AssertExpectations(t)
+		testHandler.AssertNotCalled(t, "Token", testMock.Anything, testMock.Anything, testMock.Anything)
+		asserts.NoError(err)
+		asserts.Equal(serializer.UploadModeChunk, res.Mode)
+		asserts.Equal("url", res.UploadURL)
+	}
+
 	// 无法获取上传凭证
 	{
 		cache.SetSettings(map[string]string{
@@ -0,0 +1,77 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// ErrPrivateAddress 目标地址不是公网地址
+var ErrPrivateAddress = errors.New("不允许访问环回、内网或链路本地地址")
+
+// privateNetworks 按地址前缀判断的非公网地址段
+var privateNetworks = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"fc00::/7",
+	}
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// IsPublicIP 返回 ip 是否为公网地址。环回、私有（RFC1918、IPv6 ULA）、运营商级 NAT、
+// 链路本地（含 169.254.169.254 等云服务元数据地址）、组播及未指定地址均不视为公网地址
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckPublicHost 解析 host，其任一地址不是公网地址时返回 ErrPrivateAddress
+func CheckPublicHost(ctx context.Context, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !IsPublicIP(ip) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !IsPublicIP(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// publicOnlyControl 建立连接前检查实际连接的地址，防止域名在检查后被解析至内网地址
+func publicOnlyControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !IsPublicIP(net.ParseIP(host)) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
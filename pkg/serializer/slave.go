@@ -10,3 +10,9 @@ type ListRequest struct {
 	Path      string `json:"path"`
 	Recursive bool   `json:"recursive"`
 }
+
+// SlaveChunkStatus 从机分片上传会话状态
+type SlaveChunkStatus struct {
+	Received  uint64 `json:"received"`
+	Completed bool   `json:"completed"`
+}
@@ -16,6 +16,16 @@ type UploadPolicy struct {
 	CallbackURL      string   `json:"callback_url"`
 }
 
+// 客户端直传方式，见 UploadCredential.Mode
+const (
+	// UploadModeRelay 文件上传至本站，由服务端中转
+	UploadModeRelay = "relay"
+	// UploadModeForm 将 Fields 及文件作为 multipart 表单 POST 至 UploadURL
+	UploadModeForm = "form"
+	// UploadModeChunk 按分片向 UploadURL 发送 PUT 请求，全部完成后请求 Callback
+	UploadModeChunk = "chunk"
+)
+
 // UploadCredential 返回给客户端的上传凭证
 type UploadCredential struct {
 	Token     string `json:"token"`
@@ -25,6 +35,12 @@ type UploadCredential struct {
 	KeyTime   string `json:"key_time,omitempty"` // COS用有效期
 	Callback  string `json:"callback,omitempty"` // 回调地址
 	Key       string `json:"key,omitempty"`      // 文件标识符，通常为回调key
+
+	// 以下字段由实现了统一直传约定的存储策略填写，与存储策略类型无关
+	Mode      string            `json:"mode,omitempty"`       // 直传方式
+	UploadURL string            `json:"upload_url,omitempty"` // 文件数据的上传地址
+	Fields    map[string]string `json:"fields,omitempty"`     // 表单直传时附带的字段
+	Expires   int64             `json:"expires,omitempty"`    // 凭证过期的 Unix 时间戳
 }
 
 // UploadSession 上传会话
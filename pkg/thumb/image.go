@@ -15,6 +15,7 @@ import (
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 
 	"github.com/nfnt/resize"
+	"golang.org/x/image/webp"
 )
 
 // Thumb 缩略图
@@ -24,7 +25,7 @@ type Thumb struct {
 }
 
 // NewThumbFromFile 从文件数据获取新的Thumb对象，
-// 尝试通过文件名name解码图像
+// 尝试通过文件名name解码图像，动态GIF只取第一帧
 func NewThumbFromFile(file io.Reader, name string) (*Thumb, error) {
 	ext := strings.ToLower(filepath.Ext(name))
 	// 无扩展名时
@@ -43,6 +44,8 @@ func NewThumbFromFile(file io.Reader, name string) (*Thumb, error) {
 		img, err = gif.Decode(file)
 	case "png":
 		img, err = png.Decode(file)
+	case "webp":
+		img, err = webp.Decode(file)
 	default:
 		return nil, errors.New("未知的图像类型")
 	}
@@ -67,6 +70,11 @@ func (image *Thumb) GetSize() (int, int) {
 	return b.Max.X, b.Max.Y
 }
 
+// Encode 将图像以PNG格式写入w
+func (image *Thumb) Encode(w io.Writer) error {
+	return png.Encode(w, image.src)
+}
+
 // Save 保存图像到给定路径
 func (image *Thumb) Save(path string) (err error) {
 	out, err := util.CreatNestedFile(path)
@@ -76,8 +84,7 @@ func (image *Thumb) Save(path string) (err error) {
 	}
 	defer out.Close()
 
-	err = png.Encode(out, image.src)
-	return err
+	return image.Encode(out)
 
 }
 
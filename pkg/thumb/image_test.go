@@ -1,8 +1,11 @@
 package thumb
 
 import (
+	"bytes"
 	"fmt"
 	"image"
+	"image/color/palette"
+	"image/gif"
 	"image/jpeg"
 	"os"
 	"testing"
@@ -55,6 +58,11 @@ func TestNewThumbFromFile(t *testing.T) {
 		asserts.Error(err)
 		asserts.Nil(thumb)
 	}
+	{
+		thumb, err := NewThumbFromFile(file, "123.webp")
+		asserts.Error(err)
+		asserts.Nil(thumb)
+	}
 	{
 		thumb, err := NewThumbFromFile(file, "123.3211")
 		asserts.Error(err)
@@ -62,6 +70,26 @@ func TestNewThumbFromFile(t *testing.T) {
 	}
 }
 
+func TestNewThumbFromFile_AnimatedGIF(t *testing.T) {
+	asserts := assert.New(t)
+	anim := &gif.GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 300, 100), palette.Plan9),
+			image.NewPaletted(image.Rect(0, 0, 10, 10), palette.Plan9),
+		},
+		Delay: []int{10, 10},
+	}
+	buf := &bytes.Buffer{}
+	asserts.NoError(gif.EncodeAll(buf, anim))
+
+	// 取第一帧
+	thumb, err := NewThumbFromFile(buf, "123.gif")
+	asserts.NoError(err)
+	w, h := thumb.GetSize()
+	asserts.Equal(300, w)
+	asserts.Equal(100, h)
+}
+
 func TestThumb_GetSize(t *testing.T) {
 	asserts := assert.New(t)
 	file := CreateTestImage()
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"fmt"
 	"math/rand"
 	"regexp"
 	"strings"
@@ -106,3 +107,44 @@ func SliceDifference(slice1, slice2 []string) []string {
 	}
 	return nn
 }
+
+// ContentDisposition 返回强制以 fileName 为文件名下载的 Content-Disposition 头，
+// 非 ASCII 文件名按 RFC 5987 编码，同时提供 ASCII 文件名供旧客户端使用
+func ContentDisposition(fileName string) string {
+	var (
+		fallback strings.Builder
+		encoded  strings.Builder
+		isASCII  = true
+	)
+	for _, r := range fileName {
+		if r < 0x20 || r > 0x7e {
+			isASCII = false
+			fallback.WriteByte('_')
+		} else if r == '"' || r == '\\' {
+			fallback.WriteByte('_')
+		} else {
+			fallback.WriteRune(r)
+		}
+	}
+
+	for _, b := range []byte(fileName) {
+		if isAttrChar(b) {
+			encoded.WriteByte(b)
+		} else {
+			encoded.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+
+	if isASCII && !strings.ContainsAny(fileName, "\"\\%") {
+		return "attachment; filename=\"" + fileName + "\""
+	}
+	return "attachment; filename=\"" + fallback.String() + "\"; filename*=UTF-8''" + encoded.String()
+}
+
+// isAttrChar 返回字符是否为 RFC 5987 中无需编码的 attr-char
+func isAttrChar(b byte) bool {
+	if (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') {
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
@@ -96,3 +96,32 @@ func TestSliceDifference(t *testing.T) {
 		asserts.Equal([]string{"1", "2", "3", "4"}, SliceDifference(s1, s2))
 	}
 }
+
+func TestContentDisposition(t *testing.T) {
+	asserts := assert.New(t)
+
+	// ASCII 文件名
+	{
+		asserts.Equal(`attachment; filename="report 2020.pdf"`, ContentDisposition("report 2020.pdf"))
+	}
+
+	// 非 ASCII 文件名
+	{
+		asserts.Equal(
+			`attachment; filename="__.txt"; filename*=UTF-8''%E6%96%87%E4%BB%B6.txt`,
+			ContentDisposition("文件.txt"),
+		)
+		asserts.Equal(
+			`attachment; filename="caf_ menu.pdf"; filename*=UTF-8''caf%C3%A9%20menu.pdf`,
+			ContentDisposition("café menu.pdf"),
+		)
+	}
+
+	// 需要转义的 ASCII 字符
+	{
+		asserts.Equal(
+			`attachment; filename="a_b_.txt"; filename*=UTF-8''a%22b%5C.txt`,
+			ContentDisposition(`a"b\.txt`),
+		)
+	}
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -56,3 +57,18 @@ func RelativePath(name string) string {
 	e, _ := os.Executable()
 	return filepath.Join(filepath.Dir(e), name)
 }
+
+// ReplaceURLBase 将 target 的协议、主机替换为 base 的协议、主机，并在路径前加上
+// base 中的路径前缀，查询参数保持不变。用于将存储端地址替换为 CDN、反代地址
+func ReplaceURLBase(target, base *url.URL) {
+	target.Scheme = base.Scheme
+	target.Host = base.Host
+
+	prefix := strings.TrimSuffix(base.Path, "/")
+	if prefix == "" {
+		return
+	}
+	escapedPath := strings.TrimSuffix(base.EscapedPath(), "/") + target.EscapedPath()
+	target.Path = prefix + target.Path
+	target.RawPath = escapedPath
+}
@@ -1,8 +1,10 @@
 package util
 
 import (
-	"github.com/stretchr/testify/assert"
+	"net/url"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestDotPathToStandardPath(t *testing.T) {
@@ -34,3 +36,25 @@ func TestSplitPath(t *testing.T) {
 	asserts.Equal([]string{"/"}, SplitPath("/"))
 	asserts.Equal([]string{"/", "123", "321"}, SplitPath("/123/321"))
 }
+
+func TestReplaceURLBase(t *testing.T) {
+	asserts := assert.New(t)
+	replace := func(target, base string) string {
+		targetURL, _ := url.Parse(target)
+		baseURL, _ := url.Parse(base)
+		ReplaceURLBase(targetURL, baseURL)
+		return targetURL.String()
+	}
+
+	// 仅替换协议、主机
+	asserts.Equal("https://cdn.com/a.txt?sign=1", replace("http://origin.com/a.txt?sign=1", "https://cdn.com"))
+	asserts.Equal("https://cdn.com/a.txt?sign=1", replace("http://origin.com/a.txt?sign=1", "https://cdn.com/"))
+
+	// 带路径前缀
+	asserts.Equal("https://cdn.com/onedrive/dir/a.txt?sign=1&e=2", replace("http://origin.com/dir/a.txt?sign=1&e=2", "https://cdn.com/onedrive"))
+	asserts.Equal("https://cdn.com/onedrive/a.txt", replace("http://origin.com/a.txt", "https://cdn.com/onedrive/"))
+	asserts.Equal("https://cdn.com/onedrive", replace("http://origin.com", "https://cdn.com/onedrive"))
+
+	// 保留已转义的路径
+	asserts.Equal("https://cdn.com/my%20cdn/a%2Fb.txt?sign=%2B1", replace("http://origin.com/a%2Fb.txt?sign=%2B1", "https://cdn.com/my%20cdn"))
+}
@@ -114,8 +114,8 @@ func walkFS(
 	if !info.IsDir() || depth == 0 {
 		return nil
 	}
-	if depth == 1 {
-		depth = 0
+	if depth > 0 {
+		depth--
 	}
 
 	dirs, _ := info.(*model.Folder).GetChildFolder()
@@ -10,7 +10,9 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"path"
 	"strconv"
 	"time"
 
@@ -381,7 +383,9 @@ func findContentType(ctx context.Context, fs *filesystem.FileSystem, ls LockSyst
 	//// Rewind file.
 	//_, err = f.Seek(0, os.SEEK_SET)
 	//return ctype, err
-	return "", nil
+
+	// 读取文件内容代价较高，仅根据扩展名推断
+	return mime.TypeByExtension(path.Ext(fi.GetName())), nil
 }
 
 // ETager is an optional interface for the os.FileInfo objects
@@ -647,6 +647,10 @@ func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request, fs *fil
 			return http.StatusBadRequest, errInvalidDepth
 		}
 	}
+	// 限制无限深度遍历的层数，避免目录层级过深时遍历失控
+	if maxDepth := model.GetIntSetting("webdav_max_depth", 20); depth == infiniteDepth && maxDepth > 0 {
+		depth = maxDepth
+	}
 	pf, status, err := readPropfind(r.Body)
 	if err != nil {
 		return status, err
@@ -187,6 +187,28 @@ func AdminGetPolicy(c *gin.Context) {
 	}
 }
 
+// AdminGetPolicyQuota 查询存储策略在存储端的容量使用情况
+func AdminGetPolicyQuota(c *gin.Context) {
+	var service admin.PolicyService
+	if err := c.ShouldBindUri(&service); err == nil {
+		res := service.Quota(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminPingPolicy 检查存储策略能否正常访问存储端
+func AdminPingPolicy(c *gin.Context) {
+	var service admin.PolicyService
+	if err := c.ShouldBindUri(&service); err == nil {
+		res := service.Ping(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // AdminDeletePolicy 删除存储策略
 func AdminDeletePolicy(c *gin.Context) {
 	var service admin.PolicyService
@@ -275,6 +297,17 @@ func AdminGetUser(c *gin.Context) {
 	}
 }
 
+// AdminGetUserTraffic 获取用户累计流量
+func AdminGetUserTraffic(c *gin.Context) {
+	var service admin.UserService
+	if err := c.ShouldBindUri(&service); err == nil {
+		res := service.Traffic()
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // AdminDeleteUser 批量删除用户
 func AdminDeleteUser(c *gin.Context) {
 	var service admin.UserBatchService
@@ -425,3 +458,36 @@ func AdminListFolders(c *gin.Context) {
 		c.JSON(200, ErrorResponse(err))
 	}
 }
+
+// AdminDeletePhysicalFolder 删除存储策略中的目录
+func AdminDeletePhysicalFolder(c *gin.Context) {
+	var service admin.PhysicalDeleteService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Delete(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminMovePhysicalFile 移动存储策略中的文件
+func AdminMovePhysicalFile(c *gin.Context) {
+	var service admin.PhysicalMoveService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Move(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminGetFolderSize 统计存储策略中的目录大小
+func AdminGetFolderSize(c *gin.Context) {
+	var service admin.FolderSizeService
+	if err := c.ShouldBindUri(&service); err == nil {
+		res := service.Size(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
@@ -80,6 +80,17 @@ func OneDriveCallback(c *gin.Context) {
 	}
 }
 
+// OneDriveUploadStatus OneDrive 客户端查询续传位置
+func OneDriveUploadStatus(c *gin.Context) {
+	var service callback.OneDriveUploadStatusService
+	if err := c.ShouldBindQuery(&service); err == nil {
+		res := service.Status(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // OneDriveOAuth OneDrive 授权回调
 func OneDriveOAuth(c *gin.Context) {
 	var callbackBody callback.OneDriveOauthService
@@ -88,6 +88,40 @@ func AnonymousGetContent(c *gin.Context) {
 	}
 }
 
+// LocalDownload 通过签名直链下载本机存储的文件,此请求返回的HTTP状态码不全为200
+func LocalDownload(c *gin.Context) {
+	// 创建上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var service explorer.LocalDownloadService
+	if err := c.ShouldBindUri(&service); err == nil {
+		res := service.ServeFile(ctx, c, true)
+		if res.Code != 0 {
+			c.JSON(400, res)
+		}
+	} else {
+		c.JSON(400, ErrorResponse(err))
+	}
+}
+
+// LocalPreview 通过签名直链预览本机存储的文件
+func LocalPreview(c *gin.Context) {
+	// 创建上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var service explorer.LocalDownloadService
+	if err := c.ShouldBindUri(&service); err == nil {
+		res := service.ServeFile(ctx, c, false)
+		if res.Code != 0 {
+			c.JSON(200, res)
+		}
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // GetSource 获取文件的外链地址
 func GetSource(c *gin.Context) {
 	// 创建上下文
@@ -346,6 +380,21 @@ func GetUploadCredential(c *gin.Context) {
 	}
 }
 
+// CancelUploadSession 中止上传
+func CancelUploadSession(c *gin.Context) {
+	// 创建上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var service explorer.UploadSessionService
+	if err := c.ShouldBindUri(&service); err == nil {
+		res := service.Delete(ctx, c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // SearchFile 搜索文件
 func SearchFile(c *gin.Context) {
 	var service explorer.ItemSearchService
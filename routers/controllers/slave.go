@@ -2,13 +2,16 @@ package controllers
 
 import (
 	"context"
+	"io"
 	"net/url"
+	"os"
 	"strconv"
 
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	"github.com/cloudreve/Cloudreve/v3/service/admin"
 	"github.com/cloudreve/Cloudreve/v3/service/explorer"
 	"github.com/gin-gonic/gin"
@@ -65,6 +68,11 @@ func SlaveUpload(c *gin.Context) {
 		Size:     fileSize,
 	}
 
+	c.JSON(200, slaveSaveUpload(ctx, fs, fileData))
+}
+
+// slaveSaveUpload 校验并保存从机接收到的文件
+func slaveSaveUpload(ctx context.Context, fs *filesystem.FileSystem, fileData local.FileStream) serializer.Response {
 	// 给文件系统分配钩子
 	fs.Use("BeforeUpload", filesystem.HookSlaveUploadValidate)
 	fs.Use("AfterUploadCanceled", filesystem.HookDeleteTempFile)
@@ -72,15 +80,141 @@ func SlaveUpload(c *gin.Context) {
 	fs.Use("AfterValidateFailed", filesystem.HookDeleteTempFile)
 
 	// 执行上传
-	err = fs.Upload(ctx, fileData)
+	err := fs.Upload(ctx, fileData)
 	if err != nil {
-		c.JSON(200, serializer.Err(serializer.CodeUploadFailed, err.Error(), err))
-		return
+		return serializer.Err(serializer.CodeUploadFailed, err.Error(), err)
 	}
 
-	c.JSON(200, serializer.Response{
+	return serializer.Response{
 		Code: 0,
+	}
+}
+
+// SlaveUploadChunk 从机接收分片上传，收到最后一个分片后保存文件
+func SlaveUploadChunk(c *gin.Context) {
+	// 创建上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = context.WithValue(ctx, fsctx.GinCtx, c)
+	defer cancel()
+
+	// 解析上传策略
+	uploadPolicy, err := serializer.DecodeUploadPolicy(c.GetHeader("X-Policy"))
+	if err != nil {
+		c.JSON(200, serializer.ParamErr("上传策略格式有误", err))
+		return
+	}
+	ctx = context.WithValue(ctx, fsctx.UploadPolicyCtx, *uploadPolicy)
+
+	// 取得分片偏移、分片大小及文件总大小
+	offset, err := strconv.ParseUint(c.GetHeader("X-Chunk-Offset"), 10, 64)
+	if err != nil {
+		c.JSON(200, ErrorResponse(err))
+		return
+	}
+	chunkSize, err := strconv.ParseUint(c.Request.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		c.JSON(200, ErrorResponse(err))
+		return
+	}
+	fileSize, err := strconv.ParseUint(c.GetHeader("X-Total-Size"), 10, 64)
+	if err != nil {
+		c.JSON(200, ErrorResponse(err))
+		return
+	}
+	if offset+chunkSize > fileSize || (uploadPolicy.MaxSize > 0 && fileSize > uploadPolicy.MaxSize) {
+		c.JSON(200, serializer.Err(serializer.CodeUploadFailed, filesystem.ErrFileSizeTooBig.Error(), nil))
+		return
+	}
+
+	// 解码文件名
+	fileName, err := url.QueryUnescape(c.GetHeader("X-FileName"))
+	if err != nil {
+		c.JSON(200, ErrorResponse(err))
+		return
+	}
+
+	// 最后一个分片的写入与文件保存不可并发，已保存过的会话直接返回成功，
+	// 以便主机在未收到保存结果时重新提交
+	sessionID := c.Param("sessionID")
+	if offset+chunkSize == fileSize {
+		defer local.LockChunkSession(sessionID)()
+		completed, err := local.IsChunkCompleted(sessionID)
+		if err != nil {
+			c.JSON(200, serializer.Err(serializer.CodeIOFailed, err.Error(), err))
+			return
+		}
+		if completed {
+			c.JSON(200, serializer.Response{Data: fileSize})
+			return
+		}
+	}
+
+	// 写入分片
+	received, err := local.WriteChunk(sessionID, offset, io.LimitReader(c.Request.Body, int64(chunkSize)))
+	if err != nil {
+		c.JSON(200, serializer.Err(serializer.CodeIOFailed, err.Error(), err))
+		return
+	}
+	if received < fileSize {
+		c.JSON(200, serializer.Response{Data: received})
+		return
+	}
+
+	// 全部分片已接收，保存文件
+	chunkPath, _ := local.GetChunkFilePath(sessionID)
+	chunkFile, err := os.Open(chunkPath)
+	if err != nil {
+		c.JSON(200, serializer.Err(serializer.CodeIOFailed, err.Error(), err))
+		return
+	}
+
+	fs, err := filesystem.NewAnonymousFileSystem()
+	if err != nil {
+		chunkFile.Close()
+		c.JSON(200, serializer.Err(serializer.CodePolicyNotAllowed, err.Error(), err))
+		return
+	}
+	fs.Handler = local.Driver{}
+
+	res := slaveSaveUpload(ctx, fs, local.FileStream{
+		MIMEType: c.Request.Header.Get("Content-Type"),
+		File:     chunkFile,
+		Name:     fileName,
+		Size:     fileSize,
 	})
+	chunkFile.Close()
+
+	// 保存成功后留下完成标记，失败时丢弃已接收的数据
+	if res.Code == 0 {
+		if err := local.MarkChunkCompleted(sessionID); err != nil {
+			util.Log().Warning("无法记录分片上传会话[%s]的完成状态，%s", sessionID, err)
+		}
+	} else {
+		_ = local.DeleteChunkFile(sessionID)
+	}
+
+	c.JSON(200, res)
+}
+
+// SlaveUploadChunkStatus 获取从机分片上传会话已确认接收的字节数及文件是否已保存
+func SlaveUploadChunkStatus(c *gin.Context) {
+	sessionID := c.Param("sessionID")
+	completed, err := local.IsChunkCompleted(sessionID)
+	if err != nil {
+		c.JSON(200, serializer.Err(serializer.CodeIOFailed, err.Error(), err))
+		return
+	}
+
+	received, err := local.GetChunkOffset(sessionID)
+	if err != nil {
+		c.JSON(200, serializer.Err(serializer.CodeIOFailed, err.Error(), err))
+		return
+	}
+
+	c.JSON(200, serializer.Response{Data: serializer.SlaveChunkStatus{
+		Received:  received,
+		Completed: completed,
+	}})
 }
 
 // SlaveDownload 从机文件下载,此请求返回的HTTP状态码不全为200
@@ -2,15 +2,23 @@ package routers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
 	"strings"
 	"testing"
 
 	"github.com/cloudreve/Cloudreve/v3/middleware"
 	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	"github.com/cloudreve/Cloudreve/v3/service/explorer"
 	"github.com/stretchr/testify/assert"
 )
@@ -111,6 +119,44 @@ func TestLocalFileUpload(t *testing.T) {
 
 }
 
+func TestCancelUploadSessionRoute(t *testing.T) {
+	switchToMemDB()
+	asserts := assert.New(t)
+	router := InitMasterRouter()
+	middleware.SessionMock = map[string]interface{}{"user_id": 1}
+	cache.Set("callback_own", serializer.UploadSession{Key: "own", UID: 1, PolicyID: 1}, 0)
+	cache.Set("callback_others", serializer.UploadSession{Key: "others", UID: 2, PolicyID: 1}, 0)
+
+	cancelSession := func(id string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/api/v3/file/upload/"+id, nil)
+		router.ServeHTTP(w, req)
+		asserts.Equal(200, w.Code)
+		resJSON := &serializer.Response{}
+		asserts.NoError(json.Unmarshal(w.Body.Bytes(), resJSON))
+		return resJSON.Code
+	}
+
+	// 会话不存在
+	{
+		asserts.Equal(serializer.CodeNotFound, cancelSession("not_exist"))
+	}
+
+	// 不属于当前用户的会话
+	{
+		asserts.Equal(serializer.CodeNotFound, cancelSession("others"))
+		_, ok := cache.Get("callback_others")
+		asserts.True(ok)
+	}
+
+	// 成功
+	{
+		asserts.Equal(0, cancelSession("own"))
+		_, ok := cache.Get("callback_own")
+		asserts.False(ok)
+	}
+}
+
 func TestObjectDelete(t *testing.T) {
 	asserts := assert.New(t)
 	router := InitMasterRouter()
@@ -178,3 +224,126 @@ func TestObjectDelete(t *testing.T) {
 		w.Body.Reset()
 	}
 }
+
+func TestLocalSignedSourceRoute(t *testing.T) {
+	switchToMemDB()
+	asserts := assert.New(t)
+	router := InitMasterRouter()
+	auth.General = auth.HMACAuth{SecretKey: []byte("test")}
+
+	// 准备测试文件
+	sourceName := "tests/TestLocalSignedSourceRoute.txt"
+	file, err := util.CreatNestedFile(util.RelativePath(sourceName))
+	asserts.NoError(err)
+	_, err = file.WriteString("0123456789")
+	asserts.NoError(err)
+	file.Close()
+	defer os.Remove(util.RelativePath(sourceName))
+
+	handler := local.Driver{Policy: &model.Policy{}}
+	ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, model.File{
+		Name:       "a.txt",
+		SourceName: sourceName,
+	})
+	baseURL, _ := url.Parse("http://cloudreve.org")
+
+	// 下载，支持 Range
+	{
+		downloadURL, err := handler.Source(ctx, "", *baseURL, 60, true, 0)
+		asserts.NoError(err)
+		target, _ := url.Parse(downloadURL)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", target.RequestURI(), nil)
+		req.Header.Set("Range", "bytes=2-5")
+		router.ServeHTTP(w, req)
+		asserts.Equal(206, w.Code)
+		asserts.Equal("2345", w.Body.String())
+		asserts.Contains(w.Header().Get("Content-Disposition"), "a.txt")
+	}
+
+	// 预览
+	{
+		sourceURL, err := handler.Source(ctx, "", *baseURL, 60, false, 0)
+		asserts.NoError(err)
+		target, _ := url.Parse(sourceURL)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", target.RequestURI(), nil)
+		router.ServeHTTP(w, req)
+		asserts.Equal(200, w.Code)
+		asserts.Equal("0123456789", w.Body.String())
+		asserts.Empty(w.Header().Get("Content-Disposition"))
+	}
+
+	// 签名与路径不符
+	{
+		sourceURL, err := handler.Source(ctx, "", *baseURL, 60, false, 0)
+		asserts.NoError(err)
+		target, _ := url.Parse(sourceURL)
+		target.Path = strings.Replace(target.Path, "/source/0/", "/source/1/", 1)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", target.RequestURI(), nil)
+		router.ServeHTTP(w, req)
+		resJSON := &serializer.Response{}
+		asserts.NoError(json.Unmarshal(w.Body.Bytes(), resJSON))
+		asserts.Equal(serializer.CodeNoPermissionErr, resJSON.Code)
+	}
+}
+
+func TestAdminDeletePhysicalFolderRoute(t *testing.T) {
+	switchToMemDB()
+	asserts := assert.New(t)
+	router := InitMasterRouter()
+	middleware.SessionMock = map[string]interface{}{"user_id": 1}
+
+	// 准备测试文件
+	files := []string{
+		"tests/TestAdminDeletePhysicalFolder/a.txt",
+		"tests/TestAdminDeletePhysicalFolder/sub/b.txt",
+	}
+	for _, name := range files {
+		file, err := util.CreatNestedFile(util.RelativePath(name))
+		asserts.NoError(err)
+		file.Close()
+	}
+	defer os.RemoveAll(util.RelativePath("tests/TestAdminDeletePhysicalFolder"))
+
+	request := func(dryRun bool) *serializer.Response {
+		body, _ := json.Marshal(map[string]interface{}{
+			"id":      1,
+			"path":    "tests/TestAdminDeletePhysicalFolder",
+			"dry_run": dryRun,
+		})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v3/admin/file/physical/delete", bytes.NewReader(body))
+		router.ServeHTTP(w, req)
+		asserts.Equal(200, w.Code)
+		resJSON := &serializer.Response{}
+		asserts.NoError(json.Unmarshal(w.Body.Bytes(), resJSON))
+		return resJSON
+	}
+
+	// 仅预览时返回将被删除的文件，不删除任何文件
+	var planned []interface{}
+	{
+		res := request(true)
+		asserts.Equal(0, res.Code)
+		planned = res.Data.(map[string]interface{})["files"].([]interface{})
+		asserts.Len(planned, len(files))
+		for _, name := range files {
+			asserts.True(util.Exists(util.RelativePath(name)))
+		}
+	}
+
+	// 实际删除预览中列出的全部文件
+	{
+		res := request(false)
+		asserts.Equal(0, res.Code)
+		asserts.Empty(res.Data.(map[string]interface{})["failed"])
+		for _, name := range planned {
+			asserts.False(util.Exists(name.(string)))
+		}
+		for _, name := range files {
+			asserts.False(util.Exists(util.RelativePath(name)))
+		}
+	}
+}
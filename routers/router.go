@@ -39,6 +39,9 @@ func InitSlaveRouter() *gin.Engine {
 		v3.POST("ping", controllers.SlavePing)
 		// 上传
 		v3.POST("upload", controllers.SlaveUpload)
+		// 分片上传及查询已接收的偏移
+		v3.POST("upload/chunk/:sessionID", controllers.SlaveUploadChunk)
+		v3.POST("upload/chunk/:sessionID/status", controllers.SlaveUploadChunkStatus)
 		// 下载
 		v3.GET("download/:speed/:path/:name", controllers.SlaveDownload)
 		// 预览 / 外链
@@ -168,6 +171,9 @@ func InitMasterRouter() *gin.Engine {
 				file.GET("archive/:id/archive.zip", controllers.DownloadArchive)
 				// 下载文件
 				file.GET("download/:id", controllers.Download)
+				// 本机存储策略签名直链下载 / 预览
+				file.GET("local/download/:speed/:path/:name", controllers.LocalDownload)
+				file.GET("local/source/:speed/:path/:name", controllers.LocalPreview)
 			}
 		}
 
@@ -206,6 +212,11 @@ func InitMasterRouter() *gin.Engine {
 					middleware.OneDriveCallbackAuth(),
 					controllers.OneDriveCallback,
 				)
+				// 查询上传会话状态，获取续传位置
+				onedrive.GET(
+					"status/:key",
+					controllers.OneDriveUploadStatus,
+				)
 				// 文件上传完成
 				onedrive.GET(
 					"auth",
@@ -330,6 +341,10 @@ func InitMasterRouter() *gin.Engine {
 					policy.POST("scf", controllers.AdminAddSCF)
 					// 获取 OneDrive OAuth URL
 					policy.GET(":id/oauth", controllers.AdminOneDriveOAuth)
+					// 查询存储端容量
+					policy.GET(":id/quota", controllers.AdminGetPolicyQuota)
+					// 测试存储端连通性
+					policy.GET(":id/ping", controllers.AdminPingPolicy)
 					// 获取 存储策略
 					policy.GET(":id", controllers.AdminGetPolicy)
 					// 删除 存储策略
@@ -355,6 +370,8 @@ func InitMasterRouter() *gin.Engine {
 					user.POST("list", controllers.AdminListUser)
 					// 获取用户
 					user.GET(":id", controllers.AdminGetUser)
+					// 获取用户累计流量
+					user.GET(":id/traffic", controllers.AdminGetUserTraffic)
 					// 创建/保存用户
 					user.POST("", controllers.AdminAddUser)
 					// 删除
@@ -374,6 +391,12 @@ func InitMasterRouter() *gin.Engine {
 					// 列出用户或外部文件系统目录
 					file.GET("folders/:type/:id/*path",
 						controllers.AdminListFolders)
+					// 统计外部文件系统目录大小
+					file.GET("size/:id/*path", controllers.AdminGetFolderSize)
+					// 删除外部文件系统中的目录，可仅预览将被删除的文件
+					file.POST("physical/delete", controllers.AdminDeletePhysicalFolder)
+					// 移动外部文件系统中的文件
+					file.POST("physical/move", controllers.AdminMovePhysicalFile)
 				}
 
 				share := admin.Group("share")
@@ -447,6 +470,8 @@ func InitMasterRouter() *gin.Engine {
 				file.POST("upload", controllers.FileUploadStream)
 				// 获取上传凭证
 				file.GET("upload/credential", controllers.GetUploadCredential)
+				// 中止上传
+				file.DELETE("upload/:sessionId", controllers.CancelUploadSession)
 				// 更新文件
 				file.PUT("update/:id", controllers.PutContent)
 				// 创建空白文件
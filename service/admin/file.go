@@ -30,6 +30,99 @@ type ListFolderService struct {
 	Type string `uri:"type" binding:"eq=policy|eq=user"`
 }
 
+// FolderSizeService 统计存储策略中的目录大小
+type FolderSizeService struct {
+	Path string `uri:"path" binding:"required,max=65535"`
+	ID   uint   `uri:"id" binding:"required"`
+}
+
+// PhysicalMoveService 移动存储策略中的文件
+type PhysicalMoveService struct {
+	ID  uint   `json:"id" binding:"required"`
+	Src string `json:"src" binding:"required,max=65535"`
+	Dst string `json:"dst" binding:"required,max=65535"`
+}
+
+// PhysicalDeleteService 删除存储策略中的目录
+type PhysicalDeleteService struct {
+	ID     uint   `json:"id" binding:"required"`
+	Path   string `json:"path" binding:"required,max=65535"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// Delete 删除存储策略中的目录及其下的全部内容，不修改文件记录。指定 DryRun 时
+// 不删除任何文件，仅返回将被删除的文件路径，供确认后再执行
+func (service *PhysicalDeleteService) Delete(c *gin.Context) serializer.Response {
+	policy, err := model.GetPolicyByID(service.ID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "存储策略不存在", err)
+	}
+
+	// 创建文件系统
+	fs, err := filesystem.NewAnonymousFileSystem()
+	if err != nil {
+		return serializer.Err(serializer.CodeInternalSetting, "无法创建文件系统", err)
+	}
+	defer fs.Recycle()
+
+	fs.Policy = &policy
+	ctx := context.WithValue(c.Request.Context(), fsctx.DryRunCtx, service.DryRun)
+	res, err := fs.DeletePhysicalPrefix(ctx, service.Path)
+	if err != nil {
+		return serializer.Err(serializer.CodeIOFailed, "无法删除目录", err)
+	}
+
+	if service.DryRun {
+		return serializer.Response{Data: map[string]interface{}{"files": res}}
+	}
+	return serializer.Response{Data: map[string]interface{}{"failed": res}}
+}
+
+// Move 在存储端移动文件，不修改文件记录，适用于整理未被记录的外部文件
+func (service *PhysicalMoveService) Move(c *gin.Context) serializer.Response {
+	policy, err := model.GetPolicyByID(service.ID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "存储策略不存在", err)
+	}
+
+	// 创建文件系统
+	fs, err := filesystem.NewAnonymousFileSystem()
+	if err != nil {
+		return serializer.Err(serializer.CodeInternalSetting, "无法创建文件系统", err)
+	}
+	defer fs.Recycle()
+
+	fs.Policy = &policy
+	if err := fs.MovePhysical(c.Request.Context(), service.Src, service.Dst); err != nil {
+		return serializer.Err(serializer.CodeIOFailed, "无法移动文件", err)
+	}
+
+	return serializer.Response{}
+}
+
+// Size 统计存储策略中指定目录下文件的总大小及数量
+func (service *FolderSizeService) Size(c *gin.Context) serializer.Response {
+	policy, err := model.GetPolicyByID(service.ID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "存储策略不存在", err)
+	}
+
+	// 创建文件系统
+	fs, err := filesystem.NewAnonymousFileSystem()
+	if err != nil {
+		return serializer.Err(serializer.CodeInternalSetting, "无法创建文件系统", err)
+	}
+	defer fs.Recycle()
+
+	fs.Policy = &policy
+	res, err := fs.GetPhysicalDirSize(c.Request.Context(), service.Path)
+	if err != nil {
+		return serializer.Err(serializer.CodeIOFailed, "无法统计目录大小", err)
+	}
+
+	return serializer.Response{Data: res}
+}
+
 // List 列出指定路径下的目录
 func (service *ListFolderService) List(c *gin.Context) serializer.Response {
 	if service.Type == "policy" {
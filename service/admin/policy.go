@@ -14,8 +14,8 @@ import (
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
-	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
 	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/cos"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/onedrive"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/oss"
@@ -88,6 +88,9 @@ func (service *PolicyService) Delete() serializer.Response {
 
 	model.DB.Delete(&policy)
 	policy.ClearCache()
+	if err := filesystem.ClosePolicy(&policy); err != nil {
+		util.Log().Warning("无法释放存储策略[%s]的资源，%s", policy.Name, err)
+	}
 
 	return serializer.Response{}
 }
@@ -102,6 +105,58 @@ func (service *PolicyService) Get() serializer.Response {
 	return serializer.Response{Data: policy}
 }
 
+// Quota 查询存储策略在存储端的容量使用情况
+func (service *PolicyService) Quota(c *gin.Context) serializer.Response {
+	policy, err := model.GetPolicyByID(service.ID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "存储策略不存在", err)
+	}
+
+	// 创建文件系统
+	fs, err := filesystem.NewAnonymousFileSystem()
+	if err != nil {
+		return serializer.Err(serializer.CodeInternalSetting, "无法创建文件系统", err)
+	}
+	defer fs.Recycle()
+
+	fs.Policy = &policy
+	res, err := fs.GetPolicyQuota(c.Request.Context())
+	if err == filesystem.ErrQuotaUnsupported {
+		return serializer.Err(serializer.CodePolicyNotAllowed, "此存储策略不支持查询容量", err)
+	}
+	if err != nil {
+		return serializer.Err(serializer.CodeIOFailed, "无法查询存储端容量", err)
+	}
+
+	return serializer.Response{Data: res}
+}
+
+// Ping 检查存储策略能否正常访问存储端
+func (service *PolicyService) Ping(c *gin.Context) serializer.Response {
+	policy, err := model.GetPolicyByID(service.ID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "存储策略不存在", err)
+	}
+
+	// 创建文件系统
+	fs, err := filesystem.NewAnonymousFileSystem()
+	if err != nil {
+		return serializer.Err(serializer.CodeInternalSetting, "无法创建文件系统", err)
+	}
+	defer fs.Recycle()
+
+	fs.Policy = &policy
+	err = fs.PingPolicy(c.Request.Context())
+	if err == filesystem.ErrPingUnsupported {
+		return serializer.Err(serializer.CodePolicyNotAllowed, "此存储策略不支持连通性检查", err)
+	}
+	if err != nil {
+		return serializer.ParamErr("连接测试失败，"+err.Error(), nil)
+	}
+
+	return serializer.Response{}
+}
+
 // GetOAuth 获取 OneDrive OAuth 地址
 func (service *PolicyService) GetOAuth(c *gin.Context) serializer.Response {
 	policy, err := model.GetPolicyByID(service.ID)
@@ -118,7 +173,7 @@ func (service *PolicyService) GetOAuth(c *gin.Context) serializer.Response {
 		"onedrive_oauth_policy": policy.ID,
 	})
 
-	cache.Deletes([]string{policy.BucketName}, "onedrive_")
+	client.ClearCredentialCache()
 
 	return serializer.Response{Data: client.OAuthURL(context.Background(), []string{
 		"offline_access",
@@ -258,17 +313,25 @@ func (service *AddPolicyService) Add() serializer.Response {
 	}
 
 	if service.Policy.ID > 0 {
+		// 修改前的存储策略，保存后释放其适配器资源
+		previous, previousErr := model.GetPolicyByID(service.Policy.ID)
 		if err := model.DB.Save(&service.Policy).Error; err != nil {
 			return serializer.ParamErr("存储策略保存失败", err)
 		}
+		// 先清除缓存，使释放资源时恢复的任务读取到修改后的存储策略
+		service.Policy.ClearCache()
+		if previousErr == nil {
+			if err := filesystem.ClosePolicy(&previous); err != nil {
+				util.Log().Warning("无法释放存储策略[%s]的资源，%s", previous.Name, err)
+			}
+		}
 	} else {
 		if err := model.DB.Create(&service.Policy).Error; err != nil {
 			return serializer.ParamErr("存储策略添加失败", err)
 		}
+		service.Policy.ClearCache()
 	}
 
-	service.Policy.ClearCache()
-
 	return serializer.Response{Data: service.Policy.ID}
 }
 
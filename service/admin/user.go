@@ -95,6 +95,15 @@ func (service *UserService) Get() serializer.Response {
 	return serializer.Response{Data: group}
 }
 
+// Traffic 获取用户经由服务端中转的累计流量
+func (service *UserService) Traffic() serializer.Response {
+	if _, err := model.GetUserByID(service.ID); err != nil {
+		return serializer.Err(serializer.CodeNotFound, "用户不存在", err)
+	}
+
+	return serializer.Response{Data: filesystem.GetUserTraffic(service.ID)}
+}
+
 // Add 添加用户
 func (service *AddUserService) Add() serializer.Response {
 	if service.User.ID > 0 {
@@ -4,7 +4,6 @@ import (
 	"context"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
-	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/onedrive"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
@@ -51,7 +50,7 @@ func (service *OneDriveOauthService) Auth(c *gin.Context) serializer.Response {
 		return serializer.DBErr("无法更新 RefreshToken", err)
 	}
 
-	cache.Deletes([]string{client.Policy.AccessKey}, "onedrive_")
+	client.ClearCredentialCache()
 
 	return serializer.Response{}
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/cos"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
@@ -55,6 +56,17 @@ type OneDriveCallback struct {
 	Meta *onedrive.FileInfo
 }
 
+// OneDriveUploadStatusService OneDrive 客户端查询续传位置服务
+type OneDriveUploadStatusService struct {
+	Sign string `form:"sign" binding:"required"`
+}
+
+// OneDriveUploadStatus 上传会话尚未接收的字节范围及续传的起始位置
+type OneDriveUploadStatus struct {
+	NextExpectedRanges []string `json:"nextExpectedRanges"`
+	Offset             uint64   `json:"offset"`
+}
+
 // COSCallback COS 客户端回调正文
 type COSCallback struct {
 	Bucket string `form:"bucket"`
@@ -215,6 +227,33 @@ func (service *OneDriveCallback) PreProcess(c *gin.Context) serializer.Response
 	return ProcessCallback(service, c)
 }
 
+// Status 查询上传会话状态，供客户端上传分片失败后获取续传位置。
+// 使用与上传完成回调相同的签名，查询不会消耗回调会话
+func (service *OneDriveUploadStatusService) Status(c *gin.Context) serializer.Response {
+	key := c.Param("key")
+	callbackSessionRaw, ok := cache.Get("callback_" + key)
+	if !ok {
+		return serializer.Err(serializer.CodeNotFound, "回调会话不存在或已过期", nil)
+	}
+	callbackSession := callbackSessionRaw.(serializer.UploadSession)
+	if err := onedrive.CheckCallbackSign(service.Sign, &callbackSession); err != nil {
+		return serializer.Err(serializer.CodeCheckLogin, err.Error(), err)
+	}
+
+	nextRanges, offset, err := onedrive.UploadStatus(context.Background(), key)
+	if err != nil {
+		if err == onedrive.ErrMonitorNotFound {
+			return serializer.Err(serializer.CodeNotFound, err.Error(), err)
+		}
+		return serializer.Err(serializer.CodeUploadFailed, "无法获取上传会话状态", err)
+	}
+
+	return serializer.Response{Data: OneDriveUploadStatus{
+		NextExpectedRanges: nextRanges,
+		Offset:             offset,
+	}}
+}
+
 // PreProcess 对COS客户端回调进行预处理
 func (service *COSCallback) PreProcess(c *gin.Context) serializer.Response {
 	// 创建文件系统
@@ -18,7 +18,9 @@ import (
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 )
@@ -50,6 +52,13 @@ type SlaveDownloadService struct {
 	Speed       int    `uri:"speed" binding:"min=0"`
 }
 
+// LocalDownloadService 本机存储策略签名直链下载服务
+type LocalDownloadService struct {
+	PathEncoded string `uri:"path" binding:"required"`
+	Name        string `uri:"name" binding:"required"`
+	Speed       int    `uri:"speed" binding:"min=0"`
+}
+
 // SlaveFileService 从机单文件文件相关服务
 type SlaveFileService struct {
 	PathEncoded string `uri:"path" binding:"required"`
@@ -134,19 +143,25 @@ func (service *DownloadService) DownloadArchived(ctx context.Context, c *gin.Con
 
 	// 获取文件流
 	rs, err := fs.GetPhysicalFileContent(ctx, zipPath.(string))
-	defer rs.Close()
 	if err != nil {
 		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
 	}
+	defer rs.Close()
 
 	if fs.User.Group.OptionsSerialized.OneTimeDownload {
 		// 清理资源，删除临时文件
 		_ = cache.Deletes([]string{service.ID}, "archive_")
 	}
 
+	// 以归档文件的修改时间响应条件请求
+	modTime := time.Now()
+	if info, err := fs.Handler.Head(ctx, zipPath.(string)); err == nil {
+		modTime = info.LastModify
+	}
+
 	c.Header("Content-Disposition", "attachment;")
 	c.Header("Content-Type", "application/zip")
-	http.ServeContent(c.Writer, c.Request, "", time.Now(), rs)
+	http.ServeContent(c.Writer, c.Request, "", modTime, rs)
 
 	return serializer.Response{
 		Code: 0,
@@ -169,14 +184,20 @@ func (service *FileAnonymousGetService) Download(ctx context.Context, c *gin.Con
 	}
 
 	// 获取文件流
+	ctx = context.WithValue(ctx, fsctx.GinCtx, c)
 	rs, err := fs.GetDownloadContent(ctx, 0)
-	defer rs.Close()
 	if err != nil {
 		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
 	}
+	defer rs.Close()
 
 	// 发送文件
-	http.ServeContent(c.Writer, c.Request, service.Name, fs.FileTarget[0].UpdatedAt, rs)
+	// 存储策略探测到内容类型时以其为准，避免无法识别扩展名的文件无法在线预览
+	if contentType := response.ContentType(rs); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+
+	response.ServeContent(c.Writer, c.Request, service.Name, fs.FileTarget[0].UpdatedAt, rs)
 
 	return serializer.Response{
 		Code: 0,
@@ -280,7 +301,7 @@ func (service *DownloadService) Download(ctx context.Context, c *gin.Context) se
 	defer rs.Close()
 
 	// 设置文件名
-	c.Header("Content-Disposition", "attachment; filename=\""+url.PathEscape(fs.FileTarget[0].Name)+"\"")
+	c.Header("Content-Disposition", util.ContentDisposition(fs.FileTarget[0].Name))
 
 	if fs.User.Group.OptionsSerialized.OneTimeDownload {
 		// 清理资源，删除临时文件
@@ -288,7 +309,12 @@ func (service *DownloadService) Download(ctx context.Context, c *gin.Context) se
 	}
 
 	// 发送文件
-	http.ServeContent(c.Writer, c.Request, fs.FileTarget[0].Name, fs.FileTarget[0].UpdatedAt, rs)
+	// 存储策略探测到内容类型时以其为准，避免无法识别扩展名的文件无法在线预览
+	if contentType := response.ContentType(rs); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+
+	response.ServeContent(c.Writer, c.Request, fs.FileTarget[0].Name, fs.FileTarget[0].UpdatedAt, rs)
 
 	return serializer.Response{
 		Code: 0,
@@ -347,6 +373,11 @@ func (service *FileIDService) PreviewContent(ctx context.Context, c *gin.Context
 		c.Header("Cache-Control", "no-cache")
 	}
 
+	// 存储策略探测到内容类型时以其为准，避免无法识别扩展名的文件无法在线预览
+	if contentType := response.ContentType(resp.Content); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+
 	http.ServeContent(c.Writer, c.Request, fs.FileTarget[0].Name, fs.FileTarget[0].UpdatedAt, resp.Content)
 
 	return serializer.Response{
@@ -461,11 +492,50 @@ func (service *SlaveDownloadService) ServeFile(ctx context.Context, c *gin.Conte
 
 	// 设置下载文件名
 	if isDownload {
-		c.Header("Content-Disposition", "attachment; filename=\""+url.PathEscape(fs.FileTarget[0].Name)+"\"")
+		c.Header("Content-Disposition", util.ContentDisposition(fs.FileTarget[0].Name))
+	}
+
+	// URL 中不含文件的修改时间，从存储端获取，以便响应 If-Range 等条件请求
+	modTime := time.Now()
+	if info, err := fs.Handler.Head(ctx, fs.FileTarget[0].SourceName); err == nil {
+		modTime = info.LastModify
+	}
+
+	// 发送文件
+	response.ServeContent(c.Writer, c.Request, fs.FileTarget[0].Name, modTime, rs)
+
+	return serializer.Response{
+		Code: 0,
+	}
+}
+
+// ServeFile 通过签名直链发送本机存储的文件，支持 Range 请求
+func (service *LocalDownloadService) ServeFile(ctx context.Context, c *gin.Context, isDownload bool) serializer.Response {
+	// 解码文件路径
+	fileSource, err := base64.RawURLEncoding.DecodeString(service.PathEncoded)
+	if err != nil {
+		return serializer.ParamErr("无法解析的文件地址", err)
+	}
+
+	// 获取文件流
+	rs, err := local.Driver{}.Get(ctx, string(fileSource))
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "文件不存在", err)
+	}
+	defer rs.Close()
+
+	modTime := time.Now()
+	if info, err := (local.Driver{}).Head(ctx, string(fileSource)); err == nil {
+		modTime = info.LastModify
+	}
+
+	// 设置下载文件名
+	if isDownload {
+		c.Header("Content-Disposition", util.ContentDisposition(service.Name))
 	}
 
 	// 发送文件
-	http.ServeContent(c.Writer, c.Request, fs.FileTarget[0].Name, time.Now(), rs)
+	http.ServeContent(c.Writer, c.Request, service.Name, modTime, response.LimitSpeed(rs, service.Speed))
 
 	return serializer.Response{
 		Code: 0,
@@ -3,7 +3,10 @@ package explorer
 import (
 	"context"
 
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/onedrive"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/gin-gonic/gin"
@@ -17,6 +20,11 @@ type UploadCredentialService struct {
 	Type string `form:"type"`
 }
 
+// UploadSessionService 上传会话服务
+type UploadSessionService struct {
+	ID string `uri:"sessionId" binding:"required"`
+}
+
 // Get 获取新的上传凭证
 func (service *UploadCredentialService) Get(ctx context.Context, c *gin.Context) serializer.Response {
 	// 创建文件系统
@@ -43,3 +51,28 @@ func (service *UploadCredentialService) Get(ctx context.Context, c *gin.Context)
 		Data: credential,
 	}
 }
+
+// Delete 中止上传，删除回调会话并结束存储端的上传监控
+func (service *UploadSessionService) Delete(ctx context.Context, c *gin.Context) serializer.Response {
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodePolicyNotAllowed, err.Error(), err)
+	}
+	defer fs.Recycle()
+
+	sessionRaw, ok := cache.Get("callback_" + service.ID)
+	if !ok {
+		return serializer.Err(serializer.CodeNotFound, "上传会话不存在或已过期", nil)
+	}
+	session := sessionRaw.(serializer.UploadSession)
+	if session.UID != fs.User.ID {
+		return serializer.Err(serializer.CodeNotFound, "上传会话不存在或已过期", nil)
+	}
+
+	_ = cache.Deletes([]string{service.ID}, "callback_")
+	if policy, err := model.GetPolicyByID(session.PolicyID); err == nil && policy.Type == "onedrive" {
+		onedrive.CancelMonitor(service.ID)
+	}
+
+	return serializer.Response{}
+}